@@ -0,0 +1,268 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thromel/go-database/pkg/storage"
+	"github.com/thromel/go-database/pkg/storage/file"
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// BackupFileExtension is the extension of the backup files written by the
+// backup scheduler.
+const BackupFileExtension = ".backup"
+
+// backupTimeFormat names scheduled backups so that they sort by age.
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// Backup writes a consistent copy of the database to w while reads and
+// writes continue. Only the persistent engine has a file to back up.
+func (db *DatabaseImpl) Backup(ctx context.Context, w io.Writer) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return utils.ErrDatabaseClosed
+	}
+
+	engine, ok := db.storage.(*storage.PersistentEngine)
+	if !ok {
+		return utils.NewDatabaseErrorWithPath("backup", db.path, ErrBackupUnsupported)
+	}
+
+	if _, err := engine.Backup(ctx, w); err != nil {
+		return utils.NewDatabaseErrorWithPath("backup", db.path, err)
+	}
+	return nil
+}
+
+// BackupIncremental writes the pages that changed after the backup taken at
+// LSN since while reads and writes continue.
+func (db *DatabaseImpl) BackupIncremental(ctx context.Context, w io.Writer, since uint64) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return utils.ErrDatabaseClosed
+	}
+
+	engine, ok := db.storage.(*storage.PersistentEngine)
+	if !ok {
+		return utils.NewDatabaseErrorWithPath("backup", db.path, ErrBackupUnsupported)
+	}
+
+	if _, err := engine.BackupIncremental(ctx, w, since); err != nil {
+		return utils.NewDatabaseErrorWithPath("backup", db.path, err)
+	}
+	return nil
+}
+
+// BackupManifest describes a backup written by Database.Backup or
+// Database.BackupIncremental.
+type BackupManifest struct {
+	// PageSize is the size of each page in bytes
+	PageSize int
+
+	// PageCount is the number of pages in the database file the backup
+	// restores, starting with the meta page
+	PageCount int64
+
+	// LSN is the log position the backup is consistent at. An incremental
+	// backup taken since it builds on this backup.
+	LSN uint64
+
+	// Created is when the backup was taken
+	Created time.Time
+
+	// Incremental reports whether the backup holds only the pages changed
+	// since BaseLSN, rather than every page
+	Incremental bool
+
+	// BaseLSN is the LSN of the backup an incremental backup builds on
+	BaseLSN uint64
+}
+
+// ReadBackupManifest reads the manifest at the start of a backup. Only the
+// manifest is read; the rest of the backup is checked when it is restored.
+func ReadBackupManifest(r io.Reader) (*BackupManifest, error) {
+	m, err := storage.ReadBackupManifest(r)
+	if err != nil {
+		return nil, utils.NewDatabaseError("read backup manifest", err)
+	}
+	manifest := BackupManifest(*m)
+	return &manifest, nil
+}
+
+// Restore recreates a database at path from a backup written by
+// Database.Backup. Neither the database file nor its write-ahead log may
+// exist yet. The backup's checksum is verified before the database file is
+// created, so a damaged backup leaves nothing behind.
+func Restore(r io.Reader, path string) error {
+	return RestoreChain(path, r)
+}
+
+// RestoreChain recreates a database at path from a full backup followed by
+// incremental backups, applied in order. Each incremental backup must build
+// on the backup before it in the chain, or on an earlier one. Nothing is left
+// behind if any backup is damaged or the chain is broken.
+func RestoreChain(path string, backups ...io.Reader) error {
+	if _, err := storage.RestoreBackupChain(path, backups...); err != nil {
+		return utils.NewDatabaseErrorWithPath("restore", path, err)
+	}
+	return nil
+}
+
+// backupScheduler backs up the database every BackupInterval into a
+// directory, keeping the newest BackupRetention backups.
+type backupScheduler struct {
+	db        *DatabaseImpl
+	dir       string
+	prefix    string
+	interval  time.Duration
+	retention int
+
+	// cancel stops the scheduler, and done is closed once it has stopped
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// mu protects the outcome of the last backup
+	mu      sync.Mutex
+	last    time.Time
+	lastErr error
+}
+
+// startBackupScheduler starts taking scheduled backups of the database. The
+// first one is taken one interval after the database is opened.
+func startBackupScheduler(db *DatabaseImpl) *backupScheduler {
+	dir := db.config.Storage.BackupDir
+	if dir == "" {
+		dir = db.config.Path + ".backups"
+	}
+	name := filepath.Base(db.config.Path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &backupScheduler{
+		db:        db,
+		dir:       dir,
+		prefix:    strings.TrimSuffix(name, filepath.Ext(name)) + "-",
+		interval:  db.config.Storage.BackupInterval,
+		retention: db.config.Storage.BackupRetention,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go s.run(ctx)
+	return s
+}
+
+// run takes a backup on every tick until ctx is cancelled.
+func (s *backupScheduler) run(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := s.backup(ctx)
+		if ctx.Err() != nil {
+			return // Interrupted by stop
+		}
+
+		s.mu.Lock()
+		s.last, s.lastErr = time.Now(), err
+		s.mu.Unlock()
+	}
+}
+
+// backup writes one backup into the directory and removes the oldest ones
+// beyond the retention limit. The backup is written to a temporary file and
+// renamed into place once complete, so only whole backups ever appear.
+func (s *backupScheduler) backup(ctx context.Context) error {
+	if err := os.MkdirAll(s.dir, file.DefaultDirMode); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	name := s.prefix + time.Now().UTC().Format(backupTimeFormat) + BackupFileExtension
+	path := filepath.Join(s.dir, name)
+	tmpPath := path + ".tmp"
+
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, file.DefaultFileMode) // #nosec G304 - path is built from the backup directory
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	err = s.db.Backup(ctx, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	return s.rotate()
+}
+
+// rotate removes the oldest scheduled backups beyond the retention limit.
+func (s *backupScheduler) rotate() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, s.prefix) && strings.HasSuffix(name, BackupFileExtension) {
+			backups = append(backups, name)
+		}
+	}
+	if len(backups) <= s.retention {
+		return nil
+	}
+
+	sort.Strings(backups)
+	var errs []error
+	for _, name := range backups[:len(backups)-s.retention] {
+		if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove old backup: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lastBackup returns when the last scheduled backup finished and its error.
+func (s *backupScheduler) lastBackup() (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last, s.lastErr
+}
+
+// stop stops the scheduler, interrupting a backup in progress, and waits for
+// it to finish. It may be called more than once.
+func (s *backupScheduler) stop() {
+	s.cancel()
+	<-s.done
+}
+
+// ErrBackupUnsupported is returned when an in-memory database is backed up.
+var ErrBackupUnsupported = errors.New("in-memory databases cannot be backed up")
@@ -0,0 +1,49 @@
+package api
+
+import "github.com/thromel/go-database/pkg/storage"
+
+// WriteBatch collects puts and deletes that Database.Write applies
+// atomically, as one commit: either every change becomes visible or none
+// does. Changes to the same key apply in the order they were added.
+type WriteBatch struct {
+	batch *storage.WriteBatch
+}
+
+// NewWriteBatch creates an empty write batch.
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{batch: storage.NewWriteBatch()}
+}
+
+// Put records that key should be set to value. The key and value are copied,
+// so the caller may reuse them.
+func (b *WriteBatch) Put(key, value []byte) {
+	b.batch.Put(key, value)
+}
+
+// Delete records that key should be removed. Deleting a key that does not
+// exist when the batch is written is not an error.
+func (b *WriteBatch) Delete(key []byte) {
+	b.batch.Delete(key)
+}
+
+// Clear removes all changes from the batch so it can be reused.
+func (b *WriteBatch) Clear() {
+	b.batch.Reset()
+}
+
+// Len returns the number of changes in the batch.
+func (b *WriteBatch) Len() int {
+	return b.batch.Len()
+}
+
+// Size returns the number of key and value bytes in the batch.
+func (b *WriteBatch) Size() int {
+	return b.batch.Size()
+}
+
+// WriteOptions controls how Database.Write applies a batch.
+type WriteOptions struct {
+	// Sync makes Write return only once the batch is on stable storage, even
+	// when Storage.SyncWrites is disabled
+	Sync bool
+}
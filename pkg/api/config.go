@@ -3,6 +3,9 @@ package api
 import (
 	"errors"
 	"time"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+	"github.com/thromel/go-database/pkg/transaction"
 )
 
 // Config holds the configuration parameters for the database engine.
@@ -46,7 +49,11 @@ type MemoryConfig struct {
 
 // StorageConfig configures storage engine parameters.
 type StorageConfig struct {
-	// PageSize is the size of each page in bytes (default: 8KB)
+	// PageSize is the size of each page in bytes, a power of two between 1KB
+	// and 32KB. It is chosen when the database is created and recorded in
+	// its file; reopening the database with a different page size fails.
+	// Zero, the default, uses the page size of an existing database, and
+	// 8KB for a new one.
 	PageSize int
 
 	// MaxFileSize is the maximum database file size in bytes (0 = unlimited)
@@ -55,17 +62,45 @@ type StorageConfig struct {
 	// SyncWrites ensures all writes are synced to disk immediately
 	SyncWrites bool
 
-	// CompressionEnabled enables data compression
+	// CompressionEnabled compresses pages with LZ4 when they are written, if
+	// that at least halves them, and gives the space saved back to the file
+	// system where it supports punching holes in files (Linux). It suits
+	// repetitive values such as JSON. Disabling it later leaves the pages
+	// already compressed readable.
 	CompressionEnabled bool
 
-	// ChecksumEnabled enables page checksums for corruption detection
+	// ChecksumEnabled verifies page checksums when pages are read, to detect
+	// corruption. Pages are checksummed either way; disabling verification
+	// suits trusted read-mostly replicas.
 	ChecksumEnabled bool
 
+	// ChecksumAlgorithm is the page checksum algorithm: "crc32c" (default),
+	// "crc32", "xxhash64" or "none". It is chosen when the database is
+	// created and recorded in its file, which keeps it when reopened with a
+	// different algorithm. Empty uses the default.
+	ChecksumAlgorithm string
+
+	// DoubleWriteEnabled writes every page to a double-write file before
+	// writing it in place, so that a page write torn by a crash is repaired
+	// when the database is next opened (default: true). It costs an extra
+	// sync for each batch of pages written back, several times the cost of
+	// the write itself; it can be turned off where the storage guarantees
+	// atomic page writes, such as a file system with data journaling
+	DoubleWriteEnabled bool
+
 	// BackupEnabled enables automatic backups
 	BackupEnabled bool
 
 	// BackupInterval is the interval between automatic backups
 	BackupInterval time.Duration
+
+	// BackupDir is the directory automatic backups are written to (default:
+	// the database path followed by .backups)
+	BackupDir string
+
+	// BackupRetention is the number of automatic backups to keep; older
+	// ones are removed
+	BackupRetention int
 }
 
 // TransactionConfig configures transaction behavior.
@@ -87,6 +122,11 @@ type TransactionConfig struct {
 
 	// RetryPolicy configures automatic retry behavior
 	RetryPolicy RetryPolicyConfig
+
+	// MaxVersionMemory is the most memory in bytes the values kept for open
+	// snapshots may take; past it, the oldest snapshots expire (0 means no
+	// limit)
+	MaxVersionMemory int64
 }
 
 // RetryPolicyConfig configures automatic retry behavior for transactions.
@@ -169,13 +209,16 @@ func DefaultConfig() *Config {
 			EnableMemoryProfiling: false,
 		},
 		Storage: StorageConfig{
-			PageSize:           8192, // 8KB
-			MaxFileSize:        0,    // unlimited
+			PageSize:           0, // the file's, or 8KB for a new one
+			MaxFileSize:        0, // unlimited
 			SyncWrites:         false,
 			CompressionEnabled: false,
 			ChecksumEnabled:    true,
+			ChecksumAlgorithm:  "crc32c",
+			DoubleWriteEnabled: true,
 			BackupEnabled:      false,
 			BackupInterval:     24 * time.Hour,
+			BackupRetention:    7,
 		},
 		Transaction: TransactionConfig{
 			DefaultIsolationLevel:     "READ_COMMITTED",
@@ -190,6 +233,7 @@ func DefaultConfig() *Config {
 				MaxDelay:          1 * time.Second,
 				BackoffMultiplier: 2.0,
 			},
+			MaxVersionMemory: 64 << 20,
 		},
 		Performance: PerformanceConfig{
 			MaxConcurrentReads:  100,
@@ -226,9 +270,26 @@ func (c *Config) Validate() error {
 	}
 
 	// Storage configuration validation
-	if c.Storage.PageSize <= 0 || c.Storage.PageSize > 65536 {
+	if c.Storage.PageSize != 0 && page.ValidatePageSize(c.Storage.PageSize) != nil {
 		return ErrInvalidPageSize
 	}
+	if c.Storage.ChecksumAlgorithm != "" {
+		if _, err := page.ParseChecksumAlgorithm(c.Storage.ChecksumAlgorithm); err != nil {
+			return ErrInvalidChecksumAlgorithm
+		}
+	}
+
+	if c.Storage.BackupEnabled {
+		if c.Path == MemoryPath {
+			return ErrBackupUnsupported
+		}
+		if c.Storage.BackupInterval <= 0 {
+			return ErrInvalidBackupInterval
+		}
+		if c.Storage.BackupRetention <= 0 {
+			return ErrInvalidBackupRetention
+		}
+	}
 
 	// Transaction configuration validation
 	if c.Transaction.MaxActiveTransactions <= 0 {
@@ -239,6 +300,26 @@ func (c *Config) Validate() error {
 		return ErrInvalidTransactionTimeout
 	}
 
+	if name := c.Transaction.DefaultIsolationLevel; name != "" {
+		if _, err := transaction.ParseIsolationLevel(name); err != nil {
+			return ErrInvalidIsolationLevel
+		}
+	}
+
+	if c.Transaction.DeadlockDetectionEnabled && c.Transaction.DeadlockDetectionInterval <= 0 {
+		return ErrInvalidDeadlockDetectionInterval
+	}
+
+	if c.Transaction.MaxVersionMemory < 0 {
+		return ErrInvalidMaxVersionMemory
+	}
+
+	if retry := c.Transaction.RetryPolicy; retry.Enabled {
+		if retry.MaxRetries < 0 || retry.InitialDelay < 0 || retry.MaxDelay < retry.InitialDelay || retry.BackoffMultiplier < 1 {
+			return ErrInvalidRetryPolicy
+		}
+	}
+
 	// Performance configuration validation
 	if c.Performance.MaxConcurrentReads <= 0 {
 		return ErrInvalidMaxConcurrentReads
@@ -253,11 +334,18 @@ func (c *Config) Validate() error {
 
 // Configuration validation errors
 var (
-	ErrConfigPathRequired           = errors.New("config: path is required")
-	ErrInvalidBufferPoolSize        = errors.New("config: buffer pool size must be positive")
-	ErrInvalidPageSize              = errors.New("config: page size must be between 1 and 65536 bytes")
-	ErrInvalidMaxActiveTransactions = errors.New("config: max active transactions must be positive")
-	ErrInvalidTransactionTimeout    = errors.New("config: transaction timeout must be positive")
-	ErrInvalidMaxConcurrentReads    = errors.New("config: max concurrent reads must be positive")
-	ErrInvalidMaxConcurrentWrites   = errors.New("config: max concurrent writes must be positive")
+	ErrConfigPathRequired               = errors.New("config: path is required")
+	ErrInvalidBufferPoolSize            = errors.New("config: buffer pool size must be positive")
+	ErrInvalidPageSize                  = errors.New("config: page size must be a power of two between 1KB and 32KB")
+	ErrInvalidChecksumAlgorithm         = errors.New("config: checksum algorithm must be crc32c, crc32, xxhash64 or none")
+	ErrInvalidBackupInterval            = errors.New("config: backup interval must be positive")
+	ErrInvalidBackupRetention           = errors.New("config: backup retention must be positive")
+	ErrInvalidMaxActiveTransactions     = errors.New("config: max active transactions must be positive")
+	ErrInvalidTransactionTimeout        = errors.New("config: transaction timeout must be positive")
+	ErrInvalidIsolationLevel            = errors.New("config: unknown default isolation level")
+	ErrInvalidDeadlockDetectionInterval = errors.New("config: deadlock detection interval must be positive")
+	ErrInvalidMaxVersionMemory          = errors.New("config: max version memory cannot be negative")
+	ErrInvalidRetryPolicy               = errors.New("config: retry policy needs non-negative retries and delays, a max delay of at least the initial delay and a backoff multiplier of at least 1")
+	ErrInvalidMaxConcurrentReads        = errors.New("config: max concurrent reads must be positive")
+	ErrInvalidMaxConcurrentWrites       = errors.New("config: max concurrent writes must be positive")
 )
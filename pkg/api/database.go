@@ -2,7 +2,11 @@ package api
 
 import (
 	"context"
+	"errors"
+	"io"
+	"time"
 
+	"github.com/thromel/go-database/pkg/storage/btree"
 	"github.com/thromel/go-database/pkg/transaction"
 )
 
@@ -25,6 +29,26 @@ type Database interface {
 	// The transaction will be cancelled if the context is cancelled.
 	BeginWithContext(ctx context.Context) (transaction.Transaction, error)
 
+	// BeginWithOptions starts a new transaction with specific options, such as
+	// a read-only snapshot for long scans.
+	BeginWithOptions(opts *transaction.TransactionOptions) (transaction.Transaction, error)
+
+	// Snapshot returns a read-only view of the committed state at this
+	// moment, for consistent reads such as backups and exports while writes
+	// continue. It must be released when done, since it keeps the values
+	// later writes replace for as long as it is held.
+	Snapshot() (transaction.Snapshot, error)
+
+	// Update runs fn in a read-write transaction and commits it if fn returns
+	// nil. On a transaction conflict or deadlock the transaction is retried
+	// with jittered exponential backoff, as configured by
+	// Transaction.RetryPolicy, so fn may run more than once. Retrying stops
+	// when ctx is cancelled.
+	Update(ctx context.Context, fn func(txn transaction.Transaction) error) error
+
+	// View runs fn in a read-only transaction, retrying like Update.
+	View(ctx context.Context, fn func(txn transaction.Transaction) error) error
+
 	// Put stores a key-value pair in the database.
 	// This operation is atomic and will be immediately visible to other operations.
 	Put(key []byte, value []byte) error
@@ -37,11 +61,68 @@ type Database interface {
 	// Returns ErrKeyNotFound if the key does not exist.
 	Delete(key []byte) error
 
+	// Write applies every change in the batch atomically, taking the
+	// database's locks once and, with Storage.SyncWrites enabled, syncing to
+	// disk once for the whole batch. Deletes of keys that do not exist are
+	// ignored. opts may be nil for the defaults.
+	Write(batch *WriteBatch, opts *WriteOptions) error
+
 	// Exists checks if a key exists in the database without retrieving its value.
 	Exists(key []byte) (bool, error)
 
+	// BulkLoad fills an empty database from entries supplied in ascending
+	// key order, much faster than writing them one by one. It runs as one
+	// commit: if it fails, for example because the keys are out of order,
+	// the database is left empty. It fails with utils.ErrTransactionsActive
+	// while transactions or snapshots are open, and those begun while it
+	// runs wait for it. An in-memory database cannot be bulk loaded.
+	BulkLoad(src BulkSource) error
+
 	// Stats returns database statistics including size, number of keys, etc.
 	Stats() (*DatabaseStats, error)
+
+	// Compact shrinks the database file after large deletes by moving the
+	// pages in use toward its start and truncating the free space at its end.
+	// Reads and writes continue while it runs. It stops early, leaving the
+	// file consistent, when ctx is cancelled. progress, if not nil, is called
+	// as pages are moved and once the file has been truncated. An in-memory
+	// database has nothing to compact.
+	Compact(ctx context.Context, progress func(CompactProgress)) (*CompactProgress, error)
+
+	// Backup writes a consistent copy of the database to w while reads and
+	// writes continue. The copy holds the database as it was when Backup was
+	// called, with a manifest and a checksum; Restore turns it back into a
+	// database. It stops early when ctx is cancelled. An in-memory database
+	// cannot be backed up.
+	Backup(ctx context.Context, w io.Writer) error
+
+	// BackupIncremental writes the pages that changed after the backup taken
+	// at LSN since, which ReadBackupManifest reads from that backup. When
+	// since is the last backup taken since the database was opened, only the
+	// pages written after it are read; otherwise every page is read, as for
+	// a full backup, but only the changed ones are written. RestoreChain
+	// applies the result on top of the backups it builds on.
+	BackupIncremental(ctx context.Context, w io.Writer, since uint64) error
+}
+
+// BulkSource supplies the entries of a bulk load in ascending key order. A
+// storage.Iterator is one.
+type BulkSource = btree.Source
+
+// ErrBulkLoadUnsupported is returned when bulk loading an in-memory
+// database.
+var ErrBulkLoadUnsupported = errors.New("in-memory databases cannot be bulk loaded")
+
+// CompactProgress reports how far a compaction has got.
+type CompactProgress struct {
+	// PagesMoved is the number of pages relocated so far
+	PagesMoved int
+
+	// PagesRemaining is the number of pages still to be relocated
+	PagesRemaining int
+
+	// FileSize is the size of the database file in bytes
+	FileSize int64
 }
 
 // DatabaseStats contains various statistics about the database state.
@@ -63,4 +144,12 @@ type DatabaseStats struct {
 
 	// TransactionCount is the number of active transactions
 	TransactionCount int64
+
+	// LastBackupTime is when the last scheduled backup finished, or zero if
+	// none has yet
+	LastBackupTime time.Time
+
+	// LastBackupError is the error of the last scheduled backup, or nil if it
+	// succeeded
+	LastBackupError error
 }
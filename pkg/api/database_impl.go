@@ -2,13 +2,21 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"sync"
 
 	"github.com/thromel/go-database/pkg/storage"
+	"github.com/thromel/go-database/pkg/storage/btree"
+	"github.com/thromel/go-database/pkg/storage/file"
+	"github.com/thromel/go-database/pkg/storage/page"
 	"github.com/thromel/go-database/pkg/transaction"
 	"github.com/thromel/go-database/pkg/utils"
 )
 
+// MemoryPath is the special database path that selects the non-durable
+// in-memory storage engine instead of a database file.
+const MemoryPath = ":memory:"
+
 // DatabaseImpl implements the Database interface.
 type DatabaseImpl struct {
 	// config holds the database configuration
@@ -20,8 +28,12 @@ type DatabaseImpl struct {
 	// storage is the underlying storage engine
 	storage storage.StorageEngine
 
-	// txnManager handles transaction lifecycle
-	txnManager transaction.Manager
+	// txnManager handles transaction lifecycle; every write goes through it
+	// so that running snapshot transactions keep their view
+	txnManager *transaction.ManagerImpl
+
+	// backups takes scheduled backups, if enabled
+	backups *backupScheduler
 
 	// mu protects concurrent access to database state
 	mu sync.RWMutex
@@ -55,16 +67,112 @@ func Open(path string, config *Config) (Database, error) {
 		closed: false,
 	}
 
-	// Initialize storage engine (for now, use memory engine)
-	// TODO: In future sprints, add disk-based storage
-	db.storage = storage.NewMemoryEngine()
+	// Initialize storage engine
+	engine, err := openStorageEngine(config)
+	if err != nil {
+		return nil, utils.NewDatabaseErrorWithPath("open", path, err)
+	}
+	db.storage = engine
+
+	// Initialize transaction manager
+	txnManager, err := newTransactionManager(engine, config)
+	if err != nil {
+		_ = engine.Close()
+		return nil, utils.NewDatabaseErrorWithPath("open", path, err)
+	}
+	db.txnManager = txnManager
 
-	// TODO: Initialize transaction manager in future sprints
-	// db.txnManager = transaction.NewTransactionManager(db.storage)
+	if config.Storage.BackupEnabled {
+		db.backups = startBackupScheduler(db)
+	}
 
 	return db, nil
 }
 
+// openStorageEngine creates the storage engine selected by the configuration.
+// Databases are durable unless the in-memory path is requested explicitly.
+func openStorageEngine(config *Config) (storage.StorageEngine, error) {
+	if config.Path == MemoryPath {
+		return storage.NewMemoryEngine(), nil
+	}
+
+	persistentConfig, err := newPersistentConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.NewPersistentEngine(persistentConfig)
+}
+
+// newPersistentConfig translates the database configuration into the
+// configuration of the persistent storage engine.
+func newPersistentConfig(config *Config) (*storage.PersistentConfig, error) {
+	fileConfig := file.DefaultConfig()
+	fileConfig.SyncWrites = config.Storage.SyncWrites
+	fileConfig.VerifyChecksums = config.Storage.ChecksumEnabled
+	fileConfig.DoubleWrite = config.Storage.DoubleWriteEnabled
+	fileConfig.PageSize = config.Storage.PageSize
+	if config.Storage.CompressionEnabled {
+		fileConfig.Compression = page.CompressionLZ4
+	}
+	if config.Storage.ChecksumAlgorithm != "" {
+		checksum, err := page.ParseChecksumAlgorithm(config.Storage.ChecksumAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		fileConfig.Checksum = checksum
+	}
+
+	return &storage.PersistentConfig{
+		FilePath:              config.Path,
+		BufferPoolBytes:       config.Memory.BufferPoolSize,
+		BTreeConfig:           btree.DefaultConfig(),
+		FileConfig:            fileConfig,
+		SyncOnWrite:           config.Storage.SyncWrites,
+		EnableIntegrityChecks: true,
+	}, nil
+}
+
+// newTransactionManager creates the transaction manager for a storage engine
+// from the transaction configuration. An unset isolation level means read
+// committed.
+func newTransactionManager(engine storage.StorageEngine, config *Config) (*transaction.ManagerImpl, error) {
+	isolationLevel := transaction.ReadCommitted
+	if name := config.Transaction.DefaultIsolationLevel; name != "" {
+		level, err := transaction.ParseIsolationLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidIsolationLevel, err)
+		}
+		isolationLevel = level
+	}
+
+	return transaction.NewManager(engine, &transaction.Config{
+		MaxActiveTransactions: config.Transaction.MaxActiveTransactions,
+		DefaultTimeout:        config.Transaction.TransactionTimeout,
+		DefaultIsolationLevel: isolationLevel,
+
+		DeadlockDetection:         config.Transaction.DeadlockDetectionEnabled,
+		DeadlockDetectionInterval: config.Transaction.DeadlockDetectionInterval,
+		RetryPolicy:               newRetryPolicy(&config.Transaction.RetryPolicy),
+		MaxVersionBytes:           config.Transaction.MaxVersionMemory,
+	})
+}
+
+// newRetryPolicy translates the retry configuration into a transaction retry
+// policy, or nil when retries are disabled.
+func newRetryPolicy(config *RetryPolicyConfig) *transaction.RetryPolicy {
+	if !config.Enabled {
+		return nil
+	}
+
+	return &transaction.RetryPolicy{
+		MaxRetries:        config.MaxRetries,
+		InitialDelay:      config.InitialDelay,
+		MaxDelay:          config.MaxDelay,
+		BackoffMultiplier: config.BackoffMultiplier,
+	}
+}
+
 // Open implements the Database interface Open method.
 func (db *DatabaseImpl) Open(path string, config *Config) error {
 	// This method is for interface compatibility
@@ -74,6 +182,11 @@ func (db *DatabaseImpl) Open(path string, config *Config) error {
 
 // Close gracefully shuts down the database.
 func (db *DatabaseImpl) Close() error {
+	// A scheduled backup holds the read lock, so it is stopped first
+	if db.backups != nil {
+		db.backups.stop()
+	}
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
@@ -115,9 +228,12 @@ func (db *DatabaseImpl) Begin() (transaction.Transaction, error) {
 		return nil, utils.ErrDatabaseClosed
 	}
 
-	// TODO: Implement transaction manager in future sprints
-	// For now, return an error indicating transactions are not yet implemented
-	return nil, utils.NewDatabaseError("begin", utils.ErrTransactionNotFound)
+	txn, err := db.txnManager.Begin()
+	if err != nil {
+		return nil, utils.NewDatabaseError("begin", err)
+	}
+
+	return txn, nil
 }
 
 // BeginWithContext starts a new transaction with context.
@@ -129,8 +245,66 @@ func (db *DatabaseImpl) BeginWithContext(ctx context.Context) (transaction.Trans
 		return nil, utils.ErrDatabaseClosed
 	}
 
-	// TODO: Implement transaction manager with context support in future sprints
-	return nil, utils.NewDatabaseError("begin_with_context", utils.ErrTransactionNotFound)
+	txn, err := db.txnManager.BeginWithContext(ctx)
+	if err != nil {
+		return nil, utils.NewDatabaseError("begin_with_context", err)
+	}
+
+	return txn, nil
+}
+
+// BeginWithOptions starts a new transaction with specific options.
+func (db *DatabaseImpl) BeginWithOptions(opts *transaction.TransactionOptions) (transaction.Transaction, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, utils.ErrDatabaseClosed
+	}
+
+	txn, err := db.txnManager.BeginWithOptions(opts)
+	if err != nil {
+		return nil, utils.NewDatabaseError("begin_with_options", err)
+	}
+
+	return txn, nil
+}
+
+// Snapshot returns a read-only view of the committed state at this moment.
+func (db *DatabaseImpl) Snapshot() (transaction.Snapshot, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, utils.ErrDatabaseClosed
+	}
+
+	snapshot, err := db.txnManager.Snapshot()
+	if err != nil {
+		return nil, utils.NewDatabaseError("snapshot", err)
+	}
+
+	return snapshot, nil
+}
+
+// Update runs fn in a read-write transaction and commits it, retrying on
+// conflicts and deadlocks according to the configured retry policy.
+func (db *DatabaseImpl) Update(ctx context.Context, fn func(txn transaction.Transaction) error) error {
+	if db.IsClosed() {
+		return utils.ErrDatabaseClosed
+	}
+
+	// The database lock is not held while fn runs, so fn may use the database
+	return db.txnManager.Update(ctx, fn)
+}
+
+// View runs fn in a read-only transaction, retrying like Update.
+func (db *DatabaseImpl) View(ctx context.Context, fn func(txn transaction.Transaction) error) error {
+	if db.IsClosed() {
+		return utils.ErrDatabaseClosed
+	}
+
+	return db.txnManager.View(ctx, fn)
 }
 
 // Put stores a key-value pair in the database.
@@ -142,7 +316,7 @@ func (db *DatabaseImpl) Put(key []byte, value []byte) error {
 		return utils.ErrDatabaseClosed
 	}
 
-	err := db.storage.Put(key, value)
+	err := db.txnManager.Put(key, value)
 	if err != nil {
 		return utils.NewDatabaseErrorWithKey("put", key, err)
 	}
@@ -178,7 +352,7 @@ func (db *DatabaseImpl) Delete(key []byte) error {
 		return utils.ErrDatabaseClosed
 	}
 
-	err := db.storage.Delete(key)
+	err := db.txnManager.Delete(key)
 	if err != nil {
 		return utils.NewDatabaseErrorWithKey("delete", key, err)
 	}
@@ -188,6 +362,33 @@ func (db *DatabaseImpl) Delete(key []byte) error {
 	return nil
 }
 
+// Write applies a batch of changes as one atomic commit.
+func (db *DatabaseImpl) Write(batch *WriteBatch, opts *WriteOptions) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return utils.ErrDatabaseClosed
+	}
+
+	if batch == nil || batch.Len() == 0 {
+		return nil
+	}
+
+	if err := db.txnManager.Write(batch.batch); err != nil {
+		return utils.NewDatabaseErrorWithPath("write", db.path, err)
+	}
+
+	// SyncWrites already made the batch durable when it was committed
+	if opts != nil && opts.Sync && !db.config.Storage.SyncWrites {
+		if err := db.storage.Sync(); err != nil {
+			return utils.NewDatabaseErrorWithPath("write", db.path, err)
+		}
+	}
+
+	return nil
+}
+
 // Exists checks if a key exists in the database.
 func (db *DatabaseImpl) Exists(key []byte) (bool, error) {
 	db.mu.RLock()
@@ -223,11 +424,78 @@ func (db *DatabaseImpl) Stats() (*DatabaseStats, error) {
 	// Create a copy of stats to return
 	stats := db.stats
 	stats.KeyCount = keyCount
-	stats.TransactionCount = 0 // TODO: Get from transaction manager
+	stats.TransactionCount = db.txnManager.ActiveTransactions()
+
+	// Only the persistent engine manages pages
+	if engine, ok := db.storage.(*storage.PersistentEngine); ok {
+		storageStats := engine.GetStats()
+		stats.PageCount = storageStats.PageCount
+		stats.FreePageCount = storageStats.FreePageCount
+	}
+
+	if db.backups != nil {
+		stats.LastBackupTime, stats.LastBackupError = db.backups.lastBackup()
+	}
 
 	return &stats, nil
 }
 
+// Compact shrinks the database file. Only the persistent engine has a file to
+// compact.
+func (db *DatabaseImpl) Compact(ctx context.Context, progress func(CompactProgress)) (*CompactProgress, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, utils.ErrDatabaseClosed
+	}
+
+	engine, ok := db.storage.(*storage.PersistentEngine)
+	if !ok {
+		return &CompactProgress{}, nil
+	}
+
+	var report func(storage.CompactProgress)
+	if progress != nil {
+		report = func(p storage.CompactProgress) {
+			progress(CompactProgress(p))
+		}
+	}
+
+	// An interrupted compaction still reports the pages it moved
+	result, err := engine.Compact(ctx, report)
+	p := CompactProgress(result)
+	if err != nil {
+		return &p, utils.NewDatabaseErrorWithPath("compact", db.path, err)
+	}
+	return &p, nil
+}
+
+// BulkLoad fills an empty database from entries in ascending key order,
+// through the transaction manager so that no transaction or snapshot runs
+// alongside it.
+func (db *DatabaseImpl) BulkLoad(src BulkSource) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return utils.ErrDatabaseClosed
+	}
+
+	engine, ok := db.storage.(*storage.PersistentEngine)
+	if !ok {
+		return ErrBulkLoadUnsupported
+	}
+
+	err := db.txnManager.Load(func() error {
+		return engine.BulkLoad(src)
+	})
+	if err != nil {
+		return utils.NewDatabaseErrorWithPath("bulk load", db.path, err)
+	}
+	return nil
+}
+
 // GetStorageEngine returns the underlying storage engine (for testing).
 func (db *DatabaseImpl) GetStorageEngine() storage.StorageEngine {
 	return db.storage
@@ -3,18 +3,33 @@ package api
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/thromel/go-database/pkg/storage"
+	"github.com/thromel/go-database/pkg/storage/file"
+	"github.com/thromel/go-database/pkg/storage/page"
+	"github.com/thromel/go-database/pkg/transaction"
 	"github.com/thromel/go-database/pkg/utils"
 )
 
-const testDBPath = "test.db"
+// testDBPath returns a database path inside a per-test temporary directory.
+func testDBPath(tb testing.TB) string {
+	return filepath.Join(tb.TempDir(), "test.db")
+}
 
 func TestDatabase_Open(t *testing.T) {
+	path := testDBPath(t)
 	config := DefaultConfig()
-	config.Path = testDBPath
+	config.Path = path
 
-	db, err := Open(testDBPath, config)
+	db, err := Open(path, config)
 	if err != nil {
 		t.Fatalf("Open failed: %v", err)
 	}
@@ -27,13 +42,14 @@ func TestDatabase_Open(t *testing.T) {
 	}
 
 	// Verify config is set
-	if impl.GetConfig().Path != testDBPath {
-		t.Errorf("Expected path %s, got %s", testDBPath, impl.GetConfig().Path)
+	if impl.GetConfig().Path != path {
+		t.Errorf("Expected path %s, got %s", path, impl.GetConfig().Path)
 	}
 }
 
 func TestDatabase_OpenWithNilConfig(t *testing.T) {
-	db, err := Open(testDBPath, nil)
+	path := testDBPath(t)
+	db, err := Open(path, nil)
 	if err != nil {
 		t.Fatalf("Open with nil config failed: %v", err)
 	}
@@ -46,8 +62,8 @@ func TestDatabase_OpenWithNilConfig(t *testing.T) {
 		t.Error("Config should not be nil")
 		return
 	}
-	if config.Path != testDBPath {
-		t.Errorf("Expected path %s, got %s", testDBPath, config.Path)
+	if config.Path != path {
+		t.Errorf("Expected path %s, got %s", path, config.Path)
 	}
 }
 
@@ -62,8 +78,239 @@ func TestDatabase_OpenWithInvalidConfig(t *testing.T) {
 	}
 }
 
+func TestDatabase_PersistsAcrossReopen(t *testing.T) {
+	path := testDBPath(t)
+
+	db, err := Open(path, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key-%03d", i))
+		value := []byte(fmt.Sprintf("value-%03d", i))
+		if err := db.Put(key, value); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	db, err = Open(path, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer db.Close()
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.KeyCount != 200 {
+		t.Errorf("Expected 200 keys after reopen, got %d", stats.KeyCount)
+	}
+
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key-%03d", i))
+		value, err := db.Get(key)
+		if err != nil {
+			t.Fatalf("Get %s after reopen failed: %v", key, err)
+		}
+		if want := fmt.Sprintf("value-%03d", i); string(value) != want {
+			t.Errorf("Expected %s, got %s", want, value)
+		}
+	}
+}
+
+func TestDatabase_MemoryPath(t *testing.T) {
+	db, err := Open(MemoryPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	impl := db.(*DatabaseImpl)
+	if _, ok := impl.GetStorageEngine().(*storage.MemoryEngine); !ok {
+		t.Errorf("Expected memory engine for %s, got %T", MemoryPath, impl.GetStorageEngine())
+	}
+
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+}
+
+func TestDatabase_UnsupportedPageSize(t *testing.T) {
+	for _, size := range []int{-1, 512, 3000, 65536} {
+		config := DefaultConfig()
+		config.Storage.PageSize = size
+
+		_, err := Open(testDBPath(t), config)
+		if !errors.Is(err, ErrInvalidPageSize) {
+			t.Errorf("Expected ErrInvalidPageSize for %d-byte pages, got %v", size, err)
+		}
+	}
+}
+
+func TestDatabase_PageSize(t *testing.T) {
+	for _, size := range []int{4096, 32768} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			path := testDBPath(t)
+			config := DefaultConfig()
+			config.Storage.PageSize = size
+
+			db, err := Open(path, config)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			value := bytes.Repeat([]byte("v"), 100)
+			for i := 0; i < 1000; i++ {
+				if err := db.Put([]byte(fmt.Sprintf("key-%04d", i)), value); err != nil {
+					t.Fatalf("Put failed: %v", err)
+				}
+			}
+			if err := db.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			stat, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Stat failed: %v", err)
+			}
+			if stat.Size()%int64(size) != 0 {
+				t.Errorf("Expected a file of %d-byte pages, got %d bytes", size, stat.Size())
+			}
+
+			// The database keeps the page size it was created with
+			config.Storage.PageSize = 8192
+			if _, err := Open(path, config); !errors.Is(err, file.ErrPageSizeMismatch) {
+				t.Fatalf("Expected ErrPageSizeMismatch, got %v", err)
+			}
+
+			// The default configuration opens it with its own page size
+			db, err = Open(path, DefaultConfig())
+			if err != nil {
+				t.Fatalf("Reopen failed: %v", err)
+			}
+			defer db.Close()
+
+			for i := 0; i < 1000; i++ {
+				got, err := db.Get([]byte(fmt.Sprintf("key-%04d", i)))
+				if err != nil {
+					t.Fatalf("Get after reopen failed: %v", err)
+				}
+				if !bytes.Equal(got, value) {
+					t.Fatalf("Expected %q, got %q", value, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDatabase_ChecksumAlgorithm(t *testing.T) {
+	config := DefaultConfig()
+	config.Storage.ChecksumAlgorithm = "md5"
+	if _, err := Open(testDBPath(t), config); !errors.Is(err, ErrInvalidChecksumAlgorithm) {
+		t.Errorf("Expected ErrInvalidChecksumAlgorithm, got %v", err)
+	}
+
+	for _, name := range []string{"crc32", "crc32c", "xxhash64", "none"} {
+		t.Run(name, func(t *testing.T) {
+			path := testDBPath(t)
+			config := DefaultConfig()
+			config.Storage.ChecksumAlgorithm = name
+
+			db, err := Open(path, config)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			if err := db.Put([]byte("key"), []byte("value")); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			// The database keeps its algorithm, and reads need not verify it
+			config.Storage.ChecksumAlgorithm = ""
+			config.Storage.ChecksumEnabled = false
+			db, err = Open(path, config)
+			if err != nil {
+				t.Fatalf("Reopen failed: %v", err)
+			}
+			got, err := db.Get([]byte("key"))
+			if err != nil || string(got) != "value" {
+				t.Errorf("Expected value after reopen, got %q, %v", got, err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			fm, err := file.NewFileManager(path, file.DefaultConfig())
+			if err != nil {
+				t.Fatalf("Failed to open file: %v", err)
+			}
+			defer fm.Close()
+			if got := fm.Superblock().Checksum.String(); got != name {
+				t.Errorf("Expected checksum algorithm %s, got %s", name, got)
+			}
+		})
+	}
+}
+
+func TestDatabase_Compression(t *testing.T) {
+	path := testDBPath(t)
+	config := DefaultConfig()
+	config.Storage.CompressionEnabled = true
+
+	db, err := Open(path, config)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	value := func(i int) []byte {
+		return []byte(fmt.Sprintf(`{"id":%d,"name":"user-%d","email":"user-%d@example.com","active":true}`, i, i, i))
+	}
+	for i := 0; i < 2000; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%05d", i)), value(i)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	fm, err := file.NewFileManager(path, file.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	if fm.Superblock().Features&file.FeatureCompression == 0 {
+		t.Error("Expected the database file to record compression")
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file: %v", err)
+	}
+
+	// The compressed pages are read back with compression disabled
+	config.Storage.CompressionEnabled = false
+	db, err = Open(path, config)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 2000; i++ {
+		got, err := db.Get([]byte(fmt.Sprintf("key-%05d", i)))
+		if err != nil {
+			t.Fatalf("Get after reopen failed: %v", err)
+		}
+		if !bytes.Equal(got, value(i)) {
+			t.Fatalf("Expected %q, got %q", value(i), got)
+		}
+	}
+}
+
 func TestDatabase_BasicOperations(t *testing.T) {
-	db, err := Open("test.db", DefaultConfig())
+	db, err := Open(testDBPath(t), DefaultConfig())
 	if err != nil {
 		t.Fatalf("Open failed: %v", err)
 	}
@@ -84,83 +331,631 @@ func TestDatabase_BasicOperations(t *testing.T) {
 		t.Fatalf("Get failed: %v", err)
 	}
 
-	if !bytes.Equal(result, value) {
-		t.Errorf("Expected %s, got %s", value, result)
-	}
+	if !bytes.Equal(result, value) {
+		t.Errorf("Expected %s, got %s", value, result)
+	}
+
+	// Test Exists
+	exists, err := db.Exists(key)
+	if err != nil {
+		t.Fatalf("Exists failed: %v", err)
+	}
+
+	if !exists {
+		t.Error("Key should exist")
+	}
+
+	// Test Delete
+	err = db.Delete(key)
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	// Test Get after delete
+	_, err = db.Get(key)
+	if !utils.IsKeyNotFound(err) {
+		t.Errorf("Expected key not found error, got %v", err)
+	}
+
+	// Test Exists after delete
+	exists, err = db.Exists(key)
+	if err != nil {
+		t.Fatalf("Exists failed: %v", err)
+	}
+
+	if exists {
+		t.Error("Key should not exist after delete")
+	}
+}
+
+func TestDatabase_WriteBatch(t *testing.T) {
+	config := DefaultConfig()
+	config.Storage.SyncWrites = true
+	db, err := Open(testDBPath(t), config)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Put([]byte("old"), []byte("value")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	batch := NewWriteBatch()
+	for i := 0; i < 1000; i++ {
+		batch.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte("value"))
+	}
+	batch.Delete([]byte("old"))
+	batch.Delete([]byte("missing"))
+	if batch.Len() != 1002 || batch.Size() != 1000*13+3+7 {
+		t.Errorf("Expected 1002 changes of %d bytes, got %d of %d", 1000*13+10, batch.Len(), batch.Size())
+	}
+
+	// The whole batch is synced to the log at once
+	log := db.(*DatabaseImpl).GetStorageEngine().(*storage.PersistentEngine).GetWAL()
+	syncs := log.GetStatistics().Syncs
+	if err := db.Write(batch, nil); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if got := log.GetStatistics().Syncs - syncs; got != 1 {
+		t.Errorf("Expected one log sync for the batch, got %d", got)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.KeyCount != 1000 {
+		t.Errorf("Expected 1000 keys, got %d", stats.KeyCount)
+	}
+	if exists, _ := db.Exists([]byte("old")); exists {
+		t.Error("Expected the batch to delete the key")
+	}
+
+	// An invalid change rejects the whole batch
+	batch.Clear()
+	if batch.Len() != 0 || batch.Size() != 0 {
+		t.Errorf("Expected an empty batch after Clear, got %d changes of %d bytes", batch.Len(), batch.Size())
+	}
+	batch.Put([]byte("new"), []byte("value"))
+	batch.Put(nil, []byte("value"))
+	if err := db.Write(batch, &WriteOptions{Sync: true}); !errors.Is(err, utils.ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+	if exists, _ := db.Exists([]byte("new")); exists {
+		t.Error("Expected no changes from a rejected batch")
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := db.Write(NewWriteBatch(), nil); !errors.Is(err, utils.ErrDatabaseClosed) {
+		t.Errorf("Expected ErrDatabaseClosed, got %v", err)
+	}
+}
+
+func TestDatabase_WriteBatchSync(t *testing.T) {
+	path := testDBPath(t)
+	db, err := Open(path, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	batch := NewWriteBatch()
+	batch.Put([]byte("a"), []byte("1"))
+	batch.Put([]byte("b"), []byte("2"))
+	if err := db.Write(batch, &WriteOptions{Sync: true}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// A synced batch is on disk without the log
+	engine := db.(*DatabaseImpl).GetStorageEngine().(*storage.PersistentEngine)
+	if size := engine.GetWAL().Size(); size != 0 {
+		t.Errorf("Expected the batch to be checkpointed, got %d bytes of log", size)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	db, err = Open(path, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	for _, key := range []string{"a", "b"} {
+		if _, err := db.Get([]byte(key)); err != nil {
+			t.Errorf("Expected %s to persist: %v", key, err)
+		}
+	}
+}
+
+func TestDatabase_Stats(t *testing.T) {
+	db, err := Open(testDBPath(t), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	// Initial stats
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+
+	if stats.KeyCount != 0 {
+		t.Errorf("Expected 0 keys, got %d", stats.KeyCount)
+	}
+
+	// Add some data
+	for i := 0; i < 5; i++ {
+		key := []byte("key" + string(rune('0'+i)))
+		value := []byte("value" + string(rune('0'+i)))
+		err := db.Put(key, value)
+		if err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// Check stats after adding data
+	stats, err = db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+
+	if stats.KeyCount != 5 {
+		t.Errorf("Expected 5 keys, got %d", stats.KeyCount)
+	}
+}
+
+func TestDatabase_FreePagesReused(t *testing.T) {
+	path := testDBPath(t)
+	db, err := Open(path, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	large := make([]byte, 200_000)
+	if err := db.Put([]byte("large"), large); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := db.Delete([]byte("large")); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.FreePageCount == 0 || stats.PageCount == 0 {
+		t.Fatalf("Expected free pages after deleting a large value, got %+v", stats)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The free pages survive a reopen and are reused before the file grows
+	db, err = Open(path, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer db.Close()
+
+	reopened, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if reopened.FreePageCount != stats.FreePageCount || reopened.PageCount != stats.PageCount {
+		t.Errorf("Expected %d used and %d free pages after reopen, got %+v", stats.PageCount, stats.FreePageCount, reopened)
+	}
+
+	if err := db.Put([]byte("large"), large); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	after, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if after.PageCount+after.FreePageCount != stats.PageCount+stats.FreePageCount {
+		t.Errorf("Expected the value to reuse free pages, got %+v", after)
+	}
+}
+
+func TestDatabase_Compact(t *testing.T) {
+	path := testDBPath(t)
+	db, err := Open(path, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	large := make([]byte, 20_000)
+	for i := 0; i < 100; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%03d", i)), large); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if i%10 != 0 {
+			if err := db.Delete([]byte(fmt.Sprintf("key-%03d", i))); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+		}
+	}
+
+	reports := 0
+	result, err := db.Compact(context.Background(), func(CompactProgress) { reports++ })
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if reports == 0 || result.PagesRemaining != 0 {
+		t.Errorf("Expected progress reports and no pages remaining, got %d reports and %+v", reports, result)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.FreePageCount != 0 || result.FileSize != (stats.PageCount+1)*int64(page.PageSize) {
+		t.Errorf("Expected the file to hold only the pages in use, got %d bytes for %+v", result.FileSize, stats)
+	}
+
+	for i := 0; i < 100; i += 10 {
+		value, err := db.Get([]byte(fmt.Sprintf("key-%03d", i)))
+		if err != nil || !bytes.Equal(value, large) {
+			t.Fatalf("Get failed after compaction: %v", err)
+		}
+	}
+
+	// An in-memory database has no file to compact
+	mem, err := Open(MemoryPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if result, err := mem.Compact(context.Background(), nil); err != nil || result.PagesMoved != 0 {
+		t.Errorf("Expected nothing to compact in memory, got %+v: %v", result, err)
+	}
+	if err := mem.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := mem.Compact(context.Background(), nil); !errors.Is(err, utils.ErrDatabaseClosed) {
+		t.Errorf("Expected ErrDatabaseClosed, got %v", err)
+	}
+}
+
+func TestDatabase_BulkLoad(t *testing.T) {
+	db, err := Open(testDBPath(t), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	source := storage.NewMemoryEngine()
+	defer source.Close()
+	for i := 0; i < 1000; i++ {
+		if err := source.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	load := func() error {
+		it := source.NewIterator(nil, nil)
+		defer it.Close()
+		return db.BulkLoad(it)
+	}
+
+	// Open transactions and snapshots could not see the load
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if err := load(); !errors.Is(err, utils.ErrTransactionsActive) {
+		t.Errorf("Expected ErrTransactionsActive with a snapshot open, got %v", err)
+	}
+	if err := snapshot.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	if err := load(); !errors.Is(err, utils.ErrTransactionsActive) {
+		t.Errorf("Expected ErrTransactionsActive with a transaction open, got %v", err)
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	if err := load(); err != nil {
+		t.Fatalf("BulkLoad failed: %v", err)
+	}
+	for i := 0; i < 1000; i += 100 {
+		value, err := db.Get([]byte(fmt.Sprintf("key-%04d", i)))
+		if err != nil || string(value) != fmt.Sprintf("value-%d", i) {
+			t.Fatalf("Unexpected value for key %d: %q (%v)", i, value, err)
+		}
+	}
+
+	// Transactions see the loaded data
+	err = db.View(context.Background(), func(txn transaction.Transaction) error {
+		_, err := txn.Get([]byte("key-0999"))
+		return err
+	})
+	if err != nil {
+		t.Errorf("Expected a transaction to read the loaded data, got %v", err)
+	}
+
+	mem, err := Open(MemoryPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer mem.Close()
+	it := source.NewIterator(nil, nil)
+	defer it.Close()
+	if err := mem.BulkLoad(it); !errors.Is(err, ErrBulkLoadUnsupported) {
+		t.Errorf("Expected ErrBulkLoadUnsupported, got %v", err)
+	}
+}
+
+func TestDatabase_Backup(t *testing.T) {
+	path := testDBPath(t)
+	db, err := Open(path, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 500; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("base-%03d", i)), []byte("value")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// Keys are written in order while the backup runs, so a consistent copy
+	// holds some prefix of them
+	stop := make(chan struct{})
+	written := make(chan int)
+	go func() {
+		i := 0
+		defer func() { written <- i }()
+		for ; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := db.Put([]byte(fmt.Sprintf("live-%06d", i)), []byte("value")); err != nil {
+				t.Errorf("Put failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	var backup bytes.Buffer
+	err = db.Backup(context.Background(), &backup)
+	close(stop)
+	numWritten := <-written
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	restoredPath := filepath.Join(t.TempDir(), "restored.db")
+	if err := Restore(bytes.NewReader(backup.Bytes()), restoredPath); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	restored, err := Open(restoredPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open of restored database failed: %v", err)
+	}
+	defer restored.Close()
+
+	for i := 0; i < 500; i++ {
+		if _, err := restored.Get([]byte(fmt.Sprintf("base-%03d", i))); err != nil {
+			t.Fatalf("Expected base-%03d in the backup: %v", i, err)
+		}
+	}
+	live := 0
+	for ; live < numWritten; live++ {
+		if exists, _ := restored.Exists([]byte(fmt.Sprintf("live-%06d", live))); !exists {
+			break
+		}
+	}
+	for i := live; i < numWritten; i++ {
+		if exists, _ := restored.Exists([]byte(fmt.Sprintf("live-%06d", i))); exists {
+			t.Fatalf("Backup holds live-%06d but not live-%06d", i, live)
+		}
+	}
+
+	// A damaged backup is rejected
+	damaged := bytes.Clone(backup.Bytes())
+	damaged[len(damaged)/2] ^= 0xFF
+	if err := Restore(bytes.NewReader(damaged), filepath.Join(t.TempDir(), "damaged.db")); !errors.Is(err, storage.ErrBackupCorrupted) {
+		t.Errorf("Expected ErrBackupCorrupted, got %v", err)
+	}
+
+	// An in-memory database has no file to back up
+	mem, err := Open(MemoryPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer mem.Close()
+	if err := mem.Backup(context.Background(), &bytes.Buffer{}); !errors.Is(err, ErrBackupUnsupported) {
+		t.Errorf("Expected ErrBackupUnsupported, got %v", err)
+	}
+}
+
+func TestDatabase_BackupIncremental(t *testing.T) {
+	db, err := Open(testDBPath(t), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 1000; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%04d", i)), []byte("v1")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	var full bytes.Buffer
+	if err := db.Backup(context.Background(), &full); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	// Each incremental backup builds on the one before
+	backups := []*bytes.Buffer{&full}
+	for round := 0; round < 2; round++ {
+		manifest, err := ReadBackupManifest(bytes.NewReader(backups[len(backups)-1].Bytes()))
+		if err != nil {
+			t.Fatalf("ReadBackupManifest failed: %v", err)
+		}
+		if manifest.Incremental != (round > 0) {
+			t.Errorf("Expected backup %d to be incremental: %v", round, round > 0)
+		}
+
+		if err := db.Put([]byte(fmt.Sprintf("key-%04d", round)), []byte("v2")); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		if err := db.Delete([]byte(fmt.Sprintf("key-%04d", 500+round))); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
 
-	// Test Exists
-	exists, err := db.Exists(key)
-	if err != nil {
-		t.Fatalf("Exists failed: %v", err)
+		var incremental bytes.Buffer
+		if err := db.BackupIncremental(context.Background(), &incremental, manifest.LSN); err != nil {
+			t.Fatalf("BackupIncremental failed: %v", err)
+		}
+		if incremental.Len() >= full.Len() {
+			t.Errorf("Expected the incremental backup to be smaller than %d bytes, got %d", full.Len(), incremental.Len())
+		}
+		backups = append(backups, &incremental)
 	}
 
-	if !exists {
-		t.Error("Key should exist")
+	readers := make([]io.Reader, len(backups))
+	for i, backup := range backups {
+		readers[i] = bytes.NewReader(backup.Bytes())
 	}
-
-	// Test Delete
-	err = db.Delete(key)
+	restoredPath := filepath.Join(t.TempDir(), "restored.db")
+	if err := RestoreChain(restoredPath, readers...); err != nil {
+		t.Fatalf("RestoreChain failed: %v", err)
+	}
+	restored, err := Open(restoredPath, DefaultConfig())
 	if err != nil {
-		t.Fatalf("Delete failed: %v", err)
+		t.Fatalf("Open of restored database failed: %v", err)
+	}
+	defer restored.Close()
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		want, wantErr := db.Get(key)
+		got, err := restored.Get(key)
+		if !bytes.Equal(got, want) || errors.Is(err, utils.ErrKeyNotFound) != errors.Is(wantErr, utils.ErrKeyNotFound) {
+			t.Fatalf("Expected %s to be %q after restoring, got %q: %v", key, want, got, err)
+		}
 	}
 
-	// Test Get after delete
-	_, err = db.Get(key)
-	if !utils.IsKeyNotFound(err) {
-		t.Errorf("Expected key not found error, got %v", err)
+	// Skipping a backup in the chain is an error
+	if err := RestoreChain(filepath.Join(t.TempDir(), "broken.db"), bytes.NewReader(full.Bytes()), bytes.NewReader(backups[2].Bytes())); !errors.Is(err, storage.ErrBackupChainBroken) {
+		t.Errorf("Expected ErrBackupChainBroken, got %v", err)
 	}
 
-	// Test Exists after delete
-	exists, err = db.Exists(key)
+	mem, err := Open(MemoryPath, DefaultConfig())
 	if err != nil {
-		t.Fatalf("Exists failed: %v", err)
+		t.Fatalf("Open failed: %v", err)
 	}
-
-	if exists {
-		t.Error("Key should not exist after delete")
+	defer mem.Close()
+	if err := mem.BackupIncremental(context.Background(), &bytes.Buffer{}, 0); !errors.Is(err, ErrBackupUnsupported) {
+		t.Errorf("Expected ErrBackupUnsupported, got %v", err)
 	}
 }
 
-func TestDatabase_Stats(t *testing.T) {
-	db, err := Open("test.db", DefaultConfig())
+func TestDatabase_ScheduledBackups(t *testing.T) {
+	path := testDBPath(t)
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	config := DefaultConfig()
+	config.Storage.BackupEnabled = true
+	config.Storage.BackupInterval = 10 * time.Millisecond
+	config.Storage.BackupDir = dir
+	config.Storage.BackupRetention = 2
+
+	db, err := Open(path, config)
 	if err != nil {
 		t.Fatalf("Open failed: %v", err)
 	}
-	defer db.Close()
-
-	// Initial stats
-	stats, err := db.Stats()
-	if err != nil {
-		t.Fatalf("Stats failed: %v", err)
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("Put failed: %v", err)
 	}
 
-	if stats.KeyCount != 0 {
-		t.Errorf("Expected 0 keys, got %d", stats.KeyCount)
+	// Wait for enough backups that old ones have been rotated out
+	var last time.Time
+	for backups, deadline := 0, time.Now().Add(10*time.Second); backups < 4; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 4 scheduled backups, got %d", backups)
+		}
+		stats, err := db.Stats()
+		if err != nil {
+			t.Fatalf("Stats failed: %v", err)
+		}
+		if stats.LastBackupError != nil {
+			t.Fatalf("Scheduled backup failed: %v", stats.LastBackupError)
+		}
+		if stats.LastBackupTime.After(last) {
+			last = stats.LastBackupTime
+			backups++
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
 	}
 
-	// Add some data
-	for i := 0; i < 5; i++ {
-		key := []byte("key" + string(rune('0'+i)))
-		value := []byte("value" + string(rune('0'+i)))
-		err := db.Put(key, value)
-		if err != nil {
-			t.Fatalf("Put failed: %v", err)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read backup directory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 backups to be kept, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "test-") || filepath.Ext(entry.Name()) != BackupFileExtension {
+			t.Errorf("Unexpected file in backup directory: %s", entry.Name())
 		}
 	}
 
-	// Check stats after adding data
-	stats, err = db.Stats()
+	newest, err := os.Open(filepath.Join(dir, entries[1].Name()))
 	if err != nil {
-		t.Fatalf("Stats failed: %v", err)
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	defer newest.Close()
+	restoredPath := filepath.Join(t.TempDir(), "restored.db")
+	if err := Restore(newest, restoredPath); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	restored, err := Open(restoredPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open of restored database failed: %v", err)
+	}
+	defer restored.Close()
+	if value, err := restored.Get([]byte("key")); err != nil || string(value) != "value" {
+		t.Errorf("Expected the restored database to hold key, got %q: %v", value, err)
 	}
 
-	if stats.KeyCount != 5 {
-		t.Errorf("Expected 5 keys, got %d", stats.KeyCount)
+	// Scheduled backups need a database file and a positive interval
+	for _, mutate := range []func(*Config){
+		func(c *Config) { c.Path = MemoryPath },
+		func(c *Config) { c.Storage.BackupInterval = 0 },
+		func(c *Config) { c.Storage.BackupRetention = 0 },
+	} {
+		config := DefaultConfig()
+		config.Path = testDBPath(t)
+		config.Storage.BackupEnabled = true
+		mutate(config)
+		if err := config.Validate(); err == nil {
+			t.Errorf("Expected an invalid backup configuration to be rejected")
+		}
 	}
 }
 
 func TestDatabase_Close(t *testing.T) {
-	db, err := Open("test.db", DefaultConfig())
+	db, err := Open(testDBPath(t), DefaultConfig())
 	if err != nil {
 		t.Fatalf("Open failed: %v", err)
 	}
@@ -216,27 +1011,136 @@ func TestDatabase_Close(t *testing.T) {
 	}
 }
 
-func TestDatabase_TransactionsNotImplemented(t *testing.T) {
-	db, err := Open("test.db", DefaultConfig())
+func TestDatabase_Transactions(t *testing.T) {
+	db, err := Open(testDBPath(t), DefaultConfig())
 	if err != nil {
 		t.Fatalf("Open failed: %v", err)
 	}
 	defer db.Close()
 
-	// Transactions should not be implemented yet
-	_, err = db.Begin()
-	if err == nil {
-		t.Error("Expected error for Begin() - transactions not implemented yet")
+	if err := db.Put([]byte("existing"), []byte("old")); err != nil {
+		t.Fatalf("Put failed: %v", err)
 	}
 
-	_, err = db.BeginWithContext(context.TODO())
-	if err == nil {
-		t.Error("Expected error for BeginWithContext() - transactions not implemented yet")
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+
+	if err := txn.Put([]byte("new"), []byte("value")); err != nil {
+		t.Fatalf("Transaction put failed: %v", err)
+	}
+	if err := txn.Delete([]byte("existing")); err != nil {
+		t.Fatalf("Transaction delete failed: %v", err)
+	}
+
+	// The transaction reads its own writes; the database does not see them yet
+	if value, err := txn.Get([]byte("new")); err != nil || string(value) != "value" {
+		t.Errorf("Expected transaction to read its own write, got %q (%v)", value, err)
+	}
+	if _, err := txn.Get([]byte("existing")); !errors.Is(err, utils.ErrKeyNotFound) {
+		t.Errorf("Expected deleted key to be missing in transaction, got %v", err)
+	}
+	if exists, _ := db.Exists([]byte("new")); exists {
+		t.Error("Expected uncommitted write to be invisible outside the transaction")
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.TransactionCount != 1 {
+		t.Errorf("Expected 1 active transaction, got %d", stats.TransactionCount)
+	}
+
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if value, err := db.Get([]byte("new")); err != nil || string(value) != "value" {
+		t.Errorf("Expected committed write, got %q (%v)", value, err)
+	}
+	if exists, _ := db.Exists([]byte("existing")); exists {
+		t.Error("Expected committed delete to remove the key")
+	}
+
+	stats, err = db.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if stats.TransactionCount != 0 {
+		t.Errorf("Expected no active transactions after commit, got %d", stats.TransactionCount)
+	}
+
+	if err := txn.Put([]byte("late"), []byte("value")); !errors.Is(err, utils.ErrTransactionCommitted) {
+		t.Errorf("Expected ErrTransactionCommitted, got %v", err)
+	}
+}
+
+func TestDatabase_TransactionRollback(t *testing.T) {
+	db, err := Open(testDBPath(t), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	txn, err := db.BeginWithContext(context.TODO())
+	if err != nil {
+		t.Fatalf("BeginWithContext failed: %v", err)
+	}
+
+	if err := txn.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("Transaction put failed: %v", err)
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	if exists, _ := db.Exists([]byte("key")); exists {
+		t.Error("Expected rolled back write to be discarded")
+	}
+	if err := txn.Commit(); !errors.Is(err, utils.ErrTransactionRolledBack) {
+		t.Errorf("Expected ErrTransactionRolledBack, got %v", err)
+	}
+}
+
+func TestDatabase_TransactionLimits(t *testing.T) {
+	config := DefaultConfig()
+	config.Transaction.MaxActiveTransactions = 1
+	config.Transaction.TransactionTimeout = 50 * time.Millisecond
+
+	db, err := Open(testDBPath(t), config)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+
+	if _, err := db.Begin(); !errors.Is(err, utils.ErrTooManyTransactions) {
+		t.Errorf("Expected ErrTooManyTransactions, got %v", err)
+	}
+
+	// The timed out transaction is rolled back and frees its slot
+	time.Sleep(100 * time.Millisecond)
+	if err := txn.Put([]byte("key"), []byte("value")); !errors.Is(err, utils.ErrTransactionTimeout) {
+		t.Errorf("Expected ErrTransactionTimeout, got %v", err)
+	}
+
+	txn, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Begin after timeout failed: %v", err)
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
 	}
 }
 
 func TestDatabase_InvalidOperations(t *testing.T) {
-	db, err := Open("test.db", DefaultConfig())
+	db, err := Open(testDBPath(t), DefaultConfig())
 	if err != nil {
 		t.Fatalf("Open failed: %v", err)
 	}
@@ -270,7 +1174,7 @@ func TestDatabase_InvalidOperations(t *testing.T) {
 }
 
 func TestDatabase_ConcurrentOperations(t *testing.T) {
-	db, err := Open("test.db", DefaultConfig())
+	db, err := Open(testDBPath(t), DefaultConfig())
 	if err != nil {
 		t.Fatalf("Open failed: %v", err)
 	}
@@ -326,7 +1230,7 @@ func TestDatabase_ConcurrentOperations(t *testing.T) {
 }
 
 func BenchmarkDatabase_Put(b *testing.B) {
-	db, err := Open("bench.db", DefaultConfig())
+	db, err := Open(testDBPath(b), DefaultConfig())
 	if err != nil {
 		b.Fatalf("Open failed: %v", err)
 	}
@@ -345,7 +1249,7 @@ func BenchmarkDatabase_Put(b *testing.B) {
 }
 
 func BenchmarkDatabase_Get(b *testing.B) {
-	db, err := Open("bench.db", DefaultConfig())
+	db, err := Open(testDBPath(b), DefaultConfig())
 	if err != nil {
 		b.Fatalf("Open failed: %v", err)
 	}
@@ -368,3 +1272,251 @@ func BenchmarkDatabase_Get(b *testing.B) {
 		}
 	}
 }
+
+func TestDatabase_SnapshotTransaction(t *testing.T) {
+	db, err := Open(testDBPath(t), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Put([]byte("key"), []byte("before")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	txn, err := db.BeginWithOptions(&transaction.TransactionOptions{
+		IsolationLevel: transaction.RepeatableRead,
+		ReadOnly:       true,
+	})
+	if err != nil {
+		t.Fatalf("BeginWithOptions failed: %v", err)
+	}
+	defer txn.Rollback()
+
+	// Writes outside the transaction do not disturb its snapshot
+	if err := db.Put([]byte("key"), []byte("after")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := db.Delete([]byte("key")); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	if value, err := txn.Get([]byte("key")); err != nil || string(value) != "before" {
+		t.Errorf("Expected snapshot value, got %q (%v)", value, err)
+	}
+}
+
+func TestDatabase_Snapshot(t *testing.T) {
+	db, err := Open(testDBPath(t), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	value := func(i, gen int) []byte {
+		if i%10 == 0 {
+			return bytes.Repeat([]byte{byte(i + gen)}, 20_000)
+		}
+		return []byte(fmt.Sprintf("value-%d-%d", i, gen))
+	}
+	for i := 0; i < 200; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key-%03d", i)), value(i, 1)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+
+	// Overwrite, delete and insert keys, and move the pages around
+	batch := NewWriteBatch()
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key-%03d", i))
+		if i%2 == 0 {
+			batch.Delete(key)
+		} else {
+			batch.Put(key, value(i, 2))
+		}
+		batch.Put([]byte(fmt.Sprintf("key-%03d-new", i)), value(i, 2))
+	}
+	if err := db.Write(batch, nil); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := db.Compact(context.Background(), nil); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	// The snapshot still reads the data as it was
+	it := snapshot.NewIterator([]byte("key-"), nil)
+	count := 0
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		if want := fmt.Sprintf("key-%03d", count); string(it.Key()) != want {
+			t.Fatalf("Expected %s, got %s", want, it.Key())
+		}
+		if !bytes.Equal(it.Value(), value(count, 1)) {
+			t.Fatalf("Unexpected value for %s", it.Key())
+		}
+		count++
+	}
+	if it.Error() != nil || count != 200 {
+		t.Errorf("Expected to read 200 keys from the snapshot, got %d: %v", count, it.Error())
+	}
+	it.Close()
+
+	if got, err := snapshot.Get([]byte("key-000")); err != nil || !bytes.Equal(got, value(0, 1)) {
+		t.Errorf("Expected the snapshot to read a deleted key: %v", err)
+	}
+	if exists, _ := snapshot.Exists([]byte("key-000-new")); exists {
+		t.Error("Expected a later insert to be invisible to the snapshot")
+	}
+	if got, err := db.Get([]byte("key-001")); err != nil || !bytes.Equal(got, value(1, 2)) {
+		t.Errorf("Expected the database to read the new value: %v", err)
+	}
+
+	if err := snapshot.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if _, err := snapshot.Get([]byte("key-001")); !errors.Is(err, utils.ErrSnapshotReleased) {
+		t.Errorf("Expected ErrSnapshotReleased, got %v", err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := db.Snapshot(); !errors.Is(err, utils.ErrDatabaseClosed) {
+		t.Errorf("Expected ErrDatabaseClosed, got %v", err)
+	}
+}
+
+func TestDatabase_SnapshotTooOld(t *testing.T) {
+	config := DefaultConfig()
+	config.Transaction.MaxVersionMemory = -1
+	if _, err := Open(testDBPath(t), config); !errors.Is(err, ErrInvalidMaxVersionMemory) {
+		t.Fatalf("Expected ErrInvalidMaxVersionMemory, got %v", err)
+	}
+
+	config.Transaction.MaxVersionMemory = 10_000
+	db, err := Open(testDBPath(t), config)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Put([]byte("key"), bytes.Repeat([]byte{1}, 20_000)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	snapshot, err := db.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	defer snapshot.Release()
+
+	// Keeping the replaced value would take more than allowed
+	if err := db.Put([]byte("key"), []byte("small")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := snapshot.Get([]byte("key")); !errors.Is(err, utils.ErrSnapshotTooOld) {
+		t.Errorf("Expected ErrSnapshotTooOld, got %v", err)
+	}
+}
+
+func TestDatabase_PessimisticDeadlock(t *testing.T) {
+	config := DefaultConfig()
+	config.Transaction.DeadlockDetectionInterval = 0
+	if _, err := Open(testDBPath(t), config); !errors.Is(err, ErrInvalidDeadlockDetectionInterval) {
+		t.Fatalf("Expected ErrInvalidDeadlockDetectionInterval, got %v", err)
+	}
+
+	config.Transaction.DeadlockDetectionInterval = 5 * time.Millisecond
+	db, err := Open(testDBPath(t), config)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	options := &transaction.TransactionOptions{Pessimistic: true}
+	older, err := db.BeginWithOptions(options)
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	younger, err := db.BeginWithOptions(options)
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+
+	if err := older.Put([]byte("a"), []byte("older")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := younger.Put([]byte("b"), []byte("younger")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- older.Put([]byte("b"), []byte("older")) }()
+
+	// Wait for the older transaction to queue before closing the cycle
+	time.Sleep(20 * time.Millisecond)
+	if err := younger.Put([]byte("a"), []byte("younger")); !errors.Is(err, utils.ErrTransactionDeadlock) {
+		t.Fatalf("Expected ErrTransactionDeadlock, got %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("Expected the older transaction to proceed, got %v", err)
+	}
+	if err := older.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+}
+
+func TestDatabase_UpdateAndView(t *testing.T) {
+	config := DefaultConfig()
+	config.Transaction.RetryPolicy.MaxDelay = 5 * time.Millisecond
+	config.Transaction.RetryPolicy.InitialDelay = time.Millisecond
+	config.Transaction.DefaultIsolationLevel = "SERIALIZABLE"
+
+	db, err := Open(testDBPath(t), config)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+
+	// A conflicting write during the first attempt forces one retry
+	attempts := 0
+	err = db.Update(context.Background(), func(txn transaction.Transaction) error {
+		attempts++
+		if _, err := txn.Exists([]byte("counter")); err != nil {
+			return err
+		}
+		if attempts == 1 {
+			if err := db.Put([]byte("counter"), []byte("other")); err != nil {
+				return err
+			}
+		}
+		return txn.Put([]byte("counter"), []byte("1"))
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+
+	var value []byte
+	err = db.View(context.Background(), func(txn transaction.Transaction) error {
+		value, err = txn.Get([]byte("counter"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("View failed: %v", err)
+	}
+	if string(value) != "1" {
+		t.Errorf("Expected 1, got %s", value)
+	}
+
+	config = DefaultConfig()
+	config.Transaction.RetryPolicy.BackoffMultiplier = 0.5
+	if _, err := Open(testDBPath(t), config); !errors.Is(err, ErrInvalidRetryPolicy) {
+		t.Errorf("Expected ErrInvalidRetryPolicy, got %v", err)
+	}
+}
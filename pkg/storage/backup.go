@@ -0,0 +1,453 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/thromel/go-database/pkg/storage/file"
+	"github.com/thromel/go-database/pkg/storage/page"
+	"github.com/thromel/go-database/pkg/storage/wal"
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// backupMagic identifies a full backup stream written by
+// PersistentEngine.Backup, and incrementalMagic an incremental one written
+// by PersistentEngine.BackupIncremental.
+var (
+	backupMagic      = [8]byte{'G', 'O', 'D', 'B', 'B', 'A', 'C', 'K'}
+	incrementalMagic = [8]byte{'G', 'O', 'D', 'B', 'I', 'N', 'C', 'R'}
+)
+
+// backupFormatVersion is the version of the backup stream format.
+const backupFormatVersion = 1
+
+// Layout of a backup stream. The manifest comes first; an incremental
+// backup's manifest also records the LSN of the backup it builds on. A full
+// backup then holds the raw image of every page in order, while an
+// incremental one holds only the pages that changed, each preceded by its
+// page ID, and ends with backupEndMarker. A SHA-256 checksum of all that
+// precedes it closes the stream.
+const (
+	backupMagicOffset       = 0
+	backupVersionOffset     = 8
+	backupPageSizeOffset    = 12
+	backupPageCountOffset   = 16
+	backupLSNOffset         = 24
+	backupCreatedOffset     = 32
+	backupBaseLSNOffset     = 40
+	backupManifestSize      = 40
+	incrementalManifestSize = 48
+	backupPageIDSize        = 4
+	backupChecksumSize      = sha256.Size
+)
+
+// backupEndMarker takes the place of a page ID to end the pages of an
+// incremental backup.
+const backupEndMarker = ^uint32(0)
+
+// BackupManifest describes a backup. It is written at the start of the
+// backup stream.
+type BackupManifest struct {
+	// PageSize is the size of each page in bytes
+	PageSize int
+
+	// PageCount is the number of pages in the database file the backup
+	// restores, starting with the meta page
+	PageCount int64
+
+	// LSN is the log position the backup is consistent at: it holds every
+	// change logged before it and none logged after
+	LSN uint64
+
+	// Created is when the backup was taken
+	Created time.Time
+
+	// Incremental reports whether the backup holds only the pages changed
+	// since BaseLSN, rather than every page
+	Incremental bool
+
+	// BaseLSN is the LSN of the backup an incremental backup builds on
+	BaseLSN uint64
+}
+
+// encode returns the manifest as it is written to a backup stream.
+func (m *BackupManifest) encode() []byte {
+	magic, size := backupMagic, backupManifestSize
+	if m.Incremental {
+		magic, size = incrementalMagic, incrementalManifestSize
+	}
+
+	buf := make([]byte, size)
+	copy(buf[backupMagicOffset:], magic[:])
+	binary.LittleEndian.PutUint32(buf[backupVersionOffset:], backupFormatVersion)
+	binary.LittleEndian.PutUint32(buf[backupPageSizeOffset:], uint32(m.PageSize))   // #nosec G115 - bounded by page.MaxPageSize
+	binary.LittleEndian.PutUint64(buf[backupPageCountOffset:], uint64(m.PageCount)) // #nosec G115 - page counts are never negative
+	binary.LittleEndian.PutUint64(buf[backupLSNOffset:], m.LSN)
+	binary.LittleEndian.PutUint64(buf[backupCreatedOffset:], uint64(m.Created.UnixNano())) // #nosec G115 - round-trips through the cast below
+	if m.Incremental {
+		binary.LittleEndian.PutUint64(buf[backupBaseLSNOffset:], m.BaseLSN)
+	}
+	return buf
+}
+
+// ReadBackupManifest reads the manifest at the start of a backup stream, for
+// instance to find the LSN an incremental backup should build on. Only the
+// manifest is read; the rest of the stream is not checked.
+func ReadBackupManifest(r io.Reader) (*BackupManifest, error) {
+	buf := make([]byte, incrementalManifestSize)
+	if _, err := io.ReadFull(r, buf[:backupManifestSize]); err != nil {
+		return nil, fmt.Errorf("%w: failed to read manifest: %v", ErrBackupCorrupted, err)
+	}
+
+	m := &BackupManifest{}
+	var magic [8]byte
+	copy(magic[:], buf[backupMagicOffset:])
+	switch magic {
+	case backupMagic:
+	case incrementalMagic:
+		if _, err := io.ReadFull(r, buf[backupManifestSize:]); err != nil {
+			return nil, fmt.Errorf("%w: failed to read manifest: %v", ErrBackupCorrupted, err)
+		}
+		m.Incremental = true
+		m.BaseLSN = binary.LittleEndian.Uint64(buf[backupBaseLSNOffset:])
+	default:
+		return nil, fmt.Errorf("%w: bad magic %q", ErrBackupCorrupted, magic[:])
+	}
+
+	if version := binary.LittleEndian.Uint32(buf[backupVersionOffset:]); version != backupFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrBackupCorrupted, version)
+	}
+
+	m.PageSize = int(binary.LittleEndian.Uint32(buf[backupPageSizeOffset:]))
+	m.PageCount = int64(binary.LittleEndian.Uint64(buf[backupPageCountOffset:])) // #nosec G115 - checked below
+	m.LSN = binary.LittleEndian.Uint64(buf[backupLSNOffset:])
+	m.Created = time.Unix(0, int64(binary.LittleEndian.Uint64(buf[backupCreatedOffset:]))) // #nosec G115 - written from a signed value
+	if err := page.ValidatePageSize(m.PageSize); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackupCorrupted, err)
+	}
+	if m.PageCount < 1 {
+		return nil, fmt.Errorf("%w: page count %d", ErrBackupCorrupted, m.PageCount)
+	}
+
+	return m, nil
+}
+
+// Backup writes a consistent copy of the database to w while reads and
+// writes continue. A checkpoint first brings the database file up to date
+// and fixes the LSN the backup is taken at; a fence on the file then keeps
+// every page as it was at that point until it has been copied, however
+// much later writes change it. Pages overwritten before they are copied are
+// held in memory, so a backup of a busy database needs memory for them.
+//
+// The stream holds a manifest, the pages and a checksum; RestoreBackup turns
+// it back into a database file. ctx is checked before each page is copied.
+func (pe *PersistentEngine) Backup(ctx context.Context, w io.Writer) (*BackupManifest, error) {
+	return pe.backup(ctx, w, false, 0)
+}
+
+// BackupIncremental writes the pages that changed after the backup taken at
+// LSN since, which may itself be incremental, in the same way Backup writes
+// every page. When since is the LSN of the last backup this engine took,
+// only the pages written since that backup's fence are read. Otherwise,
+// such as for the first backup after the database is opened, every page is
+// read, and the LSN it records of the last logged change to it decides
+// whether it is written; pages without an LSN, which were never written
+// through the log, are always included. That costs as much I/O as a full
+// backup, so incremental backups are best taken from one open engine.
+//
+// RestoreBackupChain applies the result on top of the backup it builds on.
+func (pe *PersistentEngine) BackupIncremental(ctx context.Context, w io.Writer, since uint64) (*BackupManifest, error) {
+	return pe.backup(ctx, w, true, since)
+}
+
+// backup writes a full or incremental backup to w.
+func (pe *PersistentEngine) backup(ctx context.Context, w io.Writer, incremental bool, since uint64) (*BackupManifest, error) {
+	if pe.closed.Load() {
+		return nil, utils.ErrDatabaseClosed
+	}
+
+	fence, manifest, lastLSN, err := pe.setBackupFence()
+	if err != nil {
+		return nil, err
+	}
+	defer fence.Release()
+
+	ids := make([]page.PageID, manifest.PageCount)
+	for id := range ids {
+		ids[id] = page.PageID(id) // #nosec G115 - page IDs fit in 32 bits
+	}
+	if incremental {
+		if since > manifest.LSN {
+			return nil, fmt.Errorf("%w: base LSN %d is past the database's LSN %d", ErrBackupChainBroken, since, manifest.LSN)
+		}
+		manifest.Incremental, manifest.BaseLSN = true, since
+
+		// Pages not written since the last backup are as it left them
+		if changed, ok := fence.Changed(); ok && since == lastLSN {
+			ids = changed
+		}
+	}
+
+	hash := sha256.New()
+	out := io.MultiWriter(w, hash)
+
+	if _, err := out.Write(manifest.encode()); err != nil {
+		return nil, fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+
+	var pg page.Page
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		data, err := fence.ReadPage(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read page %d: %w", id, err)
+		}
+
+		if incremental {
+			if err := pg.DeserializeUnverified(data); err != nil {
+				return nil, fmt.Errorf("failed to read page %d: %w", id, err)
+			}
+			if lsn := pg.LSN(); lsn != 0 && lsn <= since {
+				continue
+			}
+			if _, err := out.Write(binary.LittleEndian.AppendUint32(nil, uint32(id))); err != nil {
+				return nil, fmt.Errorf("failed to write page %d: %w", id, err)
+			}
+		}
+
+		if _, err := out.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to write page %d: %w", id, err)
+		}
+	}
+
+	if incremental {
+		if _, err := out.Write(binary.LittleEndian.AppendUint32(nil, backupEndMarker)); err != nil {
+			return nil, fmt.Errorf("failed to write backup: %w", err)
+		}
+	}
+
+	if _, err := w.Write(hash.Sum(nil)); err != nil {
+		return nil, fmt.Errorf("failed to write backup checksum: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// setBackupFence checkpoints the database and sets a fence over the pages in
+// use, returning it with the manifest of the backup it starts and the LSN of
+// the backup before it, whose fence's changes the new fence records.
+func (pe *PersistentEngine) setBackupFence() (*file.Fence, *BackupManifest, uint64, error) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	if pe.closed.Load() {
+		return nil, nil, 0, utils.ErrDatabaseClosed
+	}
+
+	// After a checkpoint the file holds every logged change, and nothing
+	// changes it until the lock is released
+	if err := pe.syncInternal(); err != nil {
+		return nil, nil, 0, fmt.Errorf("checkpoint failed: %w", err)
+	}
+
+	// Pages past the last one allocated are preallocated space
+	pageCount := min(int64(pe.pageManager.GetNextPageID()), pe.fileManager.GetPageCount())
+	fence, err := pe.fileManager.SetFence(pageCount)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to set backup fence: %w", err)
+	}
+
+	manifest := &BackupManifest{
+		PageSize:  pe.fileManager.PageSize(),
+		PageCount: pageCount,
+		LSN:       pe.wal.EndLSN(),
+		Created:   time.Now(),
+	}
+	lastLSN := pe.fenceLSN
+	pe.fenceLSN = manifest.LSN
+
+	return fence, manifest, lastLSN, nil
+}
+
+// RestoreBackup recreates a database from a full backup stream written by
+// PersistentEngine.Backup, and returns the backup's manifest. It is
+// RestoreBackupChain with no incremental backups.
+func RestoreBackup(r io.Reader, path string) (*BackupManifest, error) {
+	return RestoreBackupChain(path, r)
+}
+
+// RestoreBackupChain recreates a database from a full backup followed by
+// incremental backups, applied in order, and returns the manifest of the
+// last one. Each incremental backup must build on a backup no later than
+// the one before it in the chain, and be taken no earlier.
+//
+// The database file is created at path, with the default extension added
+// if it has none, together with an empty write-ahead log that continues
+// from the restored LSN; neither may exist yet. Every checksum is verified
+// before the file is put in place, so a damaged or truncated backup, or a
+// broken chain, leaves nothing behind.
+func RestoreBackupChain(path string, backups ...io.Reader) (*BackupManifest, error) {
+	if len(backups) == 0 {
+		return nil, fmt.Errorf("%w: no backups to restore", ErrBackupChainBroken)
+	}
+
+	if filepath.Ext(path) == "" {
+		path += file.DatabaseFileExtension
+	}
+	walDir := path + wal.DirExtension
+
+	for _, p := range []string{path, walDir} {
+		if _, err := os.Lstat(p); err == nil {
+			return nil, fmt.Errorf("cannot restore over %s: %w", p, os.ErrExist)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to check %s: %w", p, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), file.DefaultDirMode); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmpPath := path + ".restore"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, file.DefaultFileMode) // #nosec G304 - path is chosen by the caller
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database file: %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+	}()
+
+	var restored *BackupManifest
+	for i, r := range backups {
+		manifest, err := applyBackup(tmp, r, restored)
+		if err != nil {
+			return nil, fmt.Errorf("backup %d of %d: %w", i+1, len(backups), err)
+		}
+		restored = manifest
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync database file: %w", err)
+	}
+	// A double-write file without a database is left over from a deleted
+	// one, and must not be applied to the restored file
+	if err := os.Remove(path + file.DoubleWriteExtension); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale double-write file: %w", err)
+	}
+	if err := wal.Create(walDir, restored.LSN); err != nil {
+		return nil, fmt.Errorf("failed to create write-ahead log: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.RemoveAll(walDir)
+		return nil, fmt.Errorf("failed to move database file into place: %w", err)
+	}
+
+	return restored, nil
+}
+
+// applyBackup applies one backup stream of a chain to the database file
+// being restored, on top of the backup restored so far (nil before the
+// full backup that starts the chain).
+func applyBackup(f *os.File, r io.Reader, restored *BackupManifest) (*BackupManifest, error) {
+	hash := sha256.New()
+	in := io.TeeReader(r, hash)
+
+	manifest, err := ReadBackupManifest(in)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case restored == nil && manifest.Incremental:
+		return nil, fmt.Errorf("%w: the chain must start with a full backup", ErrBackupChainBroken)
+	case restored != nil && !manifest.Incremental:
+		return nil, fmt.Errorf("%w: a full backup can only start the chain", ErrBackupChainBroken)
+	case restored != nil && manifest.PageSize != restored.PageSize:
+		return nil, fmt.Errorf("%w: incremental backup of %d-byte pages follows a backup of %d-byte pages",
+			ErrBackupChainBroken, manifest.PageSize, restored.PageSize)
+	case restored != nil && (manifest.BaseLSN > restored.LSN || manifest.LSN < restored.LSN):
+		return nil, fmt.Errorf("%w: incremental backup from LSN %d to %d does not follow a backup at LSN %d",
+			ErrBackupChainBroken, manifest.BaseLSN, manifest.LSN, restored.LSN)
+	}
+
+	if manifest.Incremental {
+		err = applyPages(f, in, manifest)
+	} else {
+		err = copyPages(f, in, manifest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := make([]byte, backupChecksumSize)
+	if _, err := io.ReadFull(r, checksum); err != nil {
+		return nil, fmt.Errorf("%w: failed to read checksum: %v", ErrBackupCorrupted, err)
+	}
+	if !bytes.Equal(checksum, hash.Sum(nil)) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrBackupCorrupted)
+	}
+
+	return manifest, nil
+}
+
+// copyPages writes the pages of a full backup to the start of f.
+func copyPages(f *os.File, r io.Reader, manifest *BackupManifest) error {
+	size := manifest.PageCount * int64(manifest.PageSize)
+	if n, err := io.CopyN(f, r, size); err != nil {
+		if n < size && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+			return fmt.Errorf("%w: truncated after %d of %d bytes", ErrBackupCorrupted, n, size)
+		}
+		return fmt.Errorf("failed to write database file: %w", err)
+	}
+	return nil
+}
+
+// applyPages writes the pages of an incremental backup over those in f,
+// and resizes f to the backup's page count.
+func applyPages(f *os.File, r io.Reader, manifest *BackupManifest) error {
+	id := make([]byte, backupPageIDSize)
+	data := make([]byte, manifest.PageSize)
+	for {
+		if _, err := io.ReadFull(r, id); err != nil {
+			return fmt.Errorf("%w: failed to read page ID: %v", ErrBackupCorrupted, err)
+		}
+		pageID := binary.LittleEndian.Uint32(id)
+		if pageID == backupEndMarker {
+			break
+		}
+		if int64(pageID) >= manifest.PageCount {
+			return fmt.Errorf("%w: page %d is past the %d pages in the backup", ErrBackupCorrupted, pageID, manifest.PageCount)
+		}
+
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("%w: failed to read page %d: %v", ErrBackupCorrupted, pageID, err)
+		}
+		if _, err := f.WriteAt(data, int64(pageID)*int64(manifest.PageSize)); err != nil {
+			return fmt.Errorf("failed to write page %d: %w", pageID, err)
+		}
+	}
+
+	// The database may have grown or been compacted since the last backup
+	if err := f.Truncate(manifest.PageCount * int64(manifest.PageSize)); err != nil {
+		return fmt.Errorf("failed to resize database file: %w", err)
+	}
+	return nil
+}
+
+// ErrBackupCorrupted is returned when a backup stream is malformed or fails
+// its checksum.
+var ErrBackupCorrupted = errors.New("backup corrupted")
+
+// ErrBackupChainBroken is returned when backups are restored in an order in
+// which they do not build on each other.
+var ErrBackupChainBroken = errors.New("backup chain is broken")
@@ -0,0 +1,430 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// hookWriter buffers what is written to it and runs hook once, after the
+// given number of writes.
+type hookWriter struct {
+	bytes.Buffer
+	writes int
+	after  int
+	hook   func()
+}
+
+func (w *hookWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes == w.after && w.hook != nil {
+		w.hook()
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestPersistentEngine_Backup(t *testing.T) {
+	config := compactTestConfig(t)
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	fillAndPurge(t, engine)
+
+	// Partway through the backup, change every key, add one and compact,
+	// which moves pages and truncates the file
+	w := &hookWriter{after: 10, hook: func() {
+		for i := 0; i < 2000; i += 5 {
+			if err := engine.Put(recoveryKey(i), []byte("changed")); err != nil {
+				t.Errorf("Failed to put during backup: %v", err)
+			}
+		}
+		if err := engine.Put(recoveryKey(5000), []byte("new")); err != nil {
+			t.Errorf("Failed to put during backup: %v", err)
+		}
+		if _, err := engine.Compact(context.Background(), nil); err != nil {
+			t.Errorf("Failed to compact during backup: %v", err)
+		}
+	}}
+	manifest, err := engine.Backup(context.Background(), w)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if w.writes < w.after {
+		t.Fatalf("Expected the backup to take more than %d writes, got %d", w.after, w.writes)
+	}
+	if want := backupManifestSize + manifest.PageCount*page.PageSize + backupChecksumSize; int64(w.Len()) != want {
+		t.Errorf("Expected a %d-byte backup, got %d", want, w.Len())
+	}
+	if value, err := engine.Get(recoveryKey(0)); err != nil || string(value) != "changed" {
+		t.Errorf("Expected the writes during the backup to apply, got %q: %v", value, err)
+	}
+
+	// The restored database is the one from before the writes
+	restoredPath := filepath.Join(t.TempDir(), "restored.godb")
+	restoredManifest, err := RestoreBackup(bytes.NewReader(w.Bytes()), restoredPath)
+	if err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if restoredManifest.PageCount != manifest.PageCount || restoredManifest.LSN != manifest.LSN ||
+		!restoredManifest.Created.Equal(manifest.Created) {
+		t.Errorf("Expected manifest %+v, got %+v", manifest, restoredManifest)
+	}
+
+	restoredConfig := compactTestConfig(t)
+	restoredConfig.FilePath = restoredPath
+	restored, err := NewPersistentEngine(restoredConfig)
+	if err != nil {
+		t.Fatalf("Failed to open restored database: %v", err)
+	}
+	checkPurged(t, restored)
+	if _, err := restored.Get(recoveryKey(5000)); !errors.Is(err, utils.ErrKeyNotFound) {
+		t.Errorf("Expected a key added during the backup to be missing, got %v", err)
+	}
+
+	// The restored log continues past the LSNs in the restored pages, so
+	// its records are replayed after a crash
+	if err := restored.Put(recoveryKey(1), []byte("after restore")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	simulateCrash(restored)
+
+	restored, err = NewPersistentEngine(restoredConfig)
+	if err != nil {
+		t.Fatalf("Failed to reopen restored database: %v", err)
+	}
+	defer restored.Close()
+	if value, err := restored.Get(recoveryKey(1)); err != nil || string(value) != "after restore" {
+		t.Errorf("Expected the write after the restore to be recovered, got %q: %v", value, err)
+	}
+}
+
+func TestPersistentEngine_BackupErrors(t *testing.T) {
+	engine, err := NewPersistentEngine(compactTestConfig(t))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := engine.Put(recoveryKey(i), compactValue(i)); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	var backup bytes.Buffer
+	if _, err := engine.Backup(context.Background(), &backup); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := engine.Backup(ctx, &bytes.Buffer{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	dir := t.TempDir()
+	damaged := bytes.Clone(backup.Bytes())
+	damaged[backupManifestSize+page.PageSize+100] ^= 0xFF
+	truncated := backup.Bytes()[:backup.Len()-page.PageSize]
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"damaged", damaged},
+		{"truncated", truncated},
+		{"missing checksum", backup.Bytes()[:backup.Len()-backupChecksumSize]},
+		{"empty", nil},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".godb")
+		if _, err := RestoreBackup(bytes.NewReader(tt.data), path); !errors.Is(err, ErrBackupCorrupted) {
+			t.Errorf("%s: expected ErrBackupCorrupted, got %v", tt.name, err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%s: expected nothing to be left behind, got %d files", tt.name, len(entries))
+		}
+	}
+
+	path := filepath.Join(dir, "restored.godb")
+	if _, err := RestoreBackup(bytes.NewReader(backup.Bytes()), path); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if _, err := RestoreBackup(bytes.NewReader(backup.Bytes()), path); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Expected restoring over a database to fail with os.ErrExist, got %v", err)
+	}
+
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+	if _, err := engine.Backup(context.Background(), &bytes.Buffer{}); !errors.Is(err, utils.ErrDatabaseClosed) {
+		t.Errorf("Expected ErrDatabaseClosed, got %v", err)
+	}
+}
+
+// engineContents returns every key and value in the engine.
+func engineContents(t *testing.T, engine *PersistentEngine) map[string]string {
+	t.Helper()
+
+	contents := make(map[string]string)
+	it := engine.NewIterator(nil, nil)
+	defer it.Close()
+	for it.Next() {
+		contents[string(it.Key())] = string(it.Value())
+	}
+	if it.Error() != nil {
+		t.Fatalf("Failed to iterate: %v", it.Error())
+	}
+	return contents
+}
+
+// checkRestore restores a backup chain into a new database and verifies that
+// it holds exactly the expected contents.
+func checkRestore(t *testing.T, want map[string]string, backups ...*bytes.Buffer) {
+	t.Helper()
+
+	readers := make([]io.Reader, len(backups))
+	for i, backup := range backups {
+		readers[i] = bytes.NewReader(backup.Bytes())
+	}
+	config := compactTestConfig(t)
+	if _, err := RestoreBackupChain(config.FilePath, readers...); err != nil {
+		t.Fatalf("Failed to restore %d backups: %v", len(backups), err)
+	}
+
+	restored, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to open restored database: %v", err)
+	}
+	defer restored.Close()
+
+	got := engineContents(t, restored)
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d keys after restoring %d backups, got %d", len(want), len(backups), len(got))
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Fatalf("Unexpected value for %s after restoring %d backups", key, len(backups))
+		}
+	}
+}
+
+func TestPersistentEngine_BackupIncremental(t *testing.T) {
+	engine, err := NewPersistentEngine(compactTestConfig(t))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	put := func(i int, value []byte) {
+		t.Helper()
+		if err := engine.Put(recoveryKey(i), value); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	for i := 0; i < 2000; i++ {
+		put(i, compactValue(i))
+	}
+
+	var full bytes.Buffer
+	fullManifest, err := engine.Backup(context.Background(), &full)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	afterFull := engineContents(t, engine)
+
+	// A few changes give a small incremental backup
+	for i := 1; i < 2000; i += 400 {
+		put(i, []byte("changed"))
+	}
+	var first bytes.Buffer
+	firstManifest, err := engine.BackupIncremental(context.Background(), &first, fullManifest.LSN)
+	if err != nil {
+		t.Fatalf("Failed to take incremental backup: %v", err)
+	}
+	if !firstManifest.Incremental || firstManifest.BaseLSN != fullManifest.LSN {
+		t.Errorf("Unexpected incremental manifest %+v", firstManifest)
+	}
+	if first.Len() > full.Len()/20 {
+		t.Errorf("Expected a small incremental backup, got %d bytes for a %d-byte full one", first.Len(), full.Len())
+	}
+	afterFirst := engineContents(t, engine)
+
+	// Compaction shrinks the file; the next backup shrinks it too
+	for i := 0; i < 2000; i++ {
+		if i%5 != 0 {
+			if err := engine.Delete(recoveryKey(i)); err != nil {
+				t.Fatalf("Failed to delete: %v", err)
+			}
+		}
+	}
+	if _, err := engine.Compact(context.Background(), nil); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	var second bytes.Buffer
+	secondManifest, err := engine.BackupIncremental(context.Background(), &second, firstManifest.LSN)
+	if err != nil {
+		t.Fatalf("Failed to take incremental backup: %v", err)
+	}
+	if secondManifest.PageCount >= firstManifest.PageCount {
+		t.Errorf("Expected fewer than %d pages after compaction, got %d", firstManifest.PageCount, secondManifest.PageCount)
+	}
+	afterSecond := engineContents(t, engine)
+
+	// The file grows again, with writes continuing during the backup
+	for i := 2000; i < 2500; i++ {
+		put(i, compactValue(i))
+	}
+	afterThird := engineContents(t, engine)
+	third := &hookWriter{after: 2, hook: func() {
+		for i := 0; i < 2500; i += 7 {
+			put(i, []byte("during backup"))
+		}
+	}}
+	if _, err := engine.BackupIncremental(context.Background(), third, secondManifest.LSN); err != nil {
+		t.Fatalf("Failed to take incremental backup: %v", err)
+	}
+
+	checkRestore(t, afterFull, &full)
+	checkRestore(t, afterFirst, &full, &first)
+	checkRestore(t, afterSecond, &full, &first, &second)
+	checkRestore(t, afterThird, &full, &first, &second, &third.Buffer)
+
+	// An incremental backup may build on an earlier backup than the last
+	// one restored, as long as it leaves no gap
+	var since bytes.Buffer
+	if _, err := engine.BackupIncremental(context.Background(), &since, fullManifest.LSN); err != nil {
+		t.Fatalf("Failed to take incremental backup: %v", err)
+	}
+	checkRestore(t, engineContents(t, engine), &full, &first, &since)
+
+	if _, err := engine.BackupIncremental(context.Background(), &bytes.Buffer{}, 1<<62); !errors.Is(err, ErrBackupChainBroken) {
+		t.Errorf("Expected a base LSN in the future to be rejected, got %v", err)
+	}
+
+	damaged := bytes.Clone(second.Bytes())
+	damaged[incrementalManifestSize+backupPageIDSize+100] ^= 0xFF
+	resized := bytes.Clone(first.Bytes())
+	binary.LittleEndian.PutUint32(resized[backupPageSizeOffset:], 4096)
+	tests := []struct {
+		name    string
+		backups []*bytes.Buffer
+		want    error
+	}{
+		{"gap", []*bytes.Buffer{&full, &second}, ErrBackupChainBroken},
+		{"out of order", []*bytes.Buffer{&full, &second, &first}, ErrBackupChainBroken},
+		{"incremental first", []*bytes.Buffer{&first}, ErrBackupChainBroken},
+		{"two full", []*bytes.Buffer{&full, &full}, ErrBackupChainBroken},
+		{"page size", []*bytes.Buffer{&full, bytes.NewBuffer(resized)}, ErrBackupChainBroken},
+		{"damaged", []*bytes.Buffer{&full, &first, bytes.NewBuffer(damaged)}, ErrBackupCorrupted},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		readers := make([]io.Reader, len(tt.backups))
+		for i, backup := range tt.backups {
+			readers[i] = bytes.NewReader(backup.Bytes())
+		}
+		if _, err := RestoreBackupChain(filepath.Join(dir, "restored.godb"), readers...); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%s: expected nothing to be left behind, got %d files", tt.name, len(entries))
+		}
+	}
+
+	manifest, err := ReadBackupManifest(bytes.NewReader(second.Bytes()))
+	if err != nil || manifest.LSN != secondManifest.LSN || manifest.BaseLSN != firstManifest.LSN || !manifest.Incremental {
+		t.Errorf("Expected to read manifest %+v, got %+v: %v", secondManifest, manifest, err)
+	}
+}
+
+func TestPersistentEngine_BackupIncrementalReads(t *testing.T) {
+	config := compactTestConfig(t)
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	for i := 0; i < 2000; i++ {
+		if err := engine.Put(recoveryKey(i), compactValue(i)); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	var full bytes.Buffer
+	fullManifest, err := engine.Backup(context.Background(), &full)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+
+	// backupReads takes an incremental backup and returns it with the
+	// number of pages it read from the file
+	backupReads := func(engine *PersistentEngine, since uint64) (*bytes.Buffer, *BackupManifest, int64) {
+		t.Helper()
+		if err := engine.Sync(); err != nil {
+			t.Fatalf("Failed to sync: %v", err)
+		}
+		reads := engine.fileManager.GetStatistics().TotalReads
+		var backup bytes.Buffer
+		manifest, err := engine.BackupIncremental(context.Background(), &backup, since)
+		if err != nil {
+			t.Fatalf("Failed to take incremental backup: %v", err)
+		}
+		return &backup, manifest, engine.fileManager.GetStatistics().TotalReads - reads
+	}
+
+	// Only the pages written since the last backup are read
+	if err := engine.Put(recoveryKey(7), []byte("changed")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	first, firstManifest, reads := backupReads(engine, fullManifest.LSN)
+	if reads > fullManifest.PageCount/10 {
+		t.Errorf("Expected few of %d pages to be read, got %d", fullManifest.PageCount, reads)
+	}
+
+	// Nothing is known of the changes before the engine was opened, so
+	// every page is read
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if engine, err = NewPersistentEngine(config); err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+	if err := engine.Put(recoveryKey(8), []byte("changed")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	second, secondManifest, reads := backupReads(engine, firstManifest.LSN)
+	if reads < secondManifest.PageCount {
+		t.Errorf("Expected all %d pages to be read, got %d", secondManifest.PageCount, reads)
+	}
+	if second.Len() > full.Len()/10 {
+		t.Errorf("Expected a small incremental backup, got %d bytes for a %d-byte full one", second.Len(), full.Len())
+	}
+
+	// An older base than the last backup is read in full too
+	if err := engine.Put(recoveryKey(9), []byte("changed")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	third, thirdManifest, reads := backupReads(engine, firstManifest.LSN)
+	if reads < thirdManifest.PageCount {
+		t.Errorf("Expected all %d pages to be read, got %d", thirdManifest.PageCount, reads)
+	}
+	checkRestore(t, engineContents(t, engine), &full, first, third)
+
+	// From then on, the changes are known again
+	if err := engine.Put(recoveryKey(10), []byte("changed")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	fourth, _, reads := backupReads(engine, thirdManifest.LSN)
+	if reads > thirdManifest.PageCount/10 {
+		t.Errorf("Expected few of %d pages to be read, got %d", thirdManifest.PageCount, reads)
+	}
+	checkRestore(t, engineContents(t, engine), &full, first, third, fourth)
+}
@@ -0,0 +1,68 @@
+package storage
+
+// WriteBatch collects puts and deletes that a storage engine applies
+// atomically with Write: either every change becomes visible or none does.
+type WriteBatch struct {
+	ops  []batchOp
+	size int
+}
+
+// batchOp is a single change recorded in a write batch.
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// NewWriteBatch creates an empty write batch.
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{}
+}
+
+// Put records that key should be set to value. The key and value are copied;
+// a nil value stays nil so that the engine rejects it.
+func (b *WriteBatch) Put(key, value []byte) {
+	op := batchOp{key: append([]byte(nil), key...)}
+	if value != nil {
+		op.value = append([]byte{}, value...)
+	}
+	b.ops = append(b.ops, op)
+	b.size += len(key) + len(value)
+}
+
+// Delete records that key should be removed. Deleting a key that does not
+// exist when the batch is applied is not an error.
+func (b *WriteBatch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{
+		key:    append([]byte(nil), key...),
+		delete: true,
+	})
+	b.size += len(key)
+}
+
+// Len returns the number of changes in the batch.
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+// Size returns the number of key and value bytes in the batch.
+func (b *WriteBatch) Size() int {
+	return b.size
+}
+
+// Reset removes all changes from the batch so it can be reused.
+func (b *WriteBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
+
+// ForEach calls fn for every change in the order it was recorded; value is
+// nil for deletes. Iteration stops at the first error, which is returned.
+func (b *WriteBatch) ForEach(fn func(key, value []byte, deleted bool) error) error {
+	for _, op := range b.ops {
+		if err := fn(op.key, op.value, op.delete); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,6 +5,8 @@ package btree
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"sync"
 
 	"github.com/thromel/go-database/pkg/storage/page"
@@ -19,40 +21,58 @@ type BPlusTree struct {
 
 	// Tree metadata
 	numKeys         int64 // Total number of keys in the tree
-	branchingFactor int   // Maximum number of children per internal node
-	leafCapacity    int   // Maximum number of entries per leaf node
+	branchingFactor int   // Maximum number of children per internal node, or 0 for no limit
+	leafCapacity    int   // Maximum number of entries per leaf node, or 0 for no limit
 
 	// Page management
-	pageManager *page.Manager // Page allocation and management
+	pageManager page.Store // Page allocation and management
+	pageSize    int        // Size of the store's pages in bytes
 
 	// Concurrency control
 	treeLatch sync.RWMutex // Protects tree structure modifications
+	modCount  uint64       // Number of modifications, so cursors can detect them
 
 	// Configuration
-	maxKeySize   int // Maximum size of a key in bytes
-	maxValueSize int // Maximum size of a value in bytes
+	maxKeySize         int     // Maximum size of a key in bytes
+	maxValueSize       int     // Maximum size of a value in bytes
+	maxInlineValueSize int     // Maximum size of a value kept in its leaf
+	fillFactor         float64 // Fraction of each page BulkLoad fills
 }
 
-// Config holds configuration options for B+ Tree creation.
+// Config holds configuration options for B+ Tree creation. Nodes hold as
+// many entries as fit in their pages; BranchingFactor and LeafCapacity only
+// add a further limit on the number of entries when they are nonzero.
 type Config struct {
-	BranchingFactor int // Number of children per internal node (default: 128)
-	LeafCapacity    int // Number of entries per leaf node (default: 64)
+	BranchingFactor int // Maximum children per internal node (default: 0, no limit)
+	LeafCapacity    int // Maximum entries per leaf node (default: 0, no limit)
 	MaxKeySize      int // Maximum key size in bytes (default: 1024)
 	MaxValueSize    int // Maximum value size in bytes (default: 4096)
+
+	// MaxInlineValueSize is the largest value kept in its leaf. Larger
+	// values are stored in chains of overflow pages. Zero keeps every value
+	// inline, so MaxValueSize must then fit in a leaf.
+	MaxInlineValueSize int
+
+	// FillFactor is the fraction of each page BulkLoad fills, leaving the
+	// rest for later inserts. Zero means 0.9.
+	FillFactor float64
 }
 
 // DefaultConfig returns the default B+ Tree configuration.
 func DefaultConfig() *Config {
 	return &Config{
-		BranchingFactor: 64,  // Reasonable for 8KB pages
-		LeafCapacity:    32,  // Conservative to ensure it fits
-		MaxKeySize:      64,  // Smaller key size for testing
-		MaxValueSize:    128, // Smaller value size for testing
+		BranchingFactor:    0,        // Limited by page space only
+		LeafCapacity:       0,        // Limited by page space only
+		MaxKeySize:         64,       // Smaller key size for testing
+		MaxValueSize:       16 << 20, // Larger values go to overflow pages
+		MaxInlineValueSize: 128,      // Smaller value size for testing
+		FillFactor:         defaultFillFactor,
 	}
 }
 
-// NewBPlusTree creates a new B+ Tree with the given configuration.
-func NewBPlusTree(pageManager *page.Manager, config *Config) (*BPlusTree, error) {
+// NewBPlusTree creates a new B+ Tree with the given configuration. Nodes are
+// allocated from and written through the given page store.
+func NewBPlusTree(pageManager page.Store, config *Config) (*BPlusTree, error) {
 	if pageManager == nil {
 		return nil, errors.New("page manager cannot be nil")
 	}
@@ -62,7 +82,7 @@ func NewBPlusTree(pageManager *page.Manager, config *Config) (*BPlusTree, error)
 	}
 
 	// Validate configuration
-	if err := validateConfig(config); err != nil {
+	if err := validateConfig(config, pageManager.PageSize()); err != nil {
 		return nil, err
 	}
 
@@ -73,9 +93,12 @@ func NewBPlusTree(pageManager *page.Manager, config *Config) (*BPlusTree, error)
 		branchingFactor: config.BranchingFactor,
 		leafCapacity:    config.LeafCapacity,
 		pageManager:     pageManager,
+		pageSize:        pageManager.PageSize(),
 		maxKeySize:      config.MaxKeySize,
 		maxValueSize:    config.MaxValueSize,
+		fillFactor:      config.FillFactor,
 	}
+	tree.maxInlineValueSize = inlineLimit(config)
 
 	// Create initial root leaf page
 	if err := tree.initializeRoot(); err != nil {
@@ -85,12 +108,64 @@ func NewBPlusTree(pageManager *page.Manager, config *Config) (*BPlusTree, error)
 	return tree, nil
 }
 
-// validateConfig validates the B+ Tree configuration parameters.
-func validateConfig(config *Config) error {
-	if config.BranchingFactor < 3 {
+// OpenBPlusTree reopens an existing B+ Tree whose root and shape are
+// described by meta. No pages are allocated.
+func OpenBPlusTree(pageManager page.Store, config *Config, meta Meta) (*BPlusTree, error) {
+	if pageManager == nil {
+		return nil, errors.New("page manager cannot be nil")
+	}
+
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	if err := validateConfig(config, pageManager.PageSize()); err != nil {
+		return nil, err
+	}
+
+	if meta.Root == page.InvalidPageID {
+		return nil, errors.New("tree metadata has no root page")
+	}
+
+	if meta.Height < 0 || meta.NumKeys < 0 {
+		return nil, ErrTreeCorrupted
+	}
+
+	// Make sure the root is actually reachable before handing out the tree
+	if _, err := pageManager.GetPage(meta.Root); err != nil {
+		return nil, err
+	}
+
+	return &BPlusTree{
+		root:               meta.Root,
+		height:             meta.Height,
+		numKeys:            meta.NumKeys,
+		branchingFactor:    config.BranchingFactor,
+		leafCapacity:       config.LeafCapacity,
+		pageManager:        pageManager,
+		pageSize:           pageManager.PageSize(),
+		maxKeySize:         config.MaxKeySize,
+		maxValueSize:       config.MaxValueSize,
+		maxInlineValueSize: inlineLimit(config),
+		fillFactor:         config.FillFactor,
+	}, nil
+}
+
+// inlineLimit returns the largest value a configuration keeps in its leaf.
+func inlineLimit(config *Config) int {
+	if config.MaxInlineValueSize == 0 || config.MaxInlineValueSize > config.MaxValueSize {
+		return config.MaxValueSize
+	}
+	return config.MaxInlineValueSize
+}
+
+// validateConfig validates the B+ Tree configuration parameters for pages
+// of the given size.
+func validateConfig(config *Config, pageSize int) error {
+	if config.BranchingFactor != 0 && config.BranchingFactor < 3 {
 		return errors.New("branching factor must be at least 3")
 	}
-	if config.LeafCapacity < 2 {
+	if config.LeafCapacity != 0 && config.LeafCapacity < 2 {
 		return errors.New("leaf capacity must be at least 2")
 	}
 	if config.MaxKeySize <= 0 {
@@ -99,19 +174,32 @@ func validateConfig(config *Config) error {
 	if config.MaxValueSize <= 0 {
 		return errors.New("max value size must be positive")
 	}
+	if config.MaxInlineValueSize < 0 {
+		return errors.New("max inline value size must not be negative")
+	}
+	if config.FillFactor < 0 || config.FillFactor > 1 {
+		return errors.New("fill factor must be between 0 and 1")
+	}
 
-	// Check if entries can fit in a page
-	// Each leaf entry needs: key length (4) + key data + value length (4) + value data
-	estimatedLeafEntrySize := 4 + config.MaxKeySize + 4 + config.MaxValueSize
-	availableSpace := page.PageSize - page.PageHeaderSize - 100 // Reserve 100 bytes for node metadata
-	if estimatedLeafEntrySize*config.LeafCapacity > availableSpace {
-		return errors.New("leaf capacity too high for page size")
+	// A page must hold a few of the largest entries so that splitting a
+	// node always leaves both halves with room to spare.
+	// Each leaf entry needs: slot + key length (2) + key data + value tag (1) +
+	// value data, where the value data is at most the inline limit or an
+	// overflow reference
+	maxLeafValueSize := inlineLimit(config)
+	if maxLeafValueSize < config.MaxValueSize {
+		maxLeafValueSize = max(maxLeafValueSize, overflowRefSize)
+	}
+	availableSpace := pageSize - page.PageHeaderSize
+	leafEntrySize := page.SlotSize + leafCellHeader + config.MaxKeySize + 1 + maxLeafValueSize
+	if leafEntrySize*minNodeEntries > availableSpace {
+		return errors.New("entries too large for page size")
 	}
 
-	// Each internal entry needs: key length (4) + key data + child PageID (8)
-	estimatedInternalEntrySize := 4 + config.MaxKeySize + 8
-	if estimatedInternalEntrySize*config.BranchingFactor > availableSpace {
-		return errors.New("branching factor too high for page size")
+	// Each internal entry needs: slot + child PageID (4) + key data
+	internalEntrySize := page.SlotSize + internalCellHeader + config.MaxKeySize
+	if internalEntrySize*minNodeEntries > availableSpace {
+		return errors.New("keys too large for page size")
 	}
 
 	return nil
@@ -136,6 +224,24 @@ func (bt *BPlusTree) initializeRoot() error {
 	return nil
 }
 
+// leafLimit returns the maximum number of entries per leaf, not counting the
+// page space they take.
+func (bt *BPlusTree) leafLimit() int {
+	if bt.leafCapacity == 0 {
+		return math.MaxInt
+	}
+	return bt.leafCapacity
+}
+
+// internalLimit returns the maximum number of children per internal node,
+// not counting the page space they take.
+func (bt *BPlusTree) internalLimit() int {
+	if bt.branchingFactor == 0 {
+		return math.MaxInt
+	}
+	return bt.branchingFactor
+}
+
 // Get retrieves the value associated with the given key.
 // Returns ErrKeyNotFound if the key doesn't exist.
 func (bt *BPlusTree) Get(key []byte) ([]byte, error) {
@@ -150,29 +256,19 @@ func (bt *BPlusTree) Get(key []byte) ([]byte, error) {
 	defer bt.treeLatch.RUnlock()
 
 	// Find the leaf node containing the key
-	leafPageID, err := bt.findLeafPage(key)
-	if err != nil {
-		return nil, err
-	}
-
-	// Search within the leaf node
-	leafPage, err := bt.pageManager.GetPage(leafPageID)
-	if err != nil {
-		return nil, err
-	}
-
-	node, err := bt.deserializeNode(leafPage)
+	leaf, err := bt.findLeaf(key)
 	if err != nil {
 		return nil, err
 	}
 
 	// Binary search for the key in the leaf node
-	value, found := node.findValue(key)
+	index, found := leaf.search(key)
 	if !found {
 		return nil, ErrKeyNotFound
 	}
 
-	return value, nil
+	// The stored value refers to the page, so load from a copy
+	return bt.loadValue(append([]byte{}, leaf.value(index)...))
 }
 
 // Put inserts or updates a key-value pair in the B+ Tree.
@@ -189,28 +285,42 @@ func (bt *BPlusTree) Put(key []byte, value []byte) error {
 
 	bt.treeLatch.Lock()
 	defer bt.treeLatch.Unlock()
+	bt.modCount++
 
 	// Check if key already exists
-	existed, err := bt.existsUnlocked(key)
+	old, existed, err := bt.lookupUnlocked(key)
+	if err != nil {
+		return err
+	}
+
+	// Large values are written to overflow pages before the leaf points at them
+	stored, err := bt.storeValue(value)
 	if err != nil {
 		return err
 	}
 
 	// Insert into the tree (may cause splits)
-	newRoot, err := bt.insertRecursive(bt.root, key, value, bt.height)
+	split, err := bt.insertRecursive(bt.root, key, stored, bt.height)
 	if err != nil {
 		return err
 	}
 
-	// Update root if tree grew in height
-	if newRoot != bt.root {
+	// Grow the tree by one level if the root was split
+	if split != nil {
+		newRoot, err := bt.createNewRoot(bt.root, split.rightID, split.separator)
+		if err != nil {
+			return err
+		}
 		bt.root = newRoot
 		bt.height++
 	}
 
-	// Only increment key count if this is a new key
+	// Only increment key count if this is a new key; an overwritten value's
+	// overflow pages are no longer referenced
 	if !existed {
 		bt.numKeys++
+	} else if err := bt.freeValue(old); err != nil {
+		return err
 	}
 
 	return nil
@@ -224,24 +334,14 @@ func (bt *BPlusTree) Delete(key []byte) error {
 
 	bt.treeLatch.Lock()
 	defer bt.treeLatch.Unlock()
+	bt.modCount++
 
 	// Check if key exists before attempting deletion
-	leafPageID, err := bt.findLeafPage(key)
-	if err != nil {
-		return err
-	}
-
-	leafPage, err := bt.pageManager.GetPage(leafPageID)
-	if err != nil {
-		return err
-	}
-
-	node, err := bt.deserializeNode(leafPage)
+	old, found, err := bt.lookupUnlocked(key)
 	if err != nil {
 		return err
 	}
-
-	if _, found := node.findValue(key); !found {
+	if !found {
 		return ErrKeyNotFound
 	}
 
@@ -253,6 +353,10 @@ func (bt *BPlusTree) Delete(key []byte) error {
 
 	bt.numKeys--
 
+	if err := bt.freeValue(old); err != nil {
+		return err
+	}
+
 	// Check if root became empty and tree height should decrease
 	if bt.height > 0 {
 		rootPage, err := bt.pageManager.GetPage(bt.root)
@@ -260,19 +364,19 @@ func (bt *BPlusTree) Delete(key []byte) error {
 			return err
 		}
 
-		rootNode, err := bt.deserializeNode(rootPage)
+		rootNode, err := openNode(rootPage)
 		if err != nil {
 			return err
 		}
 
 		// If root has only one child, make that child the new root
-		if len(rootNode.keys) == 0 && len(rootNode.children) == 1 {
+		if rootNode.count() == 0 {
 			if err := bt.pageManager.DeallocatePage(bt.root); err != nil {
 				// Log the error but don't fail the delete operation
 				// In a production system, this would be logged to a proper logger
 				_ = err
 			}
-			bt.root = rootNode.children[0]
+			bt.root = rootNode.child(0)
 			bt.height--
 		}
 	}
@@ -292,59 +396,43 @@ func (bt *BPlusTree) Exists(key []byte) (bool, error) {
 	return true, nil
 }
 
-// existsUnlocked checks if a key exists in the B+ Tree without locking.
-// This is used internally when the lock is already held.
-func (bt *BPlusTree) existsUnlocked(key []byte) (bool, error) {
+// lookupUnlocked returns the stored form of a key's value and whether the key
+// exists, without locking. This is used internally when the lock is already held.
+func (bt *BPlusTree) lookupUnlocked(key []byte) ([]byte, bool, error) {
 	// Find the leaf node containing the key
-	leafPageID, err := bt.findLeafPage(key)
-	if err != nil {
-		return false, err
-	}
-
-	// Search within the leaf node
-	leafPage, err := bt.pageManager.GetPage(leafPageID)
-	if err != nil {
-		return false, err
-	}
-
-	node, err := bt.deserializeNode(leafPage)
+	leaf, err := bt.findLeaf(key)
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
 
 	// Binary search for the key in the leaf node
-	_, found := node.findValue(key)
-	return found, nil
+	index, found := leaf.search(key)
+	if !found {
+		return nil, false, nil
+	}
+	return append([]byte{}, leaf.value(index)...), true, nil
 }
 
-// findLeafPage traverses the tree to find the leaf page that should contain the given key.
-func (bt *BPlusTree) findLeafPage(key []byte) (page.PageID, error) {
+// findLeaf traverses the tree to find the leaf that should contain the given key.
+func (bt *BPlusTree) findLeaf(key []byte) (nodePage, error) {
 	currentPageID := bt.root
-	currentHeight := bt.height
 
 	// Traverse down to leaf level
-	for currentHeight > 0 {
-		currentPage, err := bt.pageManager.GetPage(currentPageID)
+	for currentHeight := bt.height; ; currentHeight-- {
+		node, err := bt.nodeAt(currentPageID)
 		if err != nil {
-			return 0, err
+			return nodePage{}, err
 		}
-
-		node, err := bt.deserializeNode(currentPage)
-		if err != nil {
-			return 0, err
+		if node.isLeaf() != (currentHeight == 0) {
+			return nodePage{}, fmt.Errorf("%w: page %d is at the wrong level", ErrTreeCorrupted, currentPageID)
 		}
-
-		// Find the appropriate child
-		childIndex := node.findChildIndex(key)
-		if childIndex >= len(node.children) {
-			return 0, errors.New("invalid child index in internal node")
+		if currentHeight == 0 {
+			return node, nil
 		}
 
-		currentPageID = node.children[childIndex]
-		currentHeight--
+		// Find the appropriate child
+		currentPageID = node.child(node.childIndex(key))
 	}
-
-	return currentPageID, nil
 }
 
 // Stats returns statistics about the B+ Tree.
@@ -361,6 +449,25 @@ func (bt *BPlusTree) Stats() TreeStats {
 	}
 }
 
+// Meta returns the information needed to reopen the tree with OpenBPlusTree.
+func (bt *BPlusTree) Meta() Meta {
+	bt.treeLatch.RLock()
+	defer bt.treeLatch.RUnlock()
+
+	return Meta{
+		Root:    bt.root,
+		Height:  bt.height,
+		NumKeys: bt.numKeys,
+	}
+}
+
+// Meta describes the persistent shape of a B+ Tree.
+type Meta struct {
+	Root    page.PageID // Root page ID
+	Height  int         // Height of the tree (leaf level = 0)
+	NumKeys int64       // Total number of keys
+}
+
 // TreeStats contains statistics about the B+ Tree.
 type TreeStats struct {
 	Height          int         // Height of the tree
@@ -377,4 +484,6 @@ var (
 	ErrKeyTooLarge   = errors.New("key too large")
 	ErrValueTooLarge = errors.New("value too large")
 	ErrTreeCorrupted = errors.New("tree structure corrupted")
+	ErrTreeNotEmpty  = errors.New("tree is not empty")
+	ErrNotSorted     = errors.New("keys are not in ascending order")
 )
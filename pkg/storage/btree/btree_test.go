@@ -1,6 +1,7 @@
 package btree
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/thromel/go-database/pkg/storage/page"
@@ -211,13 +212,14 @@ func TestBPlusTreeUpdate(t *testing.T) {
 
 func TestBPlusTreeConfig(t *testing.T) {
 	// Test default config
+	// Nodes are only limited by page space by default
 	config := DefaultConfig()
-	if config.BranchingFactor != 64 {
-		t.Errorf("Expected default branching factor 64, got %d", config.BranchingFactor)
+	if config.BranchingFactor != 0 {
+		t.Errorf("Expected default branching factor 0, got %d", config.BranchingFactor)
 	}
 
-	if config.LeafCapacity != 32 {
-		t.Errorf("Expected default leaf capacity 32, got %d", config.LeafCapacity)
+	if config.LeafCapacity != 0 {
+		t.Errorf("Expected default leaf capacity 0, got %d", config.LeafCapacity)
 	}
 
 	// Test config validation
@@ -258,3 +260,70 @@ func TestBPlusTreeWithNilPageManager(t *testing.T) {
 		t.Error("Expected error for nil page manager")
 	}
 }
+
+func TestBPlusTreeSequentialInsertsAcrossLevels(t *testing.T) {
+	pageManager := page.NewManager()
+
+	tree, err := NewBPlusTree(pageManager, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create B+ tree: %v", err)
+	}
+
+	// Enough keys to split leaves repeatedly and grow the tree past height 1.
+	// Nodes hold as many keys as fit, so the keys are long.
+	const numKeys = 5000
+	for i := 0; i < numKeys; i++ {
+		key := []byte(fmt.Sprintf("key-%056d", i))
+		if err := tree.Put(key, key); err != nil {
+			t.Fatalf("Failed to put key %s: %v", key, err)
+		}
+	}
+
+	if stats := tree.Stats(); stats.Height < 2 {
+		t.Fatalf("Expected tree height of at least 2, got %d", stats.Height)
+	}
+
+	for i := 0; i < numKeys; i++ {
+		key := []byte(fmt.Sprintf("key-%056d", i))
+		value, err := tree.Get(key)
+		if err != nil {
+			t.Fatalf("Failed to get key %s: %v", key, err)
+		}
+		if string(value) != string(key) {
+			t.Fatalf("Expected value %s, got %s", key, value)
+		}
+	}
+}
+
+func TestOpenBPlusTree(t *testing.T) {
+	pageManager := page.NewManager()
+
+	tree, err := NewBPlusTree(pageManager, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create B+ tree: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key-%03d", i))
+		if err := tree.Put(key, key); err != nil {
+			t.Fatalf("Failed to put key %s: %v", key, err)
+		}
+	}
+
+	reopened, err := OpenBPlusTree(pageManager, DefaultConfig(), tree.Meta())
+	if err != nil {
+		t.Fatalf("Failed to reopen B+ tree: %v", err)
+	}
+
+	if reopened.Stats() != tree.Stats() {
+		t.Errorf("Expected stats %+v, got %+v", tree.Stats(), reopened.Stats())
+	}
+
+	if _, err := reopened.Get([]byte("key-042")); err != nil {
+		t.Errorf("Failed to get key from reopened tree: %v", err)
+	}
+
+	if _, err := OpenBPlusTree(pageManager, DefaultConfig(), Meta{}); err == nil {
+		t.Error("Expected error when opening tree without a root page")
+	}
+}
@@ -0,0 +1,287 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// defaultFillFactor is the fraction of each page BulkLoad fills when the
+// configuration leaves it unset.
+const defaultFillFactor = 0.9
+
+// Source supplies the entries BulkLoad builds a tree from, in ascending key
+// order. Next advances to the next entry and reports whether there is one;
+// the first call moves to the first entry. storage.Iterator satisfies it.
+type Source interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Error() error
+}
+
+// BulkLoad builds the tree from entries supplied in ascending key order. The
+// leaves are written left to right, each filled to the configured fill
+// factor, and each level of internal nodes is built from the one below as
+// it is written, so no node is ever split. The tree must be empty. If the
+// keys are not strictly ascending it fails with ErrNotSorted.
+//
+// If BulkLoad fails, the tree is left as it was, but pages it allocated are
+// not freed; the storage engine rolls them back with the update.
+func (bt *BPlusTree) BulkLoad(src Source) error {
+	bt.treeLatch.Lock()
+	defer bt.treeLatch.Unlock()
+	bt.modCount++
+
+	if bt.numKeys != 0 {
+		return ErrTreeNotEmpty
+	}
+
+	leaves := &bulkLevel{tree: bt}
+	var prev []byte
+	var numKeys int64
+	for src.Next() {
+		key, value := src.Key(), src.Value()
+		if len(key) == 0 {
+			return ErrInvalidKey
+		}
+		if len(key) > bt.maxKeySize {
+			return ErrKeyTooLarge
+		}
+		if len(value) > bt.maxValueSize {
+			return ErrValueTooLarge
+		}
+		if prev != nil && bytes.Compare(prev, key) >= 0 {
+			return fmt.Errorf("%w: %q follows %q", ErrNotSorted, key, prev)
+		}
+		prev = append(prev[:0], key...)
+
+		stored, err := bt.storeValue(value)
+		if err != nil {
+			return err
+		}
+		if err := leaves.add(prev, stored, page.InvalidPageID); err != nil {
+			return err
+		}
+		numKeys++
+	}
+	if err := src.Error(); err != nil {
+		return fmt.Errorf("failed to read bulk load input: %w", err)
+	}
+	if numKeys == 0 {
+		return nil
+	}
+
+	root, height, err := leaves.finish()
+	if err != nil {
+		return err
+	}
+
+	// The empty root leaf is replaced by the loaded tree
+	if err := bt.pageManager.DeallocatePage(bt.root); err != nil {
+		return err
+	}
+	bt.root = root
+	bt.height = height
+	bt.numKeys = numKeys
+
+	return nil
+}
+
+// fillBytes returns the number of bytes BulkLoad fills each node up to.
+func (bt *BPlusTree) fillBytes() int {
+	fill := bt.fillFactor
+	if fill == 0 {
+		fill = defaultFillFactor
+	}
+	return int(fill * float64(bt.pageSize-page.PageHeaderSize))
+}
+
+// bulkLevel builds one level of the tree during BulkLoad. A finished node is
+// held back until the next one is finished too, so that the last two nodes
+// of the level can be rebalanced if the last one ends up underfull.
+type bulkLevel struct {
+	tree   *BPlusTree
+	height int
+
+	// prev and cur are the last two nodes of the level
+	prev, cur *bulkNode
+
+	// parent is the level above, created once this level has two nodes
+	parent *bulkLevel
+}
+
+// bulkNode is a node being built by BulkLoad.
+type bulkNode struct {
+	node *BPlusTreeNode
+	pg   *page.Page
+
+	// first is the node's smallest key, which separates it from the node
+	// before it in the parent
+	first []byte
+
+	// size is the number of bytes the node's cells take, with their slots
+	size int
+}
+
+// entries returns the number of entries in the node: keys in a leaf and
+// children in an internal node.
+func (n *bulkNode) entries() int {
+	if n.node.isLeaf {
+		return len(n.node.keys)
+	}
+	return len(n.node.children)
+}
+
+// add appends an entry to the level: a key and stored value at the leaf
+// level, or a child and the key separating it from the one before it above.
+func (l *bulkLevel) add(key, stored []byte, child page.PageID) error {
+	leaf := l.height == 0
+
+	var size, limit, least int
+	if leaf {
+		size = page.SlotSize + leafCellHeader + len(key) + len(stored)
+		limit, least = l.tree.leafLimit(), 1
+	} else {
+		size = page.SlotSize + internalCellHeader + len(key)
+		limit, least = l.tree.internalLimit(), 2
+	}
+
+	// Start a new node once the current one is filled, as long as it holds
+	// enough entries to leave a key between it and the next one
+	if l.cur == nil || (l.cur.entries() >= least &&
+		(l.cur.size+size > l.tree.fillBytes() || l.cur.entries() >= limit)) {
+		if err := l.startNode(key); err != nil {
+			return err
+		}
+	}
+
+	n := l.cur
+	switch {
+	case leaf:
+		n.node.keys = append(n.node.keys, append([]byte(nil), key...))
+		n.node.values = append(n.node.values, stored)
+		n.size += size
+	case len(n.node.children) == 0:
+		// A node's first child needs no key; the key separates the node
+		// from the one before it
+		n.node.children = append(n.node.children, child)
+		n.size += page.SlotSize + internalCellHeader
+	default:
+		n.node.keys = append(n.node.keys, append([]byte(nil), key...))
+		n.node.children = append(n.node.children, child)
+		n.size += size
+	}
+
+	return nil
+}
+
+// startNode begins a new node whose smallest key is first, writing out the
+// node before the current one.
+func (l *bulkLevel) startNode(first []byte) error {
+	pageType, node := page.PageTypeLeaf, newLeafNode()
+	if l.height > 0 {
+		pageType, node = page.PageTypeInternal, newInternalNode()
+	}
+
+	pg, err := l.tree.pageManager.AllocatePage(pageType)
+	if err != nil {
+		return err
+	}
+
+	if l.prev != nil {
+		if err := l.write(l.prev); err != nil {
+			return err
+		}
+	}
+	if l.cur != nil {
+		l.cur.node.next = pg.ID()
+	}
+
+	l.prev, l.cur = l.cur, &bulkNode{node: node, pg: pg, first: append([]byte(nil), first...)}
+	return nil
+}
+
+// write writes a finished node to its page and adds it to the level above.
+func (l *bulkLevel) write(n *bulkNode) error {
+	if err := l.tree.writeNodeToPage(n.node, n.pg); err != nil {
+		return err
+	}
+
+	if l.parent == nil {
+		l.parent = &bulkLevel{tree: l.tree, height: l.height + 1}
+	}
+	return l.parent.add(n.first, nil, n.pg.ID())
+}
+
+// finish writes the last nodes of the level and of every level above it,
+// and returns the root of the tree and its height.
+func (l *bulkLevel) finish() (page.PageID, int, error) {
+	// A level of one node is the root
+	if l.prev == nil && l.parent == nil {
+		if err := l.tree.writeNodeToPage(l.cur.node, l.cur.pg); err != nil {
+			return page.InvalidPageID, 0, err
+		}
+		return l.cur.pg.ID(), l.height, nil
+	}
+
+	if l.prev != nil {
+		if 2*l.cur.size < l.tree.fillBytes() {
+			l.rebalance()
+		}
+		if err := l.write(l.prev); err != nil {
+			return page.InvalidPageID, 0, err
+		}
+	}
+	l.cur.node.next = page.InvalidPageID
+	if err := l.write(l.cur); err != nil {
+		return page.InvalidPageID, 0, err
+	}
+
+	return l.parent.finish()
+}
+
+// rebalance moves entries from the second to last node of the level to the
+// underfull last one, so that both take about the same space without either
+// going over the entry limit.
+func (l *bulkLevel) rebalance() {
+	left, right := l.prev.node, l.cur.node
+
+	var node *BPlusTreeNode
+	var first []byte
+	if left.isLeaf {
+		left.keys = append(left.keys, right.keys...)
+		left.values = append(left.values, right.values...)
+		limit := l.tree.leafLimit()
+		mid := splitPoint(left.cellSizes())
+		mid = min(max(mid, len(left.keys)-limit), limit)
+		node, first = left.splitLeaf(mid)
+		left.next = l.cur.pg.ID()
+	} else if len(left.keys)+len(right.keys) >= 2 {
+		// Keep at least one key on each side of the promoted one
+		left.keys = append(append(left.keys, l.cur.first), right.keys...)
+		left.children = append(left.children, right.children...)
+		limit := l.tree.internalLimit()
+		mid := max(min(splitPoint(left.cellSizes()), len(left.keys)-2), 1)
+		mid = min(max(mid, len(left.keys)-limit), limit-1)
+		node, first = left.splitInternal(mid)
+	} else {
+		return
+	}
+
+	l.prev.size, l.cur.size = nodeSize(left), nodeSize(node)
+	l.cur.node, l.cur.first = node, first
+}
+
+// nodeSize returns the number of bytes a node's cells take, with their slots.
+func nodeSize(node *BPlusTreeNode) int {
+	size := 0
+	for _, s := range node.cellSizes() {
+		size += s
+	}
+	if !node.isLeaf {
+		size += page.SlotSize + internalCellHeader // The first child's cell
+	}
+	return size
+}
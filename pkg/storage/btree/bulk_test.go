@@ -0,0 +1,275 @@
+package btree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// sliceSource is a bulk load source over in-memory entries.
+type sliceSource struct {
+	keys, values [][]byte
+	pos          int
+	err          error
+}
+
+// newSliceSource returns a source over the keys key-0000 .. key-(n-1), with
+// the value of each given by value.
+func newSliceSource(n int, value func(i int) []byte) *sliceSource {
+	src := &sliceSource{pos: -1}
+	for i := 0; i < n; i++ {
+		src.keys = append(src.keys, cursorKey(i))
+		src.values = append(src.values, value(i))
+	}
+	return src
+}
+
+func (s *sliceSource) Next() bool {
+	if s.pos+1 >= len(s.keys) {
+		return false
+	}
+	s.pos++
+	return true
+}
+
+func (s *sliceSource) Key() []byte   { return s.keys[s.pos] }
+func (s *sliceSource) Value() []byte { return s.values[s.pos] }
+func (s *sliceSource) Error() error  { return s.err }
+
+// bulkValue returns the value of the i-th key in the bulk load tests; every
+// tenth one is stored in overflow pages.
+func bulkValue(i int) []byte {
+	if i%10 == 0 {
+		return largeValue(i, 2*overflowPageCapacity)
+	}
+	return []byte(fmt.Sprintf("value-%d", i))
+}
+
+// countLeaves returns the number of leaves in the tree, checking that no node
+// holds more entries than the tree allows.
+func countLeaves(t *testing.T, bt *BPlusTree) int {
+	t.Helper()
+
+	leaves := 0
+	var walk func(pageID page.PageID)
+	walk = func(pageID page.PageID) {
+		n, err := bt.nodeAt(pageID)
+		if err != nil {
+			t.Fatalf("Failed to read node %d: %v", pageID, err)
+		}
+		if n.isLeaf() {
+			if n.count() == 0 || n.count() > bt.leafLimit() {
+				t.Fatalf("Leaf %d holds %d entries", pageID, n.count())
+			}
+			leaves++
+			return
+		}
+		if n.count() == 0 || n.count()+1 > bt.internalLimit() {
+			t.Fatalf("Internal node %d holds %d children", pageID, n.count()+1)
+		}
+		for i := 0; i <= n.count(); i++ {
+			walk(n.child(i))
+		}
+	}
+	walk(bt.root)
+	return leaves
+}
+
+// checkBulkTree verifies that the tree holds exactly the first n keys of a
+// bulk load source, in order both ways.
+func checkBulkTree(t *testing.T, bt *BPlusTree, n int, value func(i int) []byte) {
+	t.Helper()
+
+	if got := bt.Stats().NumKeys; got != int64(n) {
+		t.Fatalf("Expected %d keys, got %d", n, got)
+	}
+	for i := 0; i < n; i++ {
+		got, err := bt.Get(cursorKey(i))
+		if err != nil || !bytes.Equal(got, value(i)) {
+			t.Fatalf("Unexpected value for %s: %v", cursorKey(i), err)
+		}
+	}
+
+	c := bt.NewCursor(nil, nil)
+	defer c.Close()
+	c.SeekToFirst()
+	keys := collect(c)
+	if len(keys) != n {
+		t.Fatalf("Expected the cursor to visit %d keys, got %d: %v", n, len(keys), c.Error())
+	}
+	for i, key := range keys {
+		if key != string(cursorKey(i)) {
+			t.Fatalf("Expected %s at position %d, got %s", cursorKey(i), i, key)
+		}
+	}
+
+	count := 0
+	for c.SeekToLast(); c.Valid(); c.Prev() {
+		count++
+	}
+	if count != n || c.Error() != nil {
+		t.Fatalf("Expected to visit %d keys backwards, got %d: %v", n, count, c.Error())
+	}
+}
+
+func TestBPlusTree_BulkLoad(t *testing.T) {
+	const n = 5000
+
+	pm := page.NewManager()
+	tree, err := NewBPlusTree(pm, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	if err := tree.BulkLoad(newSliceSource(n, bulkValue)); err != nil {
+		t.Fatalf("Failed to bulk load: %v", err)
+	}
+
+	if tree.Stats().Height < 1 {
+		t.Errorf("Expected a multi-level tree, got height %d", tree.Stats().Height)
+	}
+	checkBulkTree(t, tree, n, bulkValue)
+
+	// Bulk loaded leaves are fuller than those left by inserting in order
+	inserted, err := NewBPlusTree(page.NewManager(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		if err := inserted.Put(cursorKey(i), bulkValue(i)); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if loaded, put := countLeaves(t, tree), countLeaves(t, inserted); loaded >= put {
+		t.Errorf("Expected fewer leaves than %d when bulk loading, got %d", put, loaded)
+	}
+
+	// Only the meta page and the tree's own pages remain allocated
+	if got, want := len(treePages(t, tree)), pm.GetStatistics().AllocatedPages-1; got != want {
+		t.Errorf("Expected the tree to use all %d allocated pages, got %d", want, got)
+	}
+
+	// The loaded tree takes further changes
+	for i := 0; i < n; i += 3 {
+		if err := tree.Delete(cursorKey(i)); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+	}
+	if err := tree.Put([]byte("key-9999"), []byte("last")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := tree.Put(cursorKey(3), []byte("again")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if got := tree.Stats().NumKeys; got != n-(n+2)/3+2 {
+		t.Errorf("Expected %d keys, got %d", n-(n+2)/3+2, got)
+	}
+	if value, err := tree.Get(cursorKey(3)); err != nil || string(value) != "again" {
+		t.Errorf("Unexpected value for %s: %q, %v", cursorKey(3), value, err)
+	}
+}
+
+func TestBPlusTree_BulkLoadFillFactor(t *testing.T) {
+	value := func(i int) []byte { return []byte(fmt.Sprintf("value-%d", i)) }
+
+	leaves := make(map[float64]int)
+	for _, fill := range []float64{0.5, 1} {
+		config := DefaultConfig()
+		config.FillFactor = fill
+		tree, err := NewBPlusTree(page.NewManager(), config)
+		if err != nil {
+			t.Fatalf("Failed to create tree: %v", err)
+		}
+		if err := tree.BulkLoad(newSliceSource(3000, value)); err != nil {
+			t.Fatalf("Failed to bulk load: %v", err)
+		}
+		checkBulkTree(t, tree, 3000, value)
+		leaves[fill] = countLeaves(t, tree)
+	}
+
+	// Half full leaves take about twice as many pages
+	if leaves[0.5] < 2*leaves[1]-2 || leaves[0.5] > 2*leaves[1]+2 {
+		t.Errorf("Expected about twice %d leaves at half fill, got %d", leaves[1], leaves[0.5])
+	}
+
+	config := DefaultConfig()
+	config.FillFactor = 1.5
+	if _, err := NewBPlusTree(page.NewManager(), config); err == nil {
+		t.Error("Expected a fill factor above 1 to be rejected")
+	}
+}
+
+func TestBPlusTree_BulkLoadLimits(t *testing.T) {
+	value := func(i int) []byte { return []byte(fmt.Sprintf("value-%d", i)) }
+
+	// Every size up to a few full levels, so that each way the last nodes of
+	// a level can end up is covered
+	for n := 1; n <= 80; n++ {
+		config := &Config{BranchingFactor: 3, LeafCapacity: 4, MaxKeySize: 64, MaxValueSize: 128}
+		tree, err := NewBPlusTree(page.NewManager(), config)
+		if err != nil {
+			t.Fatalf("Failed to create tree: %v", err)
+		}
+		if err := tree.BulkLoad(newSliceSource(n, value)); err != nil {
+			t.Fatalf("Failed to bulk load %d keys: %v", n, err)
+		}
+		checkBulkTree(t, tree, n, value)
+		if leaves := countLeaves(t, tree); leaves < (n+3)/4 {
+			t.Fatalf("Expected at least %d leaves for %d keys, got %d", (n+3)/4, n, leaves)
+		}
+	}
+}
+
+func TestBPlusTree_BulkLoadErrors(t *testing.T) {
+	pm := page.NewManager()
+	tree, err := NewBPlusTree(pm, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	// An empty source leaves the tree empty
+	if err := tree.BulkLoad(newSliceSource(0, bulkValue)); err != nil {
+		t.Fatalf("Failed to bulk load nothing: %v", err)
+	}
+
+	unsorted := newSliceSource(500, bulkValue)
+	unsorted.keys[300], unsorted.keys[301] = unsorted.keys[301], unsorted.keys[300]
+	duplicate := newSliceSource(500, bulkValue)
+	duplicate.keys[301] = duplicate.keys[300]
+	failing := newSliceSource(500, bulkValue)
+	failing.err = errors.New("read failed")
+
+	tests := []struct {
+		name string
+		src  *sliceSource
+		want error
+	}{
+		{"unsorted", unsorted, ErrNotSorted},
+		{"duplicate", duplicate, ErrNotSorted},
+		{"failing", failing, failing.err},
+	}
+	for _, tt := range tests {
+		if err := tree.BulkLoad(tt.src); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+
+		// The tree is left empty
+		if got := tree.Stats().NumKeys; got != 0 {
+			t.Fatalf("%s: expected an empty tree, got %d keys", tt.name, got)
+		}
+		if _, err := tree.Get(cursorKey(0)); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("%s: expected ErrKeyNotFound, got %v", tt.name, err)
+		}
+	}
+
+	if err := tree.BulkLoad(newSliceSource(500, bulkValue)); err != nil {
+		t.Fatalf("Failed to bulk load: %v", err)
+	}
+	checkBulkTree(t, tree, 500, bulkValue)
+
+	if err := tree.BulkLoad(newSliceSource(10, bulkValue)); !errors.Is(err, ErrTreeNotEmpty) {
+		t.Errorf("Expected ErrTreeNotEmpty, got %v", err)
+	}
+}
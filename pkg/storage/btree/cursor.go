@@ -0,0 +1,522 @@
+package btree
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// Cursor iterates over the entries of a B+ Tree in key order, optionally
+// bounded to the range [start, end). A nil bound leaves that side open.
+//
+// The cursor copies the entries of one leaf at a time, so it holds no latch
+// between calls. It moves forward to the following leaf through the leaf
+// sibling chain, and backward to the preceding leaf through the stack of
+// internal nodes on the path from the root, which it keeps from its last
+// descent. If the tree was modified since the current leaf was read, the
+// chain and path may have changed under the cursor, and it descends from
+// the root again to find the key after or before the last one it returned
+// instead. The cursor therefore never returns a key twice or out of order,
+// and sees every key that is neither inserted nor deleted while it runs.
+//
+// A Cursor is not safe for concurrent use.
+type Cursor struct {
+	// tree is the tree being iterated
+	tree *BPlusTree
+
+	// start and end bound the iteration to [start, end)
+	start []byte
+	end   []byte
+
+	// keys and values are the entries of the current leaf
+	keys   [][]byte
+	values [][]byte
+
+	// index is the position of the cursor in the current leaf
+	index int
+
+	// leaf is the page of the current leaf
+	leaf page.PageID
+
+	// next is the page of the leaf after the current one
+	next page.PageID
+
+	// path holds the internal nodes from the root down to pathLeaf
+	path []frame
+
+	// pathLeaf is the leaf path leads to; path is stale if it is not leaf
+	pathLeaf page.PageID
+
+	// modCount is the tree modification count when the leaf was read
+	modCount uint64
+
+	// valid indicates if the cursor is positioned at an entry
+	valid bool
+
+	// positioned indicates if the cursor has been positioned at all
+	positioned bool
+
+	// closed indicates if the cursor is closed
+	closed bool
+
+	// err holds the first error encountered while moving the cursor
+	err error
+}
+
+// frame is an internal node on the path from the root to a leaf.
+type frame struct {
+	// children are the child pages of the node
+	children []page.PageID
+
+	// index is the position of the path among the children
+	index int
+}
+
+// NewCursor creates a cursor over the keys in [start, end). The cursor is
+// not positioned until Seek, SeekToFirst or SeekToLast is called; calling
+// Next first is the same as calling SeekToFirst.
+func (bt *BPlusTree) NewCursor(start, end []byte) *Cursor {
+	return &Cursor{
+		tree:  bt,
+		start: append([]byte(nil), start...),
+		end:   append([]byte(nil), end...),
+	}
+}
+
+// Valid returns true if the cursor is positioned at an entry.
+func (c *Cursor) Valid() bool {
+	return c.valid && !c.closed && c.err == nil
+}
+
+// Key returns the key at the cursor, or nil if it is not valid. The
+// returned slice must not be modified.
+func (c *Cursor) Key() []byte {
+	if !c.Valid() {
+		return nil
+	}
+	return c.keys[c.index]
+}
+
+// Value returns the value at the cursor, or nil if it is not valid. The
+// returned slice must not be modified.
+//
+// A value stored in overflow pages is read when Value is called. If the tree
+// was modified since the current leaf was read, the value is looked up again,
+// and Value returns nil if the key has since been deleted.
+func (c *Cursor) Value() []byte {
+	if !c.Valid() {
+		return nil
+	}
+
+	stored := c.values[c.index]
+	if !isOverflow(stored) {
+		return stored[1:]
+	}
+
+	c.tree.treeLatch.RLock()
+	defer c.tree.treeLatch.RUnlock()
+
+	// The chain may have been freed along with the key's old value
+	if c.modCount != c.tree.modCount {
+		current, found, err := c.tree.lookupUnlocked(c.keys[c.index])
+		if err != nil {
+			c.fail(err)
+			return nil
+		}
+		if !found {
+			return nil
+		}
+		stored = current
+	}
+
+	value, err := c.tree.loadValue(stored)
+	if err != nil {
+		c.fail(err)
+		return nil
+	}
+	return value
+}
+
+// Seek positions the cursor at the first key >= target within its bounds.
+func (c *Cursor) Seek(target []byte) {
+	if !c.begin() {
+		return
+	}
+
+	if len(c.start) > 0 && bytes.Compare(target, c.start) < 0 {
+		target = c.start
+	}
+
+	c.tree.treeLatch.RLock()
+	defer c.tree.treeLatch.RUnlock()
+
+	c.seekLocked(target)
+}
+
+// SeekToFirst positions the cursor at the first key within its bounds.
+func (c *Cursor) SeekToFirst() {
+	c.Seek(c.start)
+}
+
+// SeekToLast positions the cursor at the last key within its bounds.
+func (c *Cursor) SeekToLast() {
+	if !c.begin() {
+		return
+	}
+
+	c.tree.treeLatch.RLock()
+	defer c.tree.treeLatch.RUnlock()
+
+	c.seekBeforeLocked(c.end)
+}
+
+// SeekBefore positions the cursor at the last key < target within its
+// bounds. An empty target is no bound, like SeekToLast.
+func (c *Cursor) SeekBefore(target []byte) {
+	if !c.begin() {
+		return
+	}
+
+	if len(c.end) > 0 && (len(target) == 0 || bytes.Compare(target, c.end) > 0) {
+		target = c.end
+	}
+
+	c.tree.treeLatch.RLock()
+	defer c.tree.treeLatch.RUnlock()
+
+	c.seekBeforeLocked(target)
+}
+
+// Next advances the cursor to the next key within its bounds and reports
+// whether it is valid.
+func (c *Cursor) Next() bool {
+	if c.closed {
+		c.err = ErrCursorClosed
+		return false
+	}
+	if !c.positioned {
+		c.SeekToFirst()
+		return c.Valid()
+	}
+	if !c.Valid() {
+		return false
+	}
+
+	c.index++
+	if c.index < len(c.keys) {
+		c.valid = c.belowEnd(c.keys[c.index])
+		return c.valid
+	}
+
+	last := c.keys[c.index-1]
+
+	c.tree.treeLatch.RLock()
+	defer c.tree.treeLatch.RUnlock()
+
+	if c.modCount != c.tree.modCount {
+		// The leaf chain may have changed; find the successor from the root
+		c.seekLocked(successor(last))
+		return c.Valid()
+	}
+
+	c.index = 0
+	c.keys = nil
+	c.settleLocked()
+	return c.Valid()
+}
+
+// Prev moves the cursor back to the previous key within its bounds and
+// reports whether it is valid. Calling Prev first is the same as calling
+// SeekToLast.
+func (c *Cursor) Prev() bool {
+	if c.closed {
+		c.err = ErrCursorClosed
+		return false
+	}
+	if !c.positioned {
+		c.SeekToLast()
+		return c.Valid()
+	}
+	if !c.Valid() {
+		return false
+	}
+
+	if c.index > 0 {
+		c.index--
+		c.valid = c.aboveStart(c.keys[c.index])
+		return c.valid
+	}
+
+	first := c.keys[0]
+
+	c.tree.treeLatch.RLock()
+	defer c.tree.treeLatch.RUnlock()
+
+	if c.modCount != c.tree.modCount || c.pathLeaf != c.leaf {
+		// The path is stale; find the predecessor from the root
+		c.seekBeforeLocked(first)
+		return c.Valid()
+	}
+
+	found, err := c.prevLeafLocked()
+	if err != nil {
+		c.fail(err)
+		return false
+	}
+	c.valid = found && c.aboveStart(c.keys[c.index])
+	return c.valid
+}
+
+// Error returns the first error encountered while moving the cursor.
+func (c *Cursor) Error() error {
+	return c.err
+}
+
+// Close releases the cursor. Closing a closed cursor returns ErrCursorClosed.
+func (c *Cursor) Close() error {
+	if c.closed {
+		return ErrCursorClosed
+	}
+
+	c.closed = true
+	c.valid = false
+	c.keys = nil
+	c.values = nil
+	return nil
+}
+
+// begin prepares the cursor to be positioned and reports whether it may be.
+func (c *Cursor) begin() bool {
+	if c.closed {
+		c.err = ErrCursorClosed
+		return false
+	}
+
+	c.positioned = true
+	c.valid = false
+	c.err = nil
+	return true
+}
+
+// fail stops the cursor with the given error.
+func (c *Cursor) fail(err error) {
+	c.err = err
+	c.valid = false
+}
+
+// belowEnd checks whether key is below the end bound. Keys reached by
+// moving forward from a valid position are never below the start bound.
+func (c *Cursor) belowEnd(key []byte) bool {
+	return len(c.end) == 0 || bytes.Compare(key, c.end) < 0
+}
+
+// aboveStart checks whether key is at or above the start bound. Keys
+// reached by moving backward are never at or above the end bound.
+func (c *Cursor) aboveStart(key []byte) bool {
+	return len(c.start) == 0 || bytes.Compare(key, c.start) >= 0
+}
+
+// seekLocked positions the cursor at the first key >= target (assumes the
+// tree latch is held).
+func (c *Cursor) seekLocked(target []byte) {
+	c.path = c.path[:0]
+	id := c.tree.root
+	for height := c.tree.height; height > 0; height-- {
+		node, err := c.tree.readNode(id)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		if node.isLeaf {
+			c.fail(ErrTreeCorrupted)
+			return
+		}
+
+		index := node.findChildIndex(target)
+		c.path = append(c.path, frame{children: node.children, index: index})
+		id = node.children[index]
+	}
+
+	if err := c.loadLeafLocked(id); err != nil {
+		c.fail(err)
+		return
+	}
+	c.pathLeaf = id
+
+	c.index = sort.Search(len(c.keys), func(i int) bool {
+		return bytes.Compare(c.keys[i], target) >= 0
+	})
+	c.settleLocked()
+}
+
+// settleLocked moves the cursor along the leaf chain until it is at an
+// entry, skipping exhausted and empty leaves, and checks the end bound
+// (assumes the tree latch is held).
+func (c *Cursor) settleLocked() {
+	for c.index >= len(c.keys) {
+		if c.next == page.InvalidPageID {
+			c.valid = false
+			return
+		}
+		if err := c.loadLeafLocked(c.next); err != nil {
+			c.fail(err)
+			return
+		}
+		c.index = 0
+	}
+
+	c.valid = c.belowEnd(c.keys[c.index])
+}
+
+// seekBeforeLocked positions the cursor at the last key below bound, or
+// the last key at all if bound is empty, and checks the start bound
+// (assumes the tree latch is held).
+func (c *Cursor) seekBeforeLocked(bound []byte) {
+	c.path = c.path[:0]
+	found, err := c.seekLastLocked(c.tree.root, c.tree.height, bound)
+	if err != nil {
+		c.fail(err)
+		return
+	}
+	c.valid = found && c.aboveStart(c.keys[c.index])
+}
+
+// seekLastLocked positions the cursor at the last key below bound in the
+// subtree rooted at pageID, extending the path to it, and reports whether
+// there is one (assumes the tree latch is held). Leaves may be empty after
+// deletes, so it backs up to earlier children when a subtree has no such key.
+func (c *Cursor) seekLastLocked(pageID page.PageID, height int, bound []byte) (bool, error) {
+	node, err := c.tree.readNode(pageID)
+	if err != nil {
+		return false, err
+	}
+
+	if height == 0 {
+		if !node.isLeaf {
+			return false, ErrTreeCorrupted
+		}
+
+		n := len(node.keys)
+		if len(bound) > 0 {
+			n = sort.Search(len(node.keys), func(i int) bool {
+				return bytes.Compare(node.keys[i], bound) >= 0
+			})
+		}
+		if n == 0 {
+			return false, nil
+		}
+
+		c.setLeaf(pageID, node)
+		c.pathLeaf = pageID
+		c.index = n - 1
+		return true, nil
+	}
+
+	last := len(node.children) - 1
+	if len(bound) > 0 {
+		last = node.findChildIndex(bound)
+	}
+	for i := last; i >= 0; i-- {
+		// Child i only holds keys below keys[i]; stop once all are below start
+		if i < len(node.keys) && len(c.start) > 0 && bytes.Compare(node.keys[i], c.start) <= 0 {
+			break
+		}
+
+		c.path = append(c.path, frame{children: node.children, index: i})
+		found, err := c.seekLastLocked(node.children[i], height-1, bound)
+		if err != nil || found {
+			return found, err
+		}
+		c.path = c.path[:len(c.path)-1]
+	}
+
+	return false, nil
+}
+
+// prevLeafLocked moves the cursor to the last entry of the closest earlier
+// leaf that has entries, stepping back along the path, and reports whether
+// there is one (assumes the tree latch is held and the path is current).
+func (c *Cursor) prevLeafLocked() (bool, error) {
+	for {
+		// Climb to the lowest node with a child before the path's
+		level := len(c.path) - 1
+		for level >= 0 && c.path[level].index == 0 {
+			level--
+		}
+		if level < 0 {
+			return false, nil
+		}
+		c.path = c.path[:level+1]
+		c.path[level].index--
+
+		// Descend along the last children to the leaf before the current one
+		id := c.path[level].children[c.path[level].index]
+		for len(c.path) < c.tree.height {
+			node, err := c.tree.readNode(id)
+			if err != nil {
+				return false, err
+			}
+			if node.isLeaf || len(node.children) == 0 {
+				return false, ErrTreeCorrupted
+			}
+
+			index := len(node.children) - 1
+			c.path = append(c.path, frame{children: node.children, index: index})
+			id = node.children[index]
+		}
+
+		if err := c.loadLeafLocked(id); err != nil {
+			return false, err
+		}
+		c.pathLeaf = id
+		if len(c.keys) > 0 {
+			c.index = len(c.keys) - 1
+			return true, nil
+		}
+	}
+}
+
+// loadLeafLocked reads the leaf in the given page into the cursor (assumes
+// the tree latch is held).
+func (c *Cursor) loadLeafLocked(pageID page.PageID) error {
+	node, err := c.tree.readNode(pageID)
+	if err != nil {
+		return err
+	}
+	if !node.isLeaf {
+		return ErrTreeCorrupted
+	}
+
+	c.setLeaf(pageID, node)
+	return nil
+}
+
+// setLeaf makes node, read from the given page, the current leaf of the cursor.
+func (c *Cursor) setLeaf(pageID page.PageID, node *BPlusTreeNode) {
+	c.leaf = pageID
+	c.keys = node.keys
+	c.values = node.values
+	c.next = node.next
+	c.modCount = c.tree.modCount
+}
+
+// readNode reads and deserializes the node in the given page.
+func (bt *BPlusTree) readNode(pageID page.PageID) (*BPlusTreeNode, error) {
+	pg, err := bt.pageManager.GetPage(pageID)
+	if err != nil {
+		return nil, err
+	}
+	return bt.deserializeNode(pg)
+}
+
+// successor returns the smallest key greater than key.
+func successor(key []byte) []byte {
+	next := make([]byte, len(key)+1)
+	copy(next, key)
+	return next
+}
+
+// ErrCursorClosed is returned when using a closed cursor.
+var ErrCursorClosed = errors.New("cursor is closed")
@@ -0,0 +1,368 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// countingStore is a page store that counts page reads.
+type countingStore struct {
+	*page.Manager
+	reads int
+}
+
+// GetPage counts the read and delegates to the page manager.
+func (s *countingStore) GetPage(pageID page.PageID) (*page.Page, error) {
+	s.reads++
+	return s.Manager.GetPage(pageID)
+}
+
+// newCursorTestTree creates a tree holding key-0000 .. key-(n-1), small
+// enough per leaf that it has several levels.
+func newCursorTestTree(t *testing.T, n int) (*BPlusTree, *countingStore) {
+	t.Helper()
+
+	store := &countingStore{Manager: page.NewManager()}
+	tree, err := NewBPlusTree(store, &Config{BranchingFactor: 4, LeafCapacity: 4, MaxKeySize: 64, MaxValueSize: 128})
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	for i := 0; i < n; i++ {
+		if err := tree.Put(cursorKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	return tree, store
+}
+
+// cursorKey returns the i-th key of a cursor test tree.
+func cursorKey(i int) []byte {
+	return []byte(fmt.Sprintf("key-%04d", i))
+}
+
+// collect returns the keys from the cursor's position to its end.
+func collect(c *Cursor) []string {
+	var keys []string
+	for ; c.Valid(); c.Next() {
+		keys = append(keys, string(c.Key()))
+	}
+	return keys
+}
+
+func TestCursor_FullScan(t *testing.T) {
+	const n = 200
+	tree, store := newCursorTestTree(t, n)
+	if tree.Stats().Height < 2 {
+		t.Fatalf("Expected a multi-level tree, got height %d", tree.Stats().Height)
+	}
+
+	c := tree.NewCursor(nil, nil)
+	defer c.Close()
+
+	c.SeekToFirst()
+	reads := store.reads
+	leaves := 1
+	for i := 0; i < n; i++ {
+		if !c.Valid() {
+			t.Fatalf("Cursor ended after %d keys: %v", i, c.Error())
+		}
+		if string(c.Key()) != string(cursorKey(i)) {
+			t.Fatalf("Expected %s at position %d, got %s", cursorKey(i), i, c.Key())
+		}
+		if string(c.Value()) != fmt.Sprintf("value-%d", i) {
+			t.Fatalf("Unexpected value %s for %s", c.Value(), c.Key())
+		}
+		if c.index == 0 && i > 0 {
+			leaves++
+		}
+		c.Next()
+	}
+	if c.Valid() || c.Error() != nil {
+		t.Errorf("Expected cursor to end cleanly, error %v", c.Error())
+	}
+
+	// Following the leaf chain reads each remaining leaf exactly once
+	if got := store.reads - reads; got != leaves-1 {
+		t.Errorf("Expected %d page reads for %d leaves, got %d", leaves-1, leaves, got)
+	}
+}
+
+func TestCursor_Bounds(t *testing.T) {
+	tree, _ := newCursorTestTree(t, 100)
+
+	c := tree.NewCursor(cursorKey(10), cursorKey(20))
+	defer c.Close()
+
+	// Next on a new cursor starts at the first key
+	if !c.Next() || string(c.Key()) != string(cursorKey(10)) {
+		t.Fatalf("Expected first key %s, got %s", cursorKey(10), c.Key())
+	}
+	if keys := collect(c); len(keys) != 10 || keys[9] != string(cursorKey(19)) {
+		t.Errorf("Expected keys 10..19, got %v", keys)
+	}
+
+	c.Seek(cursorKey(15))
+	if keys := collect(c); len(keys) != 5 || keys[0] != string(cursorKey(15)) {
+		t.Errorf("Expected keys 15..19, got %v", keys)
+	}
+
+	// Seeks are clamped to the bounds
+	c.Seek(cursorKey(0))
+	if string(c.Key()) != string(cursorKey(10)) {
+		t.Errorf("Expected seek below start to land on %s, got %s", cursorKey(10), c.Key())
+	}
+	c.Seek(cursorKey(50))
+	if c.Valid() {
+		t.Errorf("Expected seek past end to be invalid, got %s", c.Key())
+	}
+	c.Seek([]byte("key-0012x"))
+	if string(c.Key()) != string(cursorKey(13)) {
+		t.Errorf("Expected seek between keys to land on %s, got %s", cursorKey(13), c.Key())
+	}
+
+	c.SeekToLast()
+	if string(c.Key()) != string(cursorKey(19)) {
+		t.Errorf("Expected last key %s, got %s", cursorKey(19), c.Key())
+	}
+	if c.Next() {
+		t.Errorf("Expected no key after the last one, got %s", c.Key())
+	}
+
+	empty := tree.NewCursor([]byte("zzz"), nil)
+	empty.SeekToFirst()
+	if empty.Valid() {
+		t.Error("Expected empty range to be invalid")
+	}
+	empty.SeekToLast()
+	if empty.Valid() {
+		t.Error("Expected empty range to be invalid")
+	}
+}
+
+func TestCursor_SkipsEmptyLeaves(t *testing.T) {
+	tree, _ := newCursorTestTree(t, 100)
+
+	// Deletes leave empty leaves in the chain
+	for i := 20; i < 100; i++ {
+		if i == 50 {
+			continue
+		}
+		if err := tree.Delete(cursorKey(i)); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+	}
+
+	c := tree.NewCursor(nil, nil)
+	defer c.Close()
+
+	c.SeekToLast()
+	if string(c.Key()) != string(cursorKey(50)) {
+		t.Errorf("Expected last key %s, got %s", cursorKey(50), c.Key())
+	}
+
+	c.Seek(cursorKey(19))
+	if keys := collect(c); len(keys) != 2 || keys[1] != string(cursorKey(50)) {
+		t.Errorf("Expected keys 19 and 50, got %v", keys)
+	}
+
+	bounded := tree.NewCursor(nil, cursorKey(50))
+	bounded.SeekToLast()
+	if string(bounded.Key()) != string(cursorKey(19)) {
+		t.Errorf("Expected last key below the end to be %s, got %s", cursorKey(19), bounded.Key())
+	}
+}
+
+func TestCursor_ConcurrentModification(t *testing.T) {
+	tree, _ := newCursorTestTree(t, 0)
+	for i := 0; i < 100; i += 2 {
+		if err := tree.Put(cursorKey(i), []byte("even")); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	c := tree.NewCursor(nil, nil)
+	defer c.Close()
+
+	// Insert the odd keys while scanning, splitting leaves under the cursor
+	var keys []string
+	for c.SeekToFirst(); c.Valid(); c.Next() {
+		keys = append(keys, string(c.Key()))
+		if len(keys) == 10 {
+			for i := 1; i < 100; i += 2 {
+				if err := tree.Put(cursorKey(i), []byte("odd")); err != nil {
+					t.Fatalf("Failed to put: %v", err)
+				}
+			}
+		}
+	}
+	if c.Error() != nil {
+		t.Fatalf("Cursor failed: %v", c.Error())
+	}
+
+	for i := 1; i < len(keys); i++ {
+		if keys[i] <= keys[i-1] {
+			t.Fatalf("Keys out of order or repeated: %s after %s", keys[i], keys[i-1])
+		}
+	}
+
+	// Every even key is seen, as are the odd keys after the scan position
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		seen[key] = true
+	}
+	for i := 0; i < 100; i++ {
+		if (i%2 == 0 || i > 20) && !seen[string(cursorKey(i))] {
+			t.Errorf("Expected to see %s", cursorKey(i))
+		}
+	}
+}
+
+func TestCursor_Close(t *testing.T) {
+	tree, _ := newCursorTestTree(t, 10)
+
+	c := tree.NewCursor(nil, nil)
+	c.SeekToFirst()
+	if err := c.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	if c.Valid() || c.Key() != nil {
+		t.Error("Expected closed cursor to be invalid")
+	}
+	if c.Next() || !errors.Is(c.Error(), ErrCursorClosed) {
+		t.Errorf("Expected ErrCursorClosed, got %v", c.Error())
+	}
+	if err := c.Close(); !errors.Is(err, ErrCursorClosed) {
+		t.Errorf("Expected ErrCursorClosed, got %v", err)
+	}
+}
+
+func TestCursor_Prev(t *testing.T) {
+	const n = 200
+	tree, store := newCursorTestTree(t, n)
+
+	c := tree.NewCursor(nil, nil)
+	defer c.Close()
+
+	// Prev on a new cursor starts at the last key
+	if !c.Prev() {
+		t.Fatalf("Expected a last key: %v", c.Error())
+	}
+	reads := store.reads
+	for i := n - 1; i >= 0; i-- {
+		if string(c.Key()) != string(cursorKey(i)) {
+			t.Fatalf("Expected %s, got %s", cursorKey(i), c.Key())
+		}
+		if string(c.Value()) != fmt.Sprintf("value-%d", i) {
+			t.Fatalf("Unexpected value %s for %s", c.Value(), c.Key())
+		}
+		c.Prev()
+	}
+	if c.Valid() || c.Error() != nil {
+		t.Errorf("Expected cursor to end cleanly, error %v", c.Error())
+	}
+	reads = store.reads - reads
+
+	// Stepping back through the path reads each leaf once, plus the
+	// internal nodes it climbs into, never a descent per leaf
+	leaves := 0
+	for c.SeekToFirst(); c.Valid(); c.Next() {
+		if c.index == 0 {
+			leaves++
+		}
+	}
+	if reads >= 2*leaves {
+		t.Errorf("Expected fewer than %d page reads for %d leaves, got %d", 2*leaves, leaves, reads)
+	}
+
+	// Direction changes, including across leaf boundaries
+	c.Seek(cursorKey(100))
+	for i := 0; i < 10; i++ {
+		c.Prev()
+	}
+	for i := 0; i < 5; i++ {
+		c.Next()
+	}
+	if string(c.Key()) != string(cursorKey(95)) {
+		t.Errorf("Expected %s after moving back 10 and forward 5, got %s", cursorKey(95), c.Key())
+	}
+}
+
+func TestCursor_PrevBoundsAndEmptyLeaves(t *testing.T) {
+	tree, _ := newCursorTestTree(t, 100)
+	for i := 21; i < 80; i++ {
+		if err := tree.Delete(cursorKey(i)); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+	}
+
+	c := tree.NewCursor(cursorKey(10), cursorKey(90))
+	defer c.Close()
+
+	var keys []string
+	for c.SeekToLast(); c.Valid(); c.Prev() {
+		keys = append(keys, string(c.Key()))
+	}
+	if c.Error() != nil {
+		t.Fatalf("Cursor failed: %v", c.Error())
+	}
+
+	var expected []string
+	for i := 89; i >= 10; i-- {
+		if i <= 20 || i >= 80 {
+			expected = append(expected, string(cursorKey(i)))
+		}
+	}
+	if fmt.Sprint(keys) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, keys)
+	}
+
+	c.SeekBefore(cursorKey(50))
+	if string(c.Key()) != string(cursorKey(20)) {
+		t.Errorf("Expected %s before %s, got %s", cursorKey(20), cursorKey(50), c.Key())
+	}
+	c.SeekBefore(cursorKey(10))
+	if c.Valid() {
+		t.Errorf("Expected no key before the start bound, got %s", c.Key())
+	}
+}
+
+func TestCursor_PrevConcurrentModification(t *testing.T) {
+	tree, _ := newCursorTestTree(t, 0)
+	for i := 0; i < 100; i += 2 {
+		if err := tree.Put(cursorKey(i), []byte("even")); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	c := tree.NewCursor(nil, nil)
+	defer c.Close()
+
+	var keys []string
+	for c.SeekToLast(); c.Valid(); c.Prev() {
+		keys = append(keys, string(c.Key()))
+		if len(keys) == 10 {
+			for i := 1; i < 100; i += 2 {
+				if err := tree.Put(cursorKey(i), []byte("odd")); err != nil {
+					t.Fatalf("Failed to put: %v", err)
+				}
+			}
+		}
+	}
+	if c.Error() != nil {
+		t.Fatalf("Cursor failed: %v", c.Error())
+	}
+
+	for i := 1; i < len(keys); i++ {
+		if keys[i] >= keys[i-1] {
+			t.Fatalf("Keys out of order or repeated: %s after %s", keys[i], keys[i-1])
+		}
+	}
+	if len(keys) < 50 {
+		t.Errorf("Expected to see at least every even key, saw %d keys", len(keys))
+	}
+}
@@ -129,7 +129,7 @@ func TestInternalNodeMethods(t *testing.T) {
 	}
 
 	// Test splitInternal
-	newNode, promoteKey := node.splitInternal(4)
+	newNode, promoteKey := node.splitInternal(1)
 	if newNode == nil {
 		t.Error("Expected new node from split")
 		return
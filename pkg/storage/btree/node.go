@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"sort"
 
 	"github.com/thromel/go-database/pkg/storage/page"
@@ -22,14 +23,12 @@ type BPlusTreeNode struct {
 	// For internal nodes: child page IDs (len(children) = len(keys) + 1)
 	children []page.PageID
 
-	// For leaf nodes: values corresponding to keys (len(values) = len(keys))
+	// For leaf nodes: values corresponding to keys (len(values) = len(keys)),
+	// in their stored form (see overflow.go)
 	values [][]byte
 
 	// For leaf nodes: pointer to next leaf for range scans
 	next page.PageID
-
-	// Parent tracking for efficient updates
-	parent page.PageID
 }
 
 // newLeafNode creates a new leaf node.
@@ -40,7 +39,6 @@ func newLeafNode() *BPlusTreeNode {
 		children: nil,
 		values:   make([][]byte, 0),
 		next:     0,
-		parent:   0,
 	}
 }
 
@@ -52,7 +50,6 @@ func newInternalNode() *BPlusTreeNode {
 		children: make([]page.PageID, 0),
 		values:   nil,
 		next:     0,
-		parent:   0,
 	}
 }
 
@@ -136,14 +133,13 @@ func (node *BPlusTreeNode) insertInInternal(key []byte, childPageID page.PageID,
 	return len(node.keys) > branchingFactor-1
 }
 
-// splitLeaf splits a leaf node into two nodes.
+// splitLeaf splits a leaf node into two nodes, keeping the first mid entries.
 // Returns the new right node and the key to promote to parent.
-func (node *BPlusTreeNode) splitLeaf(capacity int) (*BPlusTreeNode, []byte) {
+func (node *BPlusTreeNode) splitLeaf(mid int) (*BPlusTreeNode, []byte) {
 	if !node.isLeaf {
 		return nil, nil
 	}
 
-	mid := capacity / 2
 	newNode := newLeafNode()
 
 	// Move right half to new node
@@ -168,14 +164,14 @@ func (node *BPlusTreeNode) splitLeaf(capacity int) (*BPlusTreeNode, []byte) {
 	return newNode, promoteKey
 }
 
-// splitInternal splits an internal node into two nodes.
+// splitInternal splits an internal node into two nodes, keeping the first mid
+// keys and promoting the next one.
 // Returns the new right node and the key to promote to parent.
-func (node *BPlusTreeNode) splitInternal(branchingFactor int) (*BPlusTreeNode, []byte) {
+func (node *BPlusTreeNode) splitInternal(mid int) (*BPlusTreeNode, []byte) {
 	if node.isLeaf {
 		return nil, nil
 	}
 
-	mid := (branchingFactor - 1) / 2
 	newNode := newInternalNode()
 
 	// The middle key is promoted to parent
@@ -393,176 +389,241 @@ func removePageIDAt(slice []page.PageID, index int) []page.PageID {
 }
 
 // Serialization and deserialization
+//
+// Nodes are stored in slotted pages (see page.Page.InsertCell), one cell per
+// entry in key order, so that most changes only touch the cells involved. A
+// leaf cell holds a key and the stored form of its value, and the leaf's
+// right sibling is the page's next page:
+//
+//	key length (2) | key | stored value
+//
+// An internal node with n keys has n+1 cells, each holding a child and the
+// key separating it from the child before it. The first cell's key is empty:
+//
+//	child (4) | key
+const (
+	leafCellHeader     = 2
+	internalCellHeader = 4
+
+	// minNodeEntries is the number of the largest entries a page must hold
+	minNodeEntries = 4
+)
 
-// serializeNode converts a node to byte representation for storage.
-func (bt *BPlusTree) serializeNode(node *BPlusTreeNode) ([]byte, error) {
-	if node == nil {
-		return nil, errors.New("cannot serialize nil node")
-	}
+// leafCell encodes a leaf entry.
+func leafCell(key, stored []byte) []byte {
+	cell := make([]byte, leafCellHeader+len(key)+len(stored))
+	binary.LittleEndian.PutUint16(cell, uint16(len(key))) // #nosec G115 - bounded by validateConfig
+	copy(cell[leafCellHeader:], key)
+	copy(cell[leafCellHeader+len(key):], stored)
+	return cell
+}
 
-	buffer := make([]byte, 0, page.PageSize-page.PageHeaderSize)
+// internalCell encodes a child of an internal node and its separator key.
+func internalCell(child page.PageID, key []byte) []byte {
+	cell := make([]byte, internalCellHeader+len(key))
+	binary.LittleEndian.PutUint32(cell, uint32(child))
+	copy(cell[internalCellHeader:], key)
+	return cell
+}
 
-	// Write node type (1 byte)
-	if node.isLeaf {
-		buffer = append(buffer, 1)
-	} else {
-		buffer = append(buffer, 0)
-	}
-
-	// Write next pointer for leaf nodes (8 bytes)
-	nextBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(nextBytes, uint64(node.next))
-	buffer = append(buffer, nextBytes...)
-
-	// Write parent pointer (8 bytes)
-	parentBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(parentBytes, uint64(node.parent))
-	buffer = append(buffer, parentBytes...)
-
-	// Write number of keys (4 bytes)
-	numKeysBytes := make([]byte, 4)
-	if len(node.keys) > int(^uint32(0)) {
-		return nil, errors.New("too many keys to serialize")
-	}
-	numKeys := uint32(len(node.keys)) // #nosec G115 - bounds checked above
-	binary.LittleEndian.PutUint32(numKeysBytes, numKeys)
-	buffer = append(buffer, numKeysBytes...)
-
-	// Write keys
-	for _, key := range node.keys {
-		// Write key length (4 bytes)
-		keyLenBytes := make([]byte, 4)
-		if len(key) > int(^uint32(0)) {
-			return nil, errors.New("key too large to serialize")
-		}
-		keyLen := uint32(len(key)) // #nosec G115 - bounds checked above
-		binary.LittleEndian.PutUint32(keyLenBytes, keyLen)
-		buffer = append(buffer, keyLenBytes...)
+// nodePage reads the entries of a node directly from its page. The slices
+// it returns refer to the page and are only valid until it is modified.
+type nodePage struct {
+	pg *page.Page
+}
 
-		// Write key data
-		buffer = append(buffer, key...)
+// openNode checks that a page holds a well-formed node and returns a view
+// of it.
+func openNode(pg *page.Page) (nodePage, error) {
+	if pg == nil {
+		return nodePage{}, errors.New("cannot read node from nil page")
+	}
+	if pg.Type() != page.PageTypeLeaf && pg.Type() != page.PageTypeInternal {
+		return nodePage{}, fmt.Errorf("%w: page %d is a %s page, not a node", ErrTreeCorrupted, pg.ID(), pg.Type())
+	}
+	if err := pg.CheckSlots(); err != nil {
+		return nodePage{}, fmt.Errorf("%w: page %d: %w", ErrTreeCorrupted, pg.ID(), err)
 	}
 
-	if node.isLeaf {
-		// Write values for leaf nodes
-		for _, value := range node.values {
-			// Write value length (4 bytes)
-			valueLenBytes := make([]byte, 4)
-			if len(value) > int(^uint32(0)) {
-				return nil, errors.New("value too large to serialize")
+	n := nodePage{pg: pg}
+	if !n.isLeaf() && pg.NumSlots() == 0 {
+		return nodePage{}, fmt.Errorf("%w: internal page %d has no children", ErrTreeCorrupted, pg.ID())
+	}
+	for i := 0; i < int(pg.NumSlots()); i++ {
+		cell := pg.Cell(i)
+		if n.isLeaf() {
+			// A leaf cell needs its key and at least the value's tag byte
+			if len(cell) < leafCellHeader || leafCellHeader+int(binary.LittleEndian.Uint16(cell)) >= len(cell) {
+				return nodePage{}, fmt.Errorf("%w: malformed cell %d in leaf page %d", ErrTreeCorrupted, i, pg.ID())
 			}
-			valueLen := uint32(len(value)) // #nosec G115 - bounds checked above
-			binary.LittleEndian.PutUint32(valueLenBytes, valueLen)
-			buffer = append(buffer, valueLenBytes...)
-
-			// Write value data
-			buffer = append(buffer, value...)
-		}
-	} else {
-		// Write children for internal nodes
-		for _, child := range node.children {
-			childBytes := make([]byte, 8)
-			binary.LittleEndian.PutUint64(childBytes, uint64(child))
-			buffer = append(buffer, childBytes...)
+		} else if len(cell) < internalCellHeader {
+			return nodePage{}, fmt.Errorf("%w: malformed cell %d in internal page %d", ErrTreeCorrupted, i, pg.ID())
 		}
 	}
 
-	return buffer, nil
+	return n, nil
 }
 
-// deserializeNode converts byte representation back to a node.
-func (bt *BPlusTree) deserializeNode(pg *page.Page) (*BPlusTreeNode, error) {
-	if pg == nil {
-		return nil, errors.New("cannot deserialize nil page")
+// nodeAt reads the node stored in a page.
+func (bt *BPlusTree) nodeAt(pageID page.PageID) (nodePage, error) {
+	pg, err := bt.pageManager.GetPage(pageID)
+	if err != nil {
+		return nodePage{}, err
 	}
+	return openNode(pg)
+}
 
-	data := pg.Data()
-	if len(data) < 21 { // Minimum size: 1 + 8 + 8 + 4
-		return nil, errors.New("insufficient data for node deserialization")
+// isLeaf reports whether the node is a leaf.
+func (n nodePage) isLeaf() bool {
+	return n.pg.Type() == page.PageTypeLeaf
+}
+
+// count returns the number of keys in the node.
+func (n nodePage) count() int {
+	if n.isLeaf() {
+		return int(n.pg.NumSlots())
 	}
+	return int(n.pg.NumSlots()) - 1
+}
 
-	offset := 0
-	node := &BPlusTreeNode{}
+// key returns the i-th key of the node.
+func (n nodePage) key(i int) []byte {
+	if n.isLeaf() {
+		cell := n.pg.Cell(i)
+		return cell[leafCellHeader : leafCellHeader+int(binary.LittleEndian.Uint16(cell))]
+	}
+	return n.pg.Cell(i + 1)[internalCellHeader:]
+}
 
-	// Read node type (1 byte)
-	node.isLeaf = data[offset] == 1
-	offset++
+// value returns the stored form of the i-th value of a leaf.
+func (n nodePage) value(i int) []byte {
+	cell := n.pg.Cell(i)
+	return cell[leafCellHeader+int(binary.LittleEndian.Uint16(cell)):]
+}
 
-	// Read next pointer (8 bytes)
-	nextPtr := binary.LittleEndian.Uint64(data[offset:])
-	if nextPtr > uint64(^uint32(0)) {
-		return nil, errors.New("next pointer value too large for PageID")
-	}
-	node.next = page.PageID(nextPtr)
-	offset += 8
+// child returns the i-th child of an internal node.
+func (n nodePage) child(i int) page.PageID {
+	return page.PageID(binary.LittleEndian.Uint32(n.pg.Cell(i)))
+}
 
-	// Read parent pointer (8 bytes)
-	parentPtr := binary.LittleEndian.Uint64(data[offset:])
-	if parentPtr > uint64(^uint32(0)) {
-		return nil, errors.New("parent pointer value too large for PageID")
-	}
-	node.parent = page.PageID(parentPtr)
-	offset += 8
+// search returns the index of the first key >= key in the node, and whether
+// that key is equal to it.
+func (n nodePage) search(key []byte) (int, bool) {
+	index := sort.Search(n.count(), func(i int) bool {
+		return bytes.Compare(n.key(i), key) >= 0
+	})
+	return index, index < n.count() && bytes.Equal(n.key(index), key)
+}
 
-	// Read number of keys (4 bytes)
-	numKeys := binary.LittleEndian.Uint32(data[offset:])
-	offset += 4
+// childIndex returns the index of the child of an internal node that should
+// contain key, like findChildIndex.
+func (n nodePage) childIndex(key []byte) int {
+	return sort.Search(n.count(), func(i int) bool {
+		return bytes.Compare(n.key(i), key) > 0
+	})
+}
 
-	// Read keys
-	node.keys = make([][]byte, numKeys)
-	for i := uint32(0); i < numKeys; i++ {
-		if offset+4 > len(data) {
-			return nil, errors.New("insufficient data for key length")
+// cellSizes returns the encoded size of each entry of a node, including its
+// slot. For an internal node, entry i is key i with the child after it.
+func (node *BPlusTreeNode) cellSizes() []int {
+	sizes := make([]int, len(node.keys))
+	for i, key := range node.keys {
+		if node.isLeaf {
+			sizes[i] = page.SlotSize + leafCellHeader + len(key) + len(node.values[i])
+		} else {
+			sizes[i] = page.SlotSize + internalCellHeader + len(key)
 		}
+	}
+	return sizes
+}
 
-		keyLen := binary.LittleEndian.Uint32(data[offset:])
-		offset += 4
+// splitPoint returns how many entries of the given sizes to keep on the left
+// when splitting them, so that both sides hold about the same number of
+// bytes. Each side keeps at least one entry.
+func splitPoint(sizes []int) int {
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
 
-		if offset+int(keyLen) > len(data) {
-			return nil, errors.New("insufficient data for key")
-		}
+	mid, left := 0, 0
+	for mid < len(sizes)-1 && 2*(left+sizes[mid]) <= total {
+		left += sizes[mid]
+		mid++
+	}
+	return max(mid, 1)
+}
 
-		node.keys[i] = make([]byte, keyLen)
-		copy(node.keys[i], data[offset:offset+int(keyLen)])
-		offset += int(keyLen)
+// encodeNode writes a node to a page in the slotted layout.
+func encodeNode(node *BPlusTreeNode, pg *page.Page) error {
+	if node == nil {
+		return errors.New("cannot serialize nil node")
+	}
+	if !node.isLeaf && len(node.children) != len(node.keys)+1 {
+		return fmt.Errorf("internal node has %d keys but %d children", len(node.keys), len(node.children))
+	}
+	if node.isLeaf && len(node.values) != len(node.keys) {
+		return fmt.Errorf("leaf node has %d keys but %d values", len(node.keys), len(node.values))
 	}
 
+	pg.Reset()
 	if node.isLeaf {
-		// Read values for leaf nodes
-		node.values = make([][]byte, numKeys)
-		for i := uint32(0); i < numKeys; i++ {
-			if offset+4 > len(data) {
-				return nil, errors.New("insufficient data for value length")
+		pg.SetNextPage(node.next)
+		for i, key := range node.keys {
+			if !pg.InsertCell(i, leafCell(key, node.values[i])) {
+				return errNodeTooLarge
 			}
+		}
+		return nil
+	}
+
+	pg.SetNextPage(page.InvalidPageID)
+	if !pg.InsertCell(0, internalCell(node.children[0], nil)) {
+		return errNodeTooLarge
+	}
+	for i, key := range node.keys {
+		if !pg.InsertCell(i+1, internalCell(node.children[i+1], key)) {
+			return errNodeTooLarge
+		}
+	}
+	return nil
+}
 
-			valueLen := binary.LittleEndian.Uint32(data[offset:])
-			offset += 4
+// deserializeNode converts a page back to a node.
+func (bt *BPlusTree) deserializeNode(pg *page.Page) (*BPlusTreeNode, error) {
+	if pg == nil {
+		return nil, errors.New("cannot deserialize nil page")
+	}
 
-			if offset+int(valueLen) > len(data) {
-				return nil, errors.New("insufficient data for value")
-			}
+	n, err := openNode(pg)
+	if err != nil {
+		return nil, err
+	}
 
-			node.values[i] = make([]byte, valueLen)
-			copy(node.values[i], data[offset:offset+int(valueLen)])
-			offset += int(valueLen)
+	numKeys := n.count()
+	node := &BPlusTreeNode{
+		isLeaf: n.isLeaf(),
+		keys:   make([][]byte, numKeys),
+	}
+	for i := range node.keys {
+		node.keys[i] = append([]byte(nil), n.key(i)...)
+	}
+
+	if node.isLeaf {
+		node.next = pg.NextPage()
+		node.values = make([][]byte, numKeys)
+		for i := range node.values {
+			node.values[i] = append([]byte(nil), n.value(i)...)
 		}
 	} else {
-		// Read children for internal nodes (numKeys + 1 children)
-		numChildren := numKeys + 1
-		node.children = make([]page.PageID, numChildren)
-		for i := uint32(0); i < numChildren; i++ {
-			if offset+8 > len(data) {
-				return nil, errors.New("insufficient data for child page ID")
-			}
-
-			childPageID := binary.LittleEndian.Uint64(data[offset:])
-			if childPageID > uint64(^uint32(0)) {
-				return nil, errors.New("child page ID value too large for PageID")
-			}
-			node.children[i] = page.PageID(childPageID)
-			offset += 8
+		node.children = make([]page.PageID, numKeys+1)
+		for i := range node.children {
+			node.children[i] = n.child(i)
 		}
 	}
 
 	return node, nil
 }
+
+// errNodeTooLarge indicates that a node does not fit in a page.
+var errNodeTooLarge = errors.New("serialized node too large for page")
@@ -1,82 +1,71 @@
 package btree
 
 import (
-	"errors"
-
 	"github.com/thromel/go-database/pkg/storage/page"
 )
 
+// splitResult describes a node split that must be reflected in the parent.
+type splitResult struct {
+	separator []byte      // Smallest key routed to the new right node
+	rightID   page.PageID // Page ID of the new right node
+}
+
 // insertRecursive recursively inserts a key-value pair into the tree.
-// Returns the new root page ID if the tree height increased.
-func (bt *BPlusTree) insertRecursive(pageID page.PageID, key []byte, value []byte, height int) (page.PageID, error) {
+// Returns a non-nil split result if the node at pageID was split. Entries
+// are added to a page in place when they fit; the node is only rebuilt
+// when it has to be split.
+func (bt *BPlusTree) insertRecursive(pageID page.PageID, key []byte, value []byte, height int) (*splitResult, error) {
 	currentPage, err := bt.pageManager.GetPage(pageID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	node, err := bt.deserializeNode(currentPage)
+	n, err := openNode(currentPage)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if height == 0 {
-		// Leaf level - insert key-value pair
-		needsSplit := node.insertInLeaf(key, value, bt.leafCapacity)
-
-		// Serialize the updated node back to the page
-		if err := bt.writeNodeToPage(node, currentPage); err != nil {
-			return 0, err
+		// Leaf level - insert or replace the entry's cell
+		cell := leafCell(key, value)
+		index, found := n.search(key)
+		var fits bool
+		if found {
+			fits = currentPage.ReplaceCell(index, cell)
+		} else if n.count() < bt.leafLimit() {
+			fits = currentPage.InsertCell(index, cell)
 		}
-
-		if needsSplit {
-			return bt.splitLeafPage(pageID, node)
-		}
-		return pageID, nil
-	} else {
-		// Internal level - find child and recurse
-		childIndex := node.findChildIndex(key)
-		if childIndex >= len(node.children) {
-			return 0, ErrTreeCorrupted
+		if fits {
+			return nil, bt.pageManager.WritePage(currentPage)
 		}
 
-		newChildRoot, err := bt.insertRecursive(node.children[childIndex], key, value, height-1)
+		node, err := bt.deserializeNode(currentPage)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
+		node.insertInLeaf(key, value, bt.leafLimit())
+		return bt.splitLeafPage(pageID, node)
+	}
 
-		// If child split, we need to insert the new separator key
-		if newChildRoot != node.children[childIndex] {
-			// Get the separator key from the split
-			newChildPage, err := bt.pageManager.GetPage(newChildRoot)
-			if err != nil {
-				return 0, err
-			}
-
-			newChildNode, err := bt.deserializeNode(newChildPage)
-			if err != nil {
-				return 0, err
-			}
-
-			// The separator key is the first key of the new node
-			separatorKey := newChildNode.keys[0]
-
-			// Insert separator into this internal node
-			needsSplit := node.insertInInternal(separatorKey, newChildRoot, bt.branchingFactor)
-
-			// Update the child pointer
-			node.children[childIndex] = newChildRoot
+	// Internal level - find child and recurse
+	childIndex := n.childIndex(key)
+	childSplit, err := bt.insertRecursive(n.child(childIndex), key, value, height-1)
+	if err != nil || childSplit == nil {
+		return nil, err
+	}
 
-			// Serialize the updated node back to the page
-			if err := bt.writeNodeToPage(node, currentPage); err != nil {
-				return 0, err
-			}
+	// The child split, so the new right node needs a separator in this node
+	if n.count()+1 < bt.internalLimit() &&
+		currentPage.InsertCell(childIndex+1, internalCell(childSplit.rightID, childSplit.separator)) {
+		return nil, bt.pageManager.WritePage(currentPage)
+	}
 
-			if needsSplit {
-				return bt.splitInternalPage(pageID, node)
-			}
-		}
-		return pageID, nil
+	node, err := bt.deserializeNode(currentPage)
+	if err != nil {
+		return nil, err
 	}
+	node.insertInInternal(childSplit.separator, childSplit.rightID, bt.internalLimit())
+	return bt.splitInternalPage(pageID, node)
 }
 
 // deleteRecursive recursively deletes a key from the tree.
@@ -86,51 +75,48 @@ func (bt *BPlusTree) deleteRecursive(pageID page.PageID, key []byte, height int)
 		return err
 	}
 
-	node, err := bt.deserializeNode(currentPage)
+	n, err := openNode(currentPage)
 	if err != nil {
 		return err
 	}
 
 	if height == 0 {
-		// Leaf level - delete key-value pair
-		minCapacity := bt.leafCapacity / 2
-		isUnderfull := node.deleteFromLeaf(key, minCapacity)
+		// Leaf level - remove the entry's cell
+		index, found := n.search(key)
+		if !found {
+			return nil
+		}
+		currentPage.RemoveCell(index)
 
-		// Serialize the updated node back to the page
-		if err := bt.writeNodeToPage(node, currentPage); err != nil {
+		if err := bt.pageManager.WritePage(currentPage); err != nil {
 			return err
 		}
 
-		if isUnderfull {
-			return bt.handleLeafUnderflow(pageID, node)
+		if n.count() < bt.leafCapacity/2 {
+			return bt.handleLeafUnderflow(pageID, n.count())
 		}
 		return nil
-	} else {
-		// Internal level - find child and recurse
-		childIndex := node.findChildIndex(key)
-		if childIndex >= len(node.children) {
-			return ErrTreeCorrupted
-		}
-
-		err := bt.deleteRecursive(node.children[childIndex], key, height-1)
-		if err != nil {
-			return err
-		}
+	}
 
-		// Check if child became underfull and needs rebalancing
-		return bt.handleInternalChildUnderflow(pageID, node, childIndex)
+	// Internal level - find child and recurse
+	childPageID := n.child(n.childIndex(key))
+	if err := bt.deleteRecursive(childPageID, key, height-1); err != nil {
+		return err
 	}
+
+	// Check if child became underfull and needs rebalancing
+	return bt.handleInternalChildUnderflow(childPageID)
 }
 
-// splitLeafPage splits a leaf page and returns the new root.
-func (bt *BPlusTree) splitLeafPage(pageID page.PageID, node *BPlusTreeNode) (page.PageID, error) {
-	// Split the node
-	newNode, promoteKey := node.splitLeaf(bt.leafCapacity)
+// splitLeafPage splits a leaf page and returns the split to propagate to the parent.
+func (bt *BPlusTree) splitLeafPage(pageID page.PageID, node *BPlusTreeNode) (*splitResult, error) {
+	// Split the node so that both halves take about the same space
+	newNode, promoteKey := node.splitLeaf(splitPoint(node.cellSizes()))
 
 	// Allocate a new page for the split node
 	newPage, err := bt.pageManager.AllocatePage(page.PageTypeLeaf)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	// Update next pointers for leaf linking
@@ -139,56 +125,48 @@ func (bt *BPlusTree) splitLeafPage(pageID page.PageID, node *BPlusTreeNode) (pag
 	// Write both nodes to their pages
 	originalPage, err := bt.pageManager.GetPage(pageID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if err := bt.writeNodeToPage(node, originalPage); err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if err := bt.writeNodeToPage(newNode, newPage); err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	// Create new root if this was the root page
-	if pageID == bt.root {
-		return bt.createNewRoot(pageID, newPage.ID(), promoteKey)
-	}
-
-	return newPage.ID(), nil
+	return &splitResult{separator: promoteKey, rightID: newPage.ID()}, nil
 }
 
-// splitInternalPage splits an internal page and returns the new root.
-func (bt *BPlusTree) splitInternalPage(pageID page.PageID, node *BPlusTreeNode) (page.PageID, error) {
-	// Split the node
-	newNode, promoteKey := node.splitInternal(bt.branchingFactor)
+// splitInternalPage splits an internal page and returns the split to propagate to the parent.
+func (bt *BPlusTree) splitInternalPage(pageID page.PageID, node *BPlusTreeNode) (*splitResult, error) {
+	// Split the node so that both halves take about the same space, keeping
+	// at least one key on each side of the promoted one
+	mid := min(splitPoint(node.cellSizes()), len(node.keys)-2)
+	newNode, promoteKey := node.splitInternal(max(mid, 1))
 
 	// Allocate a new page for the split node
 	newPage, err := bt.pageManager.AllocatePage(page.PageTypeInternal)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	// Write both nodes to their pages
 	originalPage, err := bt.pageManager.GetPage(pageID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if err := bt.writeNodeToPage(node, originalPage); err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if err := bt.writeNodeToPage(newNode, newPage); err != nil {
-		return 0, err
-	}
-
-	// Create new root if this was the root page
-	if pageID == bt.root {
-		return bt.createNewRoot(pageID, newPage.ID(), promoteKey)
+		return nil, err
 	}
 
-	return newPage.ID(), nil
+	return &splitResult{separator: promoteKey, rightID: newPage.ID()}, nil
 }
 
 // createNewRoot creates a new root node with two children.
@@ -212,16 +190,15 @@ func (bt *BPlusTree) createNewRoot(leftChildID, rightChildID page.PageID, separa
 	return newRootPage.ID(), nil
 }
 
-// handleLeafUnderflow handles underflow in a leaf node.
-func (bt *BPlusTree) handleLeafUnderflow(pageID page.PageID, node *BPlusTreeNode) error {
-	_ = pageID // Suppress unused parameter warning
+// handleLeafUnderflow handles underflow in a leaf node with numKeys keys.
+func (bt *BPlusTree) handleLeafUnderflow(pageID page.PageID, numKeys int) error {
 	minCapacity := bt.leafCapacity / 2
-	if len(node.keys) >= minCapacity {
+	if numKeys >= minCapacity {
 		return nil // No underflow
 	}
 
 	// If this is the root and it's empty, tree becomes empty
-	if pageID == bt.root && len(node.keys) == 0 {
+	if pageID == bt.root && numKeys == 0 {
 		// Tree becomes empty - this is acceptable for a leaf root
 		return nil
 	}
@@ -243,32 +220,21 @@ func (bt *BPlusTree) handleLeafUnderflow(pageID page.PageID, node *BPlusTreeNode
 }
 
 // handleInternalChildUnderflow handles underflow in a child of an internal node.
-func (bt *BPlusTree) handleInternalChildUnderflow(pageID page.PageID, node *BPlusTreeNode, childIndex int) error {
-	// Check if the child actually has underflow
-	if childIndex >= len(node.children) {
-		return nil // Invalid child index
-	}
-
-	childPageID := node.children[childIndex]
-	childPage, err := bt.pageManager.GetPage(childPageID)
-	if err != nil {
-		return err
-	}
-
-	childNode, err := bt.deserializeNode(childPage)
+func (bt *BPlusTree) handleInternalChildUnderflow(childPageID page.PageID) error {
+	childNode, err := bt.nodeAt(childPageID)
 	if err != nil {
 		return err
 	}
 
 	var minCapacity int
-	if childNode.isLeaf {
+	if childNode.isLeaf() {
 		minCapacity = bt.leafCapacity / 2
 	} else {
 		minCapacity = bt.branchingFactor / 2
 	}
 
 	// Check if child actually has underflow
-	if len(childNode.keys) >= minCapacity {
+	if childNode.count() >= minCapacity {
 		return nil // No underflow
 	}
 
@@ -292,25 +258,12 @@ func (bt *BPlusTree) handleInternalChildUnderflow(pageID page.PageID, node *BPlu
 	return nil
 }
 
-// writeNodeToPage serializes a node and writes it to a page.
+// writeNodeToPage writes a node to a page in the slotted layout.
 func (bt *BPlusTree) writeNodeToPage(node *BPlusTreeNode, pg *page.Page) error {
-	data, err := bt.serializeNode(node)
-	if err != nil {
+	if err := encodeNode(node, pg); err != nil {
 		return err
 	}
 
-	// Copy the serialized data to the page's data section
-	pageData := pg.Data()
-	if len(data) > len(pageData) {
-		return errors.New("serialized node too large for page")
-	}
-
-	copy(pageData, data)
-
-	// Clear any remaining data
-	for i := len(data); i < len(pageData); i++ {
-		pageData[i] = 0
-	}
-
-	return nil
+	// Hand the modified page back to the store so it reaches disk
+	return bt.pageManager.WritePage(pg)
 }
@@ -0,0 +1,186 @@
+package btree
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// Values larger than the inline limit are stored outside the leaf, in a chain
+// of overflow pages linked through their headers' next page field, and the
+// leaf holds only a reference to the chain. A leaf value is prefixed with a
+// tag byte saying which form it takes:
+//
+//	valueInline | value
+//	valueOverflow | first page (4) | value length (8)
+const (
+	valueInline   byte = 0
+	valueOverflow byte = 1
+
+	// overflowRefSize is the size of a reference to an overflow chain
+	overflowRefSize = 12
+)
+
+// overflowPageCapacity returns the number of value bytes an overflow page
+// holds.
+func (bt *BPlusTree) overflowPageCapacity() int {
+	return bt.pageSize - page.PageHeaderSize
+}
+
+// inlineValue returns the stored form of a value kept in the leaf.
+func inlineValue(value []byte) []byte {
+	stored := make([]byte, 1+len(value))
+	stored[0] = valueInline
+	copy(stored[1:], value)
+	return stored
+}
+
+// isOverflow reports whether a stored value refers to an overflow chain.
+func isOverflow(stored []byte) bool {
+	return len(stored) > 0 && stored[0] == valueOverflow
+}
+
+// decodeOverflowRef returns the first page and length of an overflow chain.
+func decodeOverflowRef(stored []byte) (page.PageID, int, error) {
+	if len(stored) != 1+overflowRefSize {
+		return 0, 0, fmt.Errorf("%w: malformed overflow reference", ErrTreeCorrupted)
+	}
+
+	first := page.PageID(binary.LittleEndian.Uint32(stored[1:5]))
+	length := binary.LittleEndian.Uint64(stored[5:13])
+	if first == page.InvalidPageID || length == 0 || length > uint64(int(^uint(0)>>1)) {
+		return 0, 0, fmt.Errorf("%w: malformed overflow reference", ErrTreeCorrupted)
+	}
+
+	return first, int(length), nil
+}
+
+// storeValue returns the form in which a value is kept in a leaf, writing it
+// to a new overflow chain if it is too large to keep inline.
+func (bt *BPlusTree) storeValue(value []byte) ([]byte, error) {
+	if len(value) <= bt.maxInlineValueSize {
+		return inlineValue(value), nil
+	}
+	return bt.writeOverflow(value)
+}
+
+// loadValue returns the value a stored leaf value represents, reading its
+// overflow chain if it has one.
+func (bt *BPlusTree) loadValue(stored []byte) ([]byte, error) {
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("%w: empty stored value", ErrTreeCorrupted)
+	}
+	if !isOverflow(stored) {
+		return stored[1:], nil
+	}
+	return bt.readOverflow(stored)
+}
+
+// freeValue deallocates the overflow chain of a stored leaf value, if any.
+func (bt *BPlusTree) freeValue(stored []byte) error {
+	if !isOverflow(stored) {
+		return nil
+	}
+	return bt.freeOverflow(stored)
+}
+
+// writeOverflow writes a value to a new chain of overflow pages and returns
+// the stored form of a reference to it. Each page is written once, after the
+// page following it has been allocated, so that its next page link is final.
+func (bt *BPlusTree) writeOverflow(value []byte) ([]byte, error) {
+	var first page.PageID
+	var prev *page.Page
+
+	for offset := 0; offset < len(value); {
+		pg, err := bt.pageManager.AllocatePage(page.PageTypeOverflow)
+		if err != nil {
+			return nil, err
+		}
+		offset += copy(pg.Data(), value[offset:])
+
+		if prev == nil {
+			first = pg.ID()
+		} else {
+			prev.SetNextPage(pg.ID())
+			if err := bt.pageManager.WritePage(prev); err != nil {
+				return nil, err
+			}
+		}
+		prev = pg
+	}
+
+	prev.SetNextPage(page.InvalidPageID)
+	if err := bt.pageManager.WritePage(prev); err != nil {
+		return nil, err
+	}
+
+	stored := make([]byte, 1+overflowRefSize)
+	stored[0] = valueOverflow
+	binary.LittleEndian.PutUint32(stored[1:5], uint32(first))
+	binary.LittleEndian.PutUint64(stored[5:13], uint64(len(value)))
+	return stored, nil
+}
+
+// readOverflow reads the value an overflow reference points to.
+func (bt *BPlusTree) readOverflow(stored []byte) ([]byte, error) {
+	first, length, err := decodeOverflowRef(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, length)
+	pageID := first
+	for offset := 0; offset < length; {
+		pg, err := bt.overflowPage(pageID)
+		if err != nil {
+			return nil, err
+		}
+		offset += copy(value[offset:], pg.Data())
+		pageID = pg.NextPage()
+	}
+
+	return value, nil
+}
+
+// freeOverflow deallocates the pages of the chain an overflow reference
+// points to.
+func (bt *BPlusTree) freeOverflow(stored []byte) error {
+	first, length, err := decodeOverflowRef(stored)
+	if err != nil {
+		return err
+	}
+
+	pageID := first
+	for remaining := length; remaining > 0; remaining -= bt.overflowPageCapacity() {
+		pg, err := bt.overflowPage(pageID)
+		if err != nil {
+			return err
+		}
+		next := pg.NextPage()
+
+		if err := bt.pageManager.DeallocatePage(pageID); err != nil {
+			return err
+		}
+		pageID = next
+	}
+
+	return nil
+}
+
+// overflowPage reads a page of an overflow chain.
+func (bt *BPlusTree) overflowPage(pageID page.PageID) (*page.Page, error) {
+	if pageID == page.InvalidPageID {
+		return nil, fmt.Errorf("%w: overflow chain ends early", ErrTreeCorrupted)
+	}
+
+	pg, err := bt.pageManager.GetPage(pageID)
+	if err != nil {
+		return nil, err
+	}
+	if pg.Type() != page.PageTypeOverflow {
+		return nil, fmt.Errorf("%w: page %d in overflow chain is a %s page", ErrTreeCorrupted, pageID, pg.Type())
+	}
+
+	return pg, nil
+}
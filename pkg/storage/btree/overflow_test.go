@@ -0,0 +1,221 @@
+package btree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// overflowPageCapacity is the number of value bytes an overflow page of the
+// default size holds.
+const overflowPageCapacity = page.PageSize - page.PageHeaderSize
+
+// largeValue returns a value of n bytes that differs for each seed.
+func largeValue(seed, n int) []byte {
+	value := make([]byte, n)
+	for i := range value {
+		value[i] = byte(seed + i*7)
+	}
+	return value
+}
+
+// overflowPages returns the number of overflow pages in use.
+func overflowPages(pm *page.Manager) int {
+	return pm.GetStatistics().PageTypeCounts[page.PageTypeOverflow]
+}
+
+func TestBPlusTree_OverflowValues(t *testing.T) {
+	pm := page.NewManager()
+	tree, err := NewBPlusTree(pm, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	sizes := []int{0, 128, 129, overflowPageCapacity, overflowPageCapacity + 1, 3 << 20}
+	for i, size := range sizes {
+		if err := tree.Put([]byte(fmt.Sprintf("key-%d", i)), largeValue(i, size)); err != nil {
+			t.Fatalf("Failed to put %d-byte value: %v", size, err)
+		}
+	}
+
+	// One page for each value up to a page, then one more, then a chain
+	expected := 1 + 1 + 2 + (3<<20+overflowPageCapacity-1)/overflowPageCapacity
+	if n := overflowPages(pm); n != expected {
+		t.Errorf("Expected %d overflow pages, got %d", expected, n)
+	}
+
+	for i, size := range sizes {
+		value, err := tree.Get([]byte(fmt.Sprintf("key-%d", i)))
+		if err != nil {
+			t.Fatalf("Failed to get %d-byte value: %v", size, err)
+		}
+		if !bytes.Equal(value, largeValue(i, size)) {
+			t.Errorf("Value of %d bytes did not round-trip (got %d bytes)", size, len(value))
+		}
+	}
+
+	// The cursor reads the chains too
+	cursor := tree.NewCursor(nil, nil)
+	defer cursor.Close()
+	i := 0
+	for cursor.SeekToFirst(); cursor.Valid(); cursor.Next() {
+		if !bytes.Equal(cursor.Value(), largeValue(i, sizes[i])) {
+			t.Errorf("Cursor value for %s did not round-trip", cursor.Key())
+		}
+		i++
+	}
+	if cursor.Error() != nil || i != len(sizes) {
+		t.Errorf("Expected %d entries without error, got %d and %v", len(sizes), i, cursor.Error())
+	}
+
+	if err := tree.Put([]byte("too-big"), make([]byte, DefaultConfig().MaxValueSize+1)); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("Expected ErrValueTooLarge, got %v", err)
+	}
+}
+
+func TestBPlusTree_OverflowFreed(t *testing.T) {
+	pm := page.NewManager()
+	tree, err := NewBPlusTree(pm, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	key := []byte("doc")
+	if err := tree.Put(key, largeValue(1, 5*overflowPageCapacity)); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if n := overflowPages(pm); n != 5 {
+		t.Fatalf("Expected 5 overflow pages, got %d", n)
+	}
+
+	// Overwriting frees the old chain
+	if err := tree.Put(key, largeValue(2, 2*overflowPageCapacity)); err != nil {
+		t.Fatalf("Failed to overwrite: %v", err)
+	}
+	if n := overflowPages(pm); n != 2 {
+		t.Errorf("Expected 2 overflow pages after overwrite, got %d", n)
+	}
+
+	// So does overwriting with a small value
+	if err := tree.Put(key, []byte("small")); err != nil {
+		t.Fatalf("Failed to overwrite: %v", err)
+	}
+	if n := overflowPages(pm); n != 0 {
+		t.Errorf("Expected no overflow pages after a small overwrite, got %d", n)
+	}
+
+	// And deleting
+	if err := tree.Put(key, largeValue(3, 3*overflowPageCapacity)); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := tree.Delete(key); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if n := overflowPages(pm); n != 0 {
+		t.Errorf("Expected no overflow pages after delete, got %d", n)
+	}
+}
+
+func TestBPlusTree_OverflowCursorAfterChange(t *testing.T) {
+	tree, err := NewBPlusTree(page.NewManager(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := tree.Put(cursorKey(i), largeValue(i, 1000)); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	cursor := tree.NewCursor(nil, nil)
+	defer cursor.Close()
+	cursor.SeekToFirst()
+
+	// The cursor's copy of the leaf refers to the chain the overwrite frees
+	if err := tree.Put(cursorKey(0), largeValue(9, 2000)); err != nil {
+		t.Fatalf("Failed to overwrite: %v", err)
+	}
+	if !bytes.Equal(cursor.Value(), largeValue(9, 2000)) {
+		t.Error("Expected the cursor to read the current value")
+	}
+
+	if err := tree.Delete(cursorKey(0)); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if value := cursor.Value(); value != nil {
+		t.Errorf("Expected no value for a deleted key, got %d bytes", len(value))
+	}
+	if cursor.Error() != nil {
+		t.Errorf("Unexpected cursor error: %v", cursor.Error())
+	}
+}
+
+func TestValidateConfig_InlineValues(t *testing.T) {
+	// Values that must stay inline have to fit in a leaf
+	config := &Config{BranchingFactor: 4, LeafCapacity: 32, MaxKeySize: 64, MaxValueSize: 4096}
+	if err := validateConfig(config, page.PageSize); err == nil {
+		t.Error("Expected an error for inline values too large for a leaf")
+	}
+
+	// With overflow pages only the inline limit counts
+	config.MaxInlineValueSize = 128
+	if err := validateConfig(config, page.PageSize); err != nil {
+		t.Errorf("Expected config with overflow values to be valid, got %v", err)
+	}
+
+	config.MaxInlineValueSize = -1
+	if err := validateConfig(config, page.PageSize); err == nil {
+		t.Error("Expected an error for a negative inline limit")
+	}
+
+	// Larger pages hold larger entries
+	config.MaxInlineValueSize = 0
+	if err := validateConfig(config, page.MaxPageSize); err != nil {
+		t.Errorf("Expected inline values to fit in a %d-byte leaf, got %v", page.MaxPageSize, err)
+	}
+}
+
+func TestBPlusTree_PageSizes(t *testing.T) {
+	for _, size := range []int{page.MinPageSize, page.MaxPageSize} {
+		pm := page.NewManagerWithPageSize(size)
+		tree, err := NewBPlusTree(pm, DefaultConfig())
+		if err != nil {
+			t.Fatalf("Failed to create tree over %d-byte pages: %v", size, err)
+		}
+
+		const numKeys = 2000
+		for i := 0; i < numKeys; i++ {
+			if err := tree.Put([]byte(fmt.Sprintf("key-%05d", i)), largeValue(i, 100)); err != nil {
+				t.Fatalf("Failed to put key %d: %v", i, err)
+			}
+		}
+		capacity := size - page.PageHeaderSize
+		if err := tree.Put([]byte("large"), largeValue(0, 3*capacity)); err != nil {
+			t.Fatalf("Failed to put large value: %v", err)
+		}
+
+		// Overflow pages are filled to the page size
+		if n := overflowPages(pm); n != 3 {
+			t.Errorf("Expected 3 overflow pages of %d bytes, got %d", size, n)
+		}
+		// Leaves hold as many entries as fit in the page
+		leaves := pm.GetStatistics().PageTypeCounts[page.PageTypeLeaf]
+		if perLeaf := numKeys / leaves; perLeaf > capacity/100 || perLeaf < capacity/400 {
+			t.Errorf("Expected leaves sized for %d-byte pages, got %d entries per leaf", size, perLeaf)
+		}
+
+		for i := 0; i < numKeys; i++ {
+			value, err := tree.Get([]byte(fmt.Sprintf("key-%05d", i)))
+			if err != nil || !bytes.Equal(value, largeValue(i, 100)) {
+				t.Fatalf("Failed to get key %d: %v", i, err)
+			}
+		}
+		if value, err := tree.Get([]byte("large")); err != nil || !bytes.Equal(value, largeValue(0, 3*capacity)) {
+			t.Fatalf("Failed to get large value: %v", err)
+		}
+	}
+}
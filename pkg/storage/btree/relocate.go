@@ -0,0 +1,190 @@
+package btree
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// Relocate moves the pages of the tree whose IDs are at least bound to newly
+// allocated pages and frees the old ones, updating the references to them:
+// the parent's child pointer or the root, the previous leaf's next link, and
+// the leaf or overflow page pointing at an overflow page. It moves at most
+// limit pages and returns how many it moved, so fewer than limit means that
+// no page at or past bound is left.
+//
+// The page store must hand out pages below bound and must not reuse pages
+// freed during the call; the storage engine runs it in an update, whose
+// freed pages only become reusable when it commits.
+func (bt *BPlusTree) Relocate(bound page.PageID, limit int) (int, error) {
+	bt.treeLatch.Lock()
+	defer bt.treeLatch.Unlock()
+	bt.modCount++
+
+	r := &relocation{tree: bt, bound: bound, limit: limit}
+	root, err := r.node(bt.root, bt.height)
+	if err != nil {
+		return r.moved, err
+	}
+	bt.root = root
+
+	return r.moved, nil
+}
+
+// relocation tracks the state of a Relocate walk, which visits the tree in
+// key order so that the leaves are seen in the order they are linked.
+type relocation struct {
+	tree  *BPlusTree
+	bound page.PageID
+	limit int
+	moved int
+
+	// prevLeaf is the last leaf visited, whose next link may need updating
+	prevLeaf *page.Page
+}
+
+// done reports whether the walk has moved as many pages as it may.
+func (r *relocation) done() bool {
+	return r.moved >= r.limit
+}
+
+// node relocates the subtree rooted at a page and returns the page's ID,
+// which is new if the page itself was moved. Every reference patched in the
+// page is written back at once: the page manager does not keep pages pinned,
+// so fetching the next page may evict this one, and it must not reach the
+// file with changes the log has not seen.
+func (r *relocation) node(pageID page.PageID, height int) (page.PageID, error) {
+	if r.done() {
+		return pageID, nil
+	}
+
+	pg, moved, err := r.move(pageID)
+	if err != nil {
+		return pageID, err
+	}
+
+	n, err := openNode(pg)
+	if err != nil {
+		return pageID, err
+	}
+	if n.isLeaf() != (height == 0) {
+		return pageID, fmt.Errorf("%w: page %d is at the wrong level", ErrTreeCorrupted, pageID)
+	}
+
+	if n.isLeaf() {
+		if moved && r.prevLeaf != nil {
+			r.prevLeaf.SetNextPage(pg.ID())
+			if err := r.tree.pageManager.WritePage(r.prevLeaf); err != nil {
+				return pageID, err
+			}
+		}
+		r.prevLeaf = pg
+
+		for i := 0; i < n.count() && !r.done(); i++ {
+			stored := n.value(i)
+			if !isOverflow(stored) {
+				continue
+			}
+
+			first, err := r.chain(stored)
+			if err != nil {
+				return pageID, err
+			}
+			if first != page.PageID(binary.LittleEndian.Uint32(stored[1:5])) {
+				binary.LittleEndian.PutUint32(stored[1:5], uint32(first))
+				if err := r.tree.pageManager.WritePage(pg); err != nil {
+					return pageID, err
+				}
+			}
+		}
+	} else {
+		for i := 0; i <= n.count() && !r.done(); i++ {
+			child, err := r.node(n.child(i), height-1)
+			if err != nil {
+				return pageID, err
+			}
+			if child != n.child(i) {
+				binary.LittleEndian.PutUint32(pg.Cell(i), uint32(child))
+				if err := r.tree.pageManager.WritePage(pg); err != nil {
+					return pageID, err
+				}
+			}
+		}
+	}
+
+	return pg.ID(), nil
+}
+
+// chain relocates the pages of the overflow chain a stored value refers to
+// and returns the chain's first page.
+func (r *relocation) chain(stored []byte) (page.PageID, error) {
+	first, length, err := decodeOverflowRef(stored)
+	if err != nil {
+		return first, err
+	}
+
+	var prev *page.Page
+	pageID := first
+	for remaining := length; remaining > 0 && !r.done(); remaining -= r.tree.overflowPageCapacity() {
+		pg, err := r.tree.overflowPage(pageID)
+		if err != nil {
+			return first, err
+		}
+		next := pg.NextPage()
+
+		if pageID >= r.bound {
+			if pg, _, err = r.move(pageID); err != nil {
+				return first, err
+			}
+
+			if prev == nil {
+				first = pg.ID()
+			} else {
+				prev.SetNextPage(pg.ID())
+				if err := r.tree.pageManager.WritePage(prev); err != nil {
+					return first, err
+				}
+			}
+		}
+
+		prev = pg
+		pageID = next
+	}
+
+	return first, nil
+}
+
+// move copies a page at or past the bound to a newly allocated page, which
+// is written, and frees it, returning the page now holding its contents and
+// whether it was moved. A page below the bound is returned as it is.
+func (r *relocation) move(pageID page.PageID) (*page.Page, bool, error) {
+	pg, err := r.tree.pageManager.GetPage(pageID)
+	if err != nil {
+		return nil, false, err
+	}
+	if pageID < r.bound {
+		return pg, false, nil
+	}
+
+	moved, err := r.tree.pageManager.AllocatePage(pg.Type())
+	if err != nil {
+		return nil, false, err
+	}
+	if moved.ID() >= r.bound {
+		return nil, false, fmt.Errorf("page %d allocated to relocate page %d is not below %d", moved.ID(), pageID, r.bound)
+	}
+
+	if err := moved.SetImage(pg.Image()); err != nil {
+		return nil, false, err
+	}
+	if err := r.tree.pageManager.WritePage(moved); err != nil {
+		return nil, false, err
+	}
+	if err := r.tree.pageManager.DeallocatePage(pageID); err != nil {
+		return nil, false, err
+	}
+
+	r.moved++
+	return moved, true, nil
+}
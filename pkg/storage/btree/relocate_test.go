@@ -0,0 +1,238 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// deferredFreeStore is a page store that only frees pages when asked, like
+// the storage engine's page manager at the end of an update.
+type deferredFreeStore struct {
+	*page.Manager
+	pending []page.PageID
+}
+
+func (s *deferredFreeStore) DeallocatePage(pageID page.PageID) error {
+	s.pending = append(s.pending, pageID)
+	return nil
+}
+
+// treePages returns the IDs of the pages reachable from the tree's root,
+// including overflow pages.
+func treePages(t *testing.T, bt *BPlusTree) []page.PageID {
+	t.Helper()
+
+	var pages []page.PageID
+	var walk func(pageID page.PageID)
+	walk = func(pageID page.PageID) {
+		pages = append(pages, pageID)
+		n, err := bt.nodeAt(pageID)
+		if err != nil {
+			t.Fatalf("Failed to read node %d: %v", pageID, err)
+		}
+		if !n.isLeaf() {
+			for i := 0; i <= n.count(); i++ {
+				walk(n.child(i))
+			}
+			return
+		}
+		for i := 0; i < n.count(); i++ {
+			if stored := n.value(i); isOverflow(stored) {
+				first, _, _ := decodeOverflowRef(stored)
+				for id := first; id != page.InvalidPageID; {
+					pages = append(pages, id)
+					pg, err := bt.overflowPage(id)
+					if err != nil {
+						t.Fatalf("Failed to read overflow page %d: %v", id, err)
+					}
+					id = pg.NextPage()
+				}
+			}
+		}
+	}
+	walk(bt.root)
+	return pages
+}
+
+func TestBPlusTree_Relocate(t *testing.T) {
+	store := &deferredFreeStore{Manager: page.NewManager()}
+
+	// Reserve the start of the store, so that the tree is built past it
+	const reserved = 1000
+	for i := 0; i < reserved; i++ {
+		if _, err := store.AllocatePage(page.PageTypeLeaf); err != nil {
+			t.Fatalf("Failed to allocate page: %v", err)
+		}
+	}
+
+	tree, err := NewBPlusTree(store, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	value := func(i int) []byte {
+		if i%10 == 0 {
+			return largeValue(i, 3*overflowPageCapacity)
+		}
+		return []byte(fmt.Sprintf("value-%d", i))
+	}
+	for i := 0; i < 1000; i++ {
+		if err := tree.Put(cursorKey(i), value(i)); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if tree.Stats().Height == 0 {
+		t.Fatal("Expected a tree of several levels")
+	}
+
+	// Free the reserved pages so that they are handed out lowest first
+	for id := page.PageID(reserved); id >= 1; id-- {
+		if err := store.Manager.DeallocatePage(id); err != nil {
+			t.Fatalf("Failed to free page %d: %v", id, err)
+		}
+	}
+
+	bound := page.PageID(reserved + 1)
+	numPages := len(treePages(t, tree))
+
+	// Move the pages a few at a time
+	moved := 0
+	for {
+		n, err := tree.Relocate(bound, 7)
+		if err != nil {
+			t.Fatalf("Failed to relocate: %v", err)
+		}
+		moved += n
+		if n < 7 {
+			break
+		}
+	}
+	if moved != numPages {
+		t.Errorf("Expected %d pages to move, moved %d", numPages, moved)
+	}
+	if len(store.pending) != numPages {
+		t.Errorf("Expected %d old pages to be freed, got %d", numPages, len(store.pending))
+	}
+
+	for _, id := range treePages(t, tree) {
+		if id >= bound {
+			t.Errorf("Page %d was left past the bound", id)
+		}
+	}
+
+	// Every entry is still found, and the leaves are linked in order
+	for i := 0; i < 1000; i++ {
+		got, err := tree.Get(cursorKey(i))
+		if err != nil || !bytes.Equal(got, value(i)) {
+			t.Fatalf("Unexpected value for %s: %v", cursorKey(i), err)
+		}
+	}
+	cursor := tree.NewCursor(nil, nil)
+	defer cursor.Close()
+	cursor.SeekToFirst()
+	if keys := collect(cursor); len(keys) != 1000 {
+		t.Errorf("Expected the leaves to link 1000 keys, got %d", len(keys))
+	}
+
+	// The store must hand out pages below the bound
+	if _, err := tree.Relocate(1, 1); err == nil {
+		t.Error("Expected error when no page below the bound is free")
+	}
+}
+
+// writeOrderStore is a page store that fails the test if a page it handed
+// out is changed and not written before another page is fetched, which a
+// page manager that does not keep pages pinned may evict it for.
+type writeOrderStore struct {
+	*deferredFreeStore
+	t        *testing.T
+	checking bool
+	images   map[*page.Page][]byte
+}
+
+func (s *writeOrderStore) check() {
+	s.t.Helper()
+	if !s.checking {
+		return
+	}
+	for pg, image := range s.images {
+		if !bytes.Equal(pg.Image(), image) {
+			s.t.Fatalf("Page %d was changed and not written before another page was fetched", pg.ID())
+		}
+	}
+}
+
+func (s *writeOrderStore) track(pg *page.Page) {
+	s.images[pg] = pg.Image()
+}
+
+func (s *writeOrderStore) GetPage(pageID page.PageID) (*page.Page, error) {
+	s.check()
+	pg, err := s.deferredFreeStore.GetPage(pageID)
+	if err == nil {
+		s.track(pg)
+	}
+	return pg, err
+}
+
+func (s *writeOrderStore) AllocatePage(pageType page.PageType) (*page.Page, error) {
+	s.check()
+	pg, err := s.deferredFreeStore.AllocatePage(pageType)
+	if err == nil {
+		s.track(pg)
+	}
+	return pg, err
+}
+
+func (s *writeOrderStore) WritePage(pg *page.Page) error {
+	s.track(pg)
+	return s.deferredFreeStore.WritePage(pg)
+}
+
+func TestBPlusTree_RelocateWritesPatchedPages(t *testing.T) {
+	store := &writeOrderStore{
+		deferredFreeStore: &deferredFreeStore{Manager: page.NewManager()},
+		t:                 t,
+		images:            make(map[*page.Page][]byte),
+	}
+
+	const reserved = 200
+	for i := 0; i < reserved; i++ {
+		if _, err := store.AllocatePage(page.PageTypeLeaf); err != nil {
+			t.Fatalf("Failed to allocate page: %v", err)
+		}
+	}
+	tree, err := NewBPlusTree(store, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for i := 0; i < 300; i++ {
+		value := []byte(fmt.Sprintf("value-%d", i))
+		if i%10 == 0 {
+			value = largeValue(i, 2*overflowPageCapacity)
+		}
+		if err := tree.Put(cursorKey(i), value); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	for id := page.PageID(reserved); id >= 1; id-- {
+		if err := store.Manager.DeallocatePage(id); err != nil {
+			t.Fatalf("Failed to free page %d: %v", id, err)
+		}
+	}
+
+	// Each call starts from pages just fetched, as an update does
+	store.checking = true
+	for {
+		clear(store.images)
+		n, err := tree.Relocate(reserved+1, 5)
+		if err != nil {
+			t.Fatalf("Failed to relocate: %v", err)
+		}
+		if n < 5 {
+			break
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package btree
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// diffStore is a page store that counts the bytes each write changes.
+type diffStore struct {
+	*page.Manager
+	images  map[page.PageID][]byte
+	changed int
+}
+
+func newDiffStore() *diffStore {
+	return &diffStore{Manager: page.NewManager(), images: make(map[page.PageID][]byte)}
+}
+
+func (s *diffStore) GetPage(pageID page.PageID) (*page.Page, error) {
+	pg, err := s.Manager.GetPage(pageID)
+	if err == nil {
+		s.images[pageID] = pg.Image()
+	}
+	return pg, err
+}
+
+func (s *diffStore) WritePage(pg *page.Page) error {
+	before, after := s.images[pg.ID()], pg.Image()
+	for i := range after {
+		if before == nil || before[i] != after[i] {
+			s.changed++
+		}
+	}
+	s.images[pg.ID()] = after
+	return s.Manager.WritePage(pg)
+}
+
+func TestBPlusTree_CapacityByBytes(t *testing.T) {
+	// Small entries all fit in the root leaf
+	small, err := NewBPlusTree(page.NewManager(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		if err := small.Put(cursorKey(i), []byte{byte(i)}); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if height := small.Stats().Height; height != 0 {
+		t.Errorf("Expected 200 small entries to fit in one leaf, got height %d", height)
+	}
+
+	// The same number of large entries do not
+	large, err := NewBPlusTree(page.NewManager(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		if err := large.Put(cursorKey(i), largeValue(i, 100)); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if height := large.Stats().Height; height != 1 {
+		t.Errorf("Expected 200 large entries to need several leaves, got height %d", height)
+	}
+
+	// Leaves of mixed sizes are split by bytes, so every entry is still found
+	for i := 0; i < 200; i += 2 {
+		if err := small.Put(cursorKey(i), largeValue(i, 120)); err != nil {
+			t.Fatalf("Failed to overwrite: %v", err)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		value, err := small.Get(cursorKey(i))
+		expected := []byte{byte(i)}
+		if i%2 == 0 {
+			expected = largeValue(i, 120)
+		}
+		if err != nil || !bytes.Equal(value, expected) {
+			t.Fatalf("Unexpected value for %s: %v", cursorKey(i), err)
+		}
+	}
+}
+
+func TestBPlusTree_InPlaceInsert(t *testing.T) {
+	store := newDiffStore()
+	tree, err := NewBPlusTree(store, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	for i := 1; i <= 200; i++ {
+		if err := tree.Put(cursorKey(i), []byte("value")); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if tree.Stats().Height != 0 {
+		t.Fatal("Expected the entries to fit in one leaf")
+	}
+
+	// Inserting before every other key only adds a cell and shifts the
+	// slots, rather than rewriting the entries after it
+	store.changed = 0
+	if err := tree.Put(cursorKey(0), []byte("value")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if limit := 200*page.SlotSize + 64; store.changed > limit {
+		t.Errorf("Expected an insert to change at most %d bytes, changed %d", limit, store.changed)
+	}
+
+	// Overwriting with a value of the same size changes only the value
+	store.changed = 0
+	if err := tree.Put(cursorKey(100), []byte("VALUE")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if store.changed > len("VALUE") {
+		t.Errorf("Expected an overwrite to change at most 5 bytes, changed %d", store.changed)
+	}
+
+	// Deleting removes the cell without moving the others
+	store.changed = 0
+	if err := tree.Delete(cursorKey(0)); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if limit := 201*page.SlotSize + 8; store.changed > limit {
+		t.Errorf("Expected a delete to change at most %d bytes, changed %d", limit, store.changed)
+	}
+}
+
+func TestOpenNode_Corrupted(t *testing.T) {
+	pg := page.NewPage(1, page.PageTypeLeaf)
+	if !pg.InsertCell(0, []byte{5, 0, 'k'}) {
+		t.Fatal("Failed to insert cell")
+	}
+	if _, err := openNode(pg); err == nil {
+		t.Error("Expected error for a cell shorter than its key")
+	}
+
+	internal := page.NewPage(2, page.PageTypeInternal)
+	if _, err := openNode(internal); err == nil {
+		t.Error("Expected error for an internal node without children")
+	}
+
+	if _, err := openNode(page.NewPage(3, page.PageTypeOverflow)); err == nil {
+		t.Error("Expected error for a page that is not a node")
+	}
+}
@@ -6,6 +6,7 @@ package buffer
 import (
 	"container/list"
 	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -60,6 +61,40 @@ func (f *Frame) SetDirty() {
 	f.IsDirty = true
 }
 
+// DiskManager is the backing store the buffer pool loads pages from on a miss
+// and writes dirty pages back to. Both file.FileManager and the in-memory
+// page.Manager satisfy it.
+type DiskManager interface {
+	// ReadPage reads a page from the backing store.
+	ReadPage(pageID page.PageID) (*page.Page, error)
+
+	// WritePage writes a page to the backing store.
+	WritePage(pg *page.Page) error
+}
+
+// BatchWriter is implemented by backing stores that write several pages at
+// once more cheaply than one at a time, as file.FileManager does. Flushing
+// the whole pool and evicting dirty pages use it when available.
+type BatchWriter interface {
+	// WritePages writes pages to the backing store.
+	WritePages(pages []*page.Page) error
+}
+
+// LogFlusher is the write-ahead log the buffer pool consults before writing a
+// page back. A page may only reach the backing store once the log is durable
+// up to the page's LSN.
+type LogFlusher interface {
+	// FlushedLSN returns the position up to which the log is durable.
+	FlushedLSN() uint64
+
+	// Flush makes the log durable up to at least the given LSN.
+	Flush(lsn uint64) error
+}
+
+// maxEvictionBatch is the most dirty pages written back together when one is
+// evicted.
+const maxEvictionBatch = 32
+
 // BufferPool manages a fixed-size buffer of page frames with LRU eviction.
 type BufferPool struct {
 	// poolSize is the maximum number of frames in the buffer pool.
@@ -80,8 +115,11 @@ type BufferPool struct {
 	// mu protects all buffer pool state.
 	mu sync.RWMutex
 
-	// pageManager is used for page allocation and I/O.
-	pageManager *page.Manager
+	// diskManager is the backing store used for page I/O.
+	diskManager DiskManager
+
+	// log is the write-ahead log guarding page write-back, if any.
+	log LogFlusher
 
 	// Statistics
 	stats Statistics
@@ -101,15 +139,22 @@ type Statistics struct {
 	// Evictions is the number of pages evicted from the buffer pool.
 	Evictions int64
 
-	// DirtyEvictions is the number of dirty pages evicted.
+	// DirtyEvictions is the number of dirty pages written back on eviction.
 	DirtyEvictions int64
 
+	// PageWrites is the number of pages written to the backing store.
+	PageWrites int64
+
+	// LogFlushes is the number of write-backs that had to flush the log first.
+	LogFlushes int64
+
 	// PinnedPages is the current number of pinned pages.
 	PinnedPages int64
 }
 
-// NewBufferPool creates a new buffer pool with the specified size.
-func NewBufferPool(poolSize int, pageManager *page.Manager) *BufferPool {
+// NewBufferPool creates a new buffer pool with the specified size on top of
+// the given backing store.
+func NewBufferPool(poolSize int, diskManager DiskManager) *BufferPool {
 	if poolSize <= 0 {
 		poolSize = 1024 // Default size
 	}
@@ -120,7 +165,7 @@ func NewBufferPool(poolSize int, pageManager *page.Manager) *BufferPool {
 		pageTable:   make(map[page.PageID]int),
 		freeList:    make([]int, poolSize),
 		lruList:     list.New(),
-		pageManager: pageManager,
+		diskManager: diskManager,
 	}
 
 	// Initialize frames and free list
@@ -138,6 +183,15 @@ func NewBufferPool(poolSize int, pageManager *page.Manager) *BufferPool {
 	return bp
 }
 
+// SetLog attaches a write-ahead log. From then on a dirty page is only written
+// back once the log is durable up to the page's LSN. It must be called before
+// the pool is used.
+func (bp *BufferPool) SetLog(log LogFlusher) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	bp.log = log
+}
+
 // GetPage retrieves a page from the buffer pool or loads it from storage.
 func (bp *BufferPool) GetPage(pageID page.PageID) (*page.Page, error) {
 	if pageID == page.InvalidPageID {
@@ -167,7 +221,7 @@ func (bp *BufferPool) GetPage(pageID page.PageID) (*page.Page, error) {
 	}
 
 	// Load page from storage
-	pg, err := bp.pageManager.GetPage(pageID)
+	pg, err := bp.diskManager.ReadPage(pageID)
 	if err != nil {
 		// Return frame to free list
 		bp.returnFrame(frame)
@@ -216,44 +270,195 @@ func (bp *BufferPool) UnpinPage(pageID page.PageID, isDirty bool) error {
 
 // FlushPage writes a specific page to storage if it's dirty.
 func (bp *BufferPool) FlushPage(pageID page.PageID) error {
-	bp.mu.RLock()
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	frameIndex, exists := bp.pageTable[pageID]
 	if !exists {
-		bp.mu.RUnlock()
 		return fmt.Errorf("page %d not found in buffer pool", pageID)
 	}
 
-	frame := bp.frames[frameIndex]
-	bp.mu.RUnlock()
+	return bp.flushFrame(bp.frames[frameIndex])
+}
 
+// flushFrame writes a frame's page to the backing store if it is dirty
+// (assumes lock is held). The frame stays dirty if the write fails.
+func (bp *BufferPool) flushFrame(frame *Frame) error {
 	if !frame.IsDirty {
 		return nil // Nothing to flush
 	}
 
-	// TODO: Implement actual page writing to storage
-	// For now, just mark as clean
-	bp.mu.Lock()
+	// WAL rule: the log records describing the page must be durable first
+	if bp.log != nil && frame.Page.LSN() > bp.log.FlushedLSN() {
+		if err := bp.log.Flush(frame.Page.LSN()); err != nil {
+			return fmt.Errorf("failed to flush log for page %d: %w", frame.PageID, err)
+		}
+		atomic.AddInt64(&bp.stats.LogFlushes, 1)
+	}
+
+	if err := bp.diskManager.WritePage(frame.Page); err != nil {
+		return fmt.Errorf("failed to write page %d: %w", frame.PageID, err)
+	}
+
 	frame.IsDirty = false
-	bp.mu.Unlock()
+	atomic.AddInt64(&bp.stats.PageWrites, 1)
+
+	return nil
+}
+
+// PutPage installs a modified page in the buffer pool and marks it dirty, so
+// that it is written back on eviction or flush. If a frame already holds the
+// page ID, its contents are replaced. The page is left unpinned.
+func (bp *BufferPool) PutPage(pg *page.Page) error {
+	if pg == nil {
+		return fmt.Errorf("cannot put nil page")
+	}
+	if pg.ID() == page.InvalidPageID {
+		return fmt.Errorf("invalid page ID")
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if frameIndex, exists := bp.pageTable[pg.ID()]; exists {
+		frame := bp.frames[frameIndex]
+		frame.Page = pg
+		frame.SetDirty()
+		frame.LastAccess = time.Now()
+		bp.moveToFront(frame)
+		return nil
+	}
+
+	frame, err := bp.allocateFrame()
+	if err != nil {
+		return fmt.Errorf("failed to allocate frame: %w", err)
+	}
+
+	frame.PageID = pg.ID()
+	frame.Page = pg
+	frame.IsDirty = true
+	frame.LastAccess = time.Now()
+
+	frameIndex := bp.getFrameIndex(frame)
+	bp.pageTable[pg.ID()] = frameIndex
+	frame.LRUElement = bp.lruList.PushFront(frameIndex)
 
 	return nil
 }
 
 // FlushAllPages writes all dirty pages to storage.
 func (bp *BufferPool) FlushAllPages() error {
-	bp.mu.RLock()
-	var dirtyPages []page.PageID
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	writer, ok := bp.diskManager.(BatchWriter)
+	if !ok {
+		for _, frameIndex := range bp.pageTable {
+			if err := bp.flushFrame(bp.frames[frameIndex]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var dirty []*Frame
+	for _, frameIndex := range bp.pageTable {
+		if frame := bp.frames[frameIndex]; frame.IsDirty {
+			dirty = append(dirty, frame)
+		}
+	}
+	return bp.flushFrames(writer, dirty)
+}
+
+// flushFrames writes dirty frames' pages to the backing store as one batch,
+// in page ID order (assumes lock is held).
+func (bp *BufferPool) flushFrames(writer BatchWriter, dirty []*Frame) error {
+	if len(dirty) == 0 {
+		return nil
+	}
+	sort.Slice(dirty, func(i, j int) bool { return dirty[i].PageID < dirty[j].PageID })
+
+	// WAL rule, for every page at once
+	var maxLSN uint64
+	for _, frame := range dirty {
+		maxLSN = max(maxLSN, frame.Page.LSN())
+	}
+	if bp.log != nil && maxLSN > bp.log.FlushedLSN() {
+		if err := bp.log.Flush(maxLSN); err != nil {
+			return fmt.Errorf("failed to flush log: %w", err)
+		}
+		atomic.AddInt64(&bp.stats.LogFlushes, 1)
+	}
+
+	pages := make([]*page.Page, len(dirty))
+	for i, frame := range dirty {
+		pages[i] = frame.Page
+	}
+	if err := writer.WritePages(pages); err != nil {
+		return fmt.Errorf("failed to write pages: %w", err)
+	}
+
+	for _, frame := range dirty {
+		frame.IsDirty = false
+	}
+	atomic.AddInt64(&bp.stats.PageWrites, int64(len(dirty)))
+
+	return nil
+}
+
+// writeBackVictim writes back a dirty frame chosen for eviction (assumes
+// lock is held). With a backing store that writes batches, the other dirty,
+// unpinned frames among the next least recently used, which are evicted
+// soon anyway, are written with it and stay cached clean. Only frames in
+// the least recently used quarter of the pool are considered, leaving
+// recently used pages alone.
+func (bp *BufferPool) writeBackVictim(victim *Frame) error {
+	writer, ok := bp.diskManager.(BatchWriter)
+	if !ok {
+		return bp.flushFrame(victim)
+	}
+
+	dirty := []*Frame{victim}
+	window := min(maxEvictionBatch, bp.poolSize/4)
+	element := victim.LRUElement
+	for i := 1; i < window; i++ {
+		if element = element.Prev(); element == nil {
+			break
+		}
+		if frame := bp.frames[element.Value.(int)]; frame.IsDirty && !frame.IsPinned() {
+			dirty = append(dirty, frame)
+		}
+	}
+	return bp.flushFrames(writer, dirty)
+}
+
+// DiscardPages drops the frames of every page with an ID of at least from,
+// without writing them back, so that a backing store truncated to from pages
+// is not extended again. None of the pages may be pinned.
+func (bp *BufferPool) DiscardPages(from page.PageID) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	for pageID, frameIndex := range bp.pageTable {
-		if bp.frames[frameIndex].IsDirty {
-			dirtyPages = append(dirtyPages, pageID)
+		if pageID >= from && bp.frames[frameIndex].IsPinned() {
+			return fmt.Errorf("cannot discard pinned page %d", pageID)
 		}
 	}
-	bp.mu.RUnlock()
 
-	for _, pageID := range dirtyPages {
-		if err := bp.FlushPage(pageID); err != nil {
-			return fmt.Errorf("failed to flush page %d: %w", pageID, err)
+	for pageID, frameIndex := range bp.pageTable {
+		if pageID < from {
+			continue
 		}
+
+		frame := bp.frames[frameIndex]
+		delete(bp.pageTable, pageID)
+		bp.lruList.Remove(frame.LRUElement)
+
+		frame.PageID = page.InvalidPageID
+		frame.Page = nil
+		frame.IsDirty = false
+		frame.LRUElement = nil
+		bp.freeList = append(bp.freeList, frameIndex)
 	}
 
 	return nil
@@ -280,10 +485,12 @@ func (bp *BufferPool) evictFrame() (*Frame, error) {
 		frame := bp.frames[frameIndex]
 
 		if !frame.IsPinned() {
-			// Found victim frame
+			// Found victim frame; write it back before reuse
 			if frame.IsDirty {
+				if err := bp.writeBackVictim(frame); err != nil {
+					return nil, fmt.Errorf("failed to evict page %d: %w", frame.PageID, err)
+				}
 				atomic.AddInt64(&bp.stats.DirtyEvictions, 1)
-				// TODO: Flush page to storage before evicting
 			}
 
 			atomic.AddInt64(&bp.stats.Evictions, 1)
@@ -1,10 +1,14 @@
 package buffer
 
 import (
+	"errors"
+	"fmt"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/thromel/go-database/pkg/storage/file"
 	"github.com/thromel/go-database/pkg/storage/page"
 )
 
@@ -347,6 +351,290 @@ func TestBufferPool_FlushAllPages(t *testing.T) {
 	}
 }
 
+func TestBufferPool_FileBacked(t *testing.T) {
+	fm, err := file.NewFileManager(filepath.Join(t.TempDir(), "pool.godb"), file.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	defer fm.Close()
+
+	bp := NewBufferPool(2, fm)
+
+	// Install three dirty pages in a two-frame pool, forcing an eviction
+	for id := page.PageID(1); id <= 3; id++ {
+		pg := page.NewPage(id, page.PageTypeLeaf)
+		pg.Data()[0] = byte(id)
+		if err := bp.PutPage(pg); err != nil {
+			t.Fatalf("Failed to put page %d: %v", id, err)
+		}
+	}
+
+	stats := bp.GetStatistics()
+	if stats.DirtyEvictions != 1 {
+		t.Errorf("Expected 1 dirty eviction, got %d", stats.DirtyEvictions)
+	}
+
+	// The evicted page must have been written to the file
+	onDisk, err := fm.ReadPage(1)
+	if err != nil {
+		t.Fatalf("Evicted page was not written back: %v", err)
+	}
+	if onDisk.Data()[0] != 1 {
+		t.Errorf("Expected evicted page data 1, got %d", onDisk.Data()[0])
+	}
+
+	// A miss must be served from the file
+	pg, err := bp.GetPage(1)
+	if err != nil {
+		t.Fatalf("Failed to read evicted page: %v", err)
+	}
+	if pg.Data()[0] != 1 {
+		t.Errorf("Expected page data 1 after reload, got %d", pg.Data()[0])
+	}
+	if err := bp.UnpinPage(1, false); err != nil {
+		t.Fatalf("Failed to unpin page: %v", err)
+	}
+
+	if err := bp.FlushAllPages(); err != nil {
+		t.Fatalf("Failed to flush all pages: %v", err)
+	}
+	for id := page.PageID(1); id <= 3; id++ {
+		onDisk, err := fm.ReadPage(id)
+		if err != nil {
+			t.Fatalf("Page %d not on disk after flush: %v", id, err)
+		}
+		if onDisk.Data()[0] != byte(id) {
+			t.Errorf("Expected page %d data %d, got %d", id, id, onDisk.Data()[0])
+		}
+	}
+}
+
+// failingDisk is a DiskManager whose writes always fail.
+type failingDisk struct {
+	*page.Manager
+}
+
+func (d failingDisk) WritePage(pg *page.Page) error {
+	return errors.New("disk full")
+}
+
+func TestBufferPool_WriteBackFailure(t *testing.T) {
+	bp := NewBufferPool(1, failingDisk{page.NewManager()})
+
+	if err := bp.PutPage(page.NewPage(1, page.PageTypeLeaf)); err != nil {
+		t.Fatalf("Failed to put page: %v", err)
+	}
+
+	// Evicting the dirty page fails, so it must stay in the pool
+	if err := bp.PutPage(page.NewPage(2, page.PageTypeLeaf)); err == nil {
+		t.Error("Expected error when the dirty victim cannot be written")
+	}
+
+	if err := bp.FlushPage(1); err == nil {
+		t.Error("Expected flush error from the backing store")
+	}
+
+	pg, err := bp.GetPage(1)
+	if err != nil {
+		t.Fatalf("Dirty page was dropped after failed write-back: %v", err)
+	}
+	if pg.ID() != 1 {
+		t.Errorf("Expected page 1, got %d", pg.ID())
+	}
+}
+
+func TestBufferPool_DiscardPages(t *testing.T) {
+	disk := page.NewManager()
+	bp := NewBufferPool(4, disk)
+
+	for id := page.PageID(1); id <= 4; id++ {
+		if err := bp.PutPage(page.NewPage(id, page.PageTypeLeaf)); err != nil {
+			t.Fatalf("Failed to put page %d: %v", id, err)
+		}
+	}
+
+	if _, err := bp.GetPage(4); err != nil {
+		t.Fatalf("Failed to get page: %v", err)
+	}
+	if err := bp.DiscardPages(3); err == nil {
+		t.Error("Expected error discarding a pinned page")
+	}
+	if err := bp.UnpinPage(4, false); err != nil {
+		t.Fatalf("Failed to unpin page: %v", err)
+	}
+
+	if err := bp.DiscardPages(3); err != nil {
+		t.Fatalf("Failed to discard pages: %v", err)
+	}
+
+	// Discarded pages are dropped without being written back
+	if err := bp.FlushAllPages(); err != nil {
+		t.Fatalf("Failed to flush pages: %v", err)
+	}
+	for id := page.PageID(1); id <= 4; id++ {
+		_, err := disk.GetPage(id)
+		if written := err == nil; written != (id < 3) {
+			t.Errorf("Page %d written back: %v", id, written)
+		}
+	}
+
+	// Their frames are free for other pages without evicting the rest
+	for id := page.PageID(5); id <= 6; id++ {
+		if err := bp.PutPage(page.NewPage(id, page.PageTypeLeaf)); err != nil {
+			t.Fatalf("Failed to put page %d: %v", id, err)
+		}
+	}
+	if evictions := bp.GetStatistics().Evictions; evictions != 0 {
+		t.Errorf("Expected no evictions, got %d", evictions)
+	}
+}
+
+// fakeLog is a LogFlusher that records flush requests.
+type fakeLog struct {
+	flushed uint64
+	flushes []uint64
+}
+
+func (l *fakeLog) FlushedLSN() uint64 { return l.flushed }
+
+func (l *fakeLog) Flush(lsn uint64) error {
+	l.flushes = append(l.flushes, lsn)
+	l.flushed = lsn
+	return nil
+}
+
+func TestBufferPool_WALRule(t *testing.T) {
+	bp := NewBufferPool(4, page.NewManager())
+	log := &fakeLog{flushed: 10}
+	bp.SetLog(log)
+
+	covered := page.NewPage(1, page.PageTypeLeaf)
+	covered.SetLSN(5)
+	ahead := page.NewPage(2, page.PageTypeLeaf)
+	ahead.SetLSN(42)
+
+	for _, pg := range []*page.Page{covered, ahead} {
+		if err := bp.PutPage(pg); err != nil {
+			t.Fatalf("Failed to put page %d: %v", pg.ID(), err)
+		}
+	}
+
+	if err := bp.FlushPage(covered.ID()); err != nil {
+		t.Fatalf("Failed to flush page: %v", err)
+	}
+	if len(log.flushes) != 0 {
+		t.Errorf("Expected no log flush for a page already covered, got %v", log.flushes)
+	}
+
+	if err := bp.FlushPage(ahead.ID()); err != nil {
+		t.Fatalf("Failed to flush page: %v", err)
+	}
+	if len(log.flushes) != 1 || log.flushes[0] != 42 {
+		t.Errorf("Expected the log to be flushed to LSN 42 first, got %v", log.flushes)
+	}
+	if bp.GetStatistics().LogFlushes != 1 {
+		t.Errorf("Expected 1 log flush in statistics, got %d", bp.GetStatistics().LogFlushes)
+	}
+}
+
+// batchDisk is a DiskManager that records the batches of pages written.
+type batchDisk struct {
+	*page.Manager
+	batches [][]page.PageID
+}
+
+func (d *batchDisk) WritePages(pages []*page.Page) error {
+	ids := make([]page.PageID, len(pages))
+	for i, pg := range pages {
+		ids[i] = pg.ID()
+	}
+	d.batches = append(d.batches, ids)
+	return nil
+}
+
+func TestBufferPool_FlushAllPagesBatch(t *testing.T) {
+	disk := &batchDisk{Manager: page.NewManager()}
+	bp := NewBufferPool(8, disk)
+	log := &fakeLog{}
+	bp.SetLog(log)
+
+	for _, id := range []page.PageID{3, 1, 2} {
+		pg := page.NewPage(id, page.PageTypeLeaf)
+		pg.SetLSN(uint64(10 * id))
+		if err := bp.PutPage(pg); err != nil {
+			t.Fatalf("Failed to put page %d: %v", id, err)
+		}
+	}
+
+	if err := bp.FlushAllPages(); err != nil {
+		t.Fatalf("Failed to flush all pages: %v", err)
+	}
+	if len(disk.batches) != 1 || fmt.Sprint(disk.batches[0]) != "[1 2 3]" {
+		t.Errorf("Expected one batch of pages 1 to 3, got %v", disk.batches)
+	}
+	if len(log.flushes) != 1 || log.flushes[0] != 30 {
+		t.Errorf("Expected one log flush to LSN 30, got %v", log.flushes)
+	}
+	if stats := bp.GetStatistics(); stats.PageWrites != 3 {
+		t.Errorf("Expected 3 page writes, got %d", stats.PageWrites)
+	}
+
+	// Nothing is dirty any more
+	if err := bp.FlushAllPages(); err != nil {
+		t.Fatalf("Failed to flush all pages: %v", err)
+	}
+	if len(disk.batches) != 1 {
+		t.Errorf("Expected no further batches, got %v", disk.batches)
+	}
+}
+
+func TestBufferPool_EvictionBatch(t *testing.T) {
+	disk := &batchDisk{Manager: page.NewManager()}
+	bp := NewBufferPool(16, disk)
+	log := &fakeLog{}
+	bp.SetLog(log)
+
+	for id := page.PageID(1); id <= 16; id++ {
+		pg := page.NewPage(id, page.PageTypeLeaf)
+		pg.SetLSN(uint64(id))
+		if err := bp.PutPage(pg); err != nil {
+			t.Fatalf("Failed to put page %d: %v", id, err)
+		}
+	}
+	if _, err := bp.GetPage(2); err != nil {
+		t.Fatalf("Failed to get page: %v", err)
+	}
+
+	// Evicting page 1 writes back the dirty, unpinned pages among the least
+	// recently used quarter of the pool with it; page 2, used since, is not
+	// among them
+	if err := bp.PutPage(page.NewPage(17, page.PageTypeLeaf)); err != nil {
+		t.Fatalf("Failed to put page: %v", err)
+	}
+	if len(disk.batches) != 1 || fmt.Sprint(disk.batches[0]) != "[1 3 4 5]" {
+		t.Errorf("Expected one batch of pages 1, 3, 4 and 5, got %v", disk.batches)
+	}
+	if len(log.flushes) != 1 || log.flushes[0] != 5 {
+		t.Errorf("Expected one log flush to LSN 5, got %v", log.flushes)
+	}
+
+	// The pages written with it are evicted without another write
+	if err := bp.UnpinPage(2, false); err != nil {
+		t.Fatalf("Failed to unpin page: %v", err)
+	}
+	for _, id := range []page.PageID{18, 19} {
+		if err := bp.PutPage(page.NewPage(id, page.PageTypeLeaf)); err != nil {
+			t.Fatalf("Failed to put page %d: %v", id, err)
+		}
+	}
+	if len(disk.batches) != 1 {
+		t.Errorf("Expected no further batches, got %v", disk.batches)
+	}
+	if stats := bp.GetStatistics(); stats.DirtyEvictions != 1 || stats.PageWrites != 4 {
+		t.Errorf("Expected 1 dirty eviction and 4 page writes, got %d and %d", stats.DirtyEvictions, stats.PageWrites)
+	}
+}
+
 func TestBufferPool_InvalidPageID(t *testing.T) {
 	pageManager := page.NewManager()
 	bp := NewBufferPool(5, pageManager)
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// compactBatchSize is the number of pages Compact moves in one update. The
+// engine is locked for the duration of a batch, so it bounds how long reads
+// and writes wait.
+const compactBatchSize = 256
+
+// CompactProgress reports how far a compaction has got.
+type CompactProgress struct {
+	// PagesMoved is the number of pages relocated so far
+	PagesMoved int
+
+	// PagesRemaining is the number of pages still to be relocated
+	PagesRemaining int
+
+	// FileSize is the size of the database file in bytes
+	FileSize int64
+}
+
+// Compact shrinks the database file by moving the pages in use toward its
+// start and truncating the free pages left at its end. Pages are moved in
+// batches, each one atomic, logged update; reads and writes proceed between
+// batches, and ctx is checked before each one. If ctx is cancelled, Compact
+// returns its error with the pages moved so far in place and the file
+// unchanged in size; compacting again continues from there.
+//
+// progress, if not nil, is called after each batch and once the file has
+// been truncated. The final progress is also returned.
+func (pe *PersistentEngine) Compact(ctx context.Context, progress func(CompactProgress)) (CompactProgress, error) {
+	var p CompactProgress
+	if pe.closed.Load() {
+		return p, utils.ErrDatabaseClosed
+	}
+
+	report := func() {
+		p.FileSize = pe.fileManager.GetFileSize()
+		if progress != nil {
+			progress(p)
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return p, err
+		}
+
+		moved, remaining, err := pe.relocateBatch()
+		if err != nil {
+			return p, fmt.Errorf("failed to relocate pages: %w", err)
+		}
+		p.PagesMoved += moved
+		p.PagesRemaining = remaining
+		report()
+
+		if moved < compactBatchSize {
+			break
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return p, err
+	}
+	if err := pe.truncate(); err != nil {
+		return p, err
+	}
+	report()
+
+	return p, nil
+}
+
+// relocateBatch moves up to compactBatchSize pages from the end of the file
+// to free pages before it, in one update. It returns the number of pages
+// moved and the number left to move.
+func (pe *PersistentEngine) relocateBatch() (int, int, error) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	if pe.closed.Load() {
+		return 0, 0, utils.ErrDatabaseClosed
+	}
+
+	// The bound is found anew for every batch, as writes between batches
+	// allocate and free pages
+	var moved, remaining int
+	_, err := pe.update(func() error {
+		bound, toMove := pe.pageManager.RelocationBound()
+		if toMove == 0 {
+			return nil
+		}
+
+		// Pages freed by the last batch were added to the free list in no
+		// particular order
+		if err := pe.pageManager.SortFreeList(); err != nil {
+			return err
+		}
+
+		var err error
+		moved, err = pe.btree.Relocate(bound, compactBatchSize)
+		remaining = toMove - moved
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return moved, remaining, nil
+}
+
+// truncate drops the free pages at the end of the file from the free list
+// and truncates the file after them.
+func (pe *PersistentEngine) truncate() error {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	if pe.closed.Load() {
+		return utils.ErrDatabaseClosed
+	}
+
+	var end page.PageID
+	_, err := pe.update(func() error {
+		var err error
+		end, err = pe.pageManager.Shrink()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to shrink free list: %w", err)
+	}
+
+	// The meta page must record the new size before the pages past it go,
+	// and the log must no longer refer to them
+	if err := pe.syncInternal(); err != nil {
+		return err
+	}
+
+	if int64(end) >= pe.fileManager.GetPageCount() {
+		return nil
+	}
+	if err := pe.bufferPool.DiscardPages(end); err != nil {
+		return fmt.Errorf("failed to discard truncated pages: %w", err)
+	}
+	if err := pe.fileManager.Truncate(int64(end)); err != nil {
+		return fmt.Errorf("failed to truncate database file: %w", err)
+	}
+
+	return nil
+}
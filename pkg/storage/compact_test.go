@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+	"github.com/thromel/go-database/pkg/storage/wal"
+)
+
+// compactTestConfig returns an engine configuration whose file is not
+// preallocated, so that its size follows the pages in use.
+func compactTestConfig(t *testing.T) *PersistentConfig {
+	config := DefaultPersistentConfig()
+	config.FilePath = filepath.Join(t.TempDir(), "compact.godb")
+	config.FileConfig.SyncWrites = false
+	config.FileConfig.PreallocateSize = 0
+	config.SyncOnWrite = false
+	return config
+}
+
+// compactValue returns the value of the i-th key in the compaction tests;
+// every fourth one is stored in overflow pages.
+func compactValue(i int) []byte {
+	if i%4 == 0 {
+		return bytes.Repeat([]byte{byte(i)}, 3*page.PageSize)
+	}
+	return []byte(fmt.Sprintf("value-%d", i))
+}
+
+// fillAndPurge writes 2000 keys and deletes all but every fifth one, leaving
+// most of the database file free.
+func fillAndPurge(t *testing.T, engine *PersistentEngine) {
+	t.Helper()
+
+	for i := 0; i < 2000; i++ {
+		if err := engine.Put(recoveryKey(i), compactValue(i)); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	for i := 0; i < 2000; i++ {
+		if i%5 != 0 {
+			if err := engine.Delete(recoveryKey(i)); err != nil {
+				t.Fatalf("Failed to delete: %v", err)
+			}
+		}
+	}
+	if err := engine.Sync(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+}
+
+// checkPurged verifies that exactly the keys kept by fillAndPurge remain.
+func checkPurged(t *testing.T, engine *PersistentEngine) {
+	t.Helper()
+
+	for i := 0; i < 2000; i++ {
+		value, err := engine.Get(recoveryKey(i))
+		if i%5 != 0 {
+			if err == nil {
+				t.Fatalf("Expected %s to be deleted", recoveryKey(i))
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(value, compactValue(i)) {
+			t.Fatalf("Unexpected value for %s: %v", recoveryKey(i), err)
+		}
+	}
+
+	it := engine.NewIterator(nil, nil)
+	defer it.Close()
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if it.Error() != nil || count != 400 {
+		t.Errorf("Expected to iterate over 400 keys, got %d: %v", count, it.Error())
+	}
+}
+
+func TestPersistentEngine_Compact(t *testing.T) {
+	config := compactTestConfig(t)
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	fillAndPurge(t, engine)
+
+	sizeBefore := engine.GetFileManager().GetFileSize()
+	inUse := engine.GetStats().PageCount
+
+	var reports []CompactProgress
+	result, err := engine.Compact(context.Background(), func(p CompactProgress) {
+		reports = append(reports, p)
+	})
+	if err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+
+	if len(reports) < 3 {
+		t.Errorf("Expected progress for several batches, got %d reports", len(reports))
+	}
+	if result.PagesMoved == 0 || result.PagesRemaining != 0 {
+		t.Errorf("Expected pages to be moved with none remaining, got %+v", result)
+	}
+	if reports[len(reports)-1] != result {
+		t.Errorf("Expected the last report to match the result, got %+v", reports[len(reports)-1])
+	}
+
+	// Only the meta page and the pages in use are left
+	expected := (inUse + 1) * page.PageSize
+	if result.FileSize != expected || engine.GetFileManager().GetFileSize() != expected {
+		t.Errorf("Expected the file to shrink from %d to %d bytes, got %d", sizeBefore, expected, result.FileSize)
+	}
+	if free := engine.GetStats().FreePageCount; free != 0 {
+		t.Errorf("Expected no free pages, got %d", free)
+	}
+	checkPurged(t, engine)
+
+	// Compacting again has nothing to do
+	again, err := engine.Compact(context.Background(), nil)
+	if err != nil || again.PagesMoved != 0 || again.FileSize != expected {
+		t.Errorf("Expected a second compaction to change nothing, got %+v: %v", again, err)
+	}
+
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+
+	checkPurged(t, engine)
+	if err := engine.Put(recoveryKey(1), compactValue(1)); err != nil {
+		t.Fatalf("Failed to put after compaction: %v", err)
+	}
+}
+
+func TestPersistentEngine_CompactCancel(t *testing.T) {
+	engine, err := NewPersistentEngine(compactTestConfig(t))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	fillAndPurge(t, engine)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := engine.Compact(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// Stop after the first batch: the pages moved so far stay moved, but the
+	// file keeps its size until a compaction finishes
+	size := engine.GetFileManager().GetFileSize()
+	ctx, cancel = context.WithCancel(context.Background())
+	result, err := engine.Compact(ctx, func(CompactProgress) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if result.PagesMoved != compactBatchSize || result.PagesRemaining == 0 {
+		t.Errorf("Expected one batch to be moved, got %+v", result)
+	}
+	if engine.GetFileManager().GetFileSize() != size {
+		t.Error("Expected an interrupted compaction not to truncate the file")
+	}
+	checkPurged(t, engine)
+
+	result, err = engine.Compact(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if result.FileSize >= size {
+		t.Errorf("Expected the file to shrink from %d bytes, got %d", size, result.FileSize)
+	}
+	checkPurged(t, engine)
+}
+
+func TestPersistentEngine_CompactConcurrentReads(t *testing.T) {
+	engine, err := NewPersistentEngine(compactTestConfig(t))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	fillAndPurge(t, engine)
+
+	// An iterator positioned before the compaction continues after it
+	it := engine.NewIterator(nil, nil)
+	defer it.Close()
+	for i := 0; i < 10; i++ {
+		it.Next()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := r * 5; ctx.Err() == nil; i = (i + 20) % 2000 {
+				value, err := engine.Get(recoveryKey(i))
+				if err != nil || !bytes.Equal(value, compactValue(i)) {
+					errs <- fmt.Errorf("unexpected value for %s: %v", recoveryKey(i), err)
+					return
+				}
+			}
+		}(r)
+	}
+
+	_, err = engine.Compact(context.Background(), nil)
+	cancel()
+	wg.Wait()
+	close(errs)
+	if err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	for err := range errs {
+		t.Error(err)
+	}
+
+	count := 10
+	for it.Next() {
+		if !bytes.Equal(it.Value(), compactValue(count*5)) {
+			t.Fatalf("Unexpected value for %s", it.Key())
+		}
+		count++
+	}
+	if it.Error() != nil || count != 400 {
+		t.Errorf("Expected the iterator to reach 400 keys, got %d: %v", count, it.Error())
+	}
+}
+
+func TestRecovery_Compact(t *testing.T) {
+	config := compactTestConfig(t)
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	fillAndPurge(t, engine)
+
+	// Crash after a batch has been moved and logged but not checkpointed
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := engine.Compact(ctx, func(CompactProgress) { cancel() }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if err := engine.wal.Flush(engine.wal.EndLSN()); err != nil {
+		t.Fatalf("Failed to flush log: %v", err)
+	}
+	simulateCrash(engine)
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+
+	if !engine.RecoveryReport().Performed {
+		t.Error("Expected the moved pages to be recovered from the log")
+	}
+	checkPurged(t, engine)
+
+	if _, err := engine.Compact(context.Background(), nil); err != nil {
+		t.Fatalf("Failed to compact after recovery: %v", err)
+	}
+	checkPurged(t, engine)
+}
+
+// simulatePowerLoss crashes the engine and drops the end of its log that was
+// never flushed, as a power failure would. Pages the buffer pool wrote to
+// the database file are kept.
+func simulatePowerLoss(t *testing.T, pe *PersistentEngine) {
+	t.Helper()
+
+	flushed := pe.wal.FlushedLSN()
+	dir := pe.wal.Dir()
+	simulateCrash(pe)
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*"+wal.SegmentExtension))
+	if err != nil {
+		t.Fatalf("Failed to list log segments: %v", err)
+	}
+	for _, segment := range segments {
+		base, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(segment), wal.SegmentExtension), 10, 64)
+		if err != nil {
+			t.Fatalf("Unexpected log segment %s: %v", segment, err)
+		}
+		switch {
+		case base > flushed:
+			err = os.Remove(segment)
+		default:
+			var info os.FileInfo
+			if info, err = os.Stat(segment); err == nil && uint64(info.Size()) > flushed-base {
+				err = os.Truncate(segment, int64(flushed-base))
+			}
+		}
+		if err != nil {
+			t.Fatalf("Failed to drop the unflushed log: %v", err)
+		}
+	}
+}
+
+func TestRecovery_CompactSmallBufferPool(t *testing.T) {
+	config := compactTestConfig(t)
+	config.BufferPoolSize = 4
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	fillAndPurge(t, engine)
+
+	// A batch evicts the pages it patches while it runs, and only the log
+	// those pages need is flushed before they are written
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := engine.Compact(ctx, func(CompactProgress) { cancel() }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	simulatePowerLoss(t, engine)
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+	checkPurged(t, engine)
+
+	// Pages the tree refers to must not be handed out again
+	for i := 2000; i < 2400; i++ {
+		if err := engine.Put(recoveryKey(i), compactValue(i)); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	for i := 2000; i < 2400; i++ {
+		if err := engine.Delete(recoveryKey(i)); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+	}
+	checkPurged(t, engine)
+
+	if _, err := engine.Compact(context.Background(), nil); err != nil {
+		t.Fatalf("Failed to compact after recovery: %v", err)
+	}
+	checkPurged(t, engine)
+}
@@ -19,6 +19,10 @@ type StorageEngine interface {
 	// Returns ErrKeyNotFound if the key does not exist.
 	Delete(key []byte) error
 
+	// Write applies every change in the batch atomically. Deletes of keys
+	// that do not exist are ignored.
+	Write(batch *WriteBatch) error
+
 	// Exists checks if a key exists in the storage without retrieving its value.
 	// This can be more efficient than Get when only existence needs to be checked.
 	Exists(key []byte) (bool, error)
@@ -49,6 +53,11 @@ type Iterator interface {
 	// Returns false if there are no more pairs to iterate over.
 	Next() bool
 
+	// Prev moves the iterator back to the previous key-value pair.
+	// Returns false if there are no earlier pairs. Calling Prev on an
+	// iterator that has not been positioned is the same as SeekToLast.
+	Prev() bool
+
 	// Key returns the current key. Only valid when Valid() returns true.
 	Key() []byte
 
@@ -94,4 +103,10 @@ type StorageStats struct {
 
 	// CacheMissCount is the number of cache misses (if applicable)
 	CacheMissCount int64
+
+	// PageCount is the number of pages in use (if applicable)
+	PageCount int64
+
+	// FreePageCount is the number of free pages available for reuse (if applicable)
+	FreePageCount int64
 }
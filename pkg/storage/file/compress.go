@@ -0,0 +1,71 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// Pages are compressed in place: a page whose data compresses to at most
+// half its size is stored compressed at the start of its slot in the file,
+// followed by zeros that a file system able to punch holes does not store.
+// Page offsets stay fixed, so nothing else needs to know which pages are
+// compressed. The meta page is never compressed, and the superblock records
+// FeatureCompression before any other page is, so that a version unable to
+// read compressed pages refuses the file. Turning compression off leaves
+// the pages already compressed as they are.
+
+// enableCompression records FeatureCompression in the superblock of an
+// existing file that lacks it, if compression is configured, and starts
+// compressing the pages written. It is part of Upgrade rather than opening
+// the file, since recovery may rewrite the meta page as the log has it.
+func (fm *FileManager) enableCompression() error {
+	fm.mu.RLock()
+	want, current, sb := fm.wantCompression, fm.compression, fm.superblock
+	fm.mu.RUnlock()
+	if want == current {
+		return nil
+	}
+
+	if want != page.CompressionNone && sb.Features&FeatureCompression == 0 {
+		meta, err := fm.ReadMetaPage()
+		if err != nil {
+			return fmt.Errorf("failed to read meta page: %w", err)
+		}
+		sb.Features |= FeatureCompression
+		if err := sb.Encode(meta); err != nil {
+			return err
+		}
+		if err := fm.WriteMetaPage(meta); err != nil {
+			return fmt.Errorf("failed to write meta page: %w", err)
+		}
+		if err := fm.Sync(); err != nil {
+			return err
+		}
+	}
+
+	fm.mu.Lock()
+	fm.compression = want
+	fm.mu.Unlock()
+	return nil
+}
+
+// punchHoleLocked replaces the zeros after a page written at offset with a
+// hole, or writes them if the file system cannot punch holes (assumes fm.mu
+// is held for writing).
+func (fm *FileManager) punchHoleLocked(zeros []byte, offset int64) error {
+	err := punchHole(fm.file, offset, int64(len(zeros)))
+	if errors.Is(err, errHolesUnsupported) {
+		fm.noHoles = true
+		_, err = fm.file.WriteAt(zeros, offset)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to clear the end of the page: %w", err)
+	}
+	return nil
+}
+
+// errHolesUnsupported is returned by punchHole when the file system cannot
+// punch holes in files.
+var errHolesUnsupported = errors.New("file system does not support holes")
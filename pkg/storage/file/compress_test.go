@@ -0,0 +1,153 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// jsonPage returns a leaf page full of repetitive JSON.
+func jsonPage(id page.PageID) *page.Page {
+	pg := page.NewPage(id, page.PageTypeLeaf)
+	var sb strings.Builder
+	for i := 0; sb.Len() < len(pg.Data()); i++ {
+		fmt.Fprintf(&sb, `{"id":%d,"page":%d,"status":"active"},`, i, id)
+	}
+	copy(pg.Data(), sb.String())
+	return pg
+}
+
+// writeSuperblock writes the meta page of a file holding its superblock.
+func writeSuperblock(t *testing.T, fm *FileManager) {
+	t.Helper()
+	sb := fm.Superblock()
+	meta := page.NewPageWithSize(0, page.PageTypeMeta, fm.PageSize())
+	if err := sb.Encode(meta); err != nil {
+		t.Fatalf("Failed to encode superblock: %v", err)
+	}
+	if err := fm.WriteMetaPage(meta); err != nil {
+		t.Fatalf("Failed to write meta page: %v", err)
+	}
+}
+
+// allocatedBytes returns the disk space taken by a file.
+func allocatedBytes(t *testing.T, path string) int64 {
+	t.Helper()
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	return stat.Blocks * 512
+}
+
+func TestFileManager_Compression(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.godb")
+	const numPages = 64
+
+	fm, err := NewFileManager(dbPath, &Config{Compression: page.CompressionLZ4, VerifyChecksums: true})
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	writeSuperblock(t, fm)
+	pages := make([]*page.Page, 0, numPages)
+	for id := page.PageID(1); id <= numPages; id++ {
+		pages = append(pages, jsonPage(id))
+	}
+	if err := fm.WritePages(pages); err != nil {
+		t.Fatalf("Failed to write pages: %v", err)
+	}
+	if compressed := fm.GetStatistics().PagesCompressed; compressed != numPages {
+		t.Errorf("Expected %d pages compressed, got %d", numPages, compressed)
+	}
+	noHoles := fm.noHoles
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file manager: %v", err)
+	}
+
+	// The pages take about half their size on disk, where holes can be
+	// punched
+	if size := allocatedBytes(t, dbPath); !noHoles && size > numPages*page.PageSize*3/4 {
+		t.Errorf("Expected at most %d bytes on disk, got %d", numPages*page.PageSize*3/4, size)
+	}
+
+	// Compressed pages are read whatever the configuration
+	fm, err = NewFileManager(dbPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to reopen file manager: %v", err)
+	}
+	defer fm.Close()
+	if fm.Superblock().Features&FeatureCompression == 0 {
+		t.Error("Expected the superblock to record compression")
+	}
+	for _, expected := range pages {
+		pg, err := fm.ReadPage(expected.ID())
+		if err != nil {
+			t.Fatalf("Failed to read page %d: %v", expected.ID(), err)
+		}
+		if !bytes.Equal(pg.Data(), expected.Data()) {
+			t.Errorf("Expected page %d back", expected.ID())
+		}
+	}
+
+	// Without compression configured, pages are written as they are
+	writeData(t, fm, 1, "data")
+	if compressed := fm.GetStatistics().PagesCompressed; compressed != 0 {
+		t.Errorf("Expected no pages compressed, got %d", compressed)
+	}
+	if got := readData(t, fm, 1, 4); got != "data" {
+		t.Errorf("Expected the page rewritten, got %q", got)
+	}
+}
+
+func TestFileManager_CompressionUpgrade(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.godb")
+
+	fm, err := NewFileManager(dbPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	writeSuperblock(t, fm)
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file manager: %v", err)
+	}
+
+	// An existing file compresses pages once upgraded
+	config := DefaultConfig()
+	config.Compression = page.CompressionLZ4
+	fm, err = NewFileManager(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to reopen file manager: %v", err)
+	}
+	defer fm.Close()
+
+	if err := fm.WritePage(jsonPage(1)); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	if compressed := fm.GetStatistics().PagesCompressed; compressed != 0 {
+		t.Errorf("Expected no pages compressed before the upgrade, got %d", compressed)
+	}
+
+	if err := fm.Upgrade(nil); err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+	meta, err := fm.ReadMetaPage()
+	if err != nil {
+		t.Fatalf("Failed to read meta page: %v", err)
+	}
+	sb, err := DecodeSuperblock(meta)
+	if err != nil || sb.Features&FeatureCompression == 0 {
+		t.Errorf("Expected the superblock to record compression, got %+v, %v", sb, err)
+	}
+
+	if err := fm.WritePage(jsonPage(1)); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	if compressed := fm.GetStatistics().PagesCompressed; compressed != 1 {
+		t.Errorf("Expected the page compressed after the upgrade, got %d", compressed)
+	}
+}
@@ -0,0 +1,250 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// DoubleWriteExtension is appended to the database file path to name the
+// double-write file.
+const DoubleWriteExtension = ".dw"
+
+// Every page is written twice: first appended to the double-write file,
+// which is synced, and only then written in place. A write to the database
+// file torn by a crash can therefore be repaired from the copy, which is
+// complete, while a torn copy means its in-place write never started. Once
+// the database file is synced the copies are no longer needed, and the next
+// writes start over at the beginning of the double-write file with a new
+// generation; records of older generations left behind are never applied.
+// Without SyncWrites, the database file is synced early whenever the copies
+// would grow past doubleWriteLimit, which bounds the double-write file.
+//
+// Layout of a double-write record, which is followed by the page image.
+const (
+	dwChecksumOffset   = 0 // CRC32 of the rest of the record
+	dwGenerationOffset = 4
+	dwPageIDOffset     = 12
+	dwPageSizeOffset   = 16
+	dwHeaderSize       = 20
+)
+
+// doubleWriteLimit is the size the copies in the double-write file may grow
+// to before the database file is synced so that it can be reused. A single
+// batch of pages larger than this is still copied whole.
+const doubleWriteLimit = 4 << 20
+
+// doubleWritePath returns the path of the double-write file of a database.
+func doubleWritePath(dbPath string) string {
+	return dbPath + DoubleWriteExtension
+}
+
+// openDoubleWrite repairs the database file from the double-write file left
+// by a crash, if any, and opens an empty one if enabled. The double-write
+// file of a database file that has just been created is left over from a
+// deleted one, and is discarded instead.
+func (fm *FileManager) openDoubleWrite(created, enabled bool) error {
+	path := doubleWritePath(fm.filePath)
+	if created {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale double-write file: %w", err)
+		}
+	} else if err := fm.restoreDoubleWrite(path); err != nil {
+		return err
+	}
+
+	if !enabled {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove double-write file: %w", err)
+		}
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, DefaultFileMode) // #nosec G304 - path is derived from the database path
+	if err != nil {
+		return fmt.Errorf("failed to open double-write file: %w", err)
+	}
+	fm.doubleWrite = f
+	fm.dwGeneration = 1
+	return nil
+}
+
+// restoreDoubleWrite writes every page copy of the last generation in the
+// double-write file whose in-place image differs back into the database
+// file, and syncs it. Copies are applied in the order they were written, so
+// the newest copy of a page wins.
+func (fm *FileManager) restoreDoubleWrite(path string) error {
+	f, err := os.Open(path) // #nosec G304 - path is derived from the database path
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open double-write file: %w", err)
+	}
+	defer f.Close()
+
+	var restored int64
+	var generation uint64
+	var offset int64
+	for {
+		id, image, gen, err := readDoubleWriteRecord(f, offset)
+		if err != nil {
+			break // The end of the file, or a copy torn by the crash
+		}
+		if offset == 0 {
+			generation = gen
+		} else if gen != generation {
+			break // Left over from an earlier generation
+		}
+		offset += int64(dwHeaderSize + len(image))
+
+		current := make([]byte, len(image))
+		n, err := fm.file.ReadAt(current, int64(id)*int64(len(image)))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read page %d: %w", id, err)
+		}
+		if n == len(image) && bytes.Equal(current, image) {
+			continue
+		}
+
+		if _, err := fm.file.WriteAt(image, int64(id)*int64(len(image))); err != nil {
+			return fmt.Errorf("failed to restore page %d: %w", id, err)
+		}
+		restored++
+	}
+
+	if restored > 0 {
+		if err := fm.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync file: %w", err)
+		}
+		fm.statsMu.Lock()
+		fm.stats.PagesRestored += restored
+		fm.stats.TotalSyncs++
+		fm.statsMu.Unlock()
+	}
+	return nil
+}
+
+// readDoubleWriteRecord reads the record at offset, returning the page ID,
+// its image and the record's generation. It fails if the record is
+// incomplete or its checksum does not match.
+func readDoubleWriteRecord(f *os.File, offset int64) (page.PageID, []byte, uint64, error) {
+	header := make([]byte, dwHeaderSize)
+	if _, err := f.ReadAt(header, offset); err != nil {
+		return 0, nil, 0, err
+	}
+
+	size := int(binary.LittleEndian.Uint32(header[dwPageSizeOffset:]))
+	if err := page.ValidatePageSize(size); err != nil {
+		return 0, nil, 0, err
+	}
+	image := make([]byte, size)
+	if _, err := f.ReadAt(image, offset+dwHeaderSize); err != nil {
+		return 0, nil, 0, err
+	}
+
+	h := crc32.NewIEEE()
+	_, _ = h.Write(header[dwGenerationOffset:])
+	_, _ = h.Write(image)
+	if h.Sum32() != binary.LittleEndian.Uint32(header[dwChecksumOffset:]) {
+		return 0, nil, 0, errors.New("double-write record checksum mismatch")
+	}
+
+	id := page.PageID(binary.LittleEndian.Uint32(header[dwPageIDOffset:]))
+	return id, image, binary.LittleEndian.Uint64(header[dwGenerationOffset:]), nil
+}
+
+// doubleWriteLocked appends copies of serialized pages to the double-write
+// file and syncs it, before they are written in place (assumes fm.mu is held
+// for writing).
+func (fm *FileManager) doubleWriteLocked(ids []page.PageID, buffers [][]byte) error {
+	if fm.doubleWrite == nil {
+		return nil
+	}
+
+	records := make([]byte, 0, len(buffers)*(dwHeaderSize+int(fm.pageSize)))
+	for i, buffer := range buffers {
+		record := make([]byte, dwHeaderSize, dwHeaderSize+len(buffer))
+		binary.LittleEndian.PutUint64(record[dwGenerationOffset:], fm.dwGeneration)
+		binary.LittleEndian.PutUint32(record[dwPageIDOffset:], uint32(ids[i]))
+		binary.LittleEndian.PutUint32(record[dwPageSizeOffset:], uint32(len(buffer))) // #nosec G115 - bounded by page.MaxPageSize
+		record = append(record, buffer...)
+		binary.LittleEndian.PutUint32(record[dwChecksumOffset:], crc32.ChecksumIEEE(record[dwGenerationOffset:]))
+		records = append(records, record...)
+	}
+
+	if fm.dwOffset > 0 && fm.dwOffset+int64(len(records)) > doubleWriteLimit {
+		if err := fm.syncLocked(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fm.doubleWrite.WriteAt(records, fm.dwOffset); err != nil {
+		return fmt.Errorf("failed to write double-write file: %w", err)
+	}
+	if err := fm.doubleWrite.Sync(); err != nil {
+		return fmt.Errorf("failed to sync double-write file: %w", err)
+	}
+	fm.dwOffset += int64(len(records))
+
+	fm.statsMu.Lock()
+	fm.stats.TotalSyncs++
+	fm.statsMu.Unlock()
+	return nil
+}
+
+// releaseDoubleWriteLocked lets the next writes reuse the double-write file
+// once every page written so far is synced in place (assumes fm.mu is held
+// for writing).
+func (fm *FileManager) releaseDoubleWriteLocked() {
+	if fm.dwOffset > 0 {
+		fm.dwOffset = 0
+		fm.dwGeneration++
+	}
+}
+
+// clearDoubleWriteLocked empties the double-write file, so that none of its
+// copies can be restored any more (assumes fm.mu is held for writing). Used
+// before the database file shrinks, when restoring a copy would extend it
+// again.
+func (fm *FileManager) clearDoubleWriteLocked() error {
+	if fm.doubleWrite == nil {
+		return nil
+	}
+	if err := fm.doubleWrite.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate double-write file: %w", err)
+	}
+	if err := fm.doubleWrite.Sync(); err != nil {
+		return fmt.Errorf("failed to sync double-write file: %w", err)
+	}
+	fm.dwOffset = 0
+	fm.dwGeneration++
+	return nil
+}
+
+// closeDoubleWriteLocked closes the double-write file, removing it if it
+// holds no copies that may still be needed (assumes fm.mu is held for
+// writing).
+func (fm *FileManager) closeDoubleWriteLocked() error {
+	if fm.doubleWrite == nil {
+		return nil
+	}
+
+	err := fm.doubleWrite.Close()
+	fm.doubleWrite = nil
+	if err != nil {
+		return fmt.Errorf("failed to close double-write file: %w", err)
+	}
+	if fm.dwOffset == 0 {
+		if err := os.Remove(doubleWritePath(fm.filePath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove double-write file: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// doubleWriteConfig returns a configuration that protects writes but syncs
+// the database file only when asked to.
+func doubleWriteConfig() *Config {
+	return &Config{DoubleWrite: true}
+}
+
+// writeData writes a leaf page holding data.
+func writeData(t *testing.T, fm *FileManager, id page.PageID, data string) {
+	t.Helper()
+	pg := page.NewPage(id, page.PageTypeLeaf)
+	copy(pg.Data(), data)
+	if err := fm.WritePage(pg); err != nil {
+		t.Fatalf("Failed to write page %d: %v", id, err)
+	}
+}
+
+// readData returns the start of the data of a page.
+func readData(t *testing.T, fm *FileManager, id page.PageID, n int) string {
+	t.Helper()
+	pg, err := fm.ReadPage(id)
+	if err != nil {
+		t.Fatalf("Failed to read page %d: %v", id, err)
+	}
+	return string(pg.Data()[:n])
+}
+
+func TestFileManager_DoubleWriteRepairsTornPage(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.godb")
+
+	fm, err := NewFileManager(dbPath, doubleWriteConfig())
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	writeData(t, fm, 1, "old1")
+	writeData(t, fm, 2, "old2")
+	if err := fm.Sync(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	writeData(t, fm, 1, "new1")
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file manager: %v", err)
+	}
+
+	// The crash tore the last write of page 1 at 4KB, after its header
+	f, err := os.OpenFile(dbPath, os.O_RDWR, DefaultFileMode)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	if _, err := f.WriteAt(bytes.Repeat([]byte{0xAB}, 4096), page.PageSize+4096); err != nil {
+		t.Fatalf("Failed to tear page: %v", err)
+	}
+	_ = f.Close()
+
+	fm, err = NewFileManager(dbPath, doubleWriteConfig())
+	if err != nil {
+		t.Fatalf("Failed to reopen file manager: %v", err)
+	}
+	if restored := fm.GetStatistics().PagesRestored; restored != 1 {
+		t.Errorf("Expected 1 page restored, got %d", restored)
+	}
+	if got := readData(t, fm, 1, 4); got != "new1" {
+		t.Errorf("Expected the torn page restored, got %q", got)
+	}
+	if got := readData(t, fm, 2, 4); got != "old2" {
+		t.Errorf("Expected page 2 untouched, got %q", got)
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file manager: %v", err)
+	}
+
+	// Nothing is left to restore after a clean close
+	if _, err := os.Stat(dbPath + DoubleWriteExtension); !os.IsNotExist(err) {
+		t.Errorf("Expected the double-write file to be removed, got %v", err)
+	}
+}
+
+func TestFileManager_DoubleWriteGenerations(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.godb")
+
+	fm, err := NewFileManager(dbPath, doubleWriteConfig())
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+
+	// Copies of pages 1 and 2, then a newer copy of page 2 over the first
+	batch := []*page.Page{page.NewPage(1, page.PageTypeLeaf), page.NewPage(2, page.PageTypeLeaf)}
+	copy(batch[0].Data(), "one1")
+	copy(batch[1].Data(), "two1")
+	if err := fm.WritePages(batch); err != nil {
+		t.Fatalf("Failed to write pages: %v", err)
+	}
+	if err := fm.Sync(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	writeData(t, fm, 2, "two2")
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file manager: %v", err)
+	}
+
+	// The copy of page 2 left over from the first generation must not be
+	// restored over the newer one
+	fm, err = NewFileManager(dbPath, doubleWriteConfig())
+	if err != nil {
+		t.Fatalf("Failed to reopen file manager: %v", err)
+	}
+	defer fm.Close()
+	if restored := fm.GetStatistics().PagesRestored; restored != 0 {
+		t.Errorf("Expected no pages restored, got %d", restored)
+	}
+	if got := readData(t, fm, 2, 4); got != "two2" {
+		t.Errorf("Expected the newest page 2, got %q", got)
+	}
+}
+
+func TestFileManager_DoubleWriteStale(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.godb")
+
+	fm, err := NewFileManager(dbPath, doubleWriteConfig())
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	writeData(t, fm, 1, "gone")
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file manager: %v", err)
+	}
+
+	// A new database must not get the pages of a deleted one
+	if err := os.Remove(dbPath); err != nil {
+		t.Fatalf("Failed to remove database file: %v", err)
+	}
+	fm, err = NewFileManager(dbPath, doubleWriteConfig())
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	defer fm.Close()
+	if fm.GetPageCount() != 0 || fm.GetStatistics().PagesRestored != 0 {
+		t.Errorf("Expected an empty file, got %d pages", fm.GetPageCount())
+	}
+}
+
+func TestFileManager_DoubleWriteLimit(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.godb")
+
+	fm, err := NewFileManager(dbPath, doubleWriteConfig())
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	defer fm.Close()
+
+	// Write batches adding up to several times the limit without syncing
+	const batchSize = 64
+	for batch := 0; batch < 4*doubleWriteLimit/(batchSize*page.PageSize); batch++ {
+		pages := make([]*page.Page, batchSize)
+		for i := range pages {
+			pages[i] = page.NewPage(page.PageID(1+batch*batchSize+i), page.PageTypeLeaf)
+		}
+		if err := fm.WritePages(pages); err != nil {
+			t.Fatalf("Failed to write pages: %v", err)
+		}
+	}
+
+	info, err := os.Stat(dbPath + DoubleWriteExtension)
+	if err != nil {
+		t.Fatalf("Failed to stat double-write file: %v", err)
+	}
+	if info.Size() > doubleWriteLimit {
+		t.Errorf("Expected the double-write file to stay within %d bytes, got %d", doubleWriteLimit, info.Size())
+	}
+}
+
+func BenchmarkFileManager_DoubleWrite(b *testing.B) {
+	for _, doubleWrite := range []bool{false, true} {
+		for _, batchSize := range []int{1, 32} {
+			b.Run(fmt.Sprintf("doublewrite=%v/batch=%d", doubleWrite, batchSize), func(b *testing.B) {
+				fm, err := NewFileManager(filepath.Join(b.TempDir(), "bench.godb"), &Config{DoubleWrite: doubleWrite})
+				if err != nil {
+					b.Fatalf("Failed to create file manager: %v", err)
+				}
+				defer fm.Close()
+
+				pages := make([]*page.Page, batchSize)
+				b.SetBytes(int64(batchSize * page.PageSize))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					for j := range pages {
+						pages[j] = page.NewPage(page.PageID(1+(i*batchSize+j)%4096), page.PageTypeLeaf)
+					}
+					if err := fm.WritePages(pages); err != nil {
+						b.Fatalf("Failed to write pages: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// Fence preserves the first pages of the file as they were when the fence
+// was set, so that they can be read consistently while writes continue.
+// Before a fenced page is overwritten or truncated away for the first time,
+// its original image is kept in memory; once a page has been read through
+// the fence, its original is no longer needed and later writes to it are
+// not held back. A fence must be released when done.
+type Fence struct {
+	// fm is the file manager the fence was set on
+	fm *FileManager
+
+	// pageCount is the number of pages the fence covers
+	pageCount int64
+
+	// mu protects the fields below; it is taken after fm.mu
+	mu sync.Mutex
+
+	// saved holds the original image of each fenced page changed since the
+	// fence was set and not yet read
+	saved map[int64][]byte
+
+	// read marks the pages already read through the fence
+	read map[int64]bool
+
+	// changed holds the pages written since the previous fence was set, or
+	// nil if none was set since the file was opened
+	changed map[int64]struct{}
+
+	// released indicates if the fence has been released
+	released bool
+}
+
+// SetFence sets a fence over the first pageCount pages of the file. From
+// the first fence on, the file manager records the pages written, so that
+// each fence knows which pages changed since the one before it.
+func (fm *FileManager) SetFence(pageCount int64) (*Fence, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if fm.file == nil {
+		return nil, errors.New("file manager is closed")
+	}
+	if pageCount < 0 || pageCount > fm.pageCount.Load() {
+		return nil, fmt.Errorf("cannot fence %d pages of a %d-page file", pageCount, fm.pageCount.Load())
+	}
+
+	f := &Fence{
+		fm:        fm,
+		pageCount: pageCount,
+		saved:     make(map[int64][]byte),
+		read:      make(map[int64]bool),
+		changed:   fm.written,
+	}
+	fm.fences = append(fm.fences, f)
+	fm.written = make(map[int64]struct{})
+	return f, nil
+}
+
+// PageCount returns the number of pages the fence covers.
+func (f *Fence) PageCount() int64 {
+	return f.pageCount
+}
+
+// Changed returns the fenced pages written or truncated away between the
+// previous fence and this one, in order. It reports false if this is the
+// first fence since the file was opened, when the changes are not known.
+func (f *Fence) Changed() ([]page.PageID, bool) {
+	if f.changed == nil {
+		return nil, false
+	}
+
+	ids := make([]page.PageID, 0, len(f.changed))
+	for id := range f.changed {
+		if id < f.pageCount {
+			ids = append(ids, page.PageID(id)) // #nosec G115 - page IDs fit in 32 bits
+		}
+	}
+	slices.Sort(ids)
+	return ids, true
+}
+
+// ReadPage returns the raw image a page had when the fence was set. Pages
+// that were never written read back as zeros.
+func (f *Fence) ReadPage(pageID page.PageID) ([]byte, error) {
+	id := int64(pageID)
+
+	f.fm.mu.RLock()
+	defer f.fm.mu.RUnlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case f.released:
+		return nil, ErrFenceReleased
+	case f.fm.file == nil:
+		return nil, errors.New("file manager is closed")
+	case id < 0 || id >= f.pageCount:
+		return nil, fmt.Errorf("page %d is outside the %d fenced pages", pageID, f.pageCount)
+	}
+
+	buffer, ok := f.saved[id]
+	if !ok {
+		var err error
+		if buffer, err = f.fm.readRawLocked(id); err != nil {
+			return nil, err
+		}
+	}
+
+	delete(f.saved, id)
+	f.read[id] = true
+	return buffer, nil
+}
+
+// Release removes the fence and drops the page images it kept.
+func (f *Fence) Release() {
+	f.fm.mu.Lock()
+	defer f.fm.mu.Unlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.released {
+		return
+	}
+	f.released = true
+	f.saved = nil
+
+	for i, fence := range f.fm.fences {
+		if fence == f {
+			f.fm.fences = append(f.fm.fences[:i], f.fm.fences[i+1:]...)
+			break
+		}
+	}
+}
+
+// preserveLocked keeps the current image of the pages in [start, end) for
+// every fence that still needs them, before they are overwritten or
+// truncated, and records them as written for the next fence (assumes fm.mu
+// is held for writing).
+func (fm *FileManager) preserveLocked(start, end int64) error {
+	if fm.written != nil {
+		for id := start; id < end; id++ {
+			fm.written[id] = struct{}{}
+		}
+	}
+
+	for _, f := range fm.fences {
+		f.mu.Lock()
+		err := f.preserveLocked(start, min(end, f.pageCount))
+		f.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preserveLocked keeps the current image of the fenced pages in [start, end)
+// that have been neither saved nor read (assumes locks are held).
+func (f *Fence) preserveLocked(start, end int64) error {
+	for id := start; id < end; id++ {
+		if _, ok := f.saved[id]; ok || f.read[id] {
+			continue
+		}
+
+		buffer, err := f.fm.readRawLocked(id)
+		if err != nil {
+			return fmt.Errorf("failed to preserve fenced page %d: %w", id, err)
+		}
+		f.saved[id] = buffer
+	}
+	return nil
+}
+
+// readRawLocked reads the raw image of a page, or zeros for a page past the
+// end of the file (assumes fm.mu is held).
+func (fm *FileManager) readRawLocked(id int64) ([]byte, error) {
+	buffer := make([]byte, fm.pageSize)
+
+	offset := id * fm.pageSize
+	if offset >= fm.fileSize.Load() {
+		return buffer, nil
+	}
+
+	n, err := fm.file.ReadAt(buffer, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page %d: %w", id, err)
+	}
+	if int64(n) != fm.pageSize {
+		return nil, fmt.Errorf("incomplete page read: expected %d bytes, got %d", fm.pageSize, n)
+	}
+
+	fm.statsMu.Lock()
+	fm.stats.TotalReads++
+	fm.stats.BytesRead += int64(n)
+	fm.statsMu.Unlock()
+
+	return buffer, nil
+}
+
+// ErrFenceReleased is returned when a page is read through a released fence.
+var ErrFenceReleased = errors.New("fence is released")
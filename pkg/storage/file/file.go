@@ -5,6 +5,7 @@ package file
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
@@ -51,6 +52,44 @@ type FileManager struct {
 	// pageCount tracks the number of pages in the file
 	pageCount atomic.Int64
 
+	// pageSize is the size of the file's pages in bytes
+	pageSize int64
+
+	// superblock describes the file (see superblock.go)
+	superblock Superblock
+
+	// syncWrites forces a sync after every page write
+	syncWrites bool
+
+	// verifyChecksums enables checksum verification on page reads
+	verifyChecksums bool
+
+	// checksum is the algorithm of the file's page checksums
+	checksum page.ChecksumAlgorithm
+
+	// compression is the compression of the pages written, and
+	// wantCompression the configured one, which an existing file only gets
+	// once upgraded (see compress.go). noHoles is set once the file system
+	// turns out not to support punching holes.
+	compression     page.Compression
+	wantCompression page.Compression
+	noHoles         bool
+
+	// doubleWrite is the double-write file pages are copied to before they
+	// are written in place, or nil if disabled (see doublewrite.go). Copies
+	// are appended at dwOffset, tagged with dwGeneration.
+	doubleWrite  *os.File
+	dwOffset     int64
+	dwGeneration uint64
+
+	// fences are the fences set on the file, whose pages are preserved
+	// before they change (see fence.go)
+	fences []*Fence
+
+	// written records the pages written or truncated away since the last
+	// fence was set, or is nil before the first (see fence.go)
+	written map[int64]struct{}
+
 	// Statistics
 	stats   FileStatistics
 	statsMu sync.RWMutex
@@ -75,6 +114,14 @@ type FileStatistics struct {
 
 	// CorruptionDetected is the number of corruption incidents
 	CorruptionDetected int64
+
+	// PagesRestored is the number of pages restored from the double-write
+	// file when the file was opened, because a crash may have torn their
+	// last write
+	PagesRestored int64
+
+	// PagesCompressed is the number of page writes stored compressed
+	PagesCompressed int64
 }
 
 // Config holds file manager configuration.
@@ -85,8 +132,37 @@ type Config struct {
 	// UseDirectIO enables direct I/O (bypassing OS cache)
 	UseDirectIO bool
 
-	// PreallocateSize is the initial file size to preallocate
+	// PreallocateSize is the size to preallocate for a new, empty file. An
+	// existing file keeps its size, so that a compacted file stays small.
 	PreallocateSize int64
+
+	// VerifyChecksums enables checksum verification when pages are read
+	VerifyChecksums bool
+
+	// Checksum is the algorithm of the page checksums of a new file. A file
+	// keeps the algorithm it was created with, which is recorded in its
+	// superblock.
+	Checksum page.ChecksumAlgorithm
+
+	// DoubleWrite protects pages against writes torn by a crash by writing
+	// each page to a double-write file first, so that it can be repaired
+	// when the file is next opened. It costs an extra sync per write, or per
+	// batch of pages written together.
+	DoubleWrite bool
+
+	// Compression compresses the pages written, except the meta page, if
+	// that at least halves them; the space they leave is given back to the
+	// file system where it supports punching holes in files. A new file
+	// compresses pages right away, and an existing one once Upgrade has
+	// recorded FeatureCompression in its superblock. Compressed pages stay
+	// readable whatever the configuration.
+	Compression page.Compression
+
+	// PageSize is the size of the pages of a new file. A file keeps the page
+	// size it was created with, which is recorded in its pages; opening it
+	// with a different nonzero PageSize fails. Zero means page.PageSize for
+	// a new file.
+	PageSize int
 }
 
 // DefaultConfig returns a default file manager configuration.
@@ -95,6 +171,9 @@ func DefaultConfig() *Config {
 		SyncWrites:      true,
 		UseDirectIO:     false,
 		PreallocateSize: 1024 * page.PageSize, // 1024 pages = 8MB
+		VerifyChecksums: true,
+		Checksum:        page.ChecksumCRC32C,
+		DoubleWrite:     true,
 	}
 }
 
@@ -108,6 +187,12 @@ func NewFileManager(dbPath string, config *Config) (*FileManager, error) {
 		return nil, errors.New("database path cannot be empty")
 	}
 
+	if config.PageSize != 0 {
+		if err := page.ValidatePageSize(config.PageSize); err != nil {
+			return nil, err
+		}
+	}
+
 	// Ensure path has correct extension
 	if filepath.Ext(dbPath) == "" {
 		dbPath += DatabaseFileExtension
@@ -120,8 +205,11 @@ func NewFileManager(dbPath string, config *Config) (*FileManager, error) {
 	}
 
 	fm := &FileManager{
-		filePath: dbPath,
-		lockPath: dbPath + LockFileExtension,
+		filePath:        dbPath,
+		lockPath:        dbPath + LockFileExtension,
+		syncWrites:      config.SyncWrites,
+		verifyChecksums: config.VerifyChecksums,
+		wantCompression: config.Compression,
 	}
 
 	// Acquire file lock
@@ -130,11 +218,24 @@ func NewFileManager(dbPath string, config *Config) (*FileManager, error) {
 	}
 
 	// Open or create database file
-	if err := fm.openFile(config); err != nil {
+	created, err := fm.openFile(config)
+	if err != nil {
 		_ = fm.releaseLock() // Clean up lock on failure, ignore error
 		return nil, fmt.Errorf("failed to open database file: %w", err)
 	}
 
+	// Repair pages torn by a crash before anything else is read
+	if err := fm.openDoubleWrite(created, config.DoubleWrite); err != nil {
+		_ = fm.Close() // Clean up on failure
+		return nil, fmt.Errorf("failed to open double-write file: %w", err)
+	}
+
+	// Check that the file is a database this version can read
+	if err := fm.loadSuperblock(config); err != nil {
+		_ = fm.Close() // Clean up on failure
+		return nil, fmt.Errorf("failed to read superblock: %w", err)
+	}
+
 	// Initialize file size and page count
 	if err := fm.updateFileSizeInfo(); err != nil {
 		_ = fm.Close() // Clean up on failure
@@ -181,8 +282,9 @@ func (fm *FileManager) releaseLock() error {
 	return os.Remove(fm.lockPath)
 }
 
-// openFile opens or creates the database file.
-func (fm *FileManager) openFile(config *Config) error {
+// openFile opens or creates the database file, reporting whether it was
+// created.
+func (fm *FileManager) openFile(config *Config) (bool, error) {
 	flags := os.O_RDWR | os.O_CREATE
 
 	// Add direct I/O flag if enabled (platform-specific)
@@ -190,10 +292,13 @@ func (fm *FileManager) openFile(config *Config) error {
 		flags |= getDirectIOFlag()
 	}
 
+	_, err := os.Stat(fm.filePath)
+	created := errors.Is(err, os.ErrNotExist)
+
 	// #nosec G304 - filePath is validated during FileManager creation
 	file, err := os.OpenFile(fm.filePath, flags, DefaultFileMode)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %w", fm.filePath, err)
+		return false, fmt.Errorf("failed to open file %s: %w", fm.filePath, err)
 	}
 
 	fm.file = file
@@ -201,27 +306,91 @@ func (fm *FileManager) openFile(config *Config) error {
 	// Preallocate file space if needed
 	if config.PreallocateSize > 0 {
 		if err := fm.preallocate(config.PreallocateSize); err != nil {
-			return fmt.Errorf("failed to preallocate file space: %w", err)
+			return false, fmt.Errorf("failed to preallocate file space: %w", err)
 		}
 	}
 
-	return nil
+	return created, nil
 }
 
-// preallocate extends the file to the specified size.
+// preallocate extends an empty file to the specified size.
 func (fm *FileManager) preallocate(size int64) error {
 	stat, err := fm.file.Stat()
 	if err != nil {
 		return err
 	}
 
-	if stat.Size() < size {
+	if stat.Size() == 0 {
 		return fm.file.Truncate(size)
 	}
 
 	return nil
 }
 
+// loadSuperblock reads the superblock from the meta page, taking the page
+// size from its header, or describes a new file with the configured page
+// size and checksum algorithm if the file holds no meta page yet. A
+// configured size other than zero must match the file's.
+func (fm *FileManager) loadSuperblock(config *Config) error {
+	configured := config.PageSize
+	header := make([]byte, page.PageHeaderSize)
+	_, err := fm.file.ReadAt(header, 0)
+	switch {
+	case errors.Is(err, io.EOF) || (err == nil && isZeroPage(header)):
+		// A new file
+		if configured == 0 {
+			configured = page.PageSize
+		}
+		fm.pageSize = int64(configured)
+		fm.checksum = config.Checksum
+		fm.superblock, err = newSuperblock(configured, config.Checksum)
+		if config.Compression != page.CompressionNone {
+			// Recorded when the meta page is first written
+			fm.superblock.Features |= FeatureCompression
+			fm.compression = config.Compression
+		}
+		return err
+	case err != nil:
+		return fmt.Errorf("failed to read meta page header: %w", err)
+	}
+
+	size, err := page.StoredPageSize(header)
+	if err != nil {
+		return fmt.Errorf("%w: invalid meta page header: %v", ErrNotDatabase, err)
+	}
+	if configured != 0 && configured != size {
+		return fmt.Errorf("%w: file uses %d-byte pages, configured for %d", ErrPageSizeMismatch, size, configured)
+	}
+	fm.pageSize = int64(size)
+
+	// The whole meta page must be read to get past its header, and its
+	// checksum can only be verified once the superblock names the algorithm
+	buffer := make([]byte, size)
+	if _, err := fm.file.ReadAt(buffer, 0); err != nil {
+		return fmt.Errorf("%w: failed to read meta page: %v", ErrNotDatabase, err)
+	}
+	pg := &page.Page{}
+	if err := pg.DeserializeUnverified(buffer); err != nil {
+		return fmt.Errorf("failed to deserialize meta page: %w", err)
+	}
+
+	sb, err := readSuperblock(pg)
+	if err != nil {
+		return err
+	}
+	if fm.verifyChecksums {
+		if err := sb.Checksum.Verify(buffer); err != nil {
+			return fmt.Errorf("failed to verify meta page: %w", err)
+		}
+	}
+	fm.checksum = sb.Checksum
+	fm.superblock = *sb
+	if sb.Features&FeatureCompression != 0 {
+		fm.compression = config.Compression
+	}
+	return nil
+}
+
 // updateFileSizeInfo updates the cached file size and page count.
 func (fm *FileManager) updateFileSizeInfo() error {
 	stat, err := fm.file.Stat()
@@ -231,7 +400,7 @@ func (fm *FileManager) updateFileSizeInfo() error {
 
 	size := stat.Size()
 	fm.fileSize.Store(size)
-	fm.pageCount.Store(size / page.PageSize)
+	fm.pageCount.Store(size / fm.pageSize)
 
 	return nil
 }
@@ -242,6 +411,17 @@ func (fm *FileManager) ReadPage(pageID page.PageID) (*page.Page, error) {
 		return nil, errors.New("invalid page ID")
 	}
 
+	return fm.readPage(pageID)
+}
+
+// ReadMetaPage reads the database meta page stored at page 0.
+// It returns ErrUninitializedPage if the meta page has never been written.
+func (fm *FileManager) ReadMetaPage() (*page.Page, error) {
+	return fm.readPage(0)
+}
+
+// readPage reads and deserializes the page stored at the given page ID.
+func (fm *FileManager) readPage(pageID page.PageID) (*page.Page, error) {
 	fm.mu.RLock()
 	defer fm.mu.RUnlock()
 
@@ -250,7 +430,7 @@ func (fm *FileManager) ReadPage(pageID page.PageID) (*page.Page, error) {
 	}
 
 	// Calculate file offset
-	offset := int64(pageID) * page.PageSize
+	offset := int64(pageID) * fm.pageSize
 
 	// Check if page exists in file
 	if offset >= fm.fileSize.Load() {
@@ -258,14 +438,14 @@ func (fm *FileManager) ReadPage(pageID page.PageID) (*page.Page, error) {
 	}
 
 	// Read page data
-	buffer := make([]byte, page.PageSize)
+	buffer := make([]byte, fm.pageSize)
 	n, err := fm.file.ReadAt(buffer, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read page %d: %w", pageID, err)
 	}
 
-	if n != page.PageSize {
-		return nil, fmt.Errorf("incomplete page read: expected %d bytes, got %d", page.PageSize, n)
+	if int64(n) != fm.pageSize {
+		return nil, fmt.Errorf("incomplete page read: expected %d bytes, got %d", fm.pageSize, n)
 	}
 
 	// Update statistics
@@ -274,9 +454,19 @@ func (fm *FileManager) ReadPage(pageID page.PageID) (*page.Page, error) {
 	fm.stats.BytesRead += int64(n)
 	fm.statsMu.Unlock()
 
+	// Preallocated space that was never written reads back as zeros
+	if isZeroPage(buffer) {
+		return nil, fmt.Errorf("page %d: %w", pageID, ErrUninitializedPage)
+	}
+
 	// Deserialize page
 	pg := &page.Page{}
-	if err := pg.Deserialize(buffer); err != nil {
+	if fm.verifyChecksums {
+		err = pg.DeserializeWith(buffer, fm.checksum)
+	} else {
+		err = pg.DeserializeUnverified(buffer)
+	}
+	if err != nil {
 		fm.statsMu.Lock()
 		fm.stats.CorruptionDetected++
 		fm.statsMu.Unlock()
@@ -286,17 +476,81 @@ func (fm *FileManager) ReadPage(pageID page.PageID) (*page.Page, error) {
 	return pg, nil
 }
 
+// isZeroPage reports whether a page buffer consists entirely of zero bytes.
+func isZeroPage(buffer []byte) bool {
+	for _, b := range buffer {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // WritePage writes a page to the file at the specified page ID.
 func (fm *FileManager) WritePage(pg *page.Page) error {
 	if pg == nil {
 		return errors.New("page cannot be nil")
 	}
 
-	pageID := pg.ID()
-	if pageID == page.InvalidPageID {
+	if pg.ID() == page.InvalidPageID {
 		return errors.New("invalid page ID")
 	}
 
+	return fm.writePage(pg)
+}
+
+// WriteMetaPage writes the database meta page to page 0. If the page holds a
+// superblock in the current format, it becomes the file's superblock.
+func (fm *FileManager) WriteMetaPage(pg *page.Page) error {
+	if pg == nil {
+		return errors.New("page cannot be nil")
+	}
+
+	if pg.ID() != 0 || pg.Type() != page.PageTypeMeta {
+		return fmt.Errorf("page %d is not the meta page", pg.ID())
+	}
+
+	if err := fm.writePage(pg); err != nil {
+		return err
+	}
+
+	if sb, err := readSuperblock(pg); err == nil && sb.Version == FormatVersion {
+		fm.mu.Lock()
+		fm.superblock = *sb
+		fm.mu.Unlock()
+	}
+	return nil
+}
+
+// WritePages writes several pages to the file, more cheaply than one at a
+// time: the double-write file and, with SyncWrites, the database file are
+// synced once for all of them.
+func (fm *FileManager) WritePages(pages []*page.Page) error {
+	for _, pg := range pages {
+		if pg == nil {
+			return errors.New("page cannot be nil")
+		}
+		if pg.ID() == page.InvalidPageID {
+			return errors.New("invalid page ID")
+		}
+	}
+
+	return fm.writePages(pages)
+}
+
+// writePage serializes a page and writes it at its page ID.
+func (fm *FileManager) writePage(pg *page.Page) error {
+	return fm.writePages([]*page.Page{pg})
+}
+
+// writePages serializes pages and writes each at its page ID. Every page is
+// copied to the double-write file before any is written in place, so a
+// crash cannot leave one torn beyond repair.
+func (fm *FileManager) writePages(pages []*page.Page) error {
+	if len(pages) == 0 {
+		return nil
+	}
+
 	fm.mu.Lock()
 	defer fm.mu.Unlock()
 
@@ -304,52 +558,108 @@ func (fm *FileManager) WritePage(pg *page.Page) error {
 		return errors.New("file manager is closed")
 	}
 
-	// Serialize page
-	buffer, err := pg.Serialize()
-	if err != nil {
-		return fmt.Errorf("failed to serialize page %d: %w", pageID, err)
-	}
+	ids := make([]page.PageID, len(pages))
+	buffers := make([][]byte, len(pages))
+	stored := make([]int, len(pages))
+	end := fm.fileSize.Load()
+	for i, pg := range pages {
+		ids[i] = pg.ID()
+		if int64(pg.Size()) != fm.pageSize {
+			return fmt.Errorf("cannot write %d-byte page %d to a file of %d-byte pages", pg.Size(), ids[i], fm.pageSize)
+		}
 
-	// Calculate file offset
-	offset := int64(pageID) * page.PageSize
+		// Serialize page, leaving the superblock uncompressed so that any
+		// version can check it
+		compression := fm.compression
+		if ids[i] == 0 {
+			compression = page.CompressionNone
+		}
+		buffer, n, err := pg.SerializeCompressed(fm.checksum, compression)
+		if err != nil {
+			return fmt.Errorf("failed to serialize page %d: %w", ids[i], err)
+		}
+		buffers[i], stored[i] = buffer, n
+		end = max(end, (int64(ids[i])+1)*fm.pageSize)
+	}
 
 	// Extend file if necessary
-	if offset >= fm.fileSize.Load() {
-		if err := fm.extendFile(offset + page.PageSize); err != nil {
+	if end > fm.fileSize.Load() {
+		if err := fm.extendFile(end); err != nil {
 			return fmt.Errorf("failed to extend file: %w", err)
 		}
 	}
 
-	// Write page data atomically
-	if err := fm.writePageAtomic(buffer, offset); err != nil {
-		return fmt.Errorf("failed to write page %d: %w", pageID, err)
+	// Keep the pages as they were for any fence over them
+	for _, id := range ids {
+		if err := fm.preserveLocked(int64(id), int64(id)+1); err != nil {
+			return err
+		}
 	}
 
-	// Update statistics
-	fm.statsMu.Lock()
-	fm.stats.TotalWrites++
-	fm.stats.BytesWritten += int64(len(buffer))
-	fm.statsMu.Unlock()
+	if err := fm.doubleWriteLocked(ids, buffers); err != nil {
+		return err
+	}
 
-	return nil
+	for i, buffer := range buffers {
+		if err := fm.writeInPlaceLocked(buffer, stored[i], int64(ids[i])*fm.pageSize); err != nil {
+			return fmt.Errorf("failed to write page %d: %w", ids[i], err)
+		}
+	}
+
+	if !fm.syncWrites {
+		return nil
+	}
+
+	// Force sync to ensure data is written to disk
+	return fm.syncLocked()
 }
 
-// writePageAtomic performs an atomic page write operation.
-func (fm *FileManager) writePageAtomic(buffer []byte, offset int64) error {
-	// Write data
-	n, err := fm.file.WriteAt(buffer, offset)
+// writeInPlaceLocked writes a serialized page at its offset in the database
+// file. Only its first stored bytes are written if the zeros after them can
+// be left as a hole (assumes fm.mu is held for writing).
+func (fm *FileManager) writeInPlaceLocked(buffer []byte, stored int, offset int64) error {
+	compressed := stored < len(buffer)
+	if fm.noHoles {
+		stored = len(buffer)
+	}
+
+	n, err := fm.file.WriteAt(buffer[:stored], offset)
 	if err != nil {
 		return err
 	}
 
-	if n != len(buffer) {
-		return fmt.Errorf("incomplete write: expected %d bytes, wrote %d", len(buffer), n)
+	if n != stored {
+		return fmt.Errorf("incomplete write: expected %d bytes, wrote %d", stored, n)
 	}
 
-	// Force sync to ensure data is written to disk
+	// The hole goes once the page is written, so that a crash in between
+	// leaves the new page whole
+	if stored < len(buffer) {
+		if err := fm.punchHoleLocked(buffer[stored:], offset+int64(stored)); err != nil {
+			return err
+		}
+	}
+
+	// Update statistics
+	fm.statsMu.Lock()
+	fm.stats.TotalWrites++
+	fm.stats.BytesWritten += int64(n)
+	if compressed {
+		fm.stats.PagesCompressed++
+	}
+	fm.statsMu.Unlock()
+
+	return nil
+}
+
+// syncLocked syncs the database file, after which the page copies in the
+// double-write file are no longer needed (assumes fm.mu is held for
+// writing).
+func (fm *FileManager) syncLocked() error {
 	if err := fm.file.Sync(); err != nil {
 		return fmt.Errorf("failed to sync file: %w", err)
 	}
+	fm.releaseDoubleWriteLocked()
 
 	fm.statsMu.Lock()
 	fm.stats.TotalSyncs++
@@ -365,20 +675,60 @@ func (fm *FileManager) extendFile(newSize int64) error {
 	}
 
 	fm.fileSize.Store(newSize)
-	fm.pageCount.Store(newSize / page.PageSize)
+	fm.pageCount.Store(newSize / fm.pageSize)
 
 	return nil
 }
 
 // Sync forces all pending writes to disk.
 func (fm *FileManager) Sync() error {
-	fm.mu.RLock()
-	defer fm.mu.RUnlock()
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if fm.file == nil {
+		return errors.New("file manager is closed")
+	}
+
+	return fm.syncLocked()
+}
+
+// Truncate shrinks the file to the given number of pages and syncs it, giving
+// the space past them back to the file system. Pages past the new end no
+// longer exist until they are written again.
+func (fm *FileManager) Truncate(pageCount int64) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
 
 	if fm.file == nil {
 		return errors.New("file manager is closed")
 	}
 
+	size := pageCount * fm.pageSize
+	if pageCount < 0 || size > fm.fileSize.Load() {
+		return fmt.Errorf("cannot truncate file of %d bytes to %d pages", fm.fileSize.Load(), pageCount)
+	}
+
+	if err := fm.preserveLocked(pageCount, fm.pageCount.Load()); err != nil {
+		return err
+	}
+
+	// Restoring a page copied to the double-write file could extend the
+	// file again, so the copies go first, once their pages are synced
+	if fm.dwOffset > 0 {
+		if err := fm.syncLocked(); err != nil {
+			return err
+		}
+	}
+	if err := fm.clearDoubleWriteLocked(); err != nil {
+		return err
+	}
+
+	if err := fm.file.Truncate(size); err != nil {
+		return fmt.Errorf("failed to truncate file: %w", err)
+	}
+	fm.fileSize.Store(size)
+	fm.pageCount.Store(pageCount)
+
 	if err := fm.file.Sync(); err != nil {
 		return fmt.Errorf("failed to sync file: %w", err)
 	}
@@ -390,6 +740,11 @@ func (fm *FileManager) Sync() error {
 	return nil
 }
 
+// PageSize returns the size of the file's pages in bytes.
+func (fm *FileManager) PageSize() int {
+	return int(fm.pageSize)
+}
+
 // GetPageCount returns the number of pages in the file.
 func (fm *FileManager) GetPageCount() int64 {
 	return fm.pageCount.Load()
@@ -429,8 +784,8 @@ func (fm *FileManager) CheckIntegrity() error {
 	fileSize := fm.fileSize.Load()
 
 	// Check if file size is multiple of page size
-	if fileSize%page.PageSize != 0 {
-		return fmt.Errorf("file size %d is not a multiple of page size %d", fileSize, page.PageSize)
+	if fileSize%fm.pageSize != 0 {
+		return fmt.Errorf("file size %d is not a multiple of page size %d", fileSize, fm.pageSize)
 	}
 
 	// Note: We skip checking individual pages for corruption here since
@@ -456,6 +811,10 @@ func (fm *FileManager) Close() error {
 		fm.file = nil
 	}
 
+	if err := fm.closeDoubleWriteLocked(); err != nil {
+		errs = append(errs, err)
+	}
+
 	// Release file lock
 	if err := fm.releaseLock(); err != nil {
 		errs = append(errs, fmt.Errorf("failed to release lock: %w", err))
@@ -467,3 +826,11 @@ func (fm *FileManager) Close() error {
 
 	return nil
 }
+
+// ErrUninitializedPage indicates that a page lies in allocated file space
+// but has never been written.
+var ErrUninitializedPage = errors.New("page has not been initialized")
+
+// ErrPageSizeMismatch is returned when a file is opened with a page size
+// other than the one it was created with.
+var ErrPageSizeMismatch = errors.New("page size does not match the database file")
@@ -1,8 +1,10 @@
 package file
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
@@ -388,6 +390,223 @@ func TestFileManager_FileGrowth(t *testing.T) {
 	}
 }
 
+func TestFileManager_Truncate(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.godb")
+
+	fm, err := NewFileManager(dbPath, &Config{SyncWrites: false})
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	defer fm.Close()
+
+	for id := page.PageID(1); id <= 10; id++ {
+		if err := fm.WritePage(page.NewPage(id, page.PageTypeLeaf)); err != nil {
+			t.Fatalf("Failed to write page %d: %v", id, err)
+		}
+	}
+
+	if err := fm.Truncate(4); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	if fm.GetPageCount() != 4 || fm.GetFileSize() != 4*page.PageSize {
+		t.Errorf("Expected 4 pages, got %d pages and %d bytes", fm.GetPageCount(), fm.GetFileSize())
+	}
+	if stat, err := os.Stat(dbPath); err != nil || stat.Size() != 4*page.PageSize {
+		t.Errorf("Expected the file to shrink to 4 pages: %v", err)
+	}
+
+	if _, err := fm.ReadPage(3); err != nil {
+		t.Errorf("Failed to read page before the new end: %v", err)
+	}
+	if _, err := fm.ReadPage(4); err == nil {
+		t.Error("Expected error reading a truncated page")
+	}
+
+	// The file grows again when a page past the end is written
+	if err := fm.WritePage(page.NewPage(6, page.PageTypeLeaf)); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	if fm.GetPageCount() != 7 {
+		t.Errorf("Expected 7 pages, got %d", fm.GetPageCount())
+	}
+
+	if err := fm.Truncate(8); err == nil {
+		t.Error("Expected error truncating past the end of the file")
+	}
+
+	// Preallocation only applies to a new file, so the file stays small
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file manager: %v", err)
+	}
+	reopened, err := NewFileManager(dbPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to reopen file manager: %v", err)
+	}
+	defer reopened.Close()
+	if reopened.GetPageCount() != 7 {
+		t.Errorf("Expected the reopened file to keep 7 pages, got %d", reopened.GetPageCount())
+	}
+}
+
+func TestFileManager_PageSize(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.godb")
+
+	fm, err := NewFileManager(dbPath, &Config{PageSize: 4096, PreallocateSize: 16 * 4096})
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	if fm.PageSize() != 4096 || fm.GetPageCount() != 16 {
+		t.Errorf("Expected 16 pages of 4096 bytes, got %d of %d", fm.GetPageCount(), fm.PageSize())
+	}
+
+	meta := page.NewPageWithSize(0, page.PageTypeMeta, 4096)
+	sb := fm.Superblock()
+	if err := sb.Encode(meta); err != nil {
+		t.Fatalf("Failed to encode superblock: %v", err)
+	}
+	copy(meta.Data()[SuperblockSize:], "meta")
+	if err := fm.WriteMetaPage(meta); err != nil {
+		t.Fatalf("Failed to write meta page: %v", err)
+	}
+	if err := fm.WritePage(page.NewPageWithSize(20, page.PageTypeLeaf, 4096)); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	if fm.GetFileSize() != 21*4096 {
+		t.Errorf("Expected the file to grow to 21 pages, got %d bytes", fm.GetFileSize())
+	}
+	if err := fm.WritePage(page.NewPage(2, page.PageTypeLeaf)); err == nil {
+		t.Error("Expected error writing a page of another size")
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file manager: %v", err)
+	}
+
+	// The file keeps the page size it was created with
+	if _, err := NewFileManager(dbPath, &Config{PageSize: 8192}); !errors.Is(err, ErrPageSizeMismatch) {
+		t.Fatalf("Expected ErrPageSizeMismatch, got %v", err)
+	}
+	if _, err := NewFileManager(dbPath, &Config{PageSize: 3000}); !errors.Is(err, page.ErrInvalidPageSize) {
+		t.Fatalf("Expected ErrInvalidPageSize, got %v", err)
+	}
+
+	fm, err = NewFileManager(dbPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to reopen file manager: %v", err)
+	}
+	defer fm.Close()
+
+	if fm.PageSize() != 4096 || fm.GetPageCount() != 21 {
+		t.Errorf("Expected 21 pages of 4096 bytes, got %d of %d", fm.GetPageCount(), fm.PageSize())
+	}
+	pg, err := fm.ReadMetaPage()
+	if err != nil {
+		t.Fatalf("Failed to read meta page: %v", err)
+	}
+	if data := pg.Data()[SuperblockSize:]; pg.Size() != 4096 || string(data[:4]) != "meta" {
+		t.Errorf("Expected the meta page back, got %d bytes holding %q", pg.Size(), data[:4])
+	}
+	if err := fm.CheckIntegrity(); err != nil {
+		t.Errorf("Integrity check failed: %v", err)
+	}
+}
+
+func TestFileManager_Fence(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.godb")
+
+	fm, err := NewFileManager(dbPath, &Config{SyncWrites: false})
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	defer fm.Close()
+
+	write := func(id page.PageID, data string) {
+		t.Helper()
+		pg := page.NewPage(id, page.PageTypeLeaf)
+		copy(pg.Data(), data)
+		if err := fm.WritePage(pg); err != nil {
+			t.Fatalf("Failed to write page %d: %v", id, err)
+		}
+	}
+	readFenced := func(f *Fence, id page.PageID, want string) {
+		t.Helper()
+		buffer, err := f.ReadPage(id)
+		if err != nil {
+			t.Fatalf("Failed to read page %d through the fence: %v", id, err)
+		}
+		pg := &page.Page{}
+		if err := pg.Deserialize(buffer); err != nil {
+			t.Fatalf("Failed to deserialize page %d: %v", id, err)
+		}
+		if got := string(pg.Data()[:len(want)]); got != want {
+			t.Errorf("Expected page %d to read %q through the fence, got %q", id, want, got)
+		}
+	}
+
+	for id := page.PageID(1); id <= 5; id++ {
+		write(id, "old")
+	}
+
+	if _, err := fm.SetFence(7); err == nil {
+		t.Error("Expected error fencing past the end of the file")
+	}
+	fence, err := fm.SetFence(6)
+	if err != nil {
+		t.Fatalf("Failed to set fence: %v", err)
+	}
+
+	// Page 0 was never written
+	if buffer, err := fence.ReadPage(0); err != nil || !isZeroPage(buffer) {
+		t.Errorf("Expected page 0 to read as zeros: %v", err)
+	}
+
+	// Overwritten pages read as they were
+	write(2, "new")
+	readFenced(fence, 2, "old")
+	if current, err := fm.ReadPage(2); err != nil || string(current.Data()[:3]) != "new" {
+		t.Errorf("Expected the file to hold the new page 2: %v", err)
+	}
+
+	// A page read through the fence is not kept when it changes afterwards
+	readFenced(fence, 3, "old")
+	write(3, "new")
+	if len(fence.saved) != 0 {
+		t.Errorf("Expected no saved pages, got %d", len(fence.saved))
+	}
+
+	// Truncated pages, and pages past the fence, are handled too
+	write(7, "new")
+	if err := fm.Truncate(4); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	readFenced(fence, 4, "old")
+	readFenced(fence, 5, "old")
+	if _, err := fence.ReadPage(6); err == nil {
+		t.Error("Expected error reading past the fence")
+	}
+
+	// The next fence knows the pages written since this one
+	if _, ok := fence.Changed(); ok {
+		t.Error("Expected the changes before the first fence to be unknown")
+	}
+	next, err := fm.SetFence(4)
+	if err != nil {
+		t.Fatalf("Failed to set fence: %v", err)
+	}
+	if changed, ok := next.Changed(); !ok || !slices.Equal(changed, []page.PageID{2, 3}) {
+		t.Errorf("Expected pages 2 and 3 to have changed, got %v", changed)
+	}
+	next.Release()
+
+	fence.Release()
+	if _, err := fence.ReadPage(1); !errors.Is(err, ErrFenceReleased) {
+		t.Errorf("Expected ErrFenceReleased, got %v", err)
+	}
+	if len(fm.fences) != 0 {
+		t.Errorf("Expected no fences after release, got %d", len(fm.fences))
+	}
+	write(1, "new")
+}
+
 func TestDefaultConfig(t *testing.T) {
 	config := DefaultConfig()
 
@@ -0,0 +1,25 @@
+//go:build linux
+
+package file
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Modes of fallocate(2), which the syscall package does not define.
+const (
+	fallocKeepSize  = 0x1
+	fallocPunchHole = 0x2
+)
+
+// punchHole deallocates a range of f, which then reads back as zeros,
+// without changing its size.
+func punchHole(f *os.File, offset, length int64) error {
+	err := syscall.Fallocate(int(f.Fd()), fallocPunchHole|fallocKeepSize, offset, length) // #nosec G115 - file descriptors fit in an int
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return errHolesUnsupported
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package file
+
+import "os"
+
+// punchHole deallocates a range of f, which is only supported on Linux.
+func punchHole(f *os.File, offset, length int64) error {
+	return errHolesUnsupported
+}
@@ -0,0 +1,293 @@
+package file
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// FormatVersion is the version of the file format written by this package.
+// Version 1 files predate the superblock: page 0 holds only the engine
+// metadata, with its own magic and version. Version 2 adds the superblock.
+const FormatVersion = 2
+
+// SuperblockSize is the number of bytes at the start of the meta page data
+// section taken by the superblock. The rest belongs to the storage engine.
+const SuperblockSize = 64
+
+// superblockMagic identifies a database file.
+var superblockMagic = [8]byte{'G', 'O', 'D', 'B', 'F', 'I', 'L', 'E'}
+
+// legacyMagic identifies the meta page of a version 1 file, whose format
+// version is stored at legacyVersionOffset. Files written before the format
+// was versioned have version 0 there.
+var legacyMagic = [8]byte{'G', 'O', 'D', 'B', 'M', 'E', 'T', 'A'}
+
+const legacyVersionOffset = 28
+
+// Layout of the superblock within the meta page data section.
+const (
+	sbMagicOffset    = 0
+	sbVersionOffset  = 8
+	sbPageSizeOffset = 12
+	sbCreatedOffset  = 16
+	sbUUIDOffset     = 24
+	sbFeaturesOffset = 40
+	sbChecksumOffset = 44
+	sbRootOffset     = 48
+)
+
+// Features are optional features of the file format. A file records the
+// ones its pages use, and cannot be opened by a version that lacks any.
+type Features uint32
+
+const (
+	// FeatureCompression marks a file whose pages may be compressed
+	FeatureCompression Features = 1 << iota
+
+	// FeatureEncryption marks a file whose pages are encrypted
+	FeatureEncryption
+)
+
+// supportedFeatures are the features this version can read.
+const supportedFeatures = FeatureCompression
+
+// UUID identifies a database file. It is generated when the file is created
+// and kept by copies of it, such as restored backups.
+type UUID [16]byte
+
+// String formats the UUID in the usual 8-4-4-4-12 form.
+func (u UUID) String() string {
+	s := hex.EncodeToString(u[:])
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return u, fmt.Errorf("failed to generate file UUID: %w", err)
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u, nil
+}
+
+// Superblock describes a database file. It is stored at the start of the
+// meta page (page 0), so that a file can be recognized, and its format
+// checked, before anything else in it is read.
+type Superblock struct {
+	// Version is the version of the file format
+	Version uint32
+
+	// PageSize is the size of the file's pages in bytes
+	PageSize int
+
+	// Created is when the file was created
+	Created time.Time
+
+	// UUID identifies the file
+	UUID UUID
+
+	// Features are the optional format features the file uses
+	Features Features
+
+	// Checksum is the algorithm of the page checksums
+	Checksum page.ChecksumAlgorithm
+
+	// Root is the root page of the B+ tree, kept up to date by the engine
+	// each time it writes the meta page
+	Root page.PageID
+}
+
+// newSuperblock describes a new file with the given page size and checksum
+// algorithm.
+func newSuperblock(pageSize int, checksum page.ChecksumAlgorithm) (Superblock, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return Superblock{}, err
+	}
+	return Superblock{
+		Version:  FormatVersion,
+		PageSize: pageSize,
+		Created:  time.Now(),
+		UUID:     uuid,
+		Checksum: checksum,
+		Root:     page.InvalidPageID,
+	}, nil
+}
+
+// Encode writes the superblock into the first SuperblockSize bytes of a meta
+// page's data section, leaving the rest of the page alone.
+func (sb *Superblock) Encode(pg *page.Page) error {
+	if pg.Size() != sb.PageSize {
+		return fmt.Errorf("cannot encode the superblock of a file of %d-byte pages into a %d-byte page", sb.PageSize, pg.Size())
+	}
+
+	data := pg.Data()[:SuperblockSize]
+	for i := range data {
+		data[i] = 0
+	}
+
+	copy(data[sbMagicOffset:], superblockMagic[:])
+	binary.LittleEndian.PutUint32(data[sbVersionOffset:], sb.Version)
+	binary.LittleEndian.PutUint32(data[sbPageSizeOffset:], uint32(sb.PageSize))          // #nosec G115 - bounded by page.MaxPageSize
+	binary.LittleEndian.PutUint64(data[sbCreatedOffset:], uint64(sb.Created.UnixNano())) // #nosec G115 - stored as is
+	copy(data[sbUUIDOffset:], sb.UUID[:])
+	binary.LittleEndian.PutUint32(data[sbFeaturesOffset:], uint32(sb.Features))
+	data[sbChecksumOffset] = uint8(sb.Checksum)
+	binary.LittleEndian.PutUint32(data[sbRootOffset:], uint32(sb.Root))
+
+	return nil
+}
+
+// DecodeSuperblock reads the superblock from a meta page in the current
+// format. A file in an older format must be upgraded first.
+func DecodeSuperblock(pg *page.Page) (*Superblock, error) {
+	sb, err := readSuperblock(pg)
+	if err != nil {
+		return nil, err
+	}
+	if sb.Version != FormatVersion {
+		return nil, fmt.Errorf("%w: version %d must be upgraded to %d", ErrUnsupportedVersion, sb.Version, FormatVersion)
+	}
+	return sb, nil
+}
+
+// readSuperblock reads the superblock from a meta page in any format this
+// version recognizes. For a file older than version 2, only Version and
+// PageSize are known; it has no superblock of its own.
+func readSuperblock(pg *page.Page) (*Superblock, error) {
+	if pg.Type() != page.PageTypeMeta {
+		return nil, fmt.Errorf("%w: page 0 is a %s page", ErrNotDatabase, pg.Type())
+	}
+
+	data := pg.Data()
+	var magic [8]byte
+	copy(magic[:], data[sbMagicOffset:])
+
+	switch magic {
+	case superblockMagic:
+	case legacyMagic:
+		version := binary.LittleEndian.Uint32(data[legacyVersionOffset:])
+		if version > 1 {
+			return nil, fmt.Errorf("%w: unknown version %d", ErrUnsupportedVersion, version)
+		}
+		return &Superblock{
+			Version:  version,
+			PageSize: pg.Size(),
+			Checksum: page.ChecksumCRC32,
+			Root:     page.InvalidPageID,
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: bad magic %q", ErrNotDatabase, magic[:])
+	}
+
+	sb := &Superblock{
+		Version:  binary.LittleEndian.Uint32(data[sbVersionOffset:]),
+		PageSize: int(binary.LittleEndian.Uint32(data[sbPageSizeOffset:])),
+		Created:  time.Unix(0, int64(binary.LittleEndian.Uint64(data[sbCreatedOffset:]))), // #nosec G115 - stored as is
+		Features: Features(binary.LittleEndian.Uint32(data[sbFeaturesOffset:])),
+		Checksum: page.ChecksumAlgorithm(data[sbChecksumOffset]),
+		Root:     page.PageID(binary.LittleEndian.Uint32(data[sbRootOffset:])),
+	}
+	copy(sb.UUID[:], data[sbUUIDOffset:])
+
+	switch {
+	case sb.Version > FormatVersion:
+		return nil, fmt.Errorf("%w: version %d is newer than %d", ErrUnsupportedVersion, sb.Version, FormatVersion)
+	case sb.Version < FormatVersion:
+		// The superblock first appeared in the current version
+		return nil, fmt.Errorf("%w: unknown version %d", ErrUnsupportedVersion, sb.Version)
+	case sb.PageSize != pg.Size():
+		return nil, fmt.Errorf("%w: superblock records %d-byte pages in a %d-byte page", ErrNotDatabase, sb.PageSize, pg.Size())
+	case sb.Features&^supportedFeatures != 0:
+		return nil, fmt.Errorf("%w: features %#x", ErrUnsupportedFeature, uint32(sb.Features&^supportedFeatures))
+	case !sb.Checksum.Supported():
+		return nil, fmt.Errorf("%w: checksum algorithm %s", ErrUnsupportedFeature, sb.Checksum)
+	}
+
+	return sb, nil
+}
+
+// Migration upgrades the meta page of a file from one format version to the
+// next. It rewrites everything in the page after the first SuperblockSize
+// bytes in the newer format, and fills in the superblock fields the older
+// format kept elsewhere, such as Root. The superblock itself is encoded in
+// the current format once every migration has run.
+type Migration func(meta *page.Page, sb *Superblock) error
+
+// Upgrade brings a file written in an older format up to FormatVersion in
+// place, applying migrations[v] to go from version v to v+1, and syncs it.
+// It then records the format features the file is configured to use, such
+// as compression, if it lacks them. It fails with ErrUnsupportedVersion if
+// a step has no migration. Files are upgraded after recovery, which may
+// rewrite the meta page as it was before.
+func (fm *FileManager) Upgrade(migrations map[uint32]Migration) error {
+	fm.mu.RLock()
+	version := fm.superblock.Version
+	fm.mu.RUnlock()
+	if version != FormatVersion {
+		if err := fm.upgradeVersion(version, migrations); err != nil {
+			return err
+		}
+	}
+	return fm.enableCompression()
+}
+
+// upgradeVersion rewrites the meta page of a file in the given format
+// version in the current one.
+func (fm *FileManager) upgradeVersion(version uint32, migrations map[uint32]Migration) error {
+	meta, err := fm.ReadMetaPage()
+	if err != nil {
+		return fmt.Errorf("failed to read meta page: %w", err)
+	}
+
+	sb, err := newSuperblock(fm.PageSize(), fm.checksum)
+	if err != nil {
+		return err
+	}
+	for v := version; v < FormatVersion; v++ {
+		migrate, ok := migrations[v]
+		if !ok {
+			return fmt.Errorf("%w: no upgrade from version %d", ErrUnsupportedVersion, v)
+		}
+		if err := migrate(meta, &sb); err != nil {
+			return fmt.Errorf("failed to upgrade from version %d: %w", v, err)
+		}
+	}
+	if err := sb.Encode(meta); err != nil {
+		return err
+	}
+
+	if err := fm.WriteMetaPage(meta); err != nil {
+		return fmt.Errorf("failed to write upgraded meta page: %w", err)
+	}
+	return fm.Sync()
+}
+
+// Superblock returns the superblock of the file. For a file in an older
+// format that has not been upgraded, only Version and PageSize are known.
+func (fm *FileManager) Superblock() Superblock {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+	return fm.superblock
+}
+
+var (
+	// ErrNotDatabase is returned when opening a file that is not a database.
+	ErrNotDatabase = errors.New("file is not a database")
+
+	// ErrUnsupportedVersion is returned when opening a database file whose
+	// format version this version cannot read or upgrade.
+	ErrUnsupportedVersion = errors.New("unsupported database file format version")
+
+	// ErrUnsupportedFeature is returned when opening a database file that
+	// uses a format feature this version does not support.
+	ErrUnsupportedFeature = errors.New("unsupported database file feature")
+)
@@ -0,0 +1,265 @@
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// writeMetaPage writes a file holding only the given meta page.
+func writeMetaPage(t *testing.T, path string, meta *page.Page) {
+	t.Helper()
+	buffer, err := meta.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize meta page: %v", err)
+	}
+	if err := os.WriteFile(path, buffer, DefaultFileMode); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
+
+func TestSuperblock_RoundTrip(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.godb")
+
+	fm, err := NewFileManager(dbPath, &Config{PageSize: 4096})
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+
+	sb := fm.Superblock()
+	switch {
+	case sb.Version != FormatVersion || sb.PageSize != 4096:
+		t.Errorf("Expected version %d with 4096-byte pages, got %+v", FormatVersion, sb)
+	case sb.UUID == UUID{}:
+		t.Error("Expected a new file to get a UUID")
+	case time.Since(sb.Created) > time.Minute:
+		t.Errorf("Expected a new file to be created now, got %v", sb.Created)
+	}
+
+	sb.Root = 5
+	meta := page.NewPageWithSize(0, page.PageTypeMeta, 4096)
+	if err := sb.Encode(meta); err != nil {
+		t.Fatalf("Failed to encode superblock: %v", err)
+	}
+	if err := fm.WriteMetaPage(meta); err != nil {
+		t.Fatalf("Failed to write meta page: %v", err)
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file manager: %v", err)
+	}
+
+	fm, err = NewFileManager(dbPath, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to reopen file manager: %v", err)
+	}
+	defer fm.Close()
+
+	reopened := fm.Superblock()
+	if !reopened.Created.Equal(sb.Created) {
+		t.Errorf("Expected creation time %v, got %v", sb.Created, reopened.Created)
+	}
+	reopened.Created = sb.Created
+	if reopened != sb {
+		t.Errorf("Expected superblock %+v, got %+v", sb, reopened)
+	}
+	if s := sb.UUID.String(); len(s) != 36 || strings.Count(s, "-") != 4 {
+		t.Errorf("Expected a formatted UUID, got %q", s)
+	}
+}
+
+func TestFileManager_NotDatabase(t *testing.T) {
+	dir := t.TempDir()
+
+	// A file that is not a database at all
+	textPath := filepath.Join(dir, "text.godb")
+	text := strings.Repeat("this is not a database file\n", 400)
+	if err := os.WriteFile(textPath, []byte(text), DefaultFileMode); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := NewFileManager(textPath, DefaultConfig()); !errors.Is(err, ErrNotDatabase) {
+		t.Errorf("Expected ErrNotDatabase for a text file, got %v", err)
+	}
+
+	// Pages, but no meta page
+	leafPath := filepath.Join(dir, "leaf.godb")
+	writeMetaPage(t, leafPath, page.NewPage(0, page.PageTypeLeaf))
+	if _, err := NewFileManager(leafPath, DefaultConfig()); !errors.Is(err, ErrNotDatabase) {
+		t.Errorf("Expected ErrNotDatabase without a meta page, got %v", err)
+	}
+
+	// A meta page without a superblock
+	metaPath := filepath.Join(dir, "meta.godb")
+	meta := page.NewPage(0, page.PageTypeMeta)
+	copy(meta.Data(), "NOTAFILE")
+	writeMetaPage(t, metaPath, meta)
+	if _, err := NewFileManager(metaPath, DefaultConfig()); !errors.Is(err, ErrNotDatabase) {
+		t.Errorf("Expected ErrNotDatabase without a superblock, got %v", err)
+	}
+}
+
+func TestFileManager_UnsupportedFormat(t *testing.T) {
+	dir := t.TempDir()
+	sb, err := newSuperblock(page.PageSize, page.ChecksumCRC32)
+	if err != nil {
+		t.Fatalf("Failed to create superblock: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(sb *Superblock)
+		expected error
+	}{
+		{"newer version", func(sb *Superblock) { sb.Version = FormatVersion + 1 }, ErrUnsupportedVersion},
+		{"encryption", func(sb *Superblock) { sb.Features = FeatureEncryption }, ErrUnsupportedFeature},
+		{"unknown feature", func(sb *Superblock) { sb.Features = 1 << 20 }, ErrUnsupportedFeature},
+		{"checksum", func(sb *Superblock) { sb.Checksum = 200 }, ErrUnsupportedFeature},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified := sb
+			tt.modify(&modified)
+			meta := page.NewPage(0, page.PageTypeMeta)
+			if err := modified.Encode(meta); err != nil {
+				t.Fatalf("Failed to encode superblock: %v", err)
+			}
+
+			path := filepath.Join(dir, string(rune('a'+i))+".godb")
+			writeMetaPage(t, path, meta)
+			if _, err := NewFileManager(path, DefaultConfig()); !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestFileManager_Upgrade(t *testing.T) {
+	dir := t.TempDir()
+
+	// legacyFile writes a file whose meta page predates the superblock
+	legacyFile := func(name string, version uint32) string {
+		meta := page.NewPage(0, page.PageTypeMeta)
+		copy(meta.Data(), legacyMagic[:])
+		binary.LittleEndian.PutUint32(meta.Data()[12:], 9) // The root
+		binary.LittleEndian.PutUint32(meta.Data()[legacyVersionOffset:], version)
+		path := filepath.Join(dir, name)
+		writeMetaPage(t, path, meta)
+		return path
+	}
+
+	migrations := map[uint32]Migration{
+		1: func(meta *page.Page, sb *Superblock) error {
+			data := meta.Data()
+			sb.Root = page.PageID(binary.LittleEndian.Uint32(data[12:]))
+			clear(data)
+			copy(data[SuperblockSize:], "migrated")
+			return nil
+		},
+	}
+
+	path := legacyFile("v1.godb", 1)
+	fm, err := NewFileManager(path, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to open a version 1 file: %v", err)
+	}
+	if sb := fm.Superblock(); sb.Version != 1 || sb.PageSize != page.PageSize {
+		t.Errorf("Expected version 1 with %d-byte pages, got %+v", page.PageSize, sb)
+	}
+	if err := fm.Upgrade(migrations); err != nil {
+		t.Fatalf("Failed to upgrade: %v", err)
+	}
+	if err := fm.Upgrade(nil); err != nil {
+		t.Errorf("Expected upgrading an up-to-date file to do nothing, got %v", err)
+	}
+	upgraded := fm.Superblock()
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file manager: %v", err)
+	}
+
+	fm, err = NewFileManager(path, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to reopen the upgraded file: %v", err)
+	}
+	defer fm.Close()
+
+	sb := fm.Superblock()
+	if sb.Version != FormatVersion || sb.Root != 9 || sb.UUID != upgraded.UUID || sb.UUID == (UUID{}) {
+		t.Errorf("Expected version %d with root 9 and UUID %v, got %+v", FormatVersion, upgraded.UUID, sb)
+	}
+	meta, err := fm.ReadMetaPage()
+	if err != nil {
+		t.Fatalf("Failed to read meta page: %v", err)
+	}
+	if _, err := DecodeSuperblock(meta); err != nil {
+		t.Errorf("Failed to decode upgraded superblock: %v", err)
+	}
+	if data := meta.Data()[SuperblockSize:]; string(data[:8]) != "migrated" {
+		t.Errorf("Expected the migrated meta page, got %q", data[:8])
+	}
+
+	// Nothing upgrades a file written before the format was versioned
+	fm0, err := NewFileManager(legacyFile("v0.godb", 0), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to open a version 0 file: %v", err)
+	}
+	defer fm0.Close()
+	if err := fm0.Upgrade(migrations); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+	if _, err := fm0.ReadMetaPage(); err != nil {
+		t.Errorf("Expected the file to be left alone, got %v", err)
+	}
+}
+
+func TestFileManager_ChecksumAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, algorithm := range []page.ChecksumAlgorithm{page.ChecksumCRC32, page.ChecksumCRC32C, page.ChecksumXXHash64, page.ChecksumNone} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			dbPath := filepath.Join(dir, algorithm.String()+".godb")
+			fm, err := NewFileManager(dbPath, &Config{Checksum: algorithm, VerifyChecksums: true})
+			if err != nil {
+				t.Fatalf("Failed to create file manager: %v", err)
+			}
+			sb := fm.Superblock()
+			meta := page.NewPage(0, page.PageTypeMeta)
+			if err := sb.Encode(meta); err != nil {
+				t.Fatalf("Failed to encode superblock: %v", err)
+			}
+			if err := fm.WriteMetaPage(meta); err != nil {
+				t.Fatalf("Failed to write meta page: %v", err)
+			}
+			writeData(t, fm, 1, "data")
+			if err := fm.Close(); err != nil {
+				t.Fatalf("Failed to close file manager: %v", err)
+			}
+
+			// The file keeps its algorithm whatever the configuration says
+			fm, err = NewFileManager(dbPath, DefaultConfig())
+			if err != nil {
+				t.Fatalf("Failed to reopen file manager: %v", err)
+			}
+			defer fm.Close()
+			if got := fm.Superblock().Checksum; got != algorithm {
+				t.Errorf("Expected checksum algorithm %v, got %v", algorithm, got)
+			}
+			if got := readData(t, fm, 1, 4); got != "data" {
+				t.Errorf("Expected the page data, got %q", got)
+			}
+
+			buffer := make([]byte, page.PageSize)
+			if _, err := fm.file.ReadAt(buffer, page.PageSize); err != nil {
+				t.Fatalf("Failed to read page: %v", err)
+			}
+			if err := algorithm.Verify(buffer); err != nil {
+				t.Errorf("Expected the page checksummed with %v, got %v", algorithm, err)
+			}
+		})
+	}
+}
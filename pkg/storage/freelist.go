@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// Free pages are recorded in the database file in a chain of free-list trunk
+// pages whose head is kept in the meta page. A trunk is a free page of type
+// PageTypeFree that lists other free pages in its data section:
+//
+//	count (4) | page ID (4) ...
+//
+// and links to the next trunk through its header's next page field. Pages
+// listed in a trunk are not written while they are free, so freeing or
+// reusing one only changes its trunk. A trunk is itself reused once its list
+// is empty, and a freed page becomes the new head trunk when the head is
+// full. Trunk changes are logged like any other page change, so the free
+// list is rolled back and recovered with the update that changed it.
+const trunkCountSize = 4
+
+// trunkCapacity returns the number of free pages a trunk lists.
+func (ppm *PersistentPageManager) trunkCapacity() int {
+	return (ppm.PageSize() - page.PageHeaderSize - trunkCountSize) / 4
+}
+
+// trunkCount returns the number of free pages a trunk lists.
+func trunkCount(trunk *page.Page) int {
+	return int(binary.LittleEndian.Uint32(trunk.Data()))
+}
+
+// trunkEntry returns the i-th free page a trunk lists.
+func trunkEntry(trunk *page.Page, i int) page.PageID {
+	return page.PageID(binary.LittleEndian.Uint32(trunk.Data()[trunkCountSize+4*i:]))
+}
+
+// setTrunkCount sets the number of free pages a trunk lists.
+func setTrunkCount(trunk *page.Page, n int) {
+	binary.LittleEndian.PutUint32(trunk.Data(), uint32(n)) // #nosec G115 - bounded by the trunk capacity
+}
+
+// setTrunkEntry sets the i-th free page a trunk lists.
+func setTrunkEntry(trunk *page.Page, i int, id page.PageID) {
+	binary.LittleEndian.PutUint32(trunk.Data()[trunkCountSize+4*i:], uint32(id))
+}
+
+// loadFreeListLocked walks the free list in the file to find every free page
+// (assumes lock is held).
+func (ppm *PersistentPageManager) loadFreeListLocked() error {
+	for id := ppm.meta.freeListHead; id != page.InvalidPageID; {
+		trunk, err := ppm.trunkLocked(id)
+		if err != nil {
+			return err
+		}
+		if err := ppm.markFreeLocked(id); err != nil {
+			return err
+		}
+
+		for i := 0; i < trunkCount(trunk); i++ {
+			if err := ppm.markFreeLocked(trunkEntry(trunk, i)); err != nil {
+				return err
+			}
+		}
+		id = trunk.NextPage()
+	}
+
+	return nil
+}
+
+// markFreeLocked adds a page found on the free list to the free set, checking
+// that it can be free (assumes lock is held).
+func (ppm *PersistentPageManager) markFreeLocked(id page.PageID) error {
+	if id == page.InvalidPageID || id >= ppm.meta.nextPageID || ppm.free[id] {
+		return fmt.Errorf("%w: page %d cannot be on the free list", errFreeListCorrupted, id)
+	}
+	ppm.free[id] = true
+	return nil
+}
+
+// pushFreeLocked records a page on the free list (assumes lock is held).
+func (ppm *PersistentPageManager) pushFreeLocked(id page.PageID) error {
+	head := ppm.meta.freeListHead
+	if head != page.InvalidPageID {
+		trunk, err := ppm.trunkLocked(head)
+		if err != nil {
+			return err
+		}
+
+		if n := trunkCount(trunk); n < ppm.trunkCapacity() {
+			setTrunkEntry(trunk, n, id)
+			setTrunkCount(trunk, n+1)
+			if err := ppm.writeFreeListPageLocked(trunk); err != nil {
+				return err
+			}
+			ppm.free[id] = true
+			return nil
+		}
+	}
+
+	// The head trunk is full, so the page becomes the new head. Its current
+	// contents are tracked first so that the change can be rolled back.
+	if ppm.update != nil {
+		if _, seen := ppm.update.logged[id]; !seen {
+			pg, err := ppm.bufferPool.GetPage(id)
+			if err != nil {
+				return fmt.Errorf("failed to read freed page %d: %w", id, err)
+			}
+			if err := ppm.bufferPool.UnpinPage(id, false); err != nil {
+				return err
+			}
+			ppm.trackLocked(pg)
+		}
+	}
+
+	trunk := page.NewPageWithSize(id, page.PageTypeFree, ppm.PageSize())
+	trunk.SetNextPage(head)
+	if err := ppm.writeFreeListPageLocked(trunk); err != nil {
+		return err
+	}
+
+	ppm.meta.freeListHead = id
+	ppm.free[id] = true
+	return nil
+}
+
+// popFreeLocked takes a page off the free list. It returns false if no page
+// is free (assumes lock is held).
+func (ppm *PersistentPageManager) popFreeLocked() (page.PageID, bool, error) {
+	head := ppm.meta.freeListHead
+	if head == page.InvalidPageID {
+		return page.InvalidPageID, false, nil
+	}
+
+	trunk, err := ppm.trunkLocked(head)
+	if err != nil {
+		return page.InvalidPageID, false, err
+	}
+
+	id := head
+	if n := trunkCount(trunk); n > 0 {
+		id = trunkEntry(trunk, n-1)
+		setTrunkCount(trunk, n-1)
+		if err := ppm.writeFreeListPageLocked(trunk); err != nil {
+			return page.InvalidPageID, false, err
+		}
+	} else {
+		// The trunk lists nothing more, so it is reused itself
+		ppm.meta.freeListHead = trunk.NextPage()
+	}
+
+	delete(ppm.free, id)
+	if ppm.update != nil {
+		ppm.update.reused = append(ppm.update.reused, id)
+	}
+	return id, true, nil
+}
+
+// SortFreeList rewrites the free list so that free pages are reused in
+// ascending order of page ID. Compaction relies on this to move pages toward
+// the start of the file.
+func (ppm *PersistentPageManager) SortFreeList() error {
+	ppm.mu.Lock()
+	defer ppm.mu.Unlock()
+	return ppm.rewriteFreeListLocked()
+}
+
+// RelocationBound returns the number of pages the file would need, including
+// the meta page, if every allocated page were moved to the start of it, and
+// the number of allocated pages past that bound.
+func (ppm *PersistentPageManager) RelocationBound() (page.PageID, int) {
+	ppm.mu.RLock()
+	defer ppm.mu.RUnlock()
+
+	bound := ppm.meta.nextPageID - page.PageID(len(ppm.free)) // #nosec G115 - free pages are below nextPageID
+	remaining := 0
+	for id := range ppm.free {
+		if id < bound {
+			remaining++ // Each free page below the bound is matched by an allocated page past it
+		}
+	}
+	return bound, remaining
+}
+
+// Shrink drops the free pages at the end of the file from the free list, so
+// that page IDs are allocated from the first of them again, and returns the
+// number of pages the file now needs, including the meta page. The caller
+// may truncate the file to that size once the change is on disk.
+func (ppm *PersistentPageManager) Shrink() (page.PageID, error) {
+	ppm.mu.Lock()
+	defer ppm.mu.Unlock()
+
+	end := ppm.meta.nextPageID
+	for end > 1 && ppm.free[end-1] {
+		end--
+	}
+	if end == ppm.meta.nextPageID {
+		return end, nil
+	}
+
+	for id := end; id < ppm.meta.nextPageID; id++ {
+		delete(ppm.free, id)
+		if ppm.update != nil {
+			ppm.update.reused = append(ppm.update.reused, id)
+		}
+	}
+	ppm.meta.nextPageID = end
+
+	return end, ppm.rewriteFreeListLocked()
+}
+
+// rewriteFreeListLocked writes the free list anew from the free set, so that
+// pages are taken off it in ascending order of page ID (assumes lock is held).
+// Free pages are grouped in descending order, each group's first page being
+// the trunk that lists the rest, and the group with the lowest pages becomes
+// the head.
+func (ppm *PersistentPageManager) rewriteFreeListLocked() error {
+	// Read the current trunks first, so that the update tracks their
+	// contents before any of them is overwritten
+	for id := ppm.meta.freeListHead; id != page.InvalidPageID; {
+		trunk, err := ppm.trunkLocked(id)
+		if err != nil {
+			return err
+		}
+		id = trunk.NextPage()
+	}
+
+	ids := slices.Sorted(maps.Keys(ppm.free))
+	slices.Reverse(ids)
+
+	head := page.InvalidPageID
+	capacity := ppm.trunkCapacity()
+	for start := 0; start < len(ids); start += capacity + 1 {
+		group := ids[start:min(start+capacity+1, len(ids))]
+
+		trunk := page.NewPageWithSize(group[0], page.PageTypeFree, ppm.PageSize())
+		if ppm.update != nil {
+			// Only trunks hold contents that matter, and those are tracked
+			// already, so any other page is logged in full from scratch
+			if _, seen := ppm.update.logged[trunk.ID()]; !seen {
+				ppm.trackLocked(trunk)
+				ppm.update.fresh[trunk.ID()] = true
+			}
+		}
+
+		for i, id := range group[1:] {
+			setTrunkEntry(trunk, i, id)
+		}
+		setTrunkCount(trunk, len(group)-1)
+		trunk.SetNextPage(head)
+
+		if err := ppm.writeFreeListPageLocked(trunk); err != nil {
+			return err
+		}
+		head = trunk.ID()
+	}
+
+	ppm.meta.freeListHead = head
+	return nil
+}
+
+// trunkLocked reads a free-list trunk page (assumes lock is held).
+func (ppm *PersistentPageManager) trunkLocked(id page.PageID) (*page.Page, error) {
+	trunk, err := ppm.bufferPool.GetPage(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read free-list page %d: %w", id, err)
+	}
+	if err := ppm.bufferPool.UnpinPage(id, false); err != nil {
+		return nil, err
+	}
+
+	if trunk.Type() != page.PageTypeFree {
+		return nil, fmt.Errorf("%w: page %d is a %s page", errFreeListCorrupted, id, trunk.Type())
+	}
+	if trunkCount(trunk) > ppm.trunkCapacity() {
+		return nil, fmt.Errorf("%w: page %d lists %d pages", errFreeListCorrupted, id, trunkCount(trunk))
+	}
+
+	ppm.trackLocked(trunk)
+	return trunk, nil
+}
+
+// writeFreeListPageLocked logs a change to a free-list page and hands it to
+// the buffer pool (assumes lock is held).
+func (ppm *PersistentPageManager) writeFreeListPageLocked(pg *page.Page) error {
+	if ppm.log != nil {
+		if err := ppm.logPageLocked(pg); err != nil {
+			return err
+		}
+	}
+
+	if err := ppm.bufferPool.PutPage(pg); err != nil {
+		return fmt.Errorf("failed to buffer page %d: %w", pg.ID(), err)
+	}
+	return nil
+}
+
+// errFreeListCorrupted indicates that the free list in the file is inconsistent.
+var errFreeListCorrupted = errors.New("free list corrupted")
@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"errors"
+
+	"github.com/thromel/go-database/pkg/storage/btree"
 	"github.com/thromel/go-database/pkg/utils"
 )
 
@@ -15,6 +18,9 @@ type MemoryIterator struct {
 	// position tracks the current position in the keys slice
 	position int
 
+	// positioned indicates if the iterator has been moved since it was created
+	positioned bool
+
 	// closed indicates if the iterator has been closed
 	closed bool
 
@@ -39,6 +45,24 @@ func (it *MemoryIterator) Next() bool {
 	}
 
 	it.position++
+	it.positioned = true
+	return it.Valid()
+}
+
+// Prev moves the iterator back to the previous key-value pair.
+func (it *MemoryIterator) Prev() bool {
+	if it.closed {
+		it.err = utils.ErrIteratorClosed
+		return false
+	}
+
+	switch {
+	case !it.positioned:
+		it.position = len(it.keys) - 1
+	case it.position >= 0:
+		it.position--
+	}
+	it.positioned = true
 	return it.Valid()
 }
 
@@ -77,6 +101,7 @@ func (it *MemoryIterator) Seek(target []byte) {
 		return
 	}
 
+	it.positioned = true
 	targetStr := string(target)
 
 	// Binary search for the first key >= target
@@ -104,6 +129,7 @@ func (it *MemoryIterator) SeekToFirst() {
 		return
 	}
 
+	it.positioned = true
 	it.position = 0
 	if len(it.keys) == 0 {
 		it.position = -1
@@ -117,6 +143,7 @@ func (it *MemoryIterator) SeekToLast() {
 		return
 	}
 
+	it.positioned = true
 	it.position = len(it.keys) - 1
 }
 
@@ -138,3 +165,231 @@ func (it *MemoryIterator) Close() error {
 
 	return nil
 }
+
+// PersistentIterator implements the Iterator interface for persistent
+// storage by walking the leaves of the engine's B+ tree with a cursor.
+// Unlike MemoryIterator it does not snapshot the data: it reads the tree
+// one leaf at a time and sees changes committed while it runs.
+type PersistentIterator struct {
+	// engine is the storage engine being iterated
+	engine *PersistentEngine
+
+	// tree is the B+ tree the cursor walks
+	tree *btree.BPlusTree
+
+	// cursor is the position in the tree
+	cursor *btree.Cursor
+
+	// start and end bound the iteration to [start, end)
+	start []byte
+	end   []byte
+
+	// positioned indicates if the iterator has been positioned at all
+	positioned bool
+
+	// closed indicates if the iterator has been closed
+	closed bool
+
+	// err holds any error encountered during iteration
+	err error
+}
+
+// newPersistentIterator creates an iterator over the keys in [start, end)
+// (assumes lock is held).
+func newPersistentIterator(pe *PersistentEngine, start, end []byte) *PersistentIterator {
+	return &PersistentIterator{
+		engine: pe,
+		tree:   pe.btree,
+		cursor: pe.btree.NewCursor(start, end),
+		start:  append([]byte(nil), start...),
+		end:    append([]byte(nil), end...),
+	}
+}
+
+// Valid returns true if the iterator is positioned at a valid key-value pair.
+func (it *PersistentIterator) Valid() bool {
+	if it.closed || it.err != nil {
+		return false
+	}
+
+	return it.cursor.Valid()
+}
+
+// Next advances the iterator to the next key-value pair.
+func (it *PersistentIterator) Next() bool {
+	if !it.acquire() {
+		return false
+	}
+	defer it.engine.mu.RUnlock()
+
+	if !it.positioned {
+		it.positioned = true
+		it.cursor.SeekToFirst()
+	} else if it.tree != it.engine.btree {
+		// The engine reopened its tree; continue after the last key
+		last, valid := it.cursor.Key(), it.cursor.Valid()
+		it.rebindLocked()
+		if !valid {
+			return false
+		}
+		it.cursor.Seek(append(append([]byte(nil), last...), 0))
+	} else {
+		it.cursor.Next()
+	}
+
+	return it.checkLocked()
+}
+
+// Prev moves the iterator back to the previous key-value pair.
+func (it *PersistentIterator) Prev() bool {
+	if !it.acquire() {
+		return false
+	}
+	defer it.engine.mu.RUnlock()
+
+	if !it.positioned {
+		it.positioned = true
+		it.cursor.SeekToLast()
+	} else if it.tree != it.engine.btree {
+		// The engine reopened its tree; continue before the last key
+		last, valid := it.cursor.Key(), it.cursor.Valid()
+		it.rebindLocked()
+		if !valid {
+			return false
+		}
+		it.cursor.SeekBefore(last)
+	} else {
+		it.cursor.Prev()
+	}
+
+	return it.checkLocked()
+}
+
+// Key returns the current key. The returned slice must not be modified.
+func (it *PersistentIterator) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+
+	return it.cursor.Key()
+}
+
+// Value returns the current value. The returned slice must not be modified.
+// Values stored in overflow pages are read from the database by this call.
+func (it *PersistentIterator) Value() []byte {
+	if !it.Valid() || !it.acquire() {
+		return nil
+	}
+	defer it.engine.mu.RUnlock()
+
+	if it.tree != it.engine.btree {
+		// The engine reopened its tree; the cursor's may refer to freed pages
+		value, err := it.engine.btree.Get(it.cursor.Key())
+		if err != nil && !errors.Is(err, btree.ErrKeyNotFound) {
+			it.err = translateTreeError(err)
+		}
+		return value
+	}
+
+	value := it.cursor.Value()
+	it.checkLocked()
+	return value
+}
+
+// Seek positions the iterator at the first key that is >= target.
+func (it *PersistentIterator) Seek(target []byte) {
+	it.position(func() { it.cursor.Seek(target) })
+}
+
+// SeekToFirst positions the iterator at the first key-value pair.
+func (it *PersistentIterator) SeekToFirst() {
+	it.position(it.cursor.SeekToFirst)
+}
+
+// SeekToLast positions the iterator at the last key-value pair.
+func (it *PersistentIterator) SeekToLast() {
+	it.position(it.cursor.SeekToLast)
+}
+
+// Error returns any error encountered during iteration.
+func (it *PersistentIterator) Error() error {
+	return it.err
+}
+
+// Close releases resources associated with the iterator.
+func (it *PersistentIterator) Close() error {
+	if it.closed {
+		return utils.ErrIteratorClosed
+	}
+
+	it.closed = true
+	it.err = nil
+	return it.cursor.Close()
+}
+
+// position runs a seek under the engine lock.
+func (it *PersistentIterator) position(seek func()) {
+	if !it.acquire() {
+		return
+	}
+	defer it.engine.mu.RUnlock()
+
+	if it.tree != it.engine.btree {
+		it.rebindLocked()
+	}
+	it.positioned = true
+	seek()
+	it.checkLocked()
+}
+
+// acquire takes the engine lock for reading and reports whether the
+// iterator may be used. The caller must release the lock if it returns true.
+func (it *PersistentIterator) acquire() bool {
+	if it.closed {
+		it.err = utils.ErrIteratorClosed
+		return false
+	}
+
+	it.engine.mu.RLock()
+	if it.engine.closed.Load() {
+		it.engine.mu.RUnlock()
+		it.err = utils.ErrDatabaseClosed
+		return false
+	}
+	return true
+}
+
+// rebindLocked moves the iterator to the engine's current tree (assumes
+// lock is held).
+func (it *PersistentIterator) rebindLocked() {
+	it.tree = it.engine.btree
+	it.cursor = it.tree.NewCursor(it.start, it.end)
+}
+
+// checkLocked records any cursor error and reports whether the iterator is
+// valid (assumes lock is held).
+func (it *PersistentIterator) checkLocked() bool {
+	if err := it.cursor.Error(); err != nil {
+		if errors.Is(err, btree.ErrCursorClosed) {
+			err = utils.ErrIteratorClosed
+		}
+		it.err = translateTreeError(err)
+		return false
+	}
+	return it.cursor.Valid()
+}
+
+// PrefixEnd returns the end bound of a range that holds exactly the keys
+// starting with prefix: NewIterator(prefix, PrefixEnd(prefix)) iterates
+// over them. It returns nil, an open bound, if no key sorts after every key
+// with the prefix, such as for an empty prefix or one of only 0xff bytes.
+func PrefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
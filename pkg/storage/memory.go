@@ -101,6 +101,40 @@ func (m *MemoryEngine) Delete(key []byte) error {
 	return nil
 }
 
+// Write applies every change in the batch atomically.
+func (m *MemoryEngine) Write(batch *WriteBatch) error {
+	// Validate the whole batch first so that it is applied entirely or not at all
+	err := batch.ForEach(func(key, value []byte, deleted bool) error {
+		if err := m.validateKey(key); err != nil {
+			return err
+		}
+		if deleted {
+			return nil
+		}
+		return m.validateValue(value)
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return utils.ErrDatabaseClosed
+	}
+
+	// The batch already holds copies of its keys and values
+	return batch.ForEach(func(key, value []byte, deleted bool) error {
+		if deleted {
+			delete(m.data, string(key))
+		} else {
+			m.data[string(key)] = value
+		}
+		return nil
+	})
+}
+
 // Exists checks if a key exists in the storage.
 func (m *MemoryEngine) Exists(key []byte) (bool, error) {
 	if err := m.validateKey(key); err != nil {
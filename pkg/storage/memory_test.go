@@ -382,3 +382,86 @@ func BenchmarkMemoryEngine_Get(b *testing.B) {
 		}
 	}
 }
+
+func TestMemoryEngine_WriteBatch(t *testing.T) {
+	engine := NewMemoryEngine()
+	defer engine.Close()
+
+	if err := engine.Put([]byte("old"), []byte("value")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	batch := NewWriteBatch()
+	batch.Put([]byte("a"), []byte("1"))
+	batch.Put([]byte("b"), []byte("2"))
+	batch.Delete([]byte("old"))
+	batch.Delete([]byte("missing"))
+	if batch.Len() != 4 || batch.Size() != 14 {
+		t.Errorf("Expected 4 changes of 14 bytes, got %d of %d", batch.Len(), batch.Size())
+	}
+
+	if err := engine.Write(batch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if size, _ := engine.Size(); size != 2 {
+		t.Errorf("Expected 2 keys after batch, got %d", size)
+	}
+	if exists, _ := engine.Exists([]byte("old")); exists {
+		t.Error("Expected batch delete to remove the key")
+	}
+
+	// An invalid change rejects the whole batch
+	batch.Reset()
+	if batch.Len() != 0 || batch.Size() != 0 {
+		t.Errorf("Expected an empty batch after Reset, got %d changes of %d bytes", batch.Len(), batch.Size())
+	}
+	batch.Put([]byte("c"), []byte("3"))
+	batch.Put([]byte(""), []byte("invalid"))
+	if err := engine.Write(batch); err != utils.ErrInvalidKey {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+	if exists, _ := engine.Exists([]byte("c")); exists {
+		t.Error("Expected no changes from a rejected batch")
+	}
+}
+
+func TestMemoryEngine_IteratorPrev(t *testing.T) {
+	engine := NewMemoryEngine()
+	defer engine.Close()
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		if err := engine.Put([]byte(k), []byte("value-"+k)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	iter := engine.NewIterator(nil, []byte("d"))
+	defer iter.Close()
+
+	// Prev on a new iterator starts at the last key
+	var keys []string
+	for iter.Prev(); iter.Valid(); iter.Prev() {
+		keys = append(keys, string(iter.Key()))
+	}
+	if fmt.Sprint(keys) != "[c b a]" {
+		t.Errorf("Expected [c b a], got %v", keys)
+	}
+
+	iter.Seek([]byte("b"))
+	if !iter.Prev() || string(iter.Key()) != "a" {
+		t.Errorf("Expected a before b, got %s", iter.Key())
+	}
+	if iter.Prev() {
+		t.Errorf("Expected no key before a, got %s", iter.Key())
+	}
+	if iter.Prev() {
+		t.Error("Expected Prev before the first key to stay invalid")
+	}
+
+	// Seeking past the end and stepping back lands on the last key
+	iter.Seek([]byte("z"))
+	if !iter.Prev() || string(iter.Key()) != "c" {
+		t.Errorf("Expected c, got %s", iter.Key())
+	}
+}
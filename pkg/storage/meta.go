@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/thromel/go-database/pkg/storage/btree"
+	"github.com/thromel/go-database/pkg/storage/file"
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// metaMagic identifies the engine metadata written by the persistent engine.
+var metaMagic = [8]byte{'G', 'O', 'D', 'B', 'M', 'E', 'T', 'A'}
+
+// Layout of the engine metadata within the meta page data section, after
+// the file superblock, which records the root of the B+ tree.
+const (
+	metaMagicOffset      = file.SuperblockSize
+	metaNextPageIDOffset = metaMagicOffset + 8
+	metaHeightOffset     = metaMagicOffset + 12
+	metaNumKeysOffset    = metaMagicOffset + 16
+	metaFreeListOffset   = metaMagicOffset + 24
+	metaEncodedSize      = metaMagicOffset + 28
+)
+
+// Layout of the engine metadata in a version 1 file, which had no
+// superblock, within the meta page data section.
+const (
+	metaV1NextPageIDOffset = 8
+	metaV1RootOffset       = 12
+	metaV1HeightOffset     = 16
+	metaV1NumKeysOffset    = 20
+	metaV1FreeListOffset   = 32
+)
+
+// metaMigrations upgrade files written in older formats.
+var metaMigrations = map[uint32]file.Migration{
+	1: migrateMetaV1,
+}
+
+// engineMeta is the engine state recorded in the meta page (page 0).
+type engineMeta struct {
+	// nextPageID is the next page ID the page manager will hand out
+	nextPageID page.PageID
+
+	// tree describes the root and shape of the B+ tree
+	tree btree.Meta
+
+	// freeListHead is the first free-list trunk page, or InvalidPageID if
+	// no pages are free
+	freeListHead page.PageID
+}
+
+// encode writes the metadata into the data section of a meta page, after
+// the file's superblock, which records the root.
+func (m *engineMeta) encode(pg *page.Page, sb file.Superblock) error {
+	if m.tree.Height < 0 || int64(m.tree.Height) > int64(^uint32(0)) {
+		return fmt.Errorf("tree height %d out of range", m.tree.Height)
+	}
+
+	data := pg.Data()
+	for i := range data {
+		data[i] = 0
+	}
+
+	sb.Root = m.tree.Root
+	if err := sb.Encode(pg); err != nil {
+		return err
+	}
+
+	copy(data[metaMagicOffset:], metaMagic[:])
+	binary.LittleEndian.PutUint32(data[metaNextPageIDOffset:], uint32(m.nextPageID))
+	binary.LittleEndian.PutUint32(data[metaHeightOffset:], uint32(m.tree.Height))   // #nosec G115 - bounds checked above
+	binary.LittleEndian.PutUint64(data[metaNumKeysOffset:], uint64(m.tree.NumKeys)) // #nosec G115 - key count is never negative
+	binary.LittleEndian.PutUint32(data[metaFreeListOffset:], uint32(m.freeListHead))
+
+	return nil
+}
+
+// decodeEngineMeta reads engine metadata from the data section of a meta page.
+func decodeEngineMeta(pg *page.Page) (*engineMeta, error) {
+	sb, err := file.DecodeSuperblock(pg)
+	if err != nil {
+		return nil, err
+	}
+
+	data := pg.Data()
+	if len(data) < metaEncodedSize {
+		return nil, errMetaCorrupted
+	}
+
+	var magic [8]byte
+	copy(magic[:], data[metaMagicOffset:])
+	if magic != metaMagic {
+		return nil, fmt.Errorf("%w: bad magic %q", errMetaCorrupted, magic[:])
+	}
+
+	numKeys := binary.LittleEndian.Uint64(data[metaNumKeysOffset:])
+	if numKeys > 1<<62 {
+		return nil, fmt.Errorf("%w: key count %d out of range", errMetaCorrupted, numKeys)
+	}
+
+	return &engineMeta{
+		nextPageID: page.PageID(binary.LittleEndian.Uint32(data[metaNextPageIDOffset:])),
+		tree: btree.Meta{
+			Root:    sb.Root,
+			Height:  int(binary.LittleEndian.Uint32(data[metaHeightOffset:])),
+			NumKeys: int64(numKeys),
+		},
+		freeListHead: page.PageID(binary.LittleEndian.Uint32(data[metaFreeListOffset:])),
+	}, nil
+}
+
+// migrateMetaV1 moves the engine metadata of a version 1 file past the
+// superblock, and its root into the superblock.
+func migrateMetaV1(pg *page.Page, sb *file.Superblock) error {
+	data := pg.Data()
+	numKeys := binary.LittleEndian.Uint64(data[metaV1NumKeysOffset:])
+	if numKeys > 1<<62 {
+		return fmt.Errorf("%w: key count %d out of range", errMetaCorrupted, numKeys)
+	}
+
+	meta := &engineMeta{
+		nextPageID: page.PageID(binary.LittleEndian.Uint32(data[metaV1NextPageIDOffset:])),
+		tree: btree.Meta{
+			Root:    page.PageID(binary.LittleEndian.Uint32(data[metaV1RootOffset:])),
+			Height:  int(binary.LittleEndian.Uint32(data[metaV1HeightOffset:])),
+			NumKeys: int64(numKeys),
+		},
+		freeListHead: page.PageID(binary.LittleEndian.Uint32(data[metaV1FreeListOffset:])),
+	}
+	if err := meta.encode(pg, *sb); err != nil {
+		return err
+	}
+
+	sb.Root = meta.tree.Root
+	return nil
+}
+
+// errMetaCorrupted indicates that the meta page does not hold valid engine metadata.
+var errMetaCorrupted = errors.New("meta page corrupted")
+
+// ErrUnsupportedFormat is returned when opening a database file written in
+// a format this version cannot read. It is file.ErrUnsupportedVersion.
+var ErrUnsupportedFormat = file.ErrUnsupportedVersion
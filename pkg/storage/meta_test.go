@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/btree"
+	"github.com/thromel/go-database/pkg/storage/file"
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// testSuperblock describes a file of default-size pages.
+var testSuperblock = file.Superblock{Version: file.FormatVersion, PageSize: page.PageSize}
+
+func TestEngineMeta_RoundTrip(t *testing.T) {
+	meta := &engineMeta{
+		nextPageID:   42,
+		tree:         btree.Meta{Root: 7, Height: 2, NumKeys: 1000},
+		freeListHead: 12,
+	}
+
+	pg := page.NewPage(0, page.PageTypeMeta)
+	if err := meta.encode(pg, testSuperblock); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	decoded, err := decodeEngineMeta(pg)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if *decoded != *meta {
+		t.Errorf("Expected %+v, got %+v", *meta, *decoded)
+	}
+}
+
+func TestEngineMeta_UnsupportedFormat(t *testing.T) {
+	pg := page.NewPage(0, page.PageTypeMeta)
+	meta := &engineMeta{nextPageID: 2, tree: btree.Meta{Root: 1}}
+	if err := meta.encode(pg, testSuperblock); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	copy(pg.Data()[metaMagicOffset:], "NOTMETA!")
+	if _, err := decodeEngineMeta(pg); !errors.Is(err, errMetaCorrupted) {
+		t.Errorf("Expected errMetaCorrupted, got %v", err)
+	}
+
+	// Files written before the superblock must be upgraded first, and those
+	// written before the format was versioned cannot be read at all
+	pg = page.NewPage(0, page.PageTypeMeta)
+	copy(pg.Data(), metaMagic[:])
+	if _, err := decodeEngineMeta(pg); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestEngineMeta_MigrateV1(t *testing.T) {
+	// The layout of a version 1 meta page
+	pg := page.NewPage(0, page.PageTypeMeta)
+	data := pg.Data()
+	copy(data, metaMagic[:])
+	binary.LittleEndian.PutUint32(data[metaV1NextPageIDOffset:], 42)
+	binary.LittleEndian.PutUint32(data[metaV1RootOffset:], 7)
+	binary.LittleEndian.PutUint32(data[metaV1HeightOffset:], 2)
+	binary.LittleEndian.PutUint64(data[metaV1NumKeysOffset:], 1000)
+	binary.LittleEndian.PutUint32(data[28:], 1)
+	binary.LittleEndian.PutUint32(data[metaV1FreeListOffset:], 12)
+
+	sb := testSuperblock
+	if err := migrateMetaV1(pg, &sb); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if sb.Root != 7 {
+		t.Errorf("Expected the root in the superblock, got %d", sb.Root)
+	}
+
+	decoded, err := decodeEngineMeta(pg)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	expected := engineMeta{
+		nextPageID:   42,
+		tree:         btree.Meta{Root: 7, Height: 2, NumKeys: 1000},
+		freeListHead: 12,
+	}
+	if *decoded != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *decoded)
+	}
+}
+
+func TestPersistentEngine_UpgradeV1(t *testing.T) {
+	config := recoveryTestConfig(t)
+	// Version 1 files checksum their pages with CRC32
+	config.FileConfig.Checksum = page.ChecksumCRC32
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	const numKeys = 500
+	for i := 0; i < numKeys; i++ {
+		if err := engine.Put(recoveryKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+
+	// Rewrite the meta page as a version 1 file had it
+	writeV1 := func(version uint32) {
+		t.Helper()
+		fm, err := file.NewFileManager(config.FilePath, config.FileConfig)
+		if err != nil {
+			t.Fatalf("Failed to open file: %v", err)
+		}
+		defer fm.Close()
+
+		pg, err := fm.ReadMetaPage()
+		if err != nil {
+			t.Fatalf("Failed to read meta page: %v", err)
+		}
+		meta, err := decodeEngineMeta(pg)
+		if err != nil {
+			t.Fatalf("Failed to decode meta page: %v", err)
+		}
+
+		data := pg.Data()
+		clear(data)
+		copy(data, metaMagic[:])
+		binary.LittleEndian.PutUint32(data[metaV1NextPageIDOffset:], uint32(meta.nextPageID))
+		binary.LittleEndian.PutUint32(data[metaV1RootOffset:], uint32(meta.tree.Root))
+		binary.LittleEndian.PutUint32(data[metaV1HeightOffset:], uint32(meta.tree.Height))
+		binary.LittleEndian.PutUint64(data[metaV1NumKeysOffset:], uint64(meta.tree.NumKeys))
+		binary.LittleEndian.PutUint32(data[28:], version)
+		binary.LittleEndian.PutUint32(data[metaV1FreeListOffset:], uint32(meta.freeListHead))
+		if err := fm.WriteMetaPage(pg); err != nil {
+			t.Fatalf("Failed to write meta page: %v", err)
+		}
+	}
+	writeV1(1)
+
+	// The file is upgraded in place when opened
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to open a version 1 file: %v", err)
+	}
+	sb := engine.GetFileManager().Superblock()
+	if sb.Version != file.FormatVersion || sb.UUID == (file.UUID{}) || sb.Checksum != page.ChecksumCRC32 {
+		t.Errorf("Expected a version %d superblock keeping CRC32, got %+v", file.FormatVersion, sb)
+	}
+	if got := engineContents(t, engine); len(got) != numKeys || got[string(recoveryKey(7))] != "value-7" {
+		t.Errorf("Expected %d keys after the upgrade, got %d", numKeys, len(got))
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+
+	// Files written before the format was versioned are refused
+	writeV1(0)
+	if _, err := NewPersistentEngine(config); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+}
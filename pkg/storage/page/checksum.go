@@ -2,34 +2,106 @@ package page
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"hash/crc32"
 )
 
-// crc32Table is the CRC32 polynomial table for checksum calculation.
-var crc32Table = crc32.MakeTable(crc32.IEEE)
-
-// calculateChecksum computes the CRC32 checksum for page data.
-// It takes two byte slices to handle the case where we need to skip
-// the checksum field itself in the page header.
-func calculateChecksum(data1, data2 []byte) uint32 {
-	h := crc32.New(crc32Table)
-	// Note: hash.Hash.Write() never returns an error per documentation
-	_, _ = h.Write(data1)
-	_, _ = h.Write(data2)
-	return h.Sum32()
+// crc32cTable is the Castagnoli polynomial table. The hash/crc32 package
+// computes CRC32C with hardware instructions where the CPU has them.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ChecksumAlgorithm identifies how page checksums are computed. A database
+// file records the algorithm its pages use in its superblock.
+type ChecksumAlgorithm uint8
+
+const (
+	// ChecksumCRC32 is CRC32 with the IEEE polynomial. Files written before
+	// the algorithm could be chosen use it.
+	ChecksumCRC32 ChecksumAlgorithm = iota
+
+	// ChecksumNone stores no checksum, leaving corruption undetected
+	ChecksumNone
+
+	// ChecksumCRC32C is CRC32 with the Castagnoli polynomial, which most
+	// CPUs compute in hardware
+	ChecksumCRC32C
+
+	// ChecksumXXHash64 is the low 32 bits of xxHash64, fast on CPUs without
+	// CRC instructions
+	ChecksumXXHash64
+)
+
+// ParseChecksumAlgorithm returns the algorithm with the given name, as
+// returned by String.
+func ParseChecksumAlgorithm(name string) (ChecksumAlgorithm, error) {
+	for a := ChecksumCRC32; a <= ChecksumXXHash64; a++ {
+		if a.String() == name {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownChecksumAlgorithm, name)
 }
 
-// VerifyChecksum verifies the checksum of serialized page data.
-func VerifyChecksum(pageData []byte) error {
-	if len(pageData) != PageSize {
+// String returns the name of the checksum algorithm.
+func (a ChecksumAlgorithm) String() string {
+	switch a {
+	case ChecksumCRC32:
+		return "crc32"
+	case ChecksumNone:
+		return "none"
+	case ChecksumCRC32C:
+		return "crc32c"
+	case ChecksumXXHash64:
+		return "xxhash64"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(a))
+	}
+}
+
+// Supported reports whether pages can be checked with the algorithm.
+func (a ChecksumAlgorithm) Supported() bool {
+	return a <= ChecksumXXHash64
+}
+
+// sum computes the checksum of page data, which is split in two to skip the
+// checksum field in the page header.
+func (a ChecksumAlgorithm) sum(data1, data2 []byte) uint32 {
+	switch a {
+	case ChecksumCRC32:
+		return crc32.Update(crc32.ChecksumIEEE(data1), crc32.IEEETable, data2)
+	case ChecksumCRC32C:
+		return crc32.Update(crc32.Checksum(data1, crc32cTable), crc32cTable, data2)
+	case ChecksumXXHash64:
+		var d xxh64
+		d.reset()
+		d.write(data1)
+		d.write(data2)
+		return uint32(d.sum()) // #nosec G115 - truncated on purpose
+	default:
+		return 0
+	}
+}
+
+// Verify verifies the checksum of serialized page data.
+func (a ChecksumAlgorithm) Verify(pageData []byte) error {
+	if ValidatePageSize(len(pageData)) != nil {
 		return ErrPageCorrupted
 	}
+	if a == ChecksumNone {
+		return nil
+	}
 
 	// Extract stored checksum
 	storedChecksum := binary.LittleEndian.Uint32(pageData[28:32])
 
-	// Calculate expected checksum (excluding checksum field)
-	expectedChecksum := calculateChecksum(pageData[:28], pageData[32:])
+	// Calculate expected checksum (excluding checksum field), over the
+	// compressed data only if the page is compressed
+	stored, err := storedSize(pageData)
+	if err != nil {
+		return err
+	}
+	expectedChecksum := a.sum(pageData[:28], pageData[32:stored])
 
 	if storedChecksum != expectedChecksum {
 		return ErrPageCorrupted
@@ -37,3 +109,12 @@ func VerifyChecksum(pageData []byte) error {
 
 	return nil
 }
+
+// VerifyChecksum verifies the CRC32 checksum of serialized page data.
+func VerifyChecksum(pageData []byte) error {
+	return ChecksumCRC32.Verify(pageData)
+}
+
+// ErrUnknownChecksumAlgorithm is returned when parsing the name of a
+// checksum algorithm that does not exist.
+var ErrUnknownChecksumAlgorithm = errors.New("unknown checksum algorithm")
@@ -0,0 +1,109 @@
+package page
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestXXH64(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+
+	for _, tt := range tests {
+		var d xxh64
+		d.reset()
+		d.write([]byte(tt.input))
+		if got := d.sum(); got != tt.expected {
+			t.Errorf("xxh64(%q) = %x, expected %x", tt.input, got, tt.expected)
+		}
+	}
+
+	// Writing in pieces that straddle stripes must not change the hash
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	var whole xxh64
+	whole.reset()
+	whole.write(data)
+	for _, split := range []int{1, 28, 31, 32, 33, 500, 999} {
+		var d xxh64
+		d.reset()
+		d.write(data[:split])
+		d.write(data[split:])
+		if d.sum() != whole.sum() {
+			t.Errorf("Expected the same hash when split at %d", split)
+		}
+	}
+}
+
+func TestChecksumAlgorithms(t *testing.T) {
+	for _, algorithm := range []ChecksumAlgorithm{ChecksumCRC32, ChecksumCRC32C, ChecksumXXHash64, ChecksumNone} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			pg := NewPage(3, PageTypeLeaf)
+			copy(pg.Data(), "checksummed")
+			serialized, err := pg.SerializeWith(algorithm)
+			if err != nil {
+				t.Fatalf("failed to serialize page: %v", err)
+			}
+
+			restored := &Page{}
+			if err := restored.DeserializeWith(serialized, algorithm); err != nil {
+				t.Fatalf("failed to deserialize page: %v", err)
+			}
+			if string(restored.Data()[:11]) != "checksummed" {
+				t.Errorf("expected the page data back, got %q", restored.Data()[:11])
+			}
+
+			serialized[100] ^= 0xFF
+			err = restored.DeserializeWith(serialized, algorithm)
+			if algorithm == ChecksumNone {
+				if err != nil {
+					t.Errorf("expected no verification without a checksum, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrPageCorrupted) {
+				t.Errorf("expected ErrPageCorrupted for a corrupted page, got %v", err)
+			}
+		})
+	}
+
+	// The algorithms must not accept each other's checksums
+	pg := NewPage(3, PageTypeLeaf)
+	serialized, err := pg.SerializeWith(ChecksumCRC32C)
+	if err != nil {
+		t.Fatalf("failed to serialize page: %v", err)
+	}
+	if err := ChecksumXXHash64.Verify(serialized); !errors.Is(err, ErrPageCorrupted) {
+		t.Errorf("expected a CRC32C checksum to fail xxHash64 verification, got %v", err)
+	}
+
+	if _, err := pg.SerializeWith(ChecksumAlgorithm(200)); err == nil {
+		t.Error("expected serializing with an unknown algorithm to fail")
+	}
+}
+
+func TestParseChecksumAlgorithm(t *testing.T) {
+	for _, algorithm := range []ChecksumAlgorithm{ChecksumCRC32, ChecksumNone, ChecksumCRC32C, ChecksumXXHash64} {
+		parsed, err := ParseChecksumAlgorithm(algorithm.String())
+		if err != nil || parsed != algorithm {
+			t.Errorf("ParseChecksumAlgorithm(%q) = %v, %v", algorithm, parsed, err)
+		}
+	}
+
+	if _, err := ParseChecksumAlgorithm("md5"); !errors.Is(err, ErrUnknownChecksumAlgorithm) {
+		t.Errorf("expected ErrUnknownChecksumAlgorithm, got %v", err)
+	}
+	if s := fmt.Sprint(ChecksumAlgorithm(200)); s != "unknown(200)" {
+		t.Errorf("expected an unknown algorithm to be named so, got %q", s)
+	}
+}
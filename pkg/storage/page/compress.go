@@ -0,0 +1,119 @@
+package page
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Compression identifies how the data section of a stored page is
+// compressed. A compressed page keeps its header as it is, so that its ID,
+// type and LSN can be read without decompressing it, and records the
+// compression and the size of the compressed data in header bytes 25-28,
+// which are zero for a page stored as it is.
+type Compression uint8
+
+const (
+	// CompressionNone stores the data section as it is
+	CompressionNone Compression = iota
+
+	// CompressionLZ4 compresses the data section as an LZ4 block, which is
+	// fast to compress and decompress
+	CompressionLZ4
+)
+
+// Header offsets of the compression fields.
+const (
+	compressionOffset    = 25
+	compressedSizeOffset = 26
+)
+
+// String returns the name of the compression.
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionLZ4:
+		return "lz4"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(c))
+	}
+}
+
+// Supported reports whether pages can be stored with the compression.
+func (c Compression) Supported() bool {
+	return c <= CompressionLZ4
+}
+
+// SerializeCompressed writes the page like SerializeWith, compressing its
+// data section if that stores the page in at most half its size. It returns
+// the serialized page together with the number of bytes at its start that
+// hold it; the rest are zeros, which need not be stored. The checksum covers
+// the stored bytes only.
+func (p *Page) SerializeCompressed(checksum ChecksumAlgorithm, compression Compression) ([]byte, int, error) {
+	if compression == CompressionNone {
+		buf, err := p.SerializeWith(checksum)
+		return buf, len(buf), err
+	}
+	if !compression.Supported() {
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnknownCompression, compression)
+	}
+	if !checksum.Supported() {
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnknownChecksumAlgorithm, checksum)
+	}
+
+	buf := make([]byte, p.Size())
+	compressed, ok := lz4Compress(buf[PageHeaderSize:PageHeaderSize], p.data, p.Size()/2-PageHeaderSize)
+	if !ok {
+		buf, err := p.SerializeWith(checksum)
+		return buf, len(buf), err
+	}
+
+	// The compressed data was appended in place, so only the zeros after it
+	// are left to make sure of
+	n := PageHeaderSize + len(compressed)
+	clear(buf[n:])
+
+	p.writeHeader(buf)
+	buf[compressionOffset] = byte(compression)
+	binary.LittleEndian.PutUint16(buf[compressedSizeOffset:], uint16(len(compressed))) // #nosec G115 - bounded by MaxPageSize
+	binary.LittleEndian.PutUint32(buf[28:32], checksum.sum(buf[:28], buf[32:n]))
+
+	return buf, n, nil
+}
+
+// storedSize returns the number of bytes at the start of a serialized page
+// that hold it: all of them, unless its data section is compressed.
+func storedSize(buf []byte) (int, error) {
+	compression := Compression(buf[compressionOffset])
+	if compression == CompressionNone {
+		return len(buf), nil
+	}
+	if !compression.Supported() {
+		return 0, fmt.Errorf("%w: unknown compression %d", ErrPageCorrupted, compression)
+	}
+
+	n := PageHeaderSize + int(binary.LittleEndian.Uint16(buf[compressedSizeOffset:]))
+	if n > len(buf) {
+		return 0, fmt.Errorf("%w: %d compressed bytes in a %d-byte page", ErrPageCorrupted, n-PageHeaderSize, len(buf))
+	}
+	return n, nil
+}
+
+// decompress restores the data section of a serialized page of n stored
+// bytes into data.
+func decompress(data, buf []byte, n int) error {
+	switch Compression(buf[compressionOffset]) {
+	case CompressionNone:
+		copy(data, buf[PageHeaderSize:])
+	case CompressionLZ4:
+		if err := lz4Decompress(data, buf[PageHeaderSize:n]); err != nil {
+			return fmt.Errorf("%w: %v", ErrPageCorrupted, err)
+		}
+	}
+	return nil
+}
+
+// ErrUnknownCompression is returned when serializing a page with a
+// compression that does not exist.
+var ErrUnknownCompression = errors.New("unknown page compression")
@@ -0,0 +1,146 @@
+package page
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// jsonData returns n bytes of repetitive JSON.
+func jsonData(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < n; i++ {
+		fmt.Fprintf(&buf, `{"id":%d,"name":"user-%d","active":true,"tags":["a","b"]},`, i, i%10)
+	}
+	return buf.Bytes()[:n]
+}
+
+func TestLZ4_RoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 5000)
+	rng.Read(random)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short", []byte("abc")},
+		{"zeros", make([]byte, 8160)},
+		{"json", jsonData(8160)},
+		{"random", random},
+		{"long literals", append(random[:300:300], make([]byte, 2000)...)},
+		{"long match", bytes.Repeat([]byte("0123456789"), 3000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, ok := lz4Compress(nil, tt.data, 2*len(tt.data)+16)
+			if !ok {
+				t.Fatalf("Expected %d bytes to compress within the limit", len(tt.data))
+			}
+			decompressed := make([]byte, len(tt.data))
+			if err := lz4Decompress(decompressed, compressed); err != nil {
+				t.Fatalf("Failed to decompress: %v", err)
+			}
+			if !bytes.Equal(decompressed, tt.data) {
+				t.Error("Expected the data back")
+			}
+		})
+	}
+
+	// The limit stops data that does not compress
+	if _, ok := lz4Compress(nil, random, len(random)/2); ok {
+		t.Error("Expected random data not to compress to half its size")
+	}
+}
+
+func TestLZ4_Corrupted(t *testing.T) {
+	data := jsonData(4000)
+	compressed, _ := lz4Compress(nil, data, len(data))
+
+	dst := make([]byte, len(data))
+	for _, corrupted := range [][]byte{
+		compressed[:len(compressed)/2],
+		append([]byte{0x0f, 0x01, 0x00}, compressed...), // A match before any output
+		{0xf0, 0xff, 0xff},                              // Literals past the end
+	} {
+		if err := lz4Decompress(dst, corrupted); !errors.Is(err, errLZ4Corrupted) {
+			t.Errorf("Expected errLZ4Corrupted, got %v", err)
+		}
+	}
+
+	// Every damaged byte fails cleanly, or decompresses to something
+	for i := range compressed {
+		damaged := bytes.Clone(compressed)
+		damaged[i] ^= 0x5a
+		_ = lz4Decompress(dst, damaged)
+	}
+
+	if err := lz4Decompress(make([]byte, len(data)+1), compressed); !errors.Is(err, errLZ4Corrupted) {
+		t.Errorf("Expected errLZ4Corrupted for the wrong size, got %v", err)
+	}
+}
+
+func TestPageCompression(t *testing.T) {
+	for _, size := range []int{MinPageSize, PageSize, MaxPageSize} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			pg := NewPageWithSize(5, PageTypeLeaf, size)
+			pg.SetLSN(42)
+			copy(pg.Data(), jsonData(len(pg.Data())))
+
+			buf, n, err := pg.SerializeCompressed(ChecksumCRC32C, CompressionLZ4)
+			if err != nil {
+				t.Fatalf("Failed to serialize page: %v", err)
+			}
+			if len(buf) != size || n > size/2 {
+				t.Fatalf("Expected a %d-byte page stored in at most %d bytes, got %d in %d", size, size/2, len(buf), n)
+			}
+			if !isZero(buf[n:]) {
+				t.Error("Expected zeros after the compressed page")
+			}
+
+			restored := &Page{}
+			if err := restored.DeserializeWith(buf, ChecksumCRC32C); err != nil {
+				t.Fatalf("Failed to deserialize page: %v", err)
+			}
+			if restored.ID() != 5 || restored.LSN() != 42 || !bytes.Equal(restored.Data(), pg.Data()) {
+				t.Error("Expected the page back")
+			}
+			if err := ChecksumCRC32C.Verify(buf); err != nil {
+				t.Errorf("Expected the checksum to cover the stored bytes, got %v", err)
+			}
+
+			buf[PageHeaderSize+10] ^= 0xff
+			if err := restored.DeserializeWith(buf, ChecksumCRC32C); !errors.Is(err, ErrPageCorrupted) {
+				t.Errorf("Expected ErrPageCorrupted, got %v", err)
+			}
+		})
+	}
+
+	// A page that does not compress to half its size is stored as it is
+	pg := NewPage(6, PageTypeLeaf)
+	rand.New(rand.NewSource(2)).Read(pg.Data())
+	buf, n, err := pg.SerializeCompressed(ChecksumCRC32C, CompressionLZ4)
+	if err != nil {
+		t.Fatalf("Failed to serialize page: %v", err)
+	}
+	if n != len(buf) || buf[compressionOffset] != byte(CompressionNone) {
+		t.Errorf("Expected an uncompressed page, got %d stored bytes", n)
+	}
+	restored := &Page{}
+	if err := restored.DeserializeWith(buf, ChecksumCRC32C); err != nil || !bytes.Equal(restored.Data(), pg.Data()) {
+		t.Errorf("Expected the page back, got %v", err)
+	}
+
+	if _, _, err := pg.SerializeCompressed(ChecksumCRC32C, Compression(9)); !errors.Is(err, ErrUnknownCompression) {
+		t.Errorf("Expected ErrUnknownCompression, got %v", err)
+	}
+}
+
+// isZero reports whether b holds only zeros.
+func isZero(b []byte) bool {
+	return bytes.Count(b, []byte{0}) == len(b)
+}
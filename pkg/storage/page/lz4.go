@@ -0,0 +1,152 @@
+package page
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The LZ4 block format: a sequence of literals copied as they are, each
+// followed by a match repeating earlier output, ending with literals only.
+// A sequence starts with a token whose high nibble is the number of
+// literals and whose low nibble is the match length less lz4MinMatch;
+// a nibble of 15 is continued by bytes added to it until one is below 255.
+// The literals follow, then the match offset in two little-endian bytes and
+// the rest of the match length.
+const (
+	lz4MinMatch = 4
+
+	// lz4LastLiterals is the number of bytes at the end of the input that
+	// are always literals, and lz4MatchLimit the distance from the end
+	// within which no match may start
+	lz4LastLiterals = 5
+	lz4MatchLimit   = 12
+
+	lz4HashLog = 12
+)
+
+// lz4Compress compresses src as one LZ4 block appended to dst. It gives up
+// and reports false once the block grows past limit bytes.
+func lz4Compress(dst, src []byte, limit int) ([]byte, bool) {
+	start := len(dst)
+
+	// table maps a hash of 4 bytes to the last position they were seen at.
+	// Positions are only candidates: the bytes there are compared before a
+	// match is taken.
+	var table [1 << lz4HashLog]int32
+
+	anchor := 0
+	for i := 0; i < len(src)-lz4MatchLimit; {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := (seq * 2654435761) >> (32 - lz4HashLog)
+		candidate := int(table[h])
+		table[h] = int32(i) // #nosec G115 - bounded by MaxPageSize
+
+		if candidate >= i || binary.LittleEndian.Uint32(src[candidate:]) != seq {
+			i++
+			continue
+		}
+
+		length := lz4MinMatch
+		for maxLength := len(src) - lz4LastLiterals - i; length < maxLength && src[candidate+length] == src[i+length]; {
+			length++
+		}
+
+		dst = lz4AppendLiterals(dst, src[anchor:i], length-lz4MinMatch)
+		dst = append(dst, byte(i-candidate), byte((i-candidate)>>8))
+		if length-lz4MinMatch >= 15 {
+			dst = lz4AppendLength(dst, length-lz4MinMatch-15)
+		}
+		if len(dst)-start > limit {
+			return dst, false
+		}
+
+		i += length
+		anchor = i
+	}
+
+	dst = lz4AppendLiterals(dst, src[anchor:], 0)
+	return dst, len(dst)-start <= limit
+}
+
+// lz4AppendLiterals appends the token of a sequence with the given literals
+// and match length, less lz4MinMatch, followed by the literals.
+func lz4AppendLiterals(dst, literals []byte, matchLength int) []byte {
+	token := byte(min(matchLength, 15))
+	if len(literals) >= 15 {
+		dst = append(dst, 0xf0|token)
+		dst = lz4AppendLength(dst, len(literals)-15)
+	} else {
+		dst = append(dst, byte(len(literals))<<4|token)
+	}
+	return append(dst, literals...)
+}
+
+// lz4AppendLength appends the continuation bytes of a length.
+func lz4AppendLength(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4Decompress decompresses an LZ4 block, which must fill dst exactly.
+func lz4Decompress(dst, src []byte) error {
+	d, s := 0, 0
+	for s < len(src) {
+		token := src[s]
+		s++
+
+		literals, ok := lz4ReadLength(src, &s, int(token>>4))
+		if !ok || literals > len(src)-s || literals > len(dst)-d {
+			return errLZ4Corrupted
+		}
+		d += copy(dst[d:], src[s:s+literals])
+		s += literals
+		if s == len(src) {
+			break // The last sequence has no match
+		}
+
+		if len(src)-s < 2 {
+			return errLZ4Corrupted
+		}
+		offset := int(binary.LittleEndian.Uint16(src[s:]))
+		s += 2
+		length, ok := lz4ReadLength(src, &s, int(token&0x0f))
+		length += lz4MinMatch
+		if !ok || offset == 0 || offset > d || length > len(dst)-d {
+			return errLZ4Corrupted
+		}
+
+		// The match may overlap the output it creates, so it is copied a
+		// byte at a time
+		for end := d + length; d < end; d++ {
+			dst[d] = dst[d-offset]
+		}
+	}
+
+	if d != len(dst) {
+		return errLZ4Corrupted
+	}
+	return nil
+}
+
+// lz4ReadLength reads the continuation bytes of a length that starts from
+// the nibble n, advancing *s past them.
+func lz4ReadLength(src []byte, s *int, n int) (int, bool) {
+	if n != 15 {
+		return n, true
+	}
+	for *s < len(src) {
+		b := src[*s]
+		*s++
+		n += int(b)
+		if b != 255 {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// errLZ4Corrupted is returned when decompressing data that is not a valid
+// LZ4 block of the expected size.
+var errLZ4Corrupted = errors.New("corrupted LZ4 block")
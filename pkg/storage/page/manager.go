@@ -25,18 +25,28 @@ type Manager struct {
 
 	// metaPage holds database metadata.
 	metaPage *Page
+
+	// pageSize is the size of the pages the manager allocates.
+	pageSize int
 }
 
-// NewManager creates a new page manager.
+// NewManager creates a new page manager for pages of PageSize bytes.
 func NewManager() *Manager {
+	return NewManagerWithPageSize(PageSize)
+}
+
+// NewManagerWithPageSize creates a new page manager for pages of the given
+// size, which must be valid according to ValidatePageSize.
+func NewManagerWithPageSize(pageSize int) *Manager {
 	m := &Manager{
 		freeList: make([]PageID, 0),
 		pageMap:  make(map[PageID]*Page),
+		pageSize: pageSize,
 	}
 
 	// Initialize with meta page at ID 0
 	m.nextPageID.Store(1)
-	m.metaPage = NewPage(0, PageTypeMeta)
+	m.metaPage = NewPageWithSize(0, PageTypeMeta, pageSize)
 	m.pageMap[0] = m.metaPage
 
 	return m
@@ -53,7 +63,7 @@ func (m *Manager) AllocatePage(pageType PageType) (*Page, error) {
 		m.freeListMu.Unlock()
 
 		// Create page with reused ID
-		page := NewPage(pageID, pageType)
+		page := NewPageWithSize(pageID, pageType, m.pageSize)
 
 		// Track the page
 		m.pageMapMu.Lock()
@@ -72,7 +82,7 @@ func (m *Manager) AllocatePage(pageType PageType) (*Page, error) {
 	}
 
 	// Create new page
-	page := NewPage(pageID, pageType)
+	page := NewPageWithSize(pageID, pageType, m.pageSize)
 
 	// Track the page
 	m.pageMapMu.Lock()
@@ -126,6 +136,31 @@ func (m *Manager) GetPage(pageID PageID) (*Page, error) {
 	return page, nil
 }
 
+// ReadPage retrieves a page by ID. It is equivalent to GetPage and lets an
+// in-memory Manager act as the backing store of a buffer pool.
+func (m *Manager) ReadPage(pageID PageID) (*Page, error) {
+	return m.GetPage(pageID)
+}
+
+// WritePage records a modified page. Pages handed out by the Manager are
+// modified in place, so this only (re)registers the page under its ID.
+func (m *Manager) WritePage(pg *Page) error {
+	if pg == nil {
+		return fmt.Errorf("cannot write nil page")
+	}
+
+	m.pageMapMu.Lock()
+	m.pageMap[pg.ID()] = pg
+	m.pageMapMu.Unlock()
+
+	return nil
+}
+
+// PageSize returns the size of the pages the manager allocates.
+func (m *Manager) PageSize() int {
+	return m.pageSize
+}
+
 // GetMetaPage returns the database metadata page.
 func (m *Manager) GetMetaPage() *Page {
 	return m.metaPage
@@ -253,6 +253,32 @@ func TestStatistics(t *testing.T) {
 	}
 }
 
+func TestManagerReadWritePage(t *testing.T) {
+	mgr := NewManager()
+
+	pg, err := mgr.AllocatePage(PageTypeLeaf)
+	if err != nil {
+		t.Fatalf("failed to allocate page: %v", err)
+	}
+
+	copy(pg.Data(), "data")
+	if err := mgr.WritePage(pg); err != nil {
+		t.Fatalf("failed to write page: %v", err)
+	}
+
+	read, err := mgr.ReadPage(pg.ID())
+	if err != nil {
+		t.Fatalf("failed to read page: %v", err)
+	}
+	if string(read.Data()[:4]) != "data" {
+		t.Errorf("expected written data, got %q", read.Data()[:4])
+	}
+
+	if err := mgr.WritePage(nil); err == nil {
+		t.Error("expected error writing nil page")
+	}
+}
+
 func BenchmarkPageAllocation(b *testing.B) {
 	mgr := NewManager()
 
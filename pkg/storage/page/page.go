@@ -9,13 +9,55 @@ import (
 	"fmt"
 )
 
-// PageSize defines the size of a database page in bytes.
+// PageSize defines the default size of a database page in bytes.
 // We use 8KB pages as a balance between memory efficiency and I/O performance.
+// A database may be created with any page size that ValidatePageSize accepts:
+// smaller pages suit point lookups on SSDs, larger ones long scans.
 const PageSize = 8192
 
+// MinPageSize and MaxPageSize bound the size of a page. Offsets within a page
+// are stored in 16 bits, which caps the size at 32KB.
+const (
+	MinPageSize = 1024
+	MaxPageSize = 32768
+)
+
 // PageHeaderSize is the size of the page header in bytes.
 const PageHeaderSize = 32
 
+// LayoutSize is the size of the header fields that lead a page image: the
+// slot count, free space, free space pointer, next page and page type.
+const LayoutSize = 11
+
+// MaxImageSize is the size of the image of the largest page. See Image.
+const MaxImageSize = LayoutSize + MaxPageSize - PageHeaderSize
+
+// ValidatePageSize checks that size is a power of two between MinPageSize and
+// MaxPageSize.
+func ValidatePageSize(size int) error {
+	if size < MinPageSize || size > MaxPageSize || size&(size-1) != 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidPageSize, size)
+	}
+	return nil
+}
+
+// StoredPageSize returns the page size recorded in the header of a serialized
+// page. Pages written before page sizes were recorded are PageSize bytes.
+func StoredPageSize(header []byte) (int, error) {
+	if len(header) < PageHeaderSize {
+		return 0, fmt.Errorf("%w: header of %d bytes", ErrPageCorrupted, len(header))
+	}
+
+	size := int(binary.LittleEndian.Uint16(header[23:25]))
+	if size == 0 {
+		return PageSize, nil
+	}
+	if err := ValidatePageSize(size); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrPageCorrupted, err)
+	}
+	return size, nil
+}
+
 // PageID uniquely identifies a page in the database.
 type PageID uint32
 
@@ -56,7 +98,9 @@ func (pt PageType) String() string {
 	}
 }
 
-// PageHeader contains metadata about a page.
+// PageHeader contains metadata about a page. The serialized header also
+// records the size of the page, which is not kept here: it is the size of
+// the page's data section plus PageHeaderSize.
 type PageHeader struct {
 	// PageID is the unique identifier for this page.
 	PageID PageID
@@ -72,33 +116,47 @@ type PageHeader struct {
 	FreeSpacePtr uint16
 	// NextPage is the ID of the next page (for linked pages).
 	NextPage PageID
-	// Checksum is the CRC32 checksum of the page data.
+	// Checksum is the checksum of the page data, computed by the algorithm
+	// the page was serialized with.
 	Checksum uint32
 }
 
-// Page represents a fixed-size unit of storage in the database.
+// Page represents a fixed-size unit of storage in the database. All pages
+// of a database have the same size, chosen when it is created.
 type Page struct {
 	header PageHeader
-	data   [PageSize - PageHeaderSize]byte
+	data   []byte
 }
 
-// NewPage creates a new page with the given ID and type.
+// NewPage creates a new page of PageSize bytes with the given ID and type.
 func NewPage(id PageID, pageType PageType) *Page {
+	return NewPageWithSize(id, pageType, PageSize)
+}
+
+// NewPageWithSize creates a new page of the given size, which must be valid
+// according to ValidatePageSize, with the given ID and type.
+func NewPageWithSize(id PageID, pageType PageType, size int) *Page {
 	p := &Page{
 		header: PageHeader{
 			PageID:       id,
 			PageType:     pageType,
 			LSN:          0,
 			NumSlots:     0,
-			FreeSpace:    PageSize - PageHeaderSize,
+			FreeSpace:    uint16(size - PageHeaderSize), // #nosec G115 - bounded by MaxPageSize
 			FreeSpacePtr: PageHeaderSize,
 			NextPage:     InvalidPageID,
 			Checksum:     0,
 		},
+		data: make([]byte, size-PageHeaderSize),
 	}
 	return p
 }
 
+// Size returns the size of the page in bytes, header included.
+func (p *Page) Size() int {
+	return PageHeaderSize + len(p.data)
+}
+
 // ID returns the page ID.
 func (p *Page) ID() PageID {
 	return p.header.PageID
@@ -144,11 +202,69 @@ func (p *Page) Data() []byte {
 	return p.data[:]
 }
 
-// Serialize writes the page to a byte slice.
+// Image returns a copy of everything about the page that writing to it can
+// change: the layout fields and type of the header, LayoutSize bytes,
+// followed by the data section, LayoutSize+Size()-PageHeaderSize bytes in
+// all. The page ID, LSN and checksum are not part of it. Logging changes to
+// images keeps a page's layout consistent with its data, and restores its
+// type when a reused page is rolled back.
+func (p *Page) Image() []byte {
+	image := make([]byte, LayoutSize+len(p.data))
+	binary.LittleEndian.PutUint16(image[0:2], p.header.NumSlots)
+	binary.LittleEndian.PutUint16(image[2:4], p.header.FreeSpace)
+	binary.LittleEndian.PutUint16(image[4:6], p.header.FreeSpacePtr)
+	binary.LittleEndian.PutUint32(image[6:10], uint32(p.header.NextPage))
+	image[10] = byte(p.header.PageType)
+	copy(image[LayoutSize:], p.data[:])
+	return image
+}
+
+// SetImage restores the layout fields, type and data section from an image.
+func (p *Page) SetImage(image []byte) error {
+	if len(image) != LayoutSize+len(p.data) {
+		return fmt.Errorf("invalid image size: expected %d, got %d", LayoutSize+len(p.data), len(image))
+	}
+	if PageType(image[10]) > PageTypeOverflow {
+		return fmt.Errorf("%w: %d", ErrInvalidPageType, image[10])
+	}
+
+	p.header.NumSlots = binary.LittleEndian.Uint16(image[0:2])
+	p.header.FreeSpace = binary.LittleEndian.Uint16(image[2:4])
+	p.header.FreeSpacePtr = binary.LittleEndian.Uint16(image[4:6])
+	p.header.NextPage = PageID(binary.LittleEndian.Uint32(image[6:10]))
+	p.header.PageType = PageType(image[10])
+	copy(p.data, image[LayoutSize:])
+	return nil
+}
+
+// Serialize writes the page to a byte slice with a CRC32 checksum.
 func (p *Page) Serialize() ([]byte, error) {
-	buf := make([]byte, PageSize)
+	return p.SerializeWith(ChecksumCRC32)
+}
+
+// SerializeWith writes the page to a byte slice with a checksum computed by
+// the given algorithm.
+func (p *Page) SerializeWith(checksum ChecksumAlgorithm) ([]byte, error) {
+	if !checksum.Supported() {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownChecksumAlgorithm, checksum)
+	}
+	buf := make([]byte, p.Size())
 
 	// Write header
+	p.writeHeader(buf)
+
+	// Copy data
+	copy(buf[PageHeaderSize:], p.data)
+
+	// Calculate and write checksum (excluding checksum field itself)
+	binary.LittleEndian.PutUint32(buf[28:32], checksum.sum(buf[:28], buf[32:]))
+
+	return buf, nil
+}
+
+// writeHeader writes the page header to buf, except for the checksum, which
+// is written at position 28-32 once calculated.
+func (p *Page) writeHeader(buf []byte) {
 	binary.LittleEndian.PutUint32(buf[0:4], uint32(p.header.PageID))
 	buf[4] = byte(p.header.PageType)
 	binary.LittleEndian.PutUint64(buf[5:13], p.header.LSN)
@@ -156,22 +272,37 @@ func (p *Page) Serialize() ([]byte, error) {
 	binary.LittleEndian.PutUint16(buf[15:17], p.header.FreeSpace)
 	binary.LittleEndian.PutUint16(buf[17:19], p.header.FreeSpacePtr)
 	binary.LittleEndian.PutUint32(buf[19:23], uint32(p.header.NextPage))
-	// Checksum is written at position 28-32 after calculation
+	binary.LittleEndian.PutUint16(buf[23:25], uint16(p.Size())) // #nosec G115 - bounded by MaxPageSize
+}
 
-	// Copy data
-	copy(buf[PageHeaderSize:], p.data[:])
+// Deserialize reads a page from a byte slice, verifying its CRC32 checksum.
+// The page takes the size of the slice, which must match the size recorded
+// in its header.
+func (p *Page) Deserialize(buf []byte) error {
+	return p.DeserializeWith(buf, ChecksumCRC32)
+}
 
-	// Calculate and write checksum (excluding checksum field itself)
-	checksum := calculateChecksum(buf[:28], buf[32:])
-	binary.LittleEndian.PutUint32(buf[28:32], checksum)
+// DeserializeWith reads a page from a byte slice, verifying its checksum
+// with the given algorithm.
+func (p *Page) DeserializeWith(buf []byte, checksum ChecksumAlgorithm) error {
+	if !checksum.Supported() {
+		return fmt.Errorf("%w: %s", ErrUnknownChecksumAlgorithm, checksum)
+	}
+	return p.deserialize(buf, checksum)
+}
 
-	return buf, nil
+// DeserializeUnverified reads a page from a byte slice without verifying
+// its checksum. It is intended for trusted storage where the cost of
+// checksumming outweighs the benefit of corruption detection.
+func (p *Page) DeserializeUnverified(buf []byte) error {
+	return p.deserialize(buf, ChecksumNone)
 }
 
-// Deserialize reads a page from a byte slice.
-func (p *Page) Deserialize(buf []byte) error {
-	if len(buf) != PageSize {
-		return fmt.Errorf("invalid buffer size: expected %d, got %d", PageSize, len(buf))
+// deserialize reads a page from a byte slice, verifying its checksum unless
+// the algorithm is ChecksumNone.
+func (p *Page) deserialize(buf []byte, checksum ChecksumAlgorithm) error {
+	if err := ValidatePageSize(len(buf)); err != nil {
+		return fmt.Errorf("invalid buffer size: %w", err)
 	}
 
 	// Read header
@@ -184,16 +315,35 @@ func (p *Page) Deserialize(buf []byte) error {
 	p.header.NextPage = PageID(binary.LittleEndian.Uint32(buf[19:23]))
 	p.header.Checksum = binary.LittleEndian.Uint32(buf[28:32])
 
+	// A compressed page is stored in the bytes before the zeros that follow
+	// its compressed data
+	stored, err := storedSize(buf)
+	if err != nil {
+		return err
+	}
+
 	// Verify checksum
-	expectedChecksum := calculateChecksum(buf[:28], buf[32:])
-	if p.header.Checksum != expectedChecksum {
-		return fmt.Errorf("page checksum mismatch: expected %x, got %x", expectedChecksum, p.header.Checksum)
+	if checksum != ChecksumNone {
+		expectedChecksum := checksum.sum(buf[:28], buf[32:stored])
+		if p.header.Checksum != expectedChecksum {
+			return fmt.Errorf("%w: checksum mismatch: expected %x, got %x", ErrPageCorrupted, expectedChecksum, p.header.Checksum)
+		}
 	}
 
-	// Copy data
-	copy(p.data[:], buf[PageHeaderSize:])
+	// Verify page size
+	size, err := StoredPageSize(buf)
+	if err != nil {
+		return err
+	}
+	if size != len(buf) {
+		return fmt.Errorf("%w: %d-byte page read as %d bytes", ErrPageCorrupted, size, len(buf))
+	}
 
-	return nil
+	// Copy data
+	if len(p.data) != len(buf)-PageHeaderSize {
+		p.data = make([]byte, len(buf)-PageHeaderSize)
+	}
+	return decompress(p.data, buf, stored)
 }
 
 // IsValid performs basic validation on the page.
@@ -204,12 +354,12 @@ func (p *Page) IsValid() error {
 	}
 
 	// Validate free space
-	if p.header.FreeSpace > PageSize-PageHeaderSize {
+	if int(p.header.FreeSpace) > len(p.data) {
 		return fmt.Errorf("invalid free space: %d", p.header.FreeSpace)
 	}
 
 	// Validate free space pointer
-	if p.header.FreeSpacePtr < PageHeaderSize || p.header.FreeSpacePtr > PageSize {
+	if p.header.FreeSpacePtr < PageHeaderSize || int(p.header.FreeSpacePtr) > p.Size() {
 		return fmt.Errorf("invalid free space pointer: %d", p.header.FreeSpacePtr)
 	}
 
@@ -224,4 +374,6 @@ var (
 	ErrInvalidPageID = errors.New("invalid page ID")
 	// ErrInvalidPageType indicates an invalid page type.
 	ErrInvalidPageType = errors.New("invalid page type")
+	// ErrInvalidPageSize indicates a page size ValidatePageSize rejects.
+	ErrInvalidPageSize = errors.New("page size must be a power of two between 1KB and 32KB")
 )
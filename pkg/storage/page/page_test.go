@@ -2,6 +2,7 @@ package page
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 )
 
@@ -95,6 +96,86 @@ func TestPageSerialization(t *testing.T) {
 	}
 }
 
+func TestPageSizes(t *testing.T) {
+	for _, size := range []int{MinPageSize, 4096, MaxPageSize} {
+		page := NewPageWithSize(7, PageTypeLeaf, size)
+		if page.Size() != size || page.FreeSpace() != uint16(size-PageHeaderSize) {
+			t.Fatalf("expected an empty %d-byte page, got %d bytes with %d free", size, page.Size(), page.FreeSpace())
+		}
+
+		// Fill the page, so that the slot directory reaches its end
+		cell := bytes.Repeat([]byte{0xAB}, 100)
+		n := 0
+		for page.InsertCell(n, cell) {
+			n++
+		}
+		if expected := (size - PageHeaderSize) / (len(cell) + SlotSize); n != expected {
+			t.Errorf("expected %d cells in a %d-byte page, got %d", expected, size, n)
+		}
+
+		serialized, err := page.Serialize()
+		if err != nil {
+			t.Fatalf("failed to serialize page: %v", err)
+		}
+		if len(serialized) != size {
+			t.Errorf("expected serialized size %d, got %d", size, len(serialized))
+		}
+		if stored, err := StoredPageSize(serialized); err != nil || stored != size {
+			t.Errorf("expected stored page size %d, got %d (%v)", size, stored, err)
+		}
+
+		newPage := &Page{}
+		if err := newPage.Deserialize(serialized); err != nil {
+			t.Fatalf("failed to deserialize %d-byte page: %v", size, err)
+		}
+		if newPage.Size() != size || int(newPage.NumSlots()) != n {
+			t.Fatalf("expected %d cells in a %d-byte page, got %d in %d bytes", n, size, newPage.NumSlots(), newPage.Size())
+		}
+		if err := newPage.CheckSlots(); err != nil {
+			t.Errorf("unexpected inconsistency: %v", err)
+		}
+		if !bytes.Equal(newPage.Cell(n-1), cell) {
+			t.Error("last cell changed by serialization")
+		}
+		if len(newPage.Image()) != LayoutSize+size-PageHeaderSize {
+			t.Errorf("unexpected image size %d", len(newPage.Image()))
+		}
+	}
+
+	// A page read with the wrong size is rejected
+	serialized, err := NewPageWithSize(1, PageTypeLeaf, 4096).Serialize()
+	if err != nil {
+		t.Fatalf("failed to serialize page: %v", err)
+	}
+	resized := append(serialized, make([]byte, 4096)...)
+	if err := (&Page{}).DeserializeUnverified(resized); !errors.Is(err, ErrPageCorrupted) {
+		t.Errorf("expected ErrPageCorrupted for a resized page, got %v", err)
+	}
+
+	// Pages written before page sizes were recorded have the default size
+	legacy, err := NewPage(1, PageTypeLeaf).Serialize()
+	if err != nil {
+		t.Fatalf("failed to serialize page: %v", err)
+	}
+	legacy[23], legacy[24] = 0, 0
+	if size, err := StoredPageSize(legacy); err != nil || size != PageSize {
+		t.Errorf("expected a legacy page to have %d bytes, got %d (%v)", PageSize, size, err)
+	}
+}
+
+func TestValidatePageSize(t *testing.T) {
+	for _, size := range []int{1024, 2048, 4096, 8192, 16384, 32768} {
+		if err := ValidatePageSize(size); err != nil {
+			t.Errorf("expected %d to be a valid page size, got %v", size, err)
+		}
+	}
+	for _, size := range []int{-4096, 0, 512, 1000, 6144, 65536} {
+		if err := ValidatePageSize(size); !errors.Is(err, ErrInvalidPageSize) {
+			t.Errorf("expected %d to be rejected, got %v", size, err)
+		}
+	}
+}
+
 func TestPageChecksumValidation(t *testing.T) {
 	// Create and serialize a page
 	page := NewPage(1, PageTypeLeaf)
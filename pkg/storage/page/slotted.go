@@ -0,0 +1,192 @@
+package page
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Slotted layout. A page stores variable-length cells addressed through a
+// slot directory:
+//
+//	header | cells ... | free space | ... slot n-1 | ... | slot 0
+//
+// Cells grow up from the header and FreeSpacePtr marks the end of the last
+// one. The slot directory grows down from the end of the page; each slot
+// holds the offset (2) and length (2) of a cell, and slots are kept in the
+// caller's order, so inserting a slot shifts the ones after it. FreeSpace
+// counts every unused byte, including holes left by removed or shrunk cells,
+// which Compact reclaims. A new page is an empty slotted page.
+const SlotSize = 4
+
+// MaxCellSize returns the size of the largest cell the page can hold.
+func (p *Page) MaxCellSize() int {
+	return len(p.data) - SlotSize
+}
+
+// Reset empties a slotted page. Its data section is left as it is.
+func (p *Page) Reset() {
+	p.header.NumSlots = 0
+	p.header.FreeSpace = uint16(len(p.data)) // #nosec G115 - bounded by MaxPageSize
+	p.header.FreeSpacePtr = PageHeaderSize
+}
+
+// FreeSpacePtr returns the offset of the end of the cells in a slotted page.
+func (p *Page) FreeSpacePtr() uint16 {
+	return p.header.FreeSpacePtr
+}
+
+// CheckSlots verifies that the slot directory of a slotted page is
+// consistent with its header, so that cells can be read without bounds
+// errors. It returns an error wrapping ErrPageCorrupted otherwise.
+func (p *Page) CheckSlots() error {
+	numSlots := int(p.header.NumSlots)
+	cellsEnd := int(p.header.FreeSpacePtr)
+	if cellsEnd < PageHeaderSize || cellsEnd > p.slotOffset(numSlots-1) {
+		return fmt.Errorf("%w: free space pointer %d outside the page with %d slots", ErrPageCorrupted, cellsEnd, numSlots)
+	}
+
+	used := numSlots * SlotSize
+	for i := 0; i < numSlots; i++ {
+		offset, length := p.slot(i)
+		if offset < PageHeaderSize || offset+length > cellsEnd {
+			return fmt.Errorf("%w: slot %d points outside the cells", ErrPageCorrupted, i)
+		}
+		used += length
+	}
+	if int(p.header.FreeSpace) != len(p.data)-used {
+		return fmt.Errorf("%w: free space %d does not match the cells", ErrPageCorrupted, p.header.FreeSpace)
+	}
+
+	return nil
+}
+
+// Cell returns the i-th cell of a slotted page. The returned slice refers
+// to the page and is only valid until the page is next modified.
+func (p *Page) Cell(i int) []byte {
+	offset, length := p.slot(i)
+	return p.data[offset-PageHeaderSize : offset-PageHeaderSize+length]
+}
+
+// InsertCell inserts a cell at slot i, shifting later slots up by one, and
+// compacts the page first if the free space is fragmented. It returns false
+// and leaves the page unchanged if the cell does not fit.
+func (p *Page) InsertCell(i int, cell []byte) bool {
+	numSlots := int(p.header.NumSlots)
+	if i < 0 || i > numSlots || len(cell)+SlotSize > int(p.header.FreeSpace) {
+		return false
+	}
+
+	if p.contiguousFree() < len(cell)+SlotSize {
+		p.Compact()
+	}
+
+	offset := int(p.header.FreeSpacePtr)
+	copy(p.data[offset-PageHeaderSize:], cell)
+
+	// Slots i..n-1 move one slot further from the end of the page
+	low := p.slotOffset(numSlots-1) - PageHeaderSize
+	high := p.slotOffset(i-1) - PageHeaderSize
+	copy(p.data[low-SlotSize:], p.data[low:high])
+
+	p.header.NumSlots++
+	p.setSlot(i, offset, len(cell))
+	p.header.FreeSpacePtr += uint16(len(cell))         // #nosec G115 - bounded by the free space
+	p.header.FreeSpace -= uint16(len(cell) + SlotSize) // #nosec G115 - bounded by the free space
+
+	return true
+}
+
+// ReplaceCell replaces the cell at slot i. A cell no larger than the old one
+// is written in its place; a larger one is moved to free space. It returns
+// false and leaves the page unchanged if the new cell does not fit.
+func (p *Page) ReplaceCell(i int, cell []byte) bool {
+	if i < 0 || i >= int(p.header.NumSlots) {
+		return false
+	}
+
+	offset, length := p.slot(i)
+	if len(cell) <= length {
+		copy(p.data[offset-PageHeaderSize:], cell)
+		p.setSlot(i, offset, len(cell))
+		p.release(offset+len(cell), length-len(cell))
+		return true
+	}
+
+	if len(cell)-length > int(p.header.FreeSpace) {
+		return false
+	}
+
+	p.RemoveCell(i)
+	return p.InsertCell(i, cell)
+}
+
+// RemoveCell removes the cell at slot i, shifting later slots down by one.
+func (p *Page) RemoveCell(i int) {
+	numSlots := int(p.header.NumSlots)
+	if i < 0 || i >= numSlots {
+		return
+	}
+
+	offset, length := p.slot(i)
+
+	// Slots i+1..n-1 move one slot closer to the end of the page
+	low := p.slotOffset(numSlots-1) - PageHeaderSize
+	high := p.slotOffset(i) - PageHeaderSize
+	copy(p.data[low+SlotSize:], p.data[low:high])
+
+	p.header.NumSlots--
+	p.header.FreeSpace += SlotSize
+	p.release(offset, length)
+}
+
+// Compact moves the cells of a slotted page together, in slot order, so
+// that all of its free space is contiguous.
+func (p *Page) Compact() {
+	numSlots := int(p.header.NumSlots)
+	cells := make([][]byte, numSlots)
+	for i := range cells {
+		cells[i] = append([]byte(nil), p.Cell(i)...)
+	}
+
+	offset := PageHeaderSize
+	for i, cell := range cells {
+		copy(p.data[offset-PageHeaderSize:], cell)
+		p.setSlot(i, offset, len(cell))
+		offset += len(cell)
+	}
+	p.header.FreeSpacePtr = uint16(offset) // #nosec G115 - bounded by the page size
+}
+
+// release accounts for length bytes at offset that no longer hold a cell.
+// Bytes at the end of the cells are returned to the contiguous free space.
+func (p *Page) release(offset, length int) {
+	p.header.FreeSpace += uint16(length) // #nosec G115 - bounded by the page size
+	if offset+length == int(p.header.FreeSpacePtr) {
+		p.header.FreeSpacePtr = uint16(offset) // #nosec G115 - bounded by the page size
+	}
+}
+
+// contiguousFree returns the number of free bytes between the cells and
+// the slot directory.
+func (p *Page) contiguousFree() int {
+	return p.slotOffset(int(p.header.NumSlots)-1) - int(p.header.FreeSpacePtr)
+}
+
+// slotOffset returns the page offset of slot i. The offset of slot -1 is
+// the end of the page.
+func (p *Page) slotOffset(i int) int {
+	return p.Size() - (i+1)*SlotSize
+}
+
+// slot returns the offset and length of the cell at slot i.
+func (p *Page) slot(i int) (int, int) {
+	s := p.data[p.slotOffset(i)-PageHeaderSize:]
+	return int(binary.LittleEndian.Uint16(s[0:2])), int(binary.LittleEndian.Uint16(s[2:4]))
+}
+
+// setSlot points slot i at a cell.
+func (p *Page) setSlot(i, offset, length int) {
+	s := p.data[p.slotOffset(i)-PageHeaderSize:]
+	binary.LittleEndian.PutUint16(s[0:2], uint16(offset)) // #nosec G115 - bounded by the page size
+	binary.LittleEndian.PutUint16(s[2:4], uint16(length)) // #nosec G115 - bounded by the page size
+}
@@ -0,0 +1,145 @@
+package page
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// cells returns the cells of a slotted page as strings.
+func cells(p *Page) []string {
+	var result []string
+	for i := 0; i < int(p.NumSlots()); i++ {
+		result = append(result, string(p.Cell(i)))
+	}
+	return result
+}
+
+func TestSlotted_InsertRemove(t *testing.T) {
+	p := NewPage(1, PageTypeLeaf)
+
+	for _, step := range []struct {
+		index int
+		cell  string
+	}{{0, "b"}, {0, "a"}, {2, "d"}, {2, "c"}} {
+		if !p.InsertCell(step.index, []byte(step.cell)) {
+			t.Fatalf("Failed to insert %s", step.cell)
+		}
+	}
+	if got := fmt.Sprint(cells(p)); got != "[a b c d]" {
+		t.Errorf("Expected cells in slot order, got %s", got)
+	}
+	if err := p.CheckSlots(); err != nil {
+		t.Errorf("Unexpected inconsistency: %v", err)
+	}
+
+	free := p.FreeSpace()
+	p.RemoveCell(1)
+	if got := fmt.Sprint(cells(p)); got != "[a c d]" {
+		t.Errorf("Expected b to be removed, got %s", got)
+	}
+	if p.FreeSpace() != free+1+SlotSize {
+		t.Errorf("Expected free space %d, got %d", free+1+SlotSize, p.FreeSpace())
+	}
+
+	// Shrinking in place leaves a hole; growing moves the cell
+	if !p.ReplaceCell(0, []byte("")) || !p.ReplaceCell(1, []byte("cccc")) {
+		t.Fatal("Failed to replace cells")
+	}
+	if got := fmt.Sprint(cells(p)); got != "[ cccc d]" {
+		t.Errorf("Unexpected cells after replace: %s", got)
+	}
+	if err := p.CheckSlots(); err != nil {
+		t.Errorf("Unexpected inconsistency: %v", err)
+	}
+
+	p.Reset()
+	if p.NumSlots() != 0 || p.FreeSpace() != PageSize-PageHeaderSize || p.FreeSpacePtr() != PageHeaderSize {
+		t.Errorf("Expected an empty page after reset, got %d slots and %d free", p.NumSlots(), p.FreeSpace())
+	}
+}
+
+func TestSlotted_FullAndCompact(t *testing.T) {
+	p := NewPage(1, PageTypeLeaf)
+	cell := bytes.Repeat([]byte{'x'}, 100)
+
+	n := 0
+	for p.InsertCell(n, cell) {
+		n++
+	}
+	if expected := (PageSize - PageHeaderSize) / (100 + SlotSize); n != expected {
+		t.Errorf("Expected %d cells to fit, got %d", expected, n)
+	}
+
+	// Free every other cell; the holes are only usable after compaction
+	for i := n - 2; i >= 0; i -= 2 {
+		p.RemoveCell(i)
+	}
+	if p.contiguousFree() >= 300+SlotSize {
+		t.Fatalf("Expected fragmented free space, got %d contiguous bytes", p.contiguousFree())
+	}
+
+	big := bytes.Repeat([]byte{'y'}, 300)
+	if !p.InsertCell(0, big) {
+		t.Fatal("Expected insert to compact the page")
+	}
+	if !bytes.Equal(p.Cell(0), big) || !bytes.Equal(p.Cell(1), cell) {
+		t.Error("Cells changed by compaction")
+	}
+	if err := p.CheckSlots(); err != nil {
+		t.Errorf("Unexpected inconsistency: %v", err)
+	}
+
+	if p.InsertCell(0, make([]byte, p.MaxCellSize())) {
+		t.Error("Expected an oversized cell not to fit")
+	}
+}
+
+func TestSlotted_CheckSlots(t *testing.T) {
+	p := NewPage(1, PageTypeLeaf)
+	p.InsertCell(0, []byte("cell"))
+
+	p.header.FreeSpacePtr = PageSize
+	if err := p.CheckSlots(); err == nil {
+		t.Error("Expected error for free space pointer inside the slots")
+	}
+
+	p.header.FreeSpacePtr = PageHeaderSize + 4
+	p.header.NumSlots = 3000
+	if err := p.CheckSlots(); err == nil {
+		t.Error("Expected error for too many slots")
+	}
+
+	p.header.NumSlots = 1
+	p.setSlot(0, PageHeaderSize+2, 4)
+	if err := p.CheckSlots(); err == nil {
+		t.Error("Expected error for a cell past the free space pointer")
+	}
+}
+
+func TestPageImage(t *testing.T) {
+	p := NewPage(1, PageTypeOverflow)
+	p.InsertCell(0, []byte("cell"))
+	p.SetNextPage(7)
+
+	image := p.Image()
+	q := NewPage(1, PageTypeLeaf)
+	if err := q.SetImage(image); err != nil {
+		t.Fatalf("Failed to set image: %v", err)
+	}
+	if q.NextPage() != 7 || q.NumSlots() != 1 || q.FreeSpace() != p.FreeSpace() || string(q.Cell(0)) != "cell" {
+		t.Error("Expected the image to carry the layout and data")
+	}
+	if q.Type() != PageTypeOverflow {
+		t.Errorf("Expected the image to carry the page type, got %s", q.Type())
+	}
+
+	if err := q.SetImage(image[1:]); err == nil {
+		t.Error("Expected error for a short image")
+	}
+	image[10] = 0xff
+	if err := q.SetImage(image); !errors.Is(err, ErrInvalidPageType) {
+		t.Errorf("Expected ErrInvalidPageType, got %v", err)
+	}
+}
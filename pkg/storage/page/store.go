@@ -0,0 +1,26 @@
+package page
+
+// Store is the page allocation and access interface that index structures
+// such as the B+ tree run against. Implementations may keep pages purely in
+// memory (Manager) or back them with a database file.
+type Store interface {
+	// AllocatePage allocates a new page with the given type.
+	AllocatePage(pageType PageType) (*Page, error)
+
+	// DeallocatePage releases a page so that its ID can be reused.
+	DeallocatePage(pageID PageID) error
+
+	// GetPage retrieves a page by ID.
+	GetPage(pageID PageID) (*Page, error)
+
+	// WritePage records that the contents of a page were modified.
+	// Callers must invoke it after every change to a page obtained
+	// from the store so that the change reaches the backing storage.
+	WritePage(pg *Page) error
+
+	// PageSize returns the size of the store's pages in bytes.
+	PageSize() int
+}
+
+// Ensure Manager satisfies the Store interface.
+var _ Store = (*Manager)(nil)
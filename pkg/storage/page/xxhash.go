@@ -0,0 +1,116 @@
+package page
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// xxHash64 primes, from the reference implementation.
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// xxh64 computes xxHash64 with a zero seed over data written in pieces,
+// without allocating.
+type xxh64 struct {
+	// v holds the four accumulator lanes
+	v [4]uint64
+
+	// total is the number of bytes written
+	total uint64
+
+	// mem holds the bytes written that do not fill a 32-byte stripe yet
+	mem [32]byte
+	n   int
+}
+
+// reset starts a new hash.
+func (d *xxh64) reset() {
+	// The lanes start from sums that wrap around, which constant
+	// arithmetic does not allow
+	prime1 := xxPrime1
+	d.v[0] = prime1 + xxPrime2
+	d.v[1] = xxPrime2
+	d.v[2] = 0
+	d.v[3] = -prime1
+	d.total = 0
+	d.n = 0
+}
+
+// write adds b to the hash.
+func (d *xxh64) write(b []byte) {
+	d.total += uint64(len(b))
+
+	if d.n+len(b) < len(d.mem) {
+		d.n += copy(d.mem[d.n:], b)
+		return
+	}
+
+	if d.n > 0 {
+		c := copy(d.mem[d.n:], b)
+		d.stripe(d.mem[:])
+		b = b[c:]
+		d.n = 0
+	}
+
+	for ; len(b) >= len(d.mem); b = b[len(d.mem):] {
+		d.stripe(b)
+	}
+
+	d.n = copy(d.mem[:], b)
+}
+
+// stripe mixes 32 bytes into the accumulator lanes.
+func (d *xxh64) stripe(b []byte) {
+	for i := range d.v {
+		d.v[i] = xxRound(d.v[i], binary.LittleEndian.Uint64(b[8*i:]))
+	}
+}
+
+// sum returns the hash of the bytes written so far.
+func (d *xxh64) sum() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		h = bits.RotateLeft64(d.v[0], 1) + bits.RotateLeft64(d.v[1], 7) +
+			bits.RotateLeft64(d.v[2], 12) + bits.RotateLeft64(d.v[3], 18)
+		for _, v := range d.v {
+			h = (h^xxRound(0, v))*xxPrime1 + xxPrime4
+		}
+	} else {
+		h = d.v[2] + xxPrime5
+	}
+	h += d.total
+
+	b := d.mem[:d.n]
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+// xxRound mixes one 8-byte lane of input into an accumulator.
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
@@ -3,6 +3,7 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -10,7 +11,7 @@ import (
 	"github.com/thromel/go-database/pkg/storage/btree"
 	"github.com/thromel/go-database/pkg/storage/buffer"
 	"github.com/thromel/go-database/pkg/storage/file"
-	"github.com/thromel/go-database/pkg/storage/page"
+	"github.com/thromel/go-database/pkg/storage/wal"
 	"github.com/thromel/go-database/pkg/utils"
 )
 
@@ -22,7 +23,8 @@ type PersistentEngine struct {
 
 	// Core components
 	fileManager *file.FileManager
-	pageManager *page.Manager
+	wal         *wal.Log
+	pageManager *PersistentPageManager
 	bufferPool  *buffer.BufferPool
 	btree       *btree.BPlusTree
 
@@ -30,6 +32,13 @@ type PersistentEngine struct {
 	mu     sync.RWMutex
 	closed atomic.Bool
 
+	// recovery describes the crash recovery performed on open
+	recovery RecoveryReport
+
+	// fenceLSN is the LSN of the last backup taken, whose fence the file
+	// manager tracks the pages written since (see backup.go)
+	fenceLSN uint64
+
 	// Statistics
 	stats StorageStats
 }
@@ -42,15 +51,27 @@ type PersistentConfig struct {
 	// BufferPoolSize is the number of pages to keep in memory
 	BufferPoolSize int
 
+	// BufferPoolBytes, if positive, sizes the buffer pool in bytes instead
+	// of BufferPoolSize, in pages of the size the file was created with
+	BufferPoolBytes int64
+
 	// BTreeConfig holds B+ tree configuration
 	BTreeConfig *btree.Config
 
 	// FileConfig holds file manager configuration
 	FileConfig *file.Config
 
-	// SyncOnWrite forces sync after each write operation
+	// WALConfig holds write-ahead log configuration (nil uses the defaults)
+	WALConfig *wal.Config
+
+	// SyncOnWrite makes each write durable before it returns by flushing
+	// the write-ahead log; concurrent writers share one fsync
 	SyncOnWrite bool
 
+	// CheckpointSize is the log size in bytes at which a write triggers a
+	// checkpoint that flushes all pages and empties the log (0 disables)
+	CheckpointSize int64
+
 	// EnableIntegrityChecks performs startup integrity validation
 	EnableIntegrityChecks bool
 }
@@ -62,7 +83,9 @@ func DefaultPersistentConfig() *PersistentConfig {
 		BufferPoolSize:        1024,
 		BTreeConfig:           btree.DefaultConfig(),
 		FileConfig:            file.DefaultConfig(),
+		WALConfig:             wal.DefaultConfig(),
 		SyncOnWrite:           true,
+		CheckpointSize:        64 * 1024 * 1024,
 		EnableIntegrityChecks: true,
 	}
 }
@@ -87,7 +110,8 @@ func NewPersistentEngine(config *PersistentConfig) (*PersistentEngine, error) {
 		return nil, fmt.Errorf("failed to initialize storage engine: %w", err)
 	}
 
-	// Perform startup integrity checks if enabled
+	// Perform startup integrity checks if enabled; recovery has already
+	// brought the file up to date with the log
 	if config.EnableIntegrityChecks {
 		if err := engine.performStartupChecks(); err != nil {
 			engine.cleanup()
@@ -104,7 +128,7 @@ func validateConfig(config *PersistentConfig) error {
 		return fmt.Errorf("file path cannot be empty")
 	}
 
-	if config.BufferPoolSize <= 0 {
+	if config.BufferPoolSize <= 0 && config.BufferPoolBytes <= 0 {
 		return fmt.Errorf("buffer pool size must be positive, got %d", config.BufferPoolSize)
 	}
 
@@ -116,6 +140,10 @@ func validateConfig(config *PersistentConfig) error {
 		return fmt.Errorf("file configuration cannot be nil")
 	}
 
+	if config.CheckpointSize < 0 {
+		return fmt.Errorf("checkpoint size cannot be negative, got %d", config.CheckpointSize)
+	}
+
 	return nil
 }
 
@@ -129,21 +157,116 @@ func (pe *PersistentEngine) initializeComponents() error {
 		return fmt.Errorf("failed to create file manager: %w", err)
 	}
 
-	// 2. Initialize page manager
-	pe.pageManager = page.NewManager()
+	// 2. Open the write-ahead log next to the database file
+	pe.wal, err = wal.Open(pe.fileManager.GetPath()+wal.DirExtension, pe.config.WALConfig)
+	if err != nil {
+		return fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+
+	// 3. Replay the log into the database file after a crash
+	pe.recovery, err = recoverDatabase(pe.fileManager, pe.wal)
+	if err != nil {
+		return fmt.Errorf("crash recovery failed: %w", err)
+	}
+
+	// 4. Bring a file written in an older format up to date, and record the
+	// format features it is configured to use, now that its log, which
+	// holds meta page images without them, has been replayed
+	if err := pe.fileManager.Upgrade(metaMigrations); err != nil {
+		return fmt.Errorf("failed to upgrade database file: %w", err)
+	}
 
-	// 3. Initialize buffer pool
-	pe.bufferPool = buffer.NewBufferPool(pe.config.BufferPoolSize, pe.pageManager)
+	// 5. Initialize buffer pool over the database file, guarded by the log
+	poolSize := pe.config.BufferPoolSize
+	if pe.config.BufferPoolBytes > 0 {
+		poolSize = int(max(pe.config.BufferPoolBytes/int64(pe.fileManager.PageSize()), 1))
+	}
+	pe.bufferPool = buffer.NewBufferPool(poolSize, pe.fileManager)
+	pe.bufferPool.SetLog(pe.wal)
 
-	// 4. Initialize B+ tree
-	pe.btree, err = btree.NewBPlusTree(pe.pageManager, pe.config.BTreeConfig)
+	// 6. Initialize page manager, which reads the meta page
+	pe.pageManager, err = NewPersistentPageManager(pe.fileManager, pe.bufferPool, pe.wal)
+	if err != nil {
+		return fmt.Errorf("failed to create page manager: %w", err)
+	}
+
+	// 7. Open the existing B+ tree, or create one for a new database
+	if meta, ok := pe.pageManager.TreeMeta(); ok {
+		pe.btree, err = btree.OpenBPlusTree(pe.pageManager, pe.config.BTreeConfig, meta)
+		if err != nil {
+			return fmt.Errorf("failed to open B+ tree: %w", err)
+		}
+		return nil
+	}
+
+	_, err = pe.update(func() error {
+		tree, err := btree.NewBPlusTree(pe.pageManager, pe.config.BTreeConfig)
+		pe.btree = tree
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create B+ tree: %w", err)
 	}
 
+	// Record the new tree so the file can be reopened right away
+	if err := pe.syncInternal(); err != nil {
+		return fmt.Errorf("failed to write initial tree: %w", err)
+	}
+
 	return nil
 }
 
+// update runs fn as one atomic, logged change to the B+ tree and returns the
+// LSN of its commit record (assumes lock is held). If fn fails, every page it
+// modified is rolled back and the tree is reopened from the restored state.
+func (pe *PersistentEngine) update(fn func() error) (uint64, error) {
+	if err := pe.pageManager.BeginUpdate(); err != nil {
+		return 0, err
+	}
+
+	if err := fn(); err != nil {
+		if abortErr := pe.pageManager.AbortUpdate(); abortErr != nil {
+			return 0, fmt.Errorf("%w (rollback failed: %v)", err, abortErr)
+		}
+
+		// The tree may have changed its root or key count before failing
+		if meta, ok := pe.pageManager.TreeMeta(); ok && pe.btree != nil {
+			tree, openErr := btree.OpenBPlusTree(pe.pageManager, pe.config.BTreeConfig, meta)
+			if openErr != nil {
+				return 0, fmt.Errorf("%w (reopen failed: %v)", err, openErr)
+			}
+			pe.btree = tree
+		}
+
+		return 0, err
+	}
+
+	pe.pageManager.SetTreeMeta(pe.btree.Meta())
+	lsn, err := pe.pageManager.CommitUpdate()
+	if err != nil {
+		return 0, err
+	}
+
+	// Bound the log, and with it the time recovery can take
+	if pe.config.CheckpointSize > 0 && pe.wal.Size() >= pe.config.CheckpointSize {
+		if err := pe.syncInternal(); err != nil {
+			return 0, fmt.Errorf("checkpoint failed: %w", err)
+		}
+	}
+
+	return lsn, nil
+}
+
+// commit waits until the update with the given commit LSN is durable, if
+// SyncOnWrite is enabled. It must be called without holding the lock so that
+// concurrent writers can share a log fsync.
+func (pe *PersistentEngine) commit(lsn uint64) error {
+	if !pe.config.SyncOnWrite || lsn == 0 {
+		return nil
+	}
+	return pe.wal.Flush(lsn)
+}
+
 // performStartupChecks performs integrity validation during startup.
 func (pe *PersistentEngine) performStartupChecks() error {
 	// Check file integrity
@@ -164,6 +287,9 @@ func (pe *PersistentEngine) cleanup() {
 	if pe.bufferPool != nil {
 		_ = pe.bufferPool.Close()
 	}
+	if pe.wal != nil {
+		_ = pe.wal.Close()
+	}
 	if pe.fileManager != nil {
 		_ = pe.fileManager.Close()
 	}
@@ -185,12 +311,10 @@ func (pe *PersistentEngine) Get(key []byte) ([]byte, error) {
 	// Get from B+ tree
 	value, err := pe.btree.Get(key)
 	if err != nil {
-		// Convert B+ tree's ErrKeyNotFound to utils.ErrKeyNotFound
-		if err.Error() == "key not found" {
+		if errors.Is(err, btree.ErrKeyNotFound) {
 			atomic.AddInt64(&pe.stats.CacheMissCount, 1)
-			return nil, utils.ErrKeyNotFound
 		}
-		return nil, err
+		return nil, translateTreeError(err)
 	}
 
 	// Update statistics
@@ -211,19 +335,23 @@ func (pe *PersistentEngine) Put(key []byte, value []byte) error {
 		return utils.ErrInvalidKey
 	}
 
-	pe.mu.Lock()
-	defer pe.mu.Unlock()
+	if value == nil {
+		return utils.ErrInvalidValue
+	}
 
 	// Store in B+ tree
-	if err := pe.btree.Put(key, value); err != nil {
-		return err
+	pe.mu.Lock()
+	lsn, err := pe.update(func() error {
+		return pe.btree.Put(key, value)
+	})
+	pe.mu.Unlock()
+	if err != nil {
+		return translateTreeError(err)
 	}
 
-	// Sync to disk if enabled
-	if pe.config.SyncOnWrite {
-		if err := pe.syncInternal(); err != nil {
-			return fmt.Errorf("failed to sync after write: %w", err)
-		}
+	// Wait for the log to reach disk if enabled
+	if err := pe.commit(lsn); err != nil {
+		return fmt.Errorf("failed to sync after write: %w", err)
 	}
 
 	// Update statistics
@@ -243,31 +371,136 @@ func (pe *PersistentEngine) Delete(key []byte) error {
 		return utils.ErrInvalidKey
 	}
 
+	// Delete from B+ tree
 	pe.mu.Lock()
-	defer pe.mu.Unlock()
+	lsn, err := pe.update(func() error {
+		return pe.btree.Delete(key)
+	})
+	pe.mu.Unlock()
+	if err != nil {
+		return translateTreeError(err)
+	}
 
-	// Delete from B+ tree
-	if err := pe.btree.Delete(key); err != nil {
-		// Convert B+ tree's ErrKeyNotFound to utils.ErrKeyNotFound
-		if err.Error() == "key not found" {
-			return utils.ErrKeyNotFound
+	// Wait for the log to reach disk if enabled
+	if err := pe.commit(lsn); err != nil {
+		return fmt.Errorf("failed to sync after delete: %w", err)
+	}
+
+	// Update statistics
+	atomic.AddInt64(&pe.stats.DeleteCount, 1)
+
+	return nil
+}
+
+// Write applies every change in the batch as one atomic update of the B+ tree.
+func (pe *PersistentEngine) Write(batch *WriteBatch) error {
+	if pe.closed.Load() {
+		return utils.ErrDatabaseClosed
+	}
+
+	err := batch.ForEach(func(key, value []byte, deleted bool) error {
+		if len(key) == 0 {
+			return utils.ErrInvalidKey
 		}
+		if !deleted && value == nil {
+			return utils.ErrInvalidValue
+		}
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 
-	// Sync to disk if enabled
-	if pe.config.SyncOnWrite {
-		if err := pe.syncInternal(); err != nil {
-			return fmt.Errorf("failed to sync after delete: %w", err)
-		}
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	// Apply all changes in one update, so a failure rolls back the whole batch
+	var puts, deletes, bytesWritten int64
+	pe.mu.Lock()
+	lsn, err := pe.update(func() error {
+		return batch.ForEach(func(key, value []byte, deleted bool) error {
+			if !deleted {
+				puts++
+				bytesWritten += int64(len(key) + len(value))
+				return pe.btree.Put(key, value)
+			}
+
+			err := pe.btree.Delete(key)
+			if errors.Is(err, btree.ErrKeyNotFound) {
+				return nil
+			}
+			deletes++
+			return err
+		})
+	})
+	pe.mu.Unlock()
+	if err != nil {
+		return translateTreeError(err)
+	}
+
+	// Wait for the log to reach disk if enabled
+	if err := pe.commit(lsn); err != nil {
+		return fmt.Errorf("failed to sync after batch: %w", err)
 	}
 
 	// Update statistics
-	atomic.AddInt64(&pe.stats.DeleteCount, 1)
+	atomic.AddInt64(&pe.stats.WriteCount, puts)
+	atomic.AddInt64(&pe.stats.DeleteCount, deletes)
+	atomic.AddInt64(&pe.stats.BytesWritten, bytesWritten)
+
+	return nil
+}
+
+// BulkLoad fills an empty engine from entries supplied in ascending key
+// order, building the B+ tree bottom-up instead of inserting the entries one
+// by one (see btree.BPlusTree.BulkLoad). It runs as a single update, so if
+// it fails, for example because the keys are out of order, the engine is
+// left empty. Like any direct write to the engine, it bypasses the
+// transaction manager; databases load through api.Database.BulkLoad.
+func (pe *PersistentEngine) BulkLoad(src btree.Source) error {
+	if pe.closed.Load() {
+		return utils.ErrDatabaseClosed
+	}
+
+	counted := &countingSource{Source: src}
+	pe.mu.Lock()
+	lsn, err := pe.update(func() error {
+		return pe.btree.BulkLoad(counted)
+	})
+	pe.mu.Unlock()
+	if err != nil {
+		return translateTreeError(err)
+	}
+
+	// Wait for the log to reach disk if enabled
+	if err := pe.commit(lsn); err != nil {
+		return fmt.Errorf("failed to sync after bulk load: %w", err)
+	}
+
+	// Update statistics
+	atomic.AddInt64(&pe.stats.WriteCount, counted.entries)
+	atomic.AddInt64(&pe.stats.BytesWritten, counted.bytes)
 
 	return nil
 }
 
+// countingSource counts the entries read from a bulk load source.
+type countingSource struct {
+	btree.Source
+	entries, bytes int64
+}
+
+// Next advances the source, counting the entry it moves to.
+func (s *countingSource) Next() bool {
+	if !s.Source.Next() {
+		return false
+	}
+	s.entries++
+	s.bytes += int64(len(s.Key()) + len(s.Value()))
+	return true
+}
+
 // Exists checks if a key exists in the storage without retrieving its value.
 func (pe *PersistentEngine) Exists(key []byte) (bool, error) {
 	if pe.closed.Load() {
@@ -281,10 +514,17 @@ func (pe *PersistentEngine) Exists(key []byte) (bool, error) {
 	pe.mu.RLock()
 	defer pe.mu.RUnlock()
 
-	return pe.btree.Exists(key)
+	exists, err := pe.btree.Exists(key)
+	if err != nil {
+		return false, translateTreeError(err)
+	}
+
+	return exists, nil
 }
 
-// NewIterator creates a new iterator for traversing key-value pairs.
+// NewIterator creates a new iterator for traversing key-value pairs in
+// [start, end), walking the leaves of the B+ tree. A nil bound leaves that
+// side of the range open.
 func (pe *PersistentEngine) NewIterator(start, end []byte) Iterator {
 	if pe.closed.Load() {
 		return &ErrorIterator{err: utils.ErrDatabaseClosed}
@@ -293,11 +533,7 @@ func (pe *PersistentEngine) NewIterator(start, end []byte) Iterator {
 	pe.mu.RLock()
 	defer pe.mu.RUnlock()
 
-	// Create B+ tree iterator
-	// Note: This is a simplified implementation. A full implementation would
-	// need to integrate with the buffer pool for efficient page loading.
-	// For now, return an error iterator to indicate this feature is not yet implemented.
-	return &ErrorIterator{err: fmt.Errorf("iterator not yet implemented for persistent storage")}
+	return newPersistentIterator(pe, start, end)
 }
 
 // Size returns the approximate number of key-value pairs in the storage.
@@ -327,14 +563,19 @@ func (pe *PersistentEngine) Sync() error {
 
 // syncInternal performs the actual sync operation (assumes lock is held).
 func (pe *PersistentEngine) syncInternal() error {
-	// 1. Flush buffer pool dirty pages
-	if err := pe.bufferPool.FlushAllPages(); err != nil {
-		return fmt.Errorf("failed to flush buffer pool: %w", err)
+	// 1. Make the whole log durable
+	if err := pe.wal.Flush(pe.wal.EndLSN()); err != nil {
+		return fmt.Errorf("failed to flush write-ahead log: %w", err)
+	}
+
+	// 2. Flush dirty pages, write the meta page and sync the file to disk
+	if err := pe.pageManager.Sync(); err != nil {
+		return fmt.Errorf("failed to sync page manager: %w", err)
 	}
 
-	// 2. Sync file manager to disk
-	if err := pe.fileManager.Sync(); err != nil {
-		return fmt.Errorf("failed to sync file manager: %w", err)
+	// 3. Every logged change is now in the database file
+	if err := pe.wal.Reset(); err != nil {
+		return fmt.Errorf("failed to reset write-ahead log: %w", err)
 	}
 
 	return nil
@@ -363,6 +604,12 @@ func (pe *PersistentEngine) Close() error {
 		}
 	}
 
+	if pe.wal != nil {
+		if err := pe.wal.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("write-ahead log close failed: %w", err))
+		}
+	}
+
 	if pe.fileManager != nil {
 		if err := pe.fileManager.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("file manager close failed: %w", err))
@@ -395,14 +642,46 @@ func (pe *PersistentEngine) GetStats() StorageStats {
 		stats.CacheMissCount += bufferStats.CacheMisses
 	}
 
+	if pe.pageManager != nil {
+		stats.PageCount = int64(pe.pageManager.GetAllocatedPageCount())
+		stats.FreePageCount = int64(pe.pageManager.GetFreePageCount())
+	}
+
 	return stats
 }
 
+// translateTreeError converts B+ tree errors into the storage-level errors
+// callers of StorageEngine expect.
+func translateTreeError(err error) error {
+	switch {
+	case errors.Is(err, btree.ErrKeyNotFound):
+		return utils.ErrKeyNotFound
+	case errors.Is(err, btree.ErrInvalidKey):
+		return utils.ErrInvalidKey
+	case errors.Is(err, btree.ErrKeyTooLarge):
+		return utils.ErrKeyTooLarge
+	case errors.Is(err, btree.ErrValueTooLarge):
+		return utils.ErrValueTooLarge
+	default:
+		return err
+	}
+}
+
 // GetFileManager returns the file manager (for testing/debugging).
 func (pe *PersistentEngine) GetFileManager() *file.FileManager {
 	return pe.fileManager
 }
 
+// RecoveryReport returns what crash recovery did when the engine was opened.
+func (pe *PersistentEngine) RecoveryReport() RecoveryReport {
+	return pe.recovery
+}
+
+// GetWAL returns the write-ahead log (for testing/debugging).
+func (pe *PersistentEngine) GetWAL() *wal.Log {
+	return pe.wal
+}
+
 // GetBufferPool returns the buffer pool (for testing/debugging).
 func (pe *PersistentEngine) GetBufferPool() *buffer.BufferPool {
 	return pe.bufferPool
@@ -420,6 +699,7 @@ type ErrorIterator struct {
 
 func (ei *ErrorIterator) Valid() bool        { return false }
 func (ei *ErrorIterator) Next() bool         { return false }
+func (ei *ErrorIterator) Prev() bool         { return false }
 func (ei *ErrorIterator) Key() []byte        { return nil }
 func (ei *ErrorIterator) Value() []byte      { return nil }
 func (ei *ErrorIterator) Seek(target []byte) {}
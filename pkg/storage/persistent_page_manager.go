@@ -1,166 +1,567 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
 
+	"github.com/thromel/go-database/pkg/storage/btree"
 	"github.com/thromel/go-database/pkg/storage/buffer"
 	"github.com/thromel/go-database/pkg/storage/file"
 	"github.com/thromel/go-database/pkg/storage/page"
+	"github.com/thromel/go-database/pkg/storage/wal"
 )
 
-// PersistentPageManager integrates the in-memory page manager with file storage
-// and buffer pool to provide persistent page management.
+// PersistentPageManager is a page.Store backed by the database file. Pages are
+// cached in the buffer pool, which writes modified pages back to the file on
+// eviction and on Sync. Allocation state and the B+ tree root are kept in the
+// meta page, and freed pages are recorded in a free list in the file (see
+// freelist.go) so that they are reused after a reopen.
+//
+// When a write-ahead log is attached, every page change must happen inside an
+// update (BeginUpdate ... CommitUpdate or AbortUpdate). Each WritePage logs the
+// bytes that changed since the page was last logged, and the page is stamped
+// with the record's LSN before it can be written back.
 type PersistentPageManager struct {
 	// Core components
-	memoryPageManager *page.Manager
-	fileManager       *file.FileManager
-	bufferPool        *buffer.BufferPool
+	fileManager *file.FileManager
+	bufferPool  *buffer.BufferPool
+	log         *wal.Log
 
 	// State
 	mu sync.RWMutex
 
-	// Page mapping: in-memory page ID -> file page ID
-	pageMapping    map[page.PageID]page.PageID
-	nextFilePageID page.PageID
+	// meta mirrors the contents of the meta page (page 0)
+	meta engineMeta
+
+	// free holds the pages on the free list, including its trunk pages
+	free map[page.PageID]bool
+
+	// hasMeta reports whether the file held a meta page when it was opened
+	hasMeta bool
+
+	// metaImage is the meta page image as of the last meta record
+	metaImage []byte
+
+	// metaLSN is the LSN of the last logged change to the meta page
+	metaLSN uint64
+
+	// update is the update in progress, if any
+	update *pageUpdate
+
+	// lastTxnID is the ID of the most recently started update
+	lastTxnID uint64
+}
+
+// pageUpdate tracks the pages touched by one atomic update so that each write
+// can be logged as a diff and the whole update can be rolled back.
+type pageUpdate struct {
+	// txnID identifies the update in the log
+	txnID uint64
+
+	// logged holds each touched page's image as last logged
+	logged map[page.PageID][]byte
+
+	// original holds each touched page's image before the update
+	original map[page.PageID][]byte
+
+	// pages holds the page objects modified by the update
+	pages map[page.PageID]*page.Page
+
+	// fresh marks pages allocated by the update that have not been logged
+	fresh map[page.PageID]bool
+
+	// freed holds pages deallocated by the update. They join the free list
+	// only when the update commits, so a page is never reused, or turned
+	// into a free-list page, within the update that freed it.
+	freed []page.PageID
+
+	// reused holds pages the update took off the free list
+	reused []page.PageID
+
+	// meta captures allocation state before the update
+	meta engineMeta
+
+	// lastLSN is the LSN of the last record written by the update
+	lastLSN uint64
+}
+
+// Ensure PersistentPageManager satisfies the page.Store interface.
+var _ page.Store = (*PersistentPageManager)(nil)
+
+// NewPersistentPageManager creates a persistent page manager over an open file.
+// The meta page is read from the file; a file without one is treated as empty.
+// The log may be nil, in which case page changes are not logged.
+func NewPersistentPageManager(fileManager *file.FileManager, bufferPool *buffer.BufferPool, log *wal.Log) (*PersistentPageManager, error) {
+	if fileManager == nil {
+		return nil, fmt.Errorf("file manager cannot be nil")
+	}
+	if bufferPool == nil {
+		return nil, fmt.Errorf("buffer pool cannot be nil")
+	}
+
+	ppm := &PersistentPageManager{
+		fileManager: fileManager,
+		bufferPool:  bufferPool,
+		log:         log,
+		meta:        engineMeta{nextPageID: 1}, // Page 0 is the meta page
+		free:        make(map[page.PageID]bool),
+		metaImage:   page.NewPageWithSize(page.InvalidPageID, page.PageTypeMeta, fileManager.PageSize()).Image(),
+	}
+
+	// A file that is empty, or only preallocated, holds no database yet
+	if fileManager.GetPageCount() == 0 {
+		return ppm, nil
+	}
+
+	metaPage, err := fileManager.ReadMetaPage()
+	switch {
+	case errors.Is(err, file.ErrUninitializedPage):
+		return ppm, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read meta page: %w", err)
+	}
+
+	meta, err := decodeEngineMeta(metaPage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode meta page: %w", err)
+	}
+	if meta.nextPageID == page.InvalidPageID {
+		return nil, fmt.Errorf("%w: next page ID is zero", errMetaCorrupted)
+	}
+
+	ppm.meta = *meta
+	ppm.hasMeta = true
+	ppm.metaLSN = metaPage.LSN()
+	copy(ppm.metaImage, metaPage.Image())
+
+	if err := ppm.loadFreeListLocked(); err != nil {
+		return nil, fmt.Errorf("failed to load free list: %w", err)
+	}
+
+	return ppm, nil
 }
 
-// NewPersistentPageManager creates a new persistent page manager.
-func NewPersistentPageManager(fileManager *file.FileManager, bufferPool *buffer.BufferPool) *PersistentPageManager {
-	return &PersistentPageManager{
-		memoryPageManager: page.NewManager(),
-		fileManager:       fileManager,
-		bufferPool:        bufferPool,
-		pageMapping:       make(map[page.PageID]page.PageID),
-		nextFilePageID:    1, // Start from 1 (0 is invalid)
+// BeginUpdate starts an atomic update. Only one update may be in progress.
+func (ppm *PersistentPageManager) BeginUpdate() error {
+	ppm.mu.Lock()
+	defer ppm.mu.Unlock()
+
+	if ppm.log == nil {
+		return nil // Nothing to track without a log
 	}
+
+	if ppm.update != nil {
+		return ErrUpdateInProgress
+	}
+
+	ppm.lastTxnID++
+	ppm.update = &pageUpdate{
+		txnID:    ppm.lastTxnID,
+		logged:   make(map[page.PageID][]byte),
+		original: make(map[page.PageID][]byte),
+		pages:    make(map[page.PageID]*page.Page),
+		fresh:    make(map[page.PageID]bool),
+		meta:     ppm.meta,
+	}
+
+	return nil
 }
 
-// AllocatePage allocates a new page and ensures it's backed by persistent storage.
-func (ppm *PersistentPageManager) AllocatePage(pageType page.PageType) (*page.Page, error) {
+// CommitUpdate logs the meta page changes and a commit record for the update
+// in progress, and returns the commit LSN. The update is durable once the log
+// has been flushed up to that LSN. It returns 0 if the update changed nothing.
+func (ppm *PersistentPageManager) CommitUpdate() (uint64, error) {
 	ppm.mu.Lock()
 	defer ppm.mu.Unlock()
 
-	// Allocate page in memory
-	memPage, err := ppm.memoryPageManager.AllocatePage(pageType)
-	if err != nil {
-		return nil, fmt.Errorf("failed to allocate memory page: %w", err)
+	if ppm.log == nil {
+		return 0, nil
 	}
 
-	// Assign file page ID
-	filePageID := ppm.nextFilePageID
-	ppm.nextFilePageID++
+	u := ppm.update
+	if u == nil {
+		return 0, ErrNoUpdate
+	}
+
+	// Pages freed by the update join the free list as part of it
+	for _, id := range u.freed {
+		if err := ppm.pushFreeLocked(id); err != nil {
+			return 0, fmt.Errorf("failed to free page %d: %w", id, err)
+		}
+	}
+
+	if err := ppm.logMetaLocked(u); err != nil {
+		return 0, err
+	}
 
-	// Create persistent page with file page ID
-	persistentPage := page.NewPage(filePageID, pageType)
+	ppm.update = nil
 
-	// Map memory page ID to file page ID
-	ppm.pageMapping[memPage.ID()] = filePageID
+	if u.lastLSN == 0 {
+		return 0, nil // Read-only update
+	}
 
-	// Write initial page to file
-	if err := ppm.fileManager.WritePage(persistentPage); err != nil {
-		// Clean up on failure
-		delete(ppm.pageMapping, memPage.ID())
-		_ = ppm.memoryPageManager.DeallocatePage(memPage.ID()) // Ignore error during cleanup
-		return nil, fmt.Errorf("failed to write page to file: %w", err)
+	lsn, err := ppm.log.Append(&wal.Record{Type: wal.RecordCommit, TxnID: u.txnID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to log commit: %w", err)
 	}
 
-	return persistentPage, nil
+	return lsn, nil
 }
 
-// DeallocatePage deallocates a page from both memory and persistent storage.
-func (ppm *PersistentPageManager) DeallocatePage(pageID page.PageID) error {
+// AbortUpdate rolls back the update in progress. Every page it modified is
+// restored to its original contents, and the restorations are logged before
+// an abort record so that recovery can replay them.
+func (ppm *PersistentPageManager) AbortUpdate() error {
 	ppm.mu.Lock()
 	defer ppm.mu.Unlock()
 
-	// Find corresponding memory page ID
-	var memoryPageID page.PageID
-	for memID, fileID := range ppm.pageMapping {
-		if fileID == pageID {
-			memoryPageID = memID
-			break
+	if ppm.log == nil {
+		return nil
+	}
+
+	u := ppm.update
+	if u == nil {
+		return ErrNoUpdate
+	}
+	ppm.update = nil
+
+	// Pages the update reused are free again once their trunks are restored
+	for _, id := range u.reused {
+		ppm.free[id] = true
+	}
+
+	if u.lastLSN == 0 {
+		ppm.meta = u.meta
+		return nil // Nothing reached the log
+	}
+
+	for pageID, pg := range u.pages {
+		original := u.original[pageID]
+		rec := wal.NewPageRecord(u.txnID, pageID, pg.Type(), u.logged[pageID], original)
+		if rec == nil {
+			continue
 		}
+
+		lsn, err := ppm.log.Append(rec)
+		if err != nil {
+			return fmt.Errorf("failed to log rollback of page %d: %w", pageID, err)
+		}
+
+		if err := pg.SetImage(original); err != nil {
+			return err
+		}
+		pg.SetLSN(lsn)
+		if err := ppm.bufferPool.PutPage(pg); err != nil {
+			return fmt.Errorf("failed to buffer page %d: %w", pageID, err)
+		}
+	}
+
+	ppm.meta = u.meta
+
+	if _, err := ppm.log.Append(&wal.Record{Type: wal.RecordAbort, TxnID: u.txnID}); err != nil {
+		return fmt.Errorf("failed to log abort: %w", err)
 	}
 
-	if memoryPageID == page.InvalidPageID {
-		return fmt.Errorf("page %d not found in mapping", pageID)
+	return nil
+}
+
+// logMetaLocked logs the changes to the meta page made by an update
+// (assumes lock is held).
+func (ppm *PersistentPageManager) logMetaLocked(u *pageUpdate) error {
+	metaPage, err := ppm.buildMetaPage()
+	if err != nil {
+		return fmt.Errorf("failed to encode meta page: %w", err)
 	}
 
-	// Remove from mapping
-	delete(ppm.pageMapping, memoryPageID)
+	image := metaPage.Image()
+	rec := wal.NewPageRecord(u.txnID, page.InvalidPageID, page.PageTypeMeta, ppm.metaImage, image)
+	if rec == nil {
+		return nil
+	}
 
-	// Deallocate from memory page manager
-	if err := ppm.memoryPageManager.DeallocatePage(memoryPageID); err != nil {
-		return fmt.Errorf("failed to deallocate memory page: %w", err)
+	lsn, err := ppm.log.Append(rec)
+	if err != nil {
+		return fmt.Errorf("failed to log meta page: %w", err)
 	}
 
-	// Note: We don't actually delete the page from the file for simplicity.
-	// In a production implementation, we would mark it as free in a free page list.
+	copy(ppm.metaImage, image)
+	ppm.metaLSN = lsn
+	u.lastLSN = lsn
 
 	return nil
 }
 
-// GetPage retrieves a page from the buffer pool or loads it from file storage.
-func (ppm *PersistentPageManager) GetPage(pageID page.PageID) (*page.Page, error) {
-	ppm.mu.RLock()
-	defer ppm.mu.RUnlock()
+// trackLocked records the image of a page the update has not seen yet
+// (assumes lock is held).
+func (ppm *PersistentPageManager) trackLocked(pg *page.Page) {
+	u := ppm.update
+	if u == nil {
+		return
+	}
+
+	if _, seen := u.logged[pg.ID()]; seen {
+		return
+	}
+
+	image := pg.Image()
+	u.logged[pg.ID()] = image
+	u.original[pg.ID()] = append([]byte(nil), image...)
+}
+
+// AllocatePage allocates a new page and places it in the buffer pool.
+func (ppm *PersistentPageManager) AllocatePage(pageType page.PageType) (*page.Page, error) {
+	ppm.mu.Lock()
+	defer ppm.mu.Unlock()
+
+	pageID, reused, err := ppm.popFreeLocked()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reuse free page: %w", err)
+	}
+	if !reused {
+		pageID = ppm.meta.nextPageID
+		ppm.meta.nextPageID++
+	}
+
+	pg := page.NewPageWithSize(pageID, pageType, ppm.PageSize())
+
+	// A page the update has already read is a reused free-list trunk, whose
+	// contents matter until the update commits, so the new page replaces it
+	// in the log right away
+	if ppm.update != nil {
+		if _, seen := ppm.update.logged[pageID]; seen {
+			if err := ppm.writeFreeListPageLocked(pg); err != nil {
+				return nil, err
+			}
+			return pg, nil
+		}
+	}
+
+	if err := ppm.bufferPool.PutPage(pg); err != nil {
+		return nil, fmt.Errorf("failed to buffer page %d: %w", pageID, err)
+	}
+
+	// A reused page may still hold old contents in the file, so its first
+	// write is logged in full to make redo independent of them.
+	ppm.trackLocked(pg)
+	if ppm.update != nil {
+		ppm.update.fresh[pageID] = true
+	}
+
+	return pg, nil
+}
+
+// DeallocatePage returns a page to the free list for reuse. Pages freed
+// during an update become reusable once it commits.
+func (ppm *PersistentPageManager) DeallocatePage(pageID page.PageID) error {
+	if pageID == page.InvalidPageID {
+		return fmt.Errorf("cannot deallocate meta page")
+	}
+
+	ppm.mu.Lock()
+	defer ppm.mu.Unlock()
+
+	if pageID >= ppm.meta.nextPageID {
+		return fmt.Errorf("page %d has not been allocated", pageID)
+	}
+
+	if ppm.isFreeLocked(pageID) {
+		return fmt.Errorf("page %d is already free", pageID)
+	}
+
+	if ppm.update != nil {
+		ppm.update.freed = append(ppm.update.freed, pageID)
+		return nil
+	}
+	return ppm.pushFreeLocked(pageID)
+}
 
-	// Try to get from buffer pool first
-	if pg, err := ppm.bufferPool.GetPage(pageID); err == nil {
-		return pg, nil
+// isFreeLocked reports whether a page is on the free list or has been freed
+// by the update in progress (assumes lock is held).
+func (ppm *PersistentPageManager) isFreeLocked(pageID page.PageID) bool {
+	if ppm.free[pageID] {
+		return true
 	}
+	return ppm.update != nil && slices.Contains(ppm.update.freed, pageID)
+}
 
-	// Load from file storage
-	pg, err := ppm.fileManager.ReadPage(pageID)
+// GetPage retrieves a page through the buffer pool, loading it from the file
+// on a miss.
+func (ppm *PersistentPageManager) GetPage(pageID page.PageID) (*page.Page, error) {
+	pg, err := ppm.bufferPool.GetPage(pageID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read page from file: %w", err)
+		return nil, err
 	}
 
+	// Modified pages are handed back through WritePage, which re-installs
+	// them if they were evicted, so the frame need not stay pinned.
+	if err := ppm.bufferPool.UnpinPage(pageID, false); err != nil {
+		return nil, err
+	}
+
+	ppm.mu.Lock()
+	ppm.trackLocked(pg)
+	ppm.mu.Unlock()
+
 	return pg, nil
 }
 
-// GetMetaPage returns the database metadata page.
+// WritePage marks a modified page dirty in the buffer pool. It reaches the
+// database file when it is evicted or on the next Sync. With a log attached,
+// the change is logged first and the page stamped with the record's LSN.
+func (ppm *PersistentPageManager) WritePage(pg *page.Page) error {
+	if pg == nil {
+		return fmt.Errorf("cannot write nil page")
+	}
+	if pg.ID() == page.InvalidPageID {
+		return fmt.Errorf("cannot write meta page as a data page")
+	}
+
+	if err := ppm.logPage(pg); err != nil {
+		return err
+	}
+
+	if err := ppm.bufferPool.PutPage(pg); err != nil {
+		return fmt.Errorf("failed to buffer page %d: %w", pg.ID(), err)
+	}
+
+	return nil
+}
+
+// logPage logs the bytes of a page changed since it was last logged.
+func (ppm *PersistentPageManager) logPage(pg *page.Page) error {
+	ppm.mu.Lock()
+	defer ppm.mu.Unlock()
+	return ppm.logPageLocked(pg)
+}
+
+// logPageLocked logs the bytes of a page changed since it was last logged
+// (assumes lock is held).
+func (ppm *PersistentPageManager) logPageLocked(pg *page.Page) error {
+	if ppm.log == nil {
+		return nil
+	}
+
+	u := ppm.update
+	if u == nil {
+		return ErrNoUpdate
+	}
+
+	before, seen := u.logged[pg.ID()]
+	if !seen {
+		return fmt.Errorf("page %d was modified without being read in this update", pg.ID())
+	}
+	u.pages[pg.ID()] = pg
+
+	after := pg.Image()
+	var records []*wal.Record
+	if u.fresh[pg.ID()] {
+		records = []*wal.Record{wal.NewFullPageRecord(u.txnID, pg.ID(), pg.Type(), before, after)}
+		delete(u.fresh, pg.ID())
+	} else {
+		records = wal.NewPageRecords(u.txnID, pg.ID(), pg.Type(), before, after)
+	}
+	if len(records) == 0 {
+		return nil // Page unchanged
+	}
+
+	for _, rec := range records {
+		lsn, err := ppm.log.Append(rec)
+		if err != nil {
+			return fmt.Errorf("failed to log page %d: %w", pg.ID(), err)
+		}
+		pg.SetLSN(lsn)
+		u.lastLSN = lsn
+	}
+	copy(before, after)
+
+	return nil
+}
+
+// PageSize returns the size of the database file's pages.
+func (ppm *PersistentPageManager) PageSize() int {
+	return ppm.fileManager.PageSize()
+}
+
+// TreeMeta returns the B+ tree metadata recorded in the meta page. The second
+// return value is false if the file did not contain a tree when it was opened.
+func (ppm *PersistentPageManager) TreeMeta() (btree.Meta, bool) {
+	ppm.mu.RLock()
+	defer ppm.mu.RUnlock()
+	return ppm.meta.tree, ppm.hasMeta
+}
+
+// SetTreeMeta records the B+ tree metadata to be written with the meta page.
+func (ppm *PersistentPageManager) SetTreeMeta(meta btree.Meta) {
+	ppm.mu.Lock()
+	defer ppm.mu.Unlock()
+	ppm.meta.tree = meta
+}
+
+// GetMetaPage returns the database metadata page reflecting the current state.
 func (ppm *PersistentPageManager) GetMetaPage() *page.Page {
-	// For simplicity, delegate to memory page manager
-	// In a full implementation, this would be stored in the file
-	return ppm.memoryPageManager.GetMetaPage()
+	ppm.mu.RLock()
+	defer ppm.mu.RUnlock()
+
+	metaPage, err := ppm.buildMetaPage()
+	if err != nil {
+		return nil
+	}
+	return metaPage
+}
+
+// buildMetaPage encodes the current metadata into a fresh meta page.
+func (ppm *PersistentPageManager) buildMetaPage() (*page.Page, error) {
+	metaPage := page.NewPageWithSize(page.InvalidPageID, page.PageTypeMeta, ppm.PageSize())
+	if err := ppm.meta.encode(metaPage, ppm.fileManager.Superblock()); err != nil {
+		return nil, err
+	}
+	return metaPage, nil
 }
 
 // GetFreePageCount returns the number of free pages.
 func (ppm *PersistentPageManager) GetFreePageCount() int {
-	return ppm.memoryPageManager.GetFreePageCount()
+	ppm.mu.RLock()
+	defer ppm.mu.RUnlock()
+	return len(ppm.free)
 }
 
 // GetAllocatedPageCount returns the number of allocated pages.
 func (ppm *PersistentPageManager) GetAllocatedPageCount() int {
 	ppm.mu.RLock()
 	defer ppm.mu.RUnlock()
-	return len(ppm.pageMapping)
+	return int(ppm.meta.nextPageID) - 1 - len(ppm.free)
 }
 
 // GetNextPageID returns the next page ID that would be allocated.
 func (ppm *PersistentPageManager) GetNextPageID() page.PageID {
 	ppm.mu.RLock()
 	defer ppm.mu.RUnlock()
-	return ppm.nextFilePageID
+	return ppm.meta.nextPageID
 }
 
 // GetStatistics returns current page manager statistics.
 func (ppm *PersistentPageManager) GetStatistics() page.Statistics {
 	ppm.mu.RLock()
-	defer ppm.mu.RUnlock()
+	nextPageID := ppm.meta.nextPageID
+	free := maps.Clone(ppm.free)
+	ppm.mu.RUnlock()
 
 	stats := page.Statistics{
-		AllocatedPages: len(ppm.pageMapping),
-		FreePages:      ppm.memoryPageManager.GetFreePageCount(),
-		NextPageID:     ppm.nextFilePageID,
+		AllocatedPages: int(nextPageID) - 1 - len(free),
+		FreePages:      len(free),
+		NextPageID:     nextPageID,
 		PageTypeCounts: make(map[page.PageType]int),
 	}
 
-	// Count page types by reading from file (simplified approach)
-	// In a production implementation, this would be cached
-	for _, filePageID := range ppm.pageMapping {
-		if pg, err := ppm.fileManager.ReadPage(filePageID); err == nil {
+	// Count page types by reading through the buffer pool
+	for id := page.PageID(1); id < nextPageID; id++ {
+		if free[id] {
+			continue
+		}
+		if pg, err := ppm.GetPage(id); err == nil {
 			stats.PageTypeCounts[pg.Type()]++
 		}
 	}
@@ -168,13 +569,35 @@ func (ppm *PersistentPageManager) GetStatistics() page.Statistics {
 	return stats
 }
 
-// Sync ensures all dirty pages are written to persistent storage.
+// Sync writes the meta page and ensures all pages are on stable storage.
 func (ppm *PersistentPageManager) Sync() error {
 	// Flush buffer pool dirty pages
 	if err := ppm.bufferPool.FlushAllPages(); err != nil {
 		return fmt.Errorf("failed to flush buffer pool: %w", err)
 	}
 
+	ppm.mu.Lock()
+	metaPage, err := ppm.buildMetaPage()
+	if err == nil {
+		ppm.hasMeta = true
+		metaPage.SetLSN(ppm.metaLSN)
+	}
+	ppm.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode meta page: %w", err)
+	}
+
+	// WAL rule: the meta page may only be written once its changes are logged
+	if ppm.log != nil {
+		if err := ppm.log.Flush(metaPage.LSN()); err != nil {
+			return fmt.Errorf("failed to flush log: %w", err)
+		}
+	}
+
+	if err := ppm.fileManager.WriteMetaPage(metaPage); err != nil {
+		return fmt.Errorf("failed to write meta page: %w", err)
+	}
+
 	// Sync file manager
 	if err := ppm.fileManager.Sync(); err != nil {
 		return fmt.Errorf("failed to sync file manager: %w", err)
@@ -182,3 +605,10 @@ func (ppm *PersistentPageManager) Sync() error {
 
 	return nil
 }
+
+// ErrUpdateInProgress is returned when an update is started while another
+// one has not finished.
+var ErrUpdateInProgress = errors.New("page update already in progress")
+
+// ErrNoUpdate is returned when a logged page change happens outside an update.
+var ErrNoUpdate = errors.New("no page update in progress")
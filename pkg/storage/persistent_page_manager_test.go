@@ -0,0 +1,482 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/btree"
+	"github.com/thromel/go-database/pkg/storage/buffer"
+	"github.com/thromel/go-database/pkg/storage/file"
+	"github.com/thromel/go-database/pkg/storage/page"
+	"github.com/thromel/go-database/pkg/storage/wal"
+)
+
+// openTestPageManager opens a persistent page manager over the given file.
+func openTestPageManager(t *testing.T, path string, poolSize int) (*PersistentPageManager, *file.FileManager) {
+	t.Helper()
+
+	fm, err := file.NewFileManager(path, file.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+
+	ppm, err := NewPersistentPageManager(fm, buffer.NewBufferPool(poolSize, fm), nil)
+	if err != nil {
+		_ = fm.Close()
+		t.Fatalf("Failed to create page manager: %v", err)
+	}
+
+	return ppm, fm
+}
+
+func TestPersistentPageManager_SyncWritesPages(t *testing.T) {
+	ppm, fm := openTestPageManager(t, filepath.Join(t.TempDir(), "pages.godb"), 4)
+	defer fm.Close()
+
+	pg, err := ppm.AllocatePage(page.PageTypeLeaf)
+	if err != nil {
+		t.Fatalf("Failed to allocate page: %v", err)
+	}
+	if pg.ID() != 1 {
+		t.Errorf("Expected first page ID 1, got %d", pg.ID())
+	}
+
+	copy(pg.Data(), "hello")
+	if err := ppm.WritePage(pg); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	if err := ppm.Sync(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+
+	onDisk, err := fm.ReadPage(pg.ID())
+	if err != nil {
+		t.Fatalf("Failed to read page from file: %v", err)
+	}
+	if string(onDisk.Data()[:5]) != "hello" {
+		t.Errorf("Expected page data on disk, got %q", onDisk.Data()[:5])
+	}
+
+	if err := ppm.WritePage(page.NewPage(page.InvalidPageID, page.PageTypeMeta)); err == nil {
+		t.Error("Expected error writing the meta page as a data page")
+	}
+}
+
+func TestPersistentPageManager_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.godb")
+
+	// A single-frame pool forces every tree page to be re-read from the file
+	ppm, fm := openTestPageManager(t, path, 1)
+	if _, ok := ppm.TreeMeta(); ok {
+		t.Error("Expected no tree metadata in a new file")
+	}
+
+	tree, err := btree.NewBPlusTree(ppm, btree.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create tree: %v", err)
+	}
+
+	const numKeys = 500
+	for i := 0; i < numKeys; i++ {
+		key := []byte(fmt.Sprintf("key-%05d", i))
+		if err := tree.Put(key, []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+
+	ppm.SetTreeMeta(tree.Meta())
+	if err := ppm.Sync(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	nextPageID := ppm.GetNextPageID()
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file: %v", err)
+	}
+
+	ppm, fm = openTestPageManager(t, path, 1)
+	defer fm.Close()
+
+	if ppm.GetNextPageID() != nextPageID {
+		t.Errorf("Expected next page ID %d after reopen, got %d", nextPageID, ppm.GetNextPageID())
+	}
+
+	meta, ok := ppm.TreeMeta()
+	if !ok {
+		t.Fatal("Expected tree metadata after reopen")
+	}
+	if meta != tree.Meta() {
+		t.Errorf("Expected tree metadata %+v, got %+v", tree.Meta(), meta)
+	}
+
+	reopened, err := btree.OpenBPlusTree(ppm, btree.DefaultConfig(), meta)
+	if err != nil {
+		t.Fatalf("Failed to reopen tree: %v", err)
+	}
+
+	for i := 0; i < numKeys; i++ {
+		key := []byte(fmt.Sprintf("key-%05d", i))
+		value, err := reopened.Get(key)
+		if err != nil {
+			t.Fatalf("Failed to get %s after reopen: %v", key, err)
+		}
+		if string(value) != fmt.Sprintf("value-%d", i) {
+			t.Errorf("Unexpected value for %s: %s", key, value)
+		}
+	}
+}
+
+func TestPersistentPageManager_DeallocateReuse(t *testing.T) {
+	ppm, fm := openTestPageManager(t, filepath.Join(t.TempDir(), "free.godb"), 4)
+	defer fm.Close()
+
+	first, err := ppm.AllocatePage(page.PageTypeLeaf)
+	if err != nil {
+		t.Fatalf("Failed to allocate page: %v", err)
+	}
+
+	if err := ppm.DeallocatePage(first.ID()); err != nil {
+		t.Fatalf("Failed to deallocate page: %v", err)
+	}
+	if err := ppm.DeallocatePage(first.ID()); err == nil {
+		t.Error("Expected error on double deallocation")
+	}
+	if err := ppm.DeallocatePage(page.InvalidPageID); err == nil {
+		t.Error("Expected error deallocating the meta page")
+	}
+
+	if ppm.GetFreePageCount() != 1 {
+		t.Errorf("Expected 1 free page, got %d", ppm.GetFreePageCount())
+	}
+
+	second, err := ppm.AllocatePage(page.PageTypeInternal)
+	if err != nil {
+		t.Fatalf("Failed to allocate page: %v", err)
+	}
+	if second.ID() != first.ID() {
+		t.Errorf("Expected page %d to be reused, got %d", first.ID(), second.ID())
+	}
+}
+
+// openLoggedPageManager opens a persistent page manager with a write-ahead log.
+func openLoggedPageManager(t *testing.T) (*PersistentPageManager, *wal.Log) {
+	t.Helper()
+
+	dir := t.TempDir()
+	fm, err := file.NewFileManager(filepath.Join(dir, "logged.godb"), file.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create file manager: %v", err)
+	}
+	t.Cleanup(func() { _ = fm.Close() })
+
+	log, err := wal.Open(filepath.Join(dir, "logged.godb"+wal.DirExtension), nil)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	t.Cleanup(func() { _ = log.Close() })
+
+	bp := buffer.NewBufferPool(4, fm)
+	bp.SetLog(log)
+
+	ppm, err := NewPersistentPageManager(fm, bp, log)
+	if err != nil {
+		t.Fatalf("Failed to create page manager: %v", err)
+	}
+
+	return ppm, log
+}
+
+func TestPersistentPageManager_LoggedUpdate(t *testing.T) {
+	ppm, log := openLoggedPageManager(t)
+
+	pg := page.NewPage(1, page.PageTypeLeaf)
+	if err := ppm.WritePage(pg); err != ErrNoUpdate {
+		t.Errorf("Expected ErrNoUpdate outside an update, got %v", err)
+	}
+
+	if err := ppm.BeginUpdate(); err != nil {
+		t.Fatalf("Failed to begin update: %v", err)
+	}
+	if err := ppm.BeginUpdate(); err != ErrUpdateInProgress {
+		t.Errorf("Expected ErrUpdateInProgress, got %v", err)
+	}
+
+	pg, err := ppm.AllocatePage(page.PageTypeLeaf)
+	if err != nil {
+		t.Fatalf("Failed to allocate page: %v", err)
+	}
+	copy(pg.Data(), "logged")
+	if err := ppm.WritePage(pg); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	if pg.LSN() == 0 {
+		t.Error("Expected page to be stamped with an LSN")
+	}
+
+	commitLSN, err := ppm.CommitUpdate()
+	if err != nil {
+		t.Fatalf("Failed to commit update: %v", err)
+	}
+	if commitLSN <= pg.LSN() {
+		t.Errorf("Expected commit LSN beyond page LSN %d, got %d", pg.LSN(), commitLSN)
+	}
+
+	// Page record, meta record and commit record
+	var types []wal.RecordType
+	if err := log.Scan(func(rec *wal.Record) error {
+		types = append(types, rec.Type)
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to scan log: %v", err)
+	}
+	expected := []wal.RecordType{wal.RecordPage, wal.RecordPage, wal.RecordCommit}
+	if fmt.Sprint(types) != fmt.Sprint(expected) {
+		t.Errorf("Expected records %v, got %v", expected, types)
+	}
+
+	// Writing back the page must first make its log records durable
+	if err := ppm.Sync(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if log.FlushedLSN() < pg.LSN() {
+		t.Errorf("Page written before its log record was durable")
+	}
+}
+
+func TestPersistentPageManager_AbortUpdate(t *testing.T) {
+	ppm, log := openLoggedPageManager(t)
+
+	if err := ppm.BeginUpdate(); err != nil {
+		t.Fatalf("Failed to begin update: %v", err)
+	}
+	pg, err := ppm.AllocatePage(page.PageTypeLeaf)
+	if err != nil {
+		t.Fatalf("Failed to allocate page: %v", err)
+	}
+	copy(pg.Data(), "committed")
+	if err := ppm.WritePage(pg); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	if _, err := ppm.CommitUpdate(); err != nil {
+		t.Fatalf("Failed to commit update: %v", err)
+	}
+	nextPageID := ppm.GetNextPageID()
+
+	if err := ppm.BeginUpdate(); err != nil {
+		t.Fatalf("Failed to begin update: %v", err)
+	}
+	pg, err = ppm.GetPage(pg.ID())
+	if err != nil {
+		t.Fatalf("Failed to get page: %v", err)
+	}
+	copy(pg.Data(), "discarded")
+	if err := ppm.WritePage(pg); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	if _, err := ppm.AllocatePage(page.PageTypeLeaf); err != nil {
+		t.Fatalf("Failed to allocate page: %v", err)
+	}
+
+	if err := ppm.AbortUpdate(); err != nil {
+		t.Fatalf("Failed to abort update: %v", err)
+	}
+
+	if string(pg.Data()[:9]) != "committed" {
+		t.Errorf("Expected page contents to be rolled back, got %q", pg.Data()[:9])
+	}
+	if ppm.GetNextPageID() != nextPageID {
+		t.Errorf("Expected allocation to be rolled back, next page ID %d, want %d", ppm.GetNextPageID(), nextPageID)
+	}
+
+	var last wal.RecordType
+	if err := log.Scan(func(rec *wal.Record) error {
+		last = rec.Type
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to scan log: %v", err)
+	}
+	if last != wal.RecordAbort {
+		t.Errorf("Expected the log to end with an abort record, got %s", last)
+	}
+}
+
+func TestPersistentPageManager_DeallocateInUpdate(t *testing.T) {
+	ppm, _ := openLoggedPageManager(t)
+
+	if err := ppm.BeginUpdate(); err != nil {
+		t.Fatalf("Failed to begin update: %v", err)
+	}
+	pg, err := ppm.AllocatePage(page.PageTypeOverflow)
+	if err != nil {
+		t.Fatalf("Failed to allocate page: %v", err)
+	}
+	if err := ppm.WritePage(pg); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	if _, err := ppm.CommitUpdate(); err != nil {
+		t.Fatalf("Failed to commit update: %v", err)
+	}
+
+	// A page freed by an update is not reused before the update commits
+	if err := ppm.BeginUpdate(); err != nil {
+		t.Fatalf("Failed to begin update: %v", err)
+	}
+	if err := ppm.DeallocatePage(pg.ID()); err != nil {
+		t.Fatalf("Failed to deallocate page: %v", err)
+	}
+	if err := ppm.DeallocatePage(pg.ID()); err == nil {
+		t.Error("Expected an error freeing the page twice")
+	}
+	other, err := ppm.AllocatePage(page.PageTypeLeaf)
+	if err != nil {
+		t.Fatalf("Failed to allocate page: %v", err)
+	}
+	if other.ID() == pg.ID() {
+		t.Error("Expected the freed page not to be reused within the update")
+	}
+	if err := ppm.AbortUpdate(); err != nil {
+		t.Fatalf("Failed to abort update: %v", err)
+	}
+	if n := ppm.GetFreePageCount(); n != 0 {
+		t.Errorf("Expected an aborted free to be dropped, got %d free pages", n)
+	}
+
+	if err := ppm.BeginUpdate(); err != nil {
+		t.Fatalf("Failed to begin update: %v", err)
+	}
+	if err := ppm.DeallocatePage(pg.ID()); err != nil {
+		t.Fatalf("Failed to deallocate page: %v", err)
+	}
+	if _, err := ppm.CommitUpdate(); err != nil {
+		t.Fatalf("Failed to commit update: %v", err)
+	}
+	if n := ppm.GetFreePageCount(); n != 1 {
+		t.Errorf("Expected the page to be free after commit, got %d free pages", n)
+	}
+}
+
+func TestPersistentPageManager_FreeListPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "freelist.godb")
+	ppm, fm := openTestPageManager(t, path, 4)
+
+	// Enough freed pages to need more than one trunk
+	numPages := ppm.trunkCapacity() + 100
+	for i := 0; i < numPages; i++ {
+		pg, err := ppm.AllocatePage(page.PageTypeLeaf)
+		if err != nil {
+			t.Fatalf("Failed to allocate page: %v", err)
+		}
+		if err := ppm.WritePage(pg); err != nil {
+			t.Fatalf("Failed to write page: %v", err)
+		}
+	}
+	for id := page.PageID(1); int(id) <= numPages; id += 2 {
+		if err := ppm.DeallocatePage(id); err != nil {
+			t.Fatalf("Failed to deallocate page %d: %v", id, err)
+		}
+	}
+	freed := ppm.GetFreePageCount()
+	if freed != (numPages+1)/2 {
+		t.Fatalf("Expected %d free pages, got %d", (numPages+1)/2, freed)
+	}
+
+	if err := ppm.Sync(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	nextPageID := ppm.GetNextPageID()
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Failed to close file: %v", err)
+	}
+
+	ppm, fm = openTestPageManager(t, path, 4)
+	defer fm.Close()
+
+	if n := ppm.GetFreePageCount(); n != freed {
+		t.Errorf("Expected %d free pages after reopen, got %d", freed, n)
+	}
+	if stats := ppm.GetStatistics(); stats.FreePages != freed || stats.PageTypeCounts[page.PageTypeFree] != 0 {
+		t.Errorf("Expected free pages to be left out of the page counts, got %+v", stats)
+	}
+
+	// Every freed page, including the trunks, is reused before the file grows
+	reused := make(map[page.PageID]bool)
+	for i := 0; i < freed; i++ {
+		pg, err := ppm.AllocatePage(page.PageTypeOverflow)
+		if err != nil {
+			t.Fatalf("Failed to allocate page: %v", err)
+		}
+		if pg.ID()%2 == 0 || reused[pg.ID()] {
+			t.Fatalf("Expected a distinct freed page, got %d", pg.ID())
+		}
+		reused[pg.ID()] = true
+	}
+	if ppm.GetNextPageID() != nextPageID || ppm.GetFreePageCount() != 0 {
+		t.Errorf("Expected no new pages, got next page %d and %d free", ppm.GetNextPageID(), ppm.GetFreePageCount())
+	}
+
+	pg, err := ppm.AllocatePage(page.PageTypeLeaf)
+	if err != nil {
+		t.Fatalf("Failed to allocate page: %v", err)
+	}
+	if pg.ID() != nextPageID {
+		t.Errorf("Expected a new page once the free list is empty, got %d", pg.ID())
+	}
+}
+
+func TestPersistentPageManager_AbortRestoresFreeList(t *testing.T) {
+	ppm, _ := openLoggedPageManager(t)
+
+	if err := ppm.BeginUpdate(); err != nil {
+		t.Fatalf("Failed to begin update: %v", err)
+	}
+	var ids []page.PageID
+	for i := 0; i < 3; i++ {
+		pg, err := ppm.AllocatePage(page.PageTypeLeaf)
+		if err != nil {
+			t.Fatalf("Failed to allocate page: %v", err)
+		}
+		if err := ppm.WritePage(pg); err != nil {
+			t.Fatalf("Failed to write page: %v", err)
+		}
+		ids = append(ids, pg.ID())
+	}
+	if _, err := ppm.CommitUpdate(); err != nil {
+		t.Fatalf("Failed to commit update: %v", err)
+	}
+
+	if err := ppm.BeginUpdate(); err != nil {
+		t.Fatalf("Failed to begin update: %v", err)
+	}
+	for _, id := range ids {
+		if err := ppm.DeallocatePage(id); err != nil {
+			t.Fatalf("Failed to deallocate page: %v", err)
+		}
+	}
+	if _, err := ppm.CommitUpdate(); err != nil {
+		t.Fatalf("Failed to commit update: %v", err)
+	}
+
+	// Reusing every free page, trunk included, and rolling back leaves the
+	// free list as it was
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := ppm.BeginUpdate(); err != nil {
+			t.Fatalf("Failed to begin update: %v", err)
+		}
+		for range ids {
+			pg, err := ppm.AllocatePage(page.PageTypeInternal)
+			if err != nil {
+				t.Fatalf("Failed to allocate page: %v", err)
+			}
+			if !slices.Contains(ids, pg.ID()) {
+				t.Errorf("Expected a freed page to be reused, got %d", pg.ID())
+			}
+		}
+		if err := ppm.AbortUpdate(); err != nil {
+			t.Fatalf("Failed to abort update: %v", err)
+		}
+		if n := ppm.GetFreePageCount(); n != len(ids) {
+			t.Errorf("Expected %d free pages after abort, got %d", len(ids), n)
+		}
+	}
+}
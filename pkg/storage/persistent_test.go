@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/thromel/go-database/pkg/storage/btree"
 	"github.com/thromel/go-database/pkg/storage/file"
+	"github.com/thromel/go-database/pkg/storage/wal"
 	"github.com/thromel/go-database/pkg/utils"
 )
 
@@ -151,12 +154,42 @@ func TestNewPersistentEngine(t *testing.T) {
 	}
 }
 
+func TestNewPersistentEngine_BufferPoolBytes(t *testing.T) {
+	config := DefaultPersistentConfig()
+	config.FilePath = filepath.Join(t.TempDir(), "test.godb")
+	config.BufferPoolBytes = 1 << 20
+	config.FileConfig.PageSize = 32768
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create persistent engine: %v", err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+
+	// The pool is sized in the file's pages, whatever size is configured
+	config.FileConfig.PageSize = 0
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen persistent engine: %v", err)
+	}
+	defer engine.Close()
+	if size := engine.bufferPool.Size(); size != 32 {
+		t.Errorf("Expected a pool of 32 pages of 32KB, got %d", size)
+	}
+}
+
 func TestNewPersistentEngine_InvalidConfig(t *testing.T) {
 	// Test with nil config (should use defaults)
-	_, err := NewPersistentEngine(nil)
+	engine, err := NewPersistentEngine(nil)
 	if err != nil {
 		// This should succeed with default config, but might fail due to file path
 		t.Logf("Engine creation with nil config failed (expected): %v", err)
+	} else {
+		_ = engine.Close()
+		_ = os.Remove(DefaultPersistentConfig().FilePath)
+		_ = os.RemoveAll(DefaultPersistentConfig().FilePath + wal.DirExtension)
 	}
 
 	// Test with invalid config
@@ -245,7 +278,6 @@ func TestPersistentEngine_BasicOperations(t *testing.T) {
 }
 
 func TestPersistentEngine_MultipleOperations(t *testing.T) {
-	t.Skip("Skipping until full persistence integration is complete")
 	tempDir := t.TempDir()
 	config := DefaultPersistentConfig()
 	config.FilePath = filepath.Join(tempDir, "test.godb")
@@ -476,7 +508,6 @@ func TestPersistentEngine_Statistics(t *testing.T) {
 }
 
 func TestPersistentEngine_Persistence(t *testing.T) {
-	t.Skip("Skipping until full persistence integration is complete")
 	tempDir := t.TempDir()
 	dbPath := filepath.Join(tempDir, "test.godb")
 
@@ -517,6 +548,97 @@ func TestPersistentEngine_Persistence(t *testing.T) {
 	}
 }
 
+func TestPersistentEngine_WriteAheadLog(t *testing.T) {
+	config := DefaultPersistentConfig()
+	config.FilePath = filepath.Join(t.TempDir(), "test.godb")
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create persistent engine: %v", err)
+	}
+	defer engine.Close()
+
+	log := engine.GetWAL()
+	if _, err := os.Stat(config.FilePath + wal.DirExtension); err != nil {
+		t.Errorf("Expected log directory next to the database file: %v", err)
+	}
+
+	if err := engine.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	// SyncOnWrite makes the write durable through the log alone
+	if log.FlushedLSN() != log.EndLSN() || log.EndLSN() == 0 {
+		t.Errorf("Expected log durable to its end, flushed %d, end %d", log.FlushedLSN(), log.EndLSN())
+	}
+
+	records := 0
+	if err := log.Scan(func(*wal.Record) error { records++; return nil }); err != nil {
+		t.Fatalf("Failed to scan log: %v", err)
+	}
+	if records == 0 {
+		t.Error("Expected the write to be logged")
+	}
+
+	// A failed delete must not leave anything behind in the log
+	end := log.EndLSN()
+	if err := engine.Delete([]byte("missing")); err == nil {
+		t.Error("Expected error deleting a missing key")
+	}
+	if log.EndLSN() != end {
+		t.Errorf("Expected no log records for a failed delete")
+	}
+
+	// Once the pages are in the database file the log is discarded
+	if err := engine.Sync(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	records = 0
+	if err := log.Scan(func(*wal.Record) error { records++; return nil }); err != nil {
+		t.Fatalf("Failed to scan log: %v", err)
+	}
+	if records != 0 {
+		t.Errorf("Expected empty log after sync, got %d records", records)
+	}
+}
+
+func TestPersistentEngine_NoSyncOnWrite(t *testing.T) {
+	config := DefaultPersistentConfig()
+	config.FilePath = filepath.Join(t.TempDir(), "test.godb")
+	config.SyncOnWrite = false
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create persistent engine: %v", err)
+	}
+
+	syncs := engine.GetWAL().GetStatistics().Syncs
+	for i := 0; i < 20; i++ {
+		if err := engine.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("value")); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if got := engine.GetWAL().GetStatistics().Syncs; got != syncs {
+		t.Errorf("Expected no log fsyncs without SyncOnWrite, got %d", got-syncs)
+	}
+
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+
+	for i := 0; i < 20; i++ {
+		if _, err := engine.Get([]byte(fmt.Sprintf("key-%d", i))); err != nil {
+			t.Errorf("Failed to get key-%d after reopen: %v", i, err)
+		}
+	}
+}
+
 func TestPersistentEngine_GetComponents(t *testing.T) {
 	tempDir := t.TempDir()
 	config := DefaultPersistentConfig()
@@ -640,3 +762,284 @@ func TestErrorIterator(t *testing.T) {
 	iter.SeekToFirst()
 	iter.SeekToLast()
 }
+
+func TestPersistentEngine_WriteBatch(t *testing.T) {
+	tempDir := t.TempDir()
+	config := DefaultPersistentConfig()
+	config.FilePath = filepath.Join(tempDir, "batch.godb")
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create persistent engine: %v", err)
+	}
+
+	if err := engine.Put([]byte("old"), []byte("value")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	batch := NewWriteBatch()
+	for i := 0; i < 100; i++ {
+		batch.Put([]byte(fmt.Sprintf("key_%03d", i)), []byte("value"))
+	}
+	batch.Delete([]byte("old"))
+	batch.Delete([]byte("missing"))
+
+	if err := engine.Write(batch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// One batch is one logged update
+	commits := 0
+	err = engine.GetWAL().Scan(func(rec *wal.Record) error {
+		if rec.Type == wal.RecordCommit {
+			commits++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan log: %v", err)
+	}
+	if commits != 2 {
+		t.Errorf("Expected 2 committed updates (put and batch), got %d", commits)
+	}
+
+	// A change that fails inside the tree rolls back the whole batch
+	batch.Reset()
+	batch.Put([]byte("new"), []byte("value"))
+	batch.Put([]byte("big"), make([]byte, 16<<20+1))
+	if err := engine.Write(batch); err == nil {
+		t.Error("Expected oversized value to fail the batch")
+	}
+	if exists, _ := engine.Exists([]byte("new")); exists {
+		t.Error("Expected no changes from a failed batch")
+	}
+
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen persistent engine: %v", err)
+	}
+	defer engine.Close()
+
+	if size, _ := engine.Size(); size != 100 {
+		t.Errorf("Expected 100 keys after reopen, got %d", size)
+	}
+}
+
+func TestPersistentEngine_BulkLoad(t *testing.T) {
+	config := DefaultPersistentConfig()
+	config.FilePath = filepath.Join(t.TempDir(), "bulk.godb")
+	config.SyncOnWrite = false
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create persistent engine: %v", err)
+	}
+
+	// Any storage iterator can be loaded from
+	source := NewMemoryEngine()
+	for i := 0; i < 3000; i++ {
+		if err := source.Put(recoveryKey(i), compactValue(i)); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+
+	// A failed load leaves nothing behind
+	pages := engine.GetStats().PageCount
+	long := bytes.Repeat([]byte("z"), 100)
+	if err := source.Put(long, []byte("value")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	it := source.NewIterator(nil, nil)
+	err = engine.BulkLoad(it)
+	it.Close()
+	if !errors.Is(err, utils.ErrKeyTooLarge) {
+		t.Errorf("Expected ErrKeyTooLarge, got %v", err)
+	}
+	if size, _ := engine.Size(); size != 0 || engine.GetStats().PageCount != pages {
+		t.Errorf("Expected a failed load to change nothing, got %d keys", size)
+	}
+
+	if err := source.Delete(long); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	it = source.NewIterator(nil, nil)
+	err = engine.BulkLoad(it)
+	it.Close()
+	if err != nil {
+		t.Fatalf("BulkLoad failed: %v", err)
+	}
+	if writes := engine.GetStats().WriteCount; writes != 3000 {
+		t.Errorf("Expected 3000 writes, got %d", writes)
+	}
+
+	// Loading is only allowed into an empty engine
+	it = source.NewIterator(nil, nil)
+	err = engine.BulkLoad(it)
+	it.Close()
+	if !errors.Is(err, btree.ErrTreeNotEmpty) {
+		t.Errorf("Expected ErrTreeNotEmpty, got %v", err)
+	}
+
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen persistent engine: %v", err)
+	}
+	defer engine.Close()
+
+	for i := 0; i < 3000; i++ {
+		value, err := engine.Get(recoveryKey(i))
+		if err != nil || !bytes.Equal(value, compactValue(i)) {
+			t.Fatalf("Unexpected value for %s: %v", recoveryKey(i), err)
+		}
+	}
+	if err := engine.Put([]byte("new"), []byte("value")); err != nil {
+		t.Errorf("Put after bulk load failed: %v", err)
+	}
+}
+
+func TestPersistentEngine_Iterator(t *testing.T) {
+	tempDir := t.TempDir()
+	config := DefaultPersistentConfig()
+	config.FilePath = filepath.Join(tempDir, "iterator.godb")
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create persistent engine: %v", err)
+	}
+
+	batch := NewWriteBatch()
+	for i := 0; i < 500; i++ {
+		batch.Put([]byte(fmt.Sprintf("user:%03d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	batch.Put([]byte("order:1"), []byte("value"))
+	batch.Put([]byte("user;"), []byte("value"))
+	if err := engine.Write(batch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// Prefix scan
+	iter := engine.NewIterator([]byte("user:"), PrefixEnd([]byte("user:")))
+	count := 0
+	for iter.SeekToFirst(); iter.Valid(); iter.Next() {
+		expected := fmt.Sprintf("user:%03d", count)
+		if string(iter.Key()) != expected {
+			t.Fatalf("Expected %s, got %s", expected, iter.Key())
+		}
+		if string(iter.Value()) != fmt.Sprintf("value-%d", count) {
+			t.Fatalf("Unexpected value %s for %s", iter.Value(), iter.Key())
+		}
+		count++
+
+		// A failed write reopens the tree under the iterator
+		if count == 100 {
+			bad := NewWriteBatch()
+			bad.Put([]byte("big"), make([]byte, 16<<20+1))
+			if err := engine.Write(bad); err == nil {
+				t.Fatal("Expected oversized value to fail the batch")
+			}
+		}
+	}
+	if iter.Error() != nil {
+		t.Fatalf("Iterator error: %v", iter.Error())
+	}
+	if count != 500 {
+		t.Errorf("Expected 500 keys with the prefix, got %d", count)
+	}
+
+	iter.SeekToLast()
+	if string(iter.Key()) != "user:499" {
+		t.Errorf("Expected last key user:499, got %s", iter.Key())
+	}
+	iter.Seek([]byte("user:250"))
+	if string(iter.Key()) != "user:250" {
+		t.Errorf("Expected user:250, got %s", iter.Key())
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatalf("Failed to close iterator: %v", err)
+	}
+	if err := iter.Close(); !errors.Is(err, utils.ErrIteratorClosed) {
+		t.Errorf("Expected ErrIteratorClosed, got %v", err)
+	}
+
+	// Iterators stop working once the engine closes
+	iter = engine.NewIterator(nil, nil)
+	iter.SeekToFirst()
+	if string(iter.Key()) != "order:1" {
+		t.Errorf("Expected first key order:1, got %s", iter.Key())
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+	if iter.Next() || !errors.Is(iter.Error(), utils.ErrDatabaseClosed) {
+		t.Errorf("Expected ErrDatabaseClosed, got %v", iter.Error())
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix, end []byte
+	}{
+		{[]byte("abc"), []byte("abd")},
+		{[]byte{'a', 0xff}, []byte("b")},
+		{[]byte{0xff, 0xff}, nil},
+		{nil, nil},
+	}
+
+	for _, tt := range tests {
+		if end := PrefixEnd(tt.prefix); !bytes.Equal(end, tt.end) {
+			t.Errorf("PrefixEnd(%q) = %q, expected %q", tt.prefix, end, tt.end)
+		}
+	}
+}
+
+func TestPersistentEngine_IteratorPrev(t *testing.T) {
+	tempDir := t.TempDir()
+	config := DefaultPersistentConfig()
+	config.FilePath = filepath.Join(tempDir, "prev.godb")
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create persistent engine: %v", err)
+	}
+	defer engine.Close()
+
+	batch := NewWriteBatch()
+	for i := 0; i < 300; i++ {
+		batch.Put([]byte(fmt.Sprintf("event:%04d", i)), []byte("value"))
+	}
+	batch.Put([]byte("other"), []byte("value"))
+	if err := engine.Write(batch); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// The latest ten events, newest first
+	iter := engine.NewIterator([]byte("event:"), PrefixEnd([]byte("event:")))
+	defer iter.Close()
+
+	var keys []string
+	for iter.SeekToLast(); iter.Valid() && len(keys) < 10; iter.Prev() {
+		keys = append(keys, string(iter.Key()))
+	}
+	if len(keys) != 10 || keys[0] != "event:0299" || keys[9] != "event:0290" {
+		t.Errorf("Expected events 299 down to 290, got %v", keys)
+	}
+
+	count := 0
+	for iter.SeekToLast(); iter.Valid(); iter.Prev() {
+		count++
+	}
+	if iter.Error() != nil {
+		t.Fatalf("Iterator error: %v", iter.Error())
+	}
+	if count != 300 {
+		t.Errorf("Expected 300 events backward, got %d", count)
+	}
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/thromel/go-database/pkg/storage/file"
+	"github.com/thromel/go-database/pkg/storage/page"
+	"github.com/thromel/go-database/pkg/storage/wal"
+)
+
+// RecoveryReport describes the crash recovery performed when the engine opened.
+type RecoveryReport struct {
+	// Performed reports whether the log held records that had to be recovered
+	Performed bool
+
+	// StartLSN and EndLSN delimit the log that was recovered
+	StartLSN uint64
+	EndLSN   uint64
+
+	// RecordsScanned is the number of log records read during analysis
+	RecordsScanned int
+
+	// RecordsRedone is the number of page records replayed
+	RecordsRedone int
+
+	// RecordsSkipped is the number of page records already reflected on disk,
+	// as shown by the page LSN
+	RecordsSkipped int
+
+	// RecordsUndone is the number of page records rolled back
+	RecordsUndone int
+
+	// TransactionsCommitted is the number of transactions found committed
+	TransactionsCommitted int
+
+	// TransactionsAborted is the number of transactions found rolled back
+	TransactionsAborted int
+
+	// TransactionsUndone is the number of incomplete transactions undone
+	TransactionsUndone int
+
+	// PagesWritten is the number of pages written back to the database file
+	PagesWritten int
+
+	// PagesRestored is the number of pages restored from the double-write
+	// file before the log was read, because the crash may have torn them
+	PagesRestored int
+
+	// Duration is how long recovery took
+	Duration time.Duration
+}
+
+// txnState is the outcome of a transaction as seen by analysis.
+type txnState int
+
+const (
+	txnActive txnState = iota
+	txnCommitted
+	txnAborted
+)
+
+// recovery runs ARIES-style analysis, redo and undo passes over the log and
+// brings the database file to a state that contains exactly the committed
+// updates.
+type recovery struct {
+	fileManager *file.FileManager
+	log         *wal.Log
+	report      RecoveryReport
+
+	// records holds the page records of the log in LSN order
+	records []*wal.Record
+
+	// txns maps each transaction to its outcome
+	txns map[uint64]txnState
+
+	// pages caches the pages read and modified during recovery
+	pages map[page.PageID]*page.Page
+}
+
+// recoverDatabase replays the write-ahead log into the database file. On
+// success the file holds every committed update, all changes of incomplete
+// updates are rolled back, and the log is emptied.
+func recoverDatabase(fileManager *file.FileManager, log *wal.Log) (RecoveryReport, error) {
+	start := time.Now()
+
+	r := &recovery{
+		fileManager: fileManager,
+		log:         log,
+		txns:        make(map[uint64]txnState),
+		pages:       make(map[page.PageID]*page.Page),
+	}
+	r.report.PagesRestored = int(fileManager.GetStatistics().PagesRestored)
+
+	if err := r.analyze(); err != nil {
+		return r.report, fmt.Errorf("analysis failed: %w", err)
+	}
+
+	if r.report.RecordsScanned == 0 {
+		return r.report, nil // Clean shutdown; nothing to recover
+	}
+	r.report.Performed = true
+
+	if err := r.redo(); err != nil {
+		return r.report, fmt.Errorf("redo failed: %w", err)
+	}
+
+	if err := r.undo(); err != nil {
+		return r.report, fmt.Errorf("undo failed: %w", err)
+	}
+
+	if err := r.writeBack(); err != nil {
+		return r.report, fmt.Errorf("failed to write recovered pages: %w", err)
+	}
+
+	// Every change the log describes is now in the database file
+	if err := log.Reset(); err != nil {
+		return r.report, fmt.Errorf("failed to reset log: %w", err)
+	}
+
+	r.report.Duration = time.Since(start)
+	return r.report, nil
+}
+
+// analyze scans the log to find the outcome of every transaction and collect
+// the page records to replay.
+func (r *recovery) analyze() error {
+	first := true
+	return r.log.Scan(func(rec *wal.Record) error {
+		r.report.RecordsScanned++
+		if first {
+			r.report.StartLSN = rec.LSN
+			first = false
+		}
+		r.report.EndLSN = rec.LSN
+
+		switch rec.Type {
+		case wal.RecordPage:
+			if _, ok := r.txns[rec.TxnID]; !ok {
+				r.txns[rec.TxnID] = txnActive
+			}
+			r.records = append(r.records, rec)
+		case wal.RecordCommit:
+			r.txns[rec.TxnID] = txnCommitted
+			r.report.TransactionsCommitted++
+		case wal.RecordAbort:
+			r.txns[rec.TxnID] = txnAborted
+			r.report.TransactionsAborted++
+		}
+
+		return nil
+	})
+}
+
+// redo repeats history: every page record not yet reflected in its page is
+// applied, including those of transactions that will be undone.
+func (r *recovery) redo() error {
+	for _, rec := range r.records {
+		pg, err := r.page(rec.PageID, rec.PageType)
+		if err != nil {
+			return err
+		}
+
+		if pg.LSN() >= rec.LSN {
+			r.report.RecordsSkipped++
+			continue
+		}
+
+		image := pg.Image()
+		if err := rec.Redo(image); err != nil {
+			return fmt.Errorf("page %d at LSN %d: %w", rec.PageID, rec.LSN, err)
+		}
+		if err := pg.SetImage(image); err != nil {
+			return err
+		}
+		pg.SetLSN(rec.LSN)
+		r.report.RecordsRedone++
+	}
+
+	return nil
+}
+
+// undo rolls back the page records of transactions that neither committed nor
+// aborted, newest first. Before-images are absolute, so running undo again
+// after a crash during recovery yields the same result.
+func (r *recovery) undo() error {
+	losers := make(map[uint64]bool)
+	for txnID, state := range r.txns {
+		if state == txnActive {
+			losers[txnID] = true
+		}
+	}
+	r.report.TransactionsUndone = len(losers)
+
+	for i := len(r.records) - 1; i >= 0; i-- {
+		rec := r.records[i]
+		if !losers[rec.TxnID] {
+			continue
+		}
+
+		pg, err := r.page(rec.PageID, rec.PageType)
+		if err != nil {
+			return err
+		}
+
+		image := pg.Image()
+		if err := rec.Undo(image); err != nil {
+			return fmt.Errorf("page %d at LSN %d: %w", rec.PageID, rec.LSN, err)
+		}
+		if err := pg.SetImage(image); err != nil {
+			return err
+		}
+		r.report.RecordsUndone++
+	}
+
+	return nil
+}
+
+// writeBack writes every page touched by recovery and syncs the file.
+func (r *recovery) writeBack() error {
+	ids := make([]page.PageID, 0, len(r.pages))
+	for id := range r.pages {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		pg := r.pages[id]
+
+		var err error
+		if id == page.InvalidPageID {
+			err = r.fileManager.WriteMetaPage(pg)
+		} else {
+			err = r.fileManager.WritePage(pg)
+		}
+		if err != nil {
+			return err
+		}
+		r.report.PagesWritten++
+	}
+
+	return r.fileManager.Sync()
+}
+
+// page returns the cached copy of a page, reading it from the file on first
+// use. Pages that were never written start out empty.
+func (r *recovery) page(pageID page.PageID, pageType page.PageType) (*page.Page, error) {
+	if pg, ok := r.pages[pageID]; ok {
+		return pg, nil
+	}
+
+	var pg *page.Page
+	var err error
+	if int64(pageID) < r.fileManager.GetPageCount() {
+		if pageID == page.InvalidPageID {
+			pg, err = r.fileManager.ReadMetaPage()
+		} else {
+			pg, err = r.fileManager.ReadPage(pageID)
+		}
+	} else {
+		err = file.ErrUninitializedPage
+	}
+
+	switch {
+	case errors.Is(err, file.ErrUninitializedPage):
+		pg = page.NewPageWithSize(pageID, pageType, r.fileManager.PageSize())
+	case err != nil:
+		return nil, fmt.Errorf("page %d cannot be recovered: %w", pageID, err)
+	}
+
+	r.pages[pageID] = pg
+	return pg, nil
+}
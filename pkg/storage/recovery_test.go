@@ -0,0 +1,547 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/file"
+	"github.com/thromel/go-database/pkg/storage/page"
+	"github.com/thromel/go-database/pkg/storage/wal"
+)
+
+// simulateCrash abandons an engine as if its process had died: no pages are
+// flushed and the log is not emptied. Only the file handles are released so
+// the database can be reopened.
+func simulateCrash(pe *PersistentEngine) {
+	pe.closed.Store(true)
+	_ = pe.wal.Close()
+	_ = pe.fileManager.Close()
+}
+
+// recoveryTestConfig returns an engine configuration for crash tests.
+func recoveryTestConfig(t *testing.T) *PersistentConfig {
+	config := DefaultPersistentConfig()
+	config.FilePath = filepath.Join(t.TempDir(), "recovery.godb")
+	config.FileConfig.SyncWrites = false
+	return config
+}
+
+// recoveryKey returns the i-th key used by the recovery tests.
+func recoveryKey(i int) []byte {
+	return []byte(fmt.Sprintf("key-%05d", i))
+}
+
+func TestRecovery_CleanOpen(t *testing.T) {
+	config := recoveryTestConfig(t)
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	if err := engine.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+
+	if report := engine.RecoveryReport(); report.Performed {
+		t.Errorf("Expected no recovery after a clean close, got %+v", report)
+	}
+}
+
+func TestRecovery_RedoCommitted(t *testing.T) {
+	config := recoveryTestConfig(t)
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	const numKeys = 300
+	for i := 0; i < numKeys; i++ {
+		if err := engine.Put(recoveryKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if err := engine.Delete(recoveryKey(0)); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	// The tree pages only exist in the buffer pool and the log
+	simulateCrash(engine)
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+
+	report := engine.RecoveryReport()
+	if !report.Performed || report.RecordsRedone == 0 {
+		t.Errorf("Expected records to be redone, got %+v", report)
+	}
+	if report.TransactionsCommitted != numKeys+1 {
+		t.Errorf("Expected %d committed transactions, got %d", numKeys+1, report.TransactionsCommitted)
+	}
+	if report.TransactionsUndone != 0 {
+		t.Errorf("Expected no transactions to undo, got %d", report.TransactionsUndone)
+	}
+
+	if _, err := engine.Get(recoveryKey(0)); err == nil {
+		t.Error("Expected deleted key to stay deleted after recovery")
+	}
+	for i := 1; i < numKeys; i++ {
+		value, err := engine.Get(recoveryKey(i))
+		if err != nil {
+			t.Fatalf("Failed to get %s after recovery: %v", recoveryKey(i), err)
+		}
+		if string(value) != fmt.Sprintf("value-%d", i) {
+			t.Errorf("Unexpected value for %s: %s", recoveryKey(i), value)
+		}
+	}
+
+	if size, _ := engine.Size(); size != numKeys-1 {
+		t.Errorf("Expected %d keys after recovery, got %d", numKeys-1, size)
+	}
+
+	records := 0
+	if err := engine.GetWAL().Scan(func(*wal.Record) error { records++; return nil }); err != nil {
+		t.Fatalf("Failed to scan log: %v", err)
+	}
+	if records != 0 {
+		t.Errorf("Expected the log to be emptied by recovery, got %d records", records)
+	}
+}
+
+func TestRecovery_SkipsAppliedRecords(t *testing.T) {
+	config := recoveryTestConfig(t)
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := engine.Put(recoveryKey(i), []byte("value")); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	// Write the tree pages back, but not the meta page, then crash
+	if err := engine.GetBufferPool().FlushAllPages(); err != nil {
+		t.Fatalf("Failed to flush buffer pool: %v", err)
+	}
+	simulateCrash(engine)
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+
+	report := engine.RecoveryReport()
+	if report.RecordsSkipped == 0 {
+		t.Errorf("Expected records already on disk to be skipped, got %+v", report)
+	}
+	if report.RecordsRedone == 0 {
+		t.Errorf("Expected the meta page changes to be redone, got %+v", report)
+	}
+
+	for i := 0; i < 100; i++ {
+		if _, err := engine.Get(recoveryKey(i)); err != nil {
+			t.Errorf("Failed to get %s after recovery: %v", recoveryKey(i), err)
+		}
+	}
+}
+
+func TestRecovery_UndoIncompleteUpdate(t *testing.T) {
+	config := recoveryTestConfig(t)
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	const committed = 40
+	for i := 0; i < committed; i++ {
+		if err := engine.Put(recoveryKey(i), []byte("committed")); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	pagesBefore := engine.pageManager.GetAllocatedPageCount()
+
+	// Start an update that splits many pages, and
+	// crash before it commits, after its pages reached the database file
+	engine.mu.Lock()
+	if err := engine.pageManager.BeginUpdate(); err != nil {
+		t.Fatalf("Failed to begin update: %v", err)
+	}
+	for i := committed; i < committed+3000; i++ {
+		if err := engine.btree.Put(recoveryKey(i), []byte("uncommitted")); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if engine.pageManager.GetAllocatedPageCount() < pagesBefore+10 {
+		t.Fatal("Expected the incomplete update to split many pages")
+	}
+	if err := engine.wal.Flush(engine.wal.EndLSN()); err != nil {
+		t.Fatalf("Failed to flush log: %v", err)
+	}
+	if err := engine.bufferPool.FlushAllPages(); err != nil {
+		t.Fatalf("Failed to flush buffer pool: %v", err)
+	}
+	engine.mu.Unlock()
+	simulateCrash(engine)
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+
+	report := engine.RecoveryReport()
+	if report.TransactionsUndone != 1 || report.RecordsUndone == 0 {
+		t.Errorf("Expected one transaction to be undone, got %+v", report)
+	}
+
+	if size, _ := engine.Size(); size != committed {
+		t.Errorf("Expected %d keys after undo, got %d", committed, size)
+	}
+	for i := 0; i < committed; i++ {
+		value, err := engine.Get(recoveryKey(i))
+		if err != nil || string(value) != "committed" {
+			t.Errorf("Expected committed value for %s, got %q (%v)", recoveryKey(i), value, err)
+		}
+	}
+	if _, err := engine.Get(recoveryKey(committed)); err == nil {
+		t.Error("Expected uncommitted key to be rolled back")
+	}
+
+	// The recovered tree must accept further writes and reopen cleanly
+	for i := committed; i < committed+100; i++ {
+		if err := engine.Put(recoveryKey(i), []byte("after")); err != nil {
+			t.Fatalf("Failed to put after recovery: %v", err)
+		}
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+
+	if size, _ := engine.Size(); size != committed+100 {
+		t.Errorf("Expected %d keys, got %d", committed+100, size)
+	}
+}
+
+func TestRecovery_Checkpoint(t *testing.T) {
+	config := recoveryTestConfig(t)
+	config.CheckpointSize = 64 * 1024
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for i := 0; i < 500; i++ {
+		if err := engine.Put(recoveryKey(i), []byte("value")); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+		if size := engine.GetWAL().Size(); size > config.CheckpointSize+wal.MaxRecordSize*4 {
+			t.Fatalf("Log grew to %d bytes despite checkpoints", size)
+		}
+	}
+}
+
+func TestRecovery_OverflowValues(t *testing.T) {
+	config := recoveryTestConfig(t)
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	large := func(seed byte, n int) []byte {
+		return bytes.Repeat([]byte{seed, seed + 1, seed + 2}, n/3)
+	}
+
+	if err := engine.Put([]byte("kept"), large(1, 300_000)); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := engine.Put([]byte("replaced"), large(2, 100_000)); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := engine.Put([]byte("replaced"), large(3, 50_000)); err != nil {
+		t.Fatalf("Failed to overwrite: %v", err)
+	}
+	if err := engine.Put([]byte("deleted"), large(4, 20_000)); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := engine.Delete([]byte("deleted")); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	// Reuses the pages freed by the overwrite and the delete
+	if err := engine.Put([]byte("reused"), large(5, 120_000)); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	simulateCrash(engine)
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+
+	expected := map[string][]byte{
+		"kept":     large(1, 300_000),
+		"replaced": large(3, 50_000),
+		"reused":   large(5, 120_000),
+	}
+	for key, want := range expected {
+		value, err := engine.Get([]byte(key))
+		if err != nil {
+			t.Fatalf("Failed to get %s after recovery: %v", key, err)
+		}
+		if !bytes.Equal(value, want) {
+			t.Errorf("Value of %s did not survive recovery (got %d bytes, want %d)", key, len(value), len(want))
+		}
+	}
+	if _, err := engine.Get([]byte("deleted")); err == nil {
+		t.Error("Expected deleted key to stay deleted after recovery")
+	}
+}
+
+func TestRecovery_FreeList(t *testing.T) {
+	config := recoveryTestConfig(t)
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	value := bytes.Repeat([]byte("free"), 25_000)
+	for i := 0; i < 3; i++ {
+		if err := engine.Put(recoveryKey(i), value); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := engine.Delete(recoveryKey(i)); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+	}
+	free := engine.pageManager.GetFreePageCount()
+	if free < 3*len(value)/page.PageSize {
+		t.Fatalf("Expected the overflow pages to be free, got %d free pages", free)
+	}
+
+	// Start an update that reuses the free pages, and crash before it
+	// commits, after its pages reached the database file
+	engine.mu.Lock()
+	if err := engine.pageManager.BeginUpdate(); err != nil {
+		t.Fatalf("Failed to begin update: %v", err)
+	}
+	if err := engine.btree.Put(recoveryKey(9), value); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if engine.pageManager.GetFreePageCount() >= free {
+		t.Fatal("Expected the incomplete update to reuse free pages")
+	}
+	if err := engine.wal.Flush(engine.wal.EndLSN()); err != nil {
+		t.Fatalf("Failed to flush log: %v", err)
+	}
+	if err := engine.bufferPool.FlushAllPages(); err != nil {
+		t.Fatalf("Failed to flush buffer pool: %v", err)
+	}
+	engine.mu.Unlock()
+	simulateCrash(engine)
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+
+	if n := engine.pageManager.GetFreePageCount(); n != free {
+		t.Errorf("Expected %d free pages after recovery, got %d", free, n)
+	}
+
+	// The recovered free list is reused rather than growing the file
+	nextPageID := engine.pageManager.GetNextPageID()
+	if err := engine.Put(recoveryKey(9), value); err != nil {
+		t.Fatalf("Failed to put after recovery: %v", err)
+	}
+	if engine.pageManager.GetNextPageID() != nextPageID {
+		t.Errorf("Expected free pages to be reused, but the file grew to %d pages", engine.pageManager.GetNextPageID())
+	}
+}
+
+func TestRecovery_PageSizes(t *testing.T) {
+	for _, size := range []int{4096, page.MaxPageSize} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			config := recoveryTestConfig(t)
+			config.FileConfig.PageSize = size
+
+			engine, err := NewPersistentEngine(config)
+			if err != nil {
+				t.Fatalf("Failed to create engine: %v", err)
+			}
+
+			// Values of several pages, and deletes that free pages, in a
+			// log that only recovery can bring into the file
+			value := func(i int) []byte {
+				if i%50 == 0 {
+					return bytes.Repeat([]byte{byte(i)}, 3*size)
+				}
+				return []byte(fmt.Sprintf("value-%d", i))
+			}
+			const numKeys = 1000
+			for i := 0; i < numKeys; i++ {
+				if err := engine.Put(recoveryKey(i), value(i)); err != nil {
+					t.Fatalf("Failed to put: %v", err)
+				}
+			}
+			for i := 0; i < numKeys; i += 3 {
+				if err := engine.Delete(recoveryKey(i)); err != nil {
+					t.Fatalf("Failed to delete: %v", err)
+				}
+			}
+			simulateCrash(engine)
+
+			// The file's page size is used when none is configured
+			config.FileConfig.PageSize = 0
+			engine, err = NewPersistentEngine(config)
+			if err != nil {
+				t.Fatalf("Failed to reopen engine: %v", err)
+			}
+			defer engine.Close()
+
+			if engine.GetFileManager().PageSize() != size {
+				t.Errorf("Expected %d-byte pages, got %d", size, engine.GetFileManager().PageSize())
+			}
+			if report := engine.RecoveryReport(); !report.Performed || report.RecordsRedone == 0 {
+				t.Errorf("Expected records to be redone, got %+v", report)
+			}
+
+			want := make(map[string]string)
+			for i := 0; i < numKeys; i++ {
+				if i%3 != 0 {
+					want[string(recoveryKey(i))] = string(value(i))
+				}
+			}
+			got := engineContents(t, engine)
+			if len(got) != len(want) {
+				t.Fatalf("Expected %d keys after recovery, got %d", len(want), len(got))
+			}
+			for key, value := range want {
+				if got[key] != value {
+					t.Fatalf("Unexpected value for %s after recovery", key)
+				}
+			}
+
+			// Compaction and backups keep the page size
+			if _, err := engine.Compact(context.Background(), nil); err != nil {
+				t.Fatalf("Failed to compact: %v", err)
+			}
+			var backup bytes.Buffer
+			manifest, err := engine.Backup(context.Background(), &backup)
+			if err != nil {
+				t.Fatalf("Failed to back up: %v", err)
+			}
+			if manifest.PageSize != size {
+				t.Errorf("Expected a backup of %d-byte pages, got %d", size, manifest.PageSize)
+			}
+			checkRestore(t, want, &backup)
+		})
+	}
+}
+
+func TestRecovery_TornPageWrites(t *testing.T) {
+	config := recoveryTestConfig(t)
+	config.FileConfig.DoubleWrite = true
+
+	engine, err := NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	const numKeys = 2000
+	for i := 0; i < numKeys; i++ {
+		if err := engine.Put(recoveryKey(i), []byte(fmt.Sprintf("value-%d", i))); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if err := engine.Sync(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	before, err := os.ReadFile(config.FilePath)
+	if err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+
+	// Rewrite every key, and crash right after the pages reach the file
+	for i := 0; i < numKeys; i++ {
+		if err := engine.Put(recoveryKey(i), []byte(fmt.Sprintf("updated-%d", i))); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if err := engine.bufferPool.FlushAllPages(); err != nil {
+		t.Fatalf("Failed to flush pages: %v", err)
+	}
+	simulateCrash(engine)
+
+	// Only the first 4KB of each page written made it to disk
+	after, err := os.ReadFile(config.FilePath)
+	if err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+	torn := 0
+	for offset := page.PageSize; offset+page.PageSize <= min(len(before), len(after)); offset += page.PageSize {
+		half := after[offset+4096 : offset+page.PageSize]
+		if !bytes.Equal(half, before[offset+4096:offset+page.PageSize]) {
+			copy(half, before[offset+4096:])
+			torn++
+		}
+	}
+	if torn == 0 {
+		t.Fatal("Expected the crash to tear pages")
+	}
+	if err := os.WriteFile(config.FilePath, after, file.DefaultFileMode); err != nil {
+		t.Fatalf("Failed to write database file: %v", err)
+	}
+
+	engine, err = NewPersistentEngine(config)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+
+	if report := engine.RecoveryReport(); report.PagesRestored != torn {
+		t.Errorf("Expected %d torn pages restored, got %+v", torn, report)
+	}
+	got := engineContents(t, engine)
+	if len(got) != numKeys {
+		t.Fatalf("Expected %d keys after recovery, got %d", numKeys, len(got))
+	}
+	for i := 0; i < numKeys; i++ {
+		if want := fmt.Sprintf("updated-%d", i); got[string(recoveryKey(i))] != want {
+			t.Fatalf("Expected %s for %s after recovery, got %s", want, recoveryKey(i), got[string(recoveryKey(i))])
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// RecordType identifies the kind of a log record.
+type RecordType uint8
+
+const (
+	// RecordPage describes a change to a byte range of a page image.
+	RecordPage RecordType = iota + 1
+
+	// RecordCommit marks the end of a transaction whose changes must survive.
+	RecordCommit
+
+	// RecordAbort marks the end of a transaction whose changes were rolled back.
+	RecordAbort
+)
+
+// String returns a string representation of the record type.
+func (rt RecordType) String() string {
+	switch rt {
+	case RecordPage:
+		return "Page"
+	case RecordCommit:
+		return "Commit"
+	case RecordAbort:
+		return "Abort"
+	default:
+		return fmt.Sprintf("Unknown(%d)", rt)
+	}
+}
+
+// Record encoding layout. Every record starts with a fixed frame header:
+//
+//	length (4) | crc32 of body (4)
+//
+// followed by a body of `length` bytes:
+//
+//	type (1) | txnID (8) | [page payload]
+//
+// Page records carry the payload:
+//
+//	pageID (4) | pageType (1) | offset (2) | length (2) | before | after
+//
+// where the offset is within the page image (see page.Page.Image).
+const (
+	frameHeaderSize   = 8
+	bodyHeaderSize    = 9
+	pagePayloadHeader = 9
+
+	// pageRecordOverhead is the size of a page record besides its images
+	pageRecordOverhead = frameHeaderSize + bodyHeaderSize + pagePayloadHeader
+
+	// MaxRecordSize is the largest encoded record the log accepts.
+	MaxRecordSize = pageRecordOverhead + 2*page.MaxImageSize
+)
+
+// Record is a single entry in the write-ahead log.
+type Record struct {
+	// LSN is the log position just past the end of this record. It is
+	// assigned by Append and filled in when records are read back.
+	LSN uint64
+
+	// Type is the kind of record.
+	Type RecordType
+
+	// TxnID identifies the transaction that wrote the record.
+	TxnID uint64
+
+	// PageID is the page changed by a page record.
+	PageID page.PageID
+
+	// PageType is the type of the page after the change.
+	PageType page.PageType
+
+	// Offset is where the changed range starts within the page image.
+	Offset int
+
+	// Before holds the bytes of the range before the change (for undo).
+	Before []byte
+
+	// After holds the bytes of the range after the change (for redo).
+	After []byte
+}
+
+// NewPageRecord builds a page record from the before and after images of a
+// page, trimmed to the range of bytes that actually differ. It returns nil
+// if the images are identical.
+func NewPageRecord(txnID uint64, pageID page.PageID, pageType page.PageType, before, after []byte) *Record {
+	if len(before) != len(after) {
+		return nil
+	}
+
+	start := 0
+	for start < len(after) && before[start] == after[start] {
+		start++
+	}
+	if start == len(after) {
+		return nil // Nothing changed
+	}
+
+	end := len(after)
+	for end > start && before[end-1] == after[end-1] {
+		end--
+	}
+
+	return &Record{
+		Type:     RecordPage,
+		TxnID:    txnID,
+		PageID:   pageID,
+		PageType: pageType,
+		Offset:   start,
+		Before:   append([]byte(nil), before[start:end]...),
+		After:    append([]byte(nil), after[start:end]...),
+	}
+}
+
+// NewPageRecords is like NewPageRecord, but builds separate records for
+// changed ranges that are far enough apart that logging the unchanged bytes
+// between them would cost more than another record. A change to a slotted
+// page typically touches its header, a cell and the slot directory. It
+// returns nil if the images are identical.
+func NewPageRecords(txnID uint64, pageID page.PageID, pageType page.PageType, before, after []byte) []*Record {
+	if len(before) != len(after) {
+		return nil
+	}
+
+	var records []*Record
+	for start := 0; ; {
+		for start < len(after) && before[start] == after[start] {
+			start++
+		}
+		if start == len(after) {
+			return records
+		}
+
+		// Extend the range past short runs of unchanged bytes
+		end := start
+		for i := start; i < len(after) && 2*(i-end) <= pageRecordOverhead; i++ {
+			if before[i] != after[i] {
+				end = i + 1
+			}
+		}
+
+		records = append(records, &Record{
+			Type:     RecordPage,
+			TxnID:    txnID,
+			PageID:   pageID,
+			PageType: pageType,
+			Offset:   start,
+			Before:   append([]byte(nil), before[start:end]...),
+			After:    append([]byte(nil), after[start:end]...),
+		})
+		start = end
+	}
+}
+
+// NewFullPageRecord builds a page record covering the whole page image, so
+// that redo does not depend on what the page held before.
+func NewFullPageRecord(txnID uint64, pageID page.PageID, pageType page.PageType, before, after []byte) *Record {
+	if len(before) != len(after) {
+		return nil
+	}
+
+	return &Record{
+		Type:     RecordPage,
+		TxnID:    txnID,
+		PageID:   pageID,
+		PageType: pageType,
+		Offset:   0,
+		Before:   append([]byte(nil), before...),
+		After:    append([]byte(nil), after...),
+	}
+}
+
+// Redo applies the record's after image to a page image.
+func (r *Record) Redo(image []byte) error {
+	return r.apply(image, r.After)
+}
+
+// Undo applies the record's before image to a page image.
+func (r *Record) Undo(image []byte) error {
+	return r.apply(image, r.Before)
+}
+
+// apply copies the bytes of the changed range into a page image.
+func (r *Record) apply(image, bytes []byte) error {
+	if r.Type != RecordPage {
+		return fmt.Errorf("%w: %s record has no page image", ErrInvalidRecord, r.Type)
+	}
+	if r.Offset < 0 || r.Offset+len(bytes) > len(image) {
+		return fmt.Errorf("%w: range [%d, %d) outside page image", ErrInvalidRecord, r.Offset, r.Offset+len(bytes))
+	}
+
+	copy(image[r.Offset:], bytes)
+	return nil
+}
+
+// encodedSize returns the number of bytes the record occupies in the log.
+func (r *Record) encodedSize() int {
+	size := frameHeaderSize + bodyHeaderSize
+	if r.Type == RecordPage {
+		size += pagePayloadHeader + len(r.Before) + len(r.After)
+	}
+	return size
+}
+
+// encode serializes the record including its frame header.
+func (r *Record) encode() ([]byte, error) {
+	switch r.Type {
+	case RecordPage:
+		if len(r.Before) != len(r.After) {
+			return nil, fmt.Errorf("%w: before and after images differ in length", ErrInvalidRecord)
+		}
+		if r.Offset < 0 || r.Offset+len(r.After) > page.MaxImageSize {
+			return nil, fmt.Errorf("%w: range outside page image", ErrInvalidRecord)
+		}
+	case RecordCommit, RecordAbort:
+	default:
+		return nil, fmt.Errorf("%w: unknown type %d", ErrInvalidRecord, r.Type)
+	}
+
+	buf := make([]byte, r.encodedSize())
+	body := buf[frameHeaderSize:]
+
+	body[0] = byte(r.Type)
+	binary.LittleEndian.PutUint64(body[1:9], r.TxnID)
+
+	if r.Type == RecordPage {
+		payload := body[bodyHeaderSize:]
+		binary.LittleEndian.PutUint32(payload[0:4], uint32(r.PageID))
+		payload[4] = byte(r.PageType)
+		binary.LittleEndian.PutUint16(payload[5:7], uint16(r.Offset))     // #nosec G115 - bounded by page size above
+		binary.LittleEndian.PutUint16(payload[7:9], uint16(len(r.After))) // #nosec G115 - bounded by page size above
+		n := copy(payload[pagePayloadHeader:], r.Before)
+		copy(payload[pagePayloadHeader+n:], r.After)
+	}
+
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(body))) // #nosec G115 - bounded by MaxRecordSize
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(body))
+
+	return buf, nil
+}
+
+// decodeRecord parses a record body whose checksum has already been verified.
+func decodeRecord(body []byte) (*Record, error) {
+	if len(body) < bodyHeaderSize {
+		return nil, fmt.Errorf("%w: body too short", ErrInvalidRecord)
+	}
+
+	r := &Record{
+		Type:  RecordType(body[0]),
+		TxnID: binary.LittleEndian.Uint64(body[1:9]),
+	}
+
+	switch r.Type {
+	case RecordPage:
+		payload := body[bodyHeaderSize:]
+		if len(payload) < pagePayloadHeader {
+			return nil, fmt.Errorf("%w: page payload too short", ErrInvalidRecord)
+		}
+
+		r.PageID = page.PageID(binary.LittleEndian.Uint32(payload[0:4]))
+		r.PageType = page.PageType(payload[4])
+		r.Offset = int(binary.LittleEndian.Uint16(payload[5:7]))
+		n := int(binary.LittleEndian.Uint16(payload[7:9]))
+
+		images := payload[pagePayloadHeader:]
+		if len(images) != 2*n {
+			return nil, fmt.Errorf("%w: image length mismatch", ErrInvalidRecord)
+		}
+		r.Before = append([]byte(nil), images[:n]...)
+		r.After = append([]byte(nil), images[n:]...)
+	case RecordCommit, RecordAbort:
+		if len(body) != bodyHeaderSize {
+			return nil, fmt.Errorf("%w: unexpected payload", ErrInvalidRecord)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown type %d", ErrInvalidRecord, r.Type)
+	}
+
+	return r, nil
+}
+
+// ErrInvalidRecord indicates a malformed log record.
+var ErrInvalidRecord = errors.New("invalid log record")
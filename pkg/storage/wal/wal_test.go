@@ -0,0 +1,341 @@
+package wal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage/page"
+)
+
+// testPageRecord builds a small page record for tests.
+func testPageRecord(txnID uint64, pageID page.PageID, fill byte) *Record {
+	before := make([]byte, 64)
+	after := make([]byte, 64)
+	for i := 10; i < 20; i++ {
+		after[i] = fill
+	}
+	return NewPageRecord(txnID, pageID, page.PageTypeLeaf, before, after)
+}
+
+// collectRecords returns every record in the log.
+func collectRecords(t *testing.T, l *Log) []*Record {
+	t.Helper()
+
+	var records []*Record
+	err := l.Scan(func(rec *Record) error {
+		records = append(records, rec)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan log: %v", err)
+	}
+	return records
+}
+
+func TestNewPageRecord(t *testing.T) {
+	before := []byte{1, 2, 3, 4, 5, 6}
+	after := []byte{1, 2, 9, 9, 5, 6}
+
+	rec := NewPageRecord(7, 3, page.PageTypeLeaf, before, after)
+	if rec == nil {
+		t.Fatal("Expected a record for differing images")
+	}
+	if rec.Offset != 2 || !bytes.Equal(rec.After, []byte{9, 9}) || !bytes.Equal(rec.Before, []byte{3, 4}) {
+		t.Errorf("Expected trimmed range at offset 2, got offset %d before %v after %v", rec.Offset, rec.Before, rec.After)
+	}
+
+	data := append([]byte(nil), before...)
+	if err := rec.Redo(data); err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+	if !bytes.Equal(data, after) {
+		t.Errorf("Expected redo to produce %v, got %v", after, data)
+	}
+	if err := rec.Undo(data); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if !bytes.Equal(data, before) {
+		t.Errorf("Expected undo to produce %v, got %v", before, data)
+	}
+
+	if NewPageRecord(7, 3, page.PageTypeLeaf, before, before) != nil {
+		t.Error("Expected no record for identical images")
+	}
+}
+
+func TestNewPageRecords(t *testing.T) {
+	before := make([]byte, 200)
+	after := append([]byte(nil), before...)
+	after[1], after[3] = 1, 1 // Close together: one range
+	after[100] = 1            // Far from the others: a separate range
+	after[199] = 1
+
+	records := NewPageRecords(7, 3, page.PageTypeLeaf, before, after)
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	if records[0].Offset != 1 || len(records[0].After) != 3 || records[1].Offset != 100 || records[2].Offset != 199 {
+		t.Errorf("Unexpected ranges: [%d +%d] [%d +%d] [%d +%d]",
+			records[0].Offset, len(records[0].After), records[1].Offset, len(records[1].After), records[2].Offset, len(records[2].After))
+	}
+
+	data := append([]byte(nil), before...)
+	for _, rec := range records {
+		if err := rec.Redo(data); err != nil {
+			t.Fatalf("Redo failed: %v", err)
+		}
+	}
+	if !bytes.Equal(data, after) {
+		t.Error("Expected the records together to redo the change")
+	}
+
+	if NewPageRecords(7, 3, page.PageTypeLeaf, before, before) != nil {
+		t.Error("Expected no records for identical images")
+	}
+}
+
+func TestLog_AppendScan(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "test.wal")
+
+	l, err := Open(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+
+	pageLSN, err := l.Append(testPageRecord(1, 5, 0xAB))
+	if err != nil {
+		t.Fatalf("Failed to append page record: %v", err)
+	}
+	commitLSN, err := l.Append(&Record{Type: RecordCommit, TxnID: 1})
+	if err != nil {
+		t.Fatalf("Failed to append commit record: %v", err)
+	}
+	if commitLSN <= pageLSN || l.EndLSN() != commitLSN {
+		t.Errorf("Expected increasing LSNs, got %d then %d (end %d)", pageLSN, commitLSN, l.EndLSN())
+	}
+
+	if err := l.Flush(commitLSN); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if l.FlushedLSN() != commitLSN {
+		t.Errorf("Expected flushed LSN %d, got %d", commitLSN, l.FlushedLSN())
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Failed to close log: %v", err)
+	}
+
+	l, err = Open(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen log: %v", err)
+	}
+	defer l.Close()
+
+	if l.EndLSN() != commitLSN {
+		t.Errorf("Expected end LSN %d after reopen, got %d", commitLSN, l.EndLSN())
+	}
+
+	records := collectRecords(t, l)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].Type != RecordPage || records[0].PageID != 5 || records[0].LSN != pageLSN {
+		t.Errorf("Unexpected first record: %+v", records[0])
+	}
+	if records[1].Type != RecordCommit || records[1].TxnID != 1 || records[1].LSN != commitLSN {
+		t.Errorf("Unexpected second record: %+v", records[1])
+	}
+}
+
+func TestLog_TornTail(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "torn.wal")
+
+	l, err := Open(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	goodLSN, err := l.Append(testPageRecord(1, 1, 1))
+	if err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	if _, err := l.Append(testPageRecord(1, 2, 2)); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	segment := l.segmentPath(0)
+	if err := l.Close(); err != nil {
+		t.Fatalf("Failed to close log: %v", err)
+	}
+
+	// Cut the second record in half, as a crash during the write would
+	info, err := os.Stat(segment)
+	if err != nil {
+		t.Fatalf("Failed to stat segment: %v", err)
+	}
+	if err := os.Truncate(segment, info.Size()-10); err != nil {
+		t.Fatalf("Failed to truncate segment: %v", err)
+	}
+
+	l, err = Open(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen log: %v", err)
+	}
+	defer l.Close()
+
+	if l.EndLSN() != goodLSN {
+		t.Errorf("Expected torn record to be dropped, end LSN %d, want %d", l.EndLSN(), goodLSN)
+	}
+	if records := collectRecords(t, l); len(records) != 1 {
+		t.Errorf("Expected 1 record after torn tail, got %d", len(records))
+	}
+
+	// New records must follow the last complete one
+	if _, err := l.Append(&Record{Type: RecordCommit, TxnID: 1}); err != nil {
+		t.Fatalf("Failed to append after recovery: %v", err)
+	}
+	if records := collectRecords(t, l); len(records) != 2 {
+		t.Errorf("Expected 2 records, got %d", len(records))
+	}
+}
+
+func TestLog_SegmentsAndReset(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "seg.wal")
+
+	l, err := Open(dir, &Config{SegmentSize: MaxRecordSize})
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer l.Close()
+
+	full := make([]byte, page.MaxImageSize)
+	for i := range full {
+		full[i] = 0xFF
+	}
+
+	const numRecords = 5
+	for i := 0; i < numRecords; i++ {
+		rec := NewPageRecord(1, page.PageID(i+1), page.PageTypeLeaf, make([]byte, len(full)), full)
+		if _, err := l.Append(rec); err != nil {
+			t.Fatalf("Failed to append record %d: %v", i, err)
+		}
+	}
+
+	if segments := l.GetStatistics().Segments; segments < 2 {
+		t.Errorf("Expected the log to roll over to several segments, got %d", segments)
+	}
+	if records := collectRecords(t, l); len(records) != numRecords {
+		t.Errorf("Expected %d records across segments, got %d", numRecords, len(records))
+	}
+
+	end := l.EndLSN()
+	if err := l.Reset(); err != nil {
+		t.Fatalf("Failed to reset log: %v", err)
+	}
+
+	if l.EndLSN() != end {
+		t.Errorf("Expected LSNs to continue after reset, end %d, want %d", l.EndLSN(), end)
+	}
+	if records := collectRecords(t, l); len(records) != 0 {
+		t.Errorf("Expected no records after reset, got %d", len(records))
+	}
+	if segments := l.GetStatistics().Segments; segments != 1 {
+		t.Errorf("Expected 1 segment after reset, got %d", segments)
+	}
+
+	lsn, err := l.Append(&Record{Type: RecordCommit, TxnID: 2})
+	if err != nil {
+		t.Fatalf("Failed to append after reset: %v", err)
+	}
+	if lsn <= end {
+		t.Errorf("Expected LSN beyond %d, got %d", end, lsn)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "created.wal")
+
+	const start = 12345
+	if err := Create(dir, start); err != nil {
+		t.Fatalf("Failed to create log: %v", err)
+	}
+	if err := Create(dir, start); err == nil {
+		t.Error("Expected error creating a log over an existing one")
+	}
+
+	l, err := Open(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer l.Close()
+
+	if l.EndLSN() != start {
+		t.Errorf("Expected the log to start at %d, got %d", start, l.EndLSN())
+	}
+	if lsn, err := l.Append(&Record{Type: RecordCommit, TxnID: 1}); err != nil || lsn <= start {
+		t.Errorf("Expected the first record past LSN %d, got %d: %v", start, lsn, err)
+	}
+}
+
+func TestLog_GroupCommit(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "group.wal"), nil)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer l.Close()
+
+	const numWriters = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, numWriters)
+
+	for i := 0; i < numWriters; i++ {
+		wg.Add(1)
+		go func(txnID uint64) {
+			defer wg.Done()
+			lsn, err := l.Append(&Record{Type: RecordCommit, TxnID: txnID})
+			if err == nil {
+				err = l.Flush(lsn)
+			}
+			if err == nil && l.FlushedLSN() < lsn {
+				t.Errorf("Flush returned before LSN %d was durable", lsn)
+			}
+			errs <- err
+		}(uint64(i + 1))
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Commit failed: %v", err)
+		}
+	}
+
+	stats := l.GetStatistics()
+	if stats.Syncs > stats.FlushRequests {
+		t.Errorf("Expected at most one sync per flush request, got %d syncs for %d requests", stats.Syncs, stats.FlushRequests)
+	}
+}
+
+func TestLog_Closed(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "closed.wal"), nil)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Failed to close log: %v", err)
+	}
+
+	if _, err := l.Append(&Record{Type: RecordCommit, TxnID: 1}); err != ErrLogClosed {
+		t.Errorf("Expected ErrLogClosed, got %v", err)
+	}
+}
+
+func TestOpen_InvalidConfig(t *testing.T) {
+	if _, err := Open("", nil); err == nil {
+		t.Error("Expected error for empty directory")
+	}
+	if _, err := Open(t.TempDir(), &Config{SegmentSize: 1024}); err == nil {
+		t.Error("Expected error for a segment smaller than a record")
+	}
+}
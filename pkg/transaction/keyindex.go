@@ -0,0 +1,124 @@
+package transaction
+
+import "math/rand/v2"
+
+// keyIndexMaxLevel bounds the height of a keyIndex; with a branching factor
+// of four it stays balanced for far more keys than fit in memory.
+const keyIndexMaxLevel = 24
+
+// keyNode is a key in a keyIndex, linked to the next key at each of its
+// levels.
+type keyNode struct {
+	key  string
+	next []*keyNode
+}
+
+// keyIndex is an ordered set of keys, kept as a skip list so that keys can be
+// added, removed and sought in logarithmic time. It is not safe for
+// concurrent use.
+type keyIndex struct {
+	// head links to the first key at each level
+	head keyNode
+
+	// level is the number of levels in use
+	level int
+
+	// n is the number of keys
+	n int
+}
+
+// newKeyIndex creates an empty key index.
+func newKeyIndex() *keyIndex {
+	return &keyIndex{
+		head:  keyNode{next: make([]*keyNode, keyIndexMaxLevel)},
+		level: 1,
+	}
+}
+
+// len returns the number of keys.
+func (ix *keyIndex) len() int {
+	return ix.n
+}
+
+// insert adds a key, if it is not there already.
+func (ix *keyIndex) insert(key string) {
+	var update [keyIndexMaxLevel]*keyNode
+	if n := ix.findLast(key, false, update[:]).next[0]; n != nil && n.key == key {
+		return
+	}
+
+	level := 1
+	for level < keyIndexMaxLevel && rand.N(4) == 0 {
+		level++
+	}
+	for ; ix.level < level; ix.level++ {
+		update[ix.level] = &ix.head
+	}
+
+	node := &keyNode{key: key, next: make([]*keyNode, level)}
+	for l := range node.next {
+		node.next[l] = update[l].next[l]
+		update[l].next[l] = node
+	}
+	ix.n++
+}
+
+// remove removes a key, if it is there.
+func (ix *keyIndex) remove(key string) {
+	var update [keyIndexMaxLevel]*keyNode
+	node := ix.findLast(key, false, update[:]).next[0]
+	if node == nil || node.key != key {
+		return
+	}
+
+	for l := range node.next {
+		update[l].next[l] = node.next[l]
+	}
+	for ix.level > 1 && ix.head.next[ix.level-1] == nil {
+		ix.level--
+	}
+	ix.n--
+}
+
+// seek returns the first key after from in the given direction, or at it if
+// inclusive. A nil from starts at the first or last key. It reports false if
+// there is no such key.
+func (ix *keyIndex) seek(from []byte, inclusive, forward bool) (string, bool) {
+	var node *keyNode
+	switch {
+	case forward && from == nil:
+		node = ix.head.next[0]
+	case forward:
+		node = ix.findLast(string(from), !inclusive, nil).next[0]
+	case from == nil:
+		node = &ix.head
+		for l := ix.level - 1; l >= 0; l-- {
+			for node.next[l] != nil {
+				node = node.next[l]
+			}
+		}
+	default:
+		node = ix.findLast(string(from), inclusive, nil)
+	}
+
+	if node == nil || node == &ix.head {
+		return "", false
+	}
+	return node.key, true
+}
+
+// findLast returns the last node whose key comes before key, or is equal to
+// it if inclusive, and fills update with the last such node at each level in
+// use when it is not nil. It returns the head if there is none.
+func (ix *keyIndex) findLast(key string, inclusive bool, update []*keyNode) *keyNode {
+	x := &ix.head
+	for l := ix.level - 1; l >= 0; l-- {
+		for n := x.next[l]; n != nil && (n.key < key || (inclusive && n.key == key)); n = x.next[l] {
+			x = n
+		}
+		if update != nil {
+			update[l] = x
+		}
+	}
+	return x
+}
@@ -0,0 +1,78 @@
+package transaction
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestKeyIndex(t *testing.T) {
+	ix := newKeyIndex()
+	if _, ok := ix.seek(nil, true, true); ok {
+		t.Error("Expected an empty index to have no first key")
+	}
+	if _, ok := ix.seek(nil, true, false); ok {
+		t.Error("Expected an empty index to have no last key")
+	}
+
+	// Keys come and go at random; the index agrees with a sorted set
+	rng := rand.New(rand.NewPCG(1, 2))
+	var want []string
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprintf("key-%03d", rng.IntN(500))
+		j, found := slices.BinarySearch(want, key)
+		if rng.IntN(3) == 0 {
+			ix.remove(key)
+			if found {
+				want = slices.Delete(want, j, j+1)
+			}
+		} else {
+			ix.insert(key)
+			if !found {
+				want = slices.Insert(want, j, key)
+			}
+		}
+	}
+	if ix.len() != len(want) {
+		t.Fatalf("Expected %d keys, got %d", len(want), ix.len())
+	}
+
+	// seekWant finds the answer to a seek in the sorted set
+	seekWant := func(from []byte, inclusive, forward bool) (string, bool) {
+		for i := range want {
+			key := want[i]
+			if !forward {
+				key = want[len(want)-1-i]
+			}
+			switch {
+			case from == nil, inclusive && key == string(from),
+				forward && key > string(from), !forward && key < string(from):
+				return key, true
+			}
+		}
+		return "", false
+	}
+
+	for i := 0; i < 2000; i++ {
+		from := []byte(fmt.Sprintf("key-%03d", rng.IntN(520)))
+		if i%100 == 0 {
+			from = nil
+		}
+		inclusive, forward := rng.IntN(2) == 0, rng.IntN(2) == 0
+
+		key, ok := ix.seek(from, inclusive, forward)
+		wantKey, wantOK := seekWant(from, inclusive, forward)
+		if key != wantKey || ok != wantOK {
+			t.Fatalf("Seek from %q (inclusive %v, forward %v): expected %q %v, got %q %v",
+				from, inclusive, forward, wantKey, wantOK, key, ok)
+		}
+	}
+
+	for _, key := range want {
+		ix.remove(key)
+	}
+	if ix.len() != 0 || ix.level != 1 {
+		t.Errorf("Expected an empty index, got %d keys in %d levels", ix.len(), ix.level)
+	}
+}
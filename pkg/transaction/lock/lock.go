@@ -0,0 +1,608 @@
+// Package lock provides the lock manager used by pessimistic transactions:
+// shared and exclusive locks on keys and key ranges, FIFO lock queues, and
+// periodic deadlock detection over the wait-for graph.
+package lock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// Mode is the mode of a lock.
+type Mode int
+
+const (
+	// Shared locks may be held by many owners at once and block exclusive locks.
+	Shared Mode = iota
+
+	// Exclusive locks block every lock held by another owner.
+	Exclusive
+)
+
+// String returns a string representation of the lock mode.
+func (m Mode) String() string {
+	switch m {
+	case Shared:
+		return "Shared"
+	case Exclusive:
+		return "Exclusive"
+	default:
+		return fmt.Sprintf("Unknown(%d)", int(m))
+	}
+}
+
+// compatible reports whether locks of the two modes may be held at once by
+// different owners.
+func compatible(a, b Mode) bool {
+	return a == Shared && b == Shared
+}
+
+// OwnerID identifies the owner of locks, normally a transaction ID. Owner IDs
+// are handed out in increasing order, so a larger ID is a younger owner.
+type OwnerID uint64
+
+// Config configures a lock manager.
+type Config struct {
+	// DeadlockDetection enables the periodic deadlock detector. Without it,
+	// deadlocked waiters only give up when their context ends.
+	DeadlockDetection bool
+
+	// DetectionInterval is how often the wait-for graph is checked for cycles
+	DetectionInterval time.Duration
+}
+
+// DefaultConfig returns a lock manager configuration with sensible defaults.
+func DefaultConfig() *Config {
+	return &Config{
+		DeadlockDetection: true,
+		DetectionInterval: time.Second,
+	}
+}
+
+// Statistics contains lock manager statistics.
+type Statistics struct {
+	// Acquired is the number of lock requests granted
+	Acquired int64
+
+	// Waits is the number of lock requests that had to wait
+	Waits int64
+
+	// Deadlocks is the number of deadlocks detected and resolved
+	Deadlocks int64
+
+	// Held is the number of locks currently held
+	Held int
+
+	// Waiting is the number of lock requests currently waiting
+	Waiting int
+}
+
+// span is the key range a lock covers: [start, end). A nil start is
+// unbounded below and a nil end unbounded above. Point locks cover exactly
+// one key.
+type span struct {
+	start []byte
+	end   []byte
+	point bool
+}
+
+// contains reports whether the span covers the key.
+func (s span) contains(key []byte) bool {
+	if s.point {
+		return bytes.Equal(s.start, key)
+	}
+	return (s.start == nil || bytes.Compare(key, s.start) >= 0) &&
+		(s.end == nil || bytes.Compare(key, s.end) < 0)
+}
+
+// overlaps reports whether two spans share a key.
+func (s span) overlaps(o span) bool {
+	switch {
+	case s.point:
+		return o.contains(s.start)
+	case o.point:
+		return s.contains(o.start)
+	}
+	return (s.end == nil || o.start == nil || bytes.Compare(o.start, s.end) < 0) &&
+		(o.end == nil || s.start == nil || bytes.Compare(s.start, o.end) < 0)
+}
+
+// covers reports whether the span includes every key of another span.
+func (s span) covers(o span) bool {
+	if o.point {
+		return s.contains(o.start)
+	}
+	if s.point {
+		return false
+	}
+	return (s.start == nil || (o.start != nil && bytes.Compare(s.start, o.start) <= 0)) &&
+		(s.end == nil || (o.end != nil && bytes.Compare(o.end, s.end) <= 0))
+}
+
+// request is a lock held or waited for by an owner.
+type request struct {
+	owner   OwnerID
+	mode    Mode
+	span    span
+	seq     uint64
+	granted bool
+
+	// ready receives the outcome of a waiting request: nil when granted,
+	// or the reason it was abandoned
+	ready chan error
+}
+
+// Manager grants key and range locks to owners. Locks are held until the
+// owner releases all of them with ReleaseAll, as strict two-phase locking
+// requires. Conflicting requests are queued in arrival order, except that an
+// owner upgrading a lock it already holds goes ahead of the queue.
+type Manager struct {
+	// config holds the manager configuration
+	config *Config
+
+	// mu protects the fields below
+	mu sync.Mutex
+
+	// points holds the point requests per key
+	points map[string][]*request
+
+	// ranges holds the range requests
+	ranges []*request
+
+	// owned holds the granted requests per owner
+	owned map[OwnerID][]*request
+
+	// waiting holds the waiting requests in arrival order; an owner waits
+	// for at most one request at a time
+	waiting []*request
+
+	// seq orders requests by arrival
+	seq uint64
+
+	// stats tracks lock statistics
+	stats Statistics
+
+	// closed indicates if the manager is closed
+	closed bool
+
+	// stop ends the deadlock detector, and done reports that it ended
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewManager creates a lock manager and starts its deadlock detector if enabled.
+func NewManager(config *Config) (*Manager, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	if config.DeadlockDetection && config.DetectionInterval <= 0 {
+		return nil, fmt.Errorf("deadlock detection interval must be positive, got %v", config.DetectionInterval)
+	}
+
+	m := &Manager{
+		config: config,
+		points: make(map[string][]*request),
+		owned:  make(map[OwnerID][]*request),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if config.DeadlockDetection {
+		go m.detectLoop()
+	} else {
+		close(m.done)
+	}
+
+	return m, nil
+}
+
+// Lock acquires a lock on a single key, waiting while other owners hold
+// conflicting locks. It returns utils.ErrTransactionDeadlock if the owner is
+// chosen as a deadlock victim, or the context error if ctx ends first.
+func (m *Manager) Lock(ctx context.Context, owner OwnerID, key []byte, mode Mode) error {
+	if len(key) == 0 {
+		return utils.ErrInvalidKey
+	}
+	return m.acquire(ctx, owner, span{start: append([]byte(nil), key...), point: true}, mode)
+}
+
+// LockRange acquires a lock on every key in [start, end), including keys
+// that do not exist yet. A nil start or end leaves the range unbounded on
+// that side.
+func (m *Manager) LockRange(ctx context.Context, owner OwnerID, start, end []byte, mode Mode) error {
+	if start != nil && end != nil && bytes.Compare(start, end) >= 0 {
+		return fmt.Errorf("%w: empty range", ErrInvalidRange)
+	}
+
+	s := span{}
+	if start != nil {
+		s.start = append([]byte{}, start...)
+	}
+	if end != nil {
+		s.end = append([]byte{}, end...)
+	}
+	return m.acquire(ctx, owner, s, mode)
+}
+
+// ReleaseAll releases every lock held by the owner and abandons its waiting
+// request, if any.
+func (m *Manager) ReleaseAll(owner OwnerID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.owned[owner] {
+		m.removeLocked(r)
+	}
+	delete(m.owned, owner)
+
+	for _, r := range m.waiting {
+		if r.owner == owner {
+			m.abandonLocked(r, ErrLockReleased)
+			break
+		}
+	}
+
+	m.grantWaitersLocked()
+}
+
+// Holds reports whether the owner holds a lock of at least the given mode
+// covering the key.
+func (m *Manager) Holds(owner OwnerID, key []byte, mode Mode) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.holdsLocked(owner, span{start: key, point: true}, mode)
+}
+
+// GetStatistics returns lock manager statistics.
+func (m *Manager) GetStatistics() Statistics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	for _, reqs := range m.owned {
+		stats.Held += len(reqs)
+	}
+	stats.Waiting = len(m.waiting)
+	return stats
+}
+
+// Close stops the deadlock detector and fails all waiting requests with
+// ErrManagerClosed.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrManagerClosed
+	}
+	m.closed = true
+	close(m.stop)
+
+	for len(m.waiting) > 0 {
+		m.abandonLocked(m.waiting[0], ErrManagerClosed)
+	}
+	m.mu.Unlock()
+
+	<-m.done
+	return nil
+}
+
+// acquire grants a request immediately or queues it and waits.
+func (m *Manager) acquire(ctx context.Context, owner OwnerID, s span, mode Mode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrManagerClosed
+	}
+
+	// Locks are reentrant: a lock already covering the request suffices
+	if m.holdsLocked(owner, s, mode) {
+		m.mu.Unlock()
+		return nil
+	}
+
+	m.seq++
+	r := &request{owner: owner, mode: mode, span: s, seq: m.seq, ready: make(chan error, 1)}
+	m.insertLocked(r)
+
+	if len(m.blockersLocked(r)) == 0 {
+		m.grantLocked(r)
+		m.mu.Unlock()
+		return nil
+	}
+
+	m.waiting = append(m.waiting, r)
+	m.stats.Waits++
+	m.mu.Unlock()
+
+	select {
+	case err := <-r.ready:
+		return err
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The request may have been decided while the context ended
+	select {
+	case err := <-r.ready:
+		return err
+	default:
+	}
+
+	m.abandonLocked(r, ctx.Err())
+	m.grantWaitersLocked()
+	return ctx.Err()
+}
+
+// holdsLocked reports whether the owner holds a granted lock of at least the
+// given mode covering the span (assumes lock is held).
+func (m *Manager) holdsLocked(owner OwnerID, s span, mode Mode) bool {
+	for _, r := range m.owned[owner] {
+		if r.mode >= mode && r.span.covers(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictsLocked returns the requests of other owners whose span overlaps
+// the request and whose mode is incompatible with it (assumes lock is held).
+func (m *Manager) conflictsLocked(r *request) []*request {
+	var conflicts []*request
+	consider := func(c *request) {
+		if c != r && c.owner != r.owner && !compatible(c.mode, r.mode) && c.span.overlaps(r.span) {
+			conflicts = append(conflicts, c)
+		}
+	}
+
+	if r.span.point {
+		for _, c := range m.points[string(r.span.start)] {
+			consider(c)
+		}
+	} else {
+		for _, reqs := range m.points {
+			for _, c := range reqs {
+				consider(c)
+			}
+		}
+	}
+	for _, c := range m.ranges {
+		consider(c)
+	}
+
+	return conflicts
+}
+
+// blockersLocked returns the requests a request must wait for: conflicting
+// granted locks and, to keep the queue fair, conflicting requests that
+// arrived earlier. Upgrades by an owner that already holds locks on the span
+// only wait for granted locks (assumes lock is held).
+func (m *Manager) blockersLocked(r *request) []*request {
+	upgrade := false
+	for _, held := range m.owned[r.owner] {
+		if held.span.overlaps(r.span) {
+			upgrade = true
+			break
+		}
+	}
+
+	var blockers []*request
+	for _, c := range m.conflictsLocked(r) {
+		if c.granted || (!upgrade && c.seq < r.seq) {
+			blockers = append(blockers, c)
+		}
+	}
+	return blockers
+}
+
+// insertLocked adds a request to the lock table (assumes lock is held).
+func (m *Manager) insertLocked(r *request) {
+	if r.span.point {
+		key := string(r.span.start)
+		m.points[key] = append(m.points[key], r)
+	} else {
+		m.ranges = append(m.ranges, r)
+	}
+}
+
+// removeLocked removes a request from the lock table (assumes lock is held).
+func (m *Manager) removeLocked(r *request) {
+	if r.span.point {
+		key := string(r.span.start)
+		m.points[key] = removeRequest(m.points[key], r)
+		if len(m.points[key]) == 0 {
+			delete(m.points, key)
+		}
+	} else {
+		m.ranges = removeRequest(m.ranges, r)
+	}
+}
+
+// grantLocked marks a request granted and notifies its waiter (assumes lock
+// is held).
+func (m *Manager) grantLocked(r *request) {
+	r.granted = true
+	m.owned[r.owner] = append(m.owned[r.owner], r)
+	m.stats.Acquired++
+	r.ready <- nil
+}
+
+// abandonLocked removes a waiting request and notifies its waiter with the
+// given reason (assumes lock is held).
+func (m *Manager) abandonLocked(r *request, reason error) {
+	m.removeLocked(r)
+	m.waiting = removeRequest(m.waiting, r)
+	r.ready <- reason
+}
+
+// grantWaitersLocked grants, in arrival order, every waiting request that is
+// no longer blocked (assumes lock is held).
+func (m *Manager) grantWaitersLocked() {
+	for i := 0; i < len(m.waiting); {
+		r := m.waiting[i]
+		if len(m.blockersLocked(r)) > 0 {
+			i++
+			continue
+		}
+
+		m.waiting = append(m.waiting[:i], m.waiting[i+1:]...)
+		m.grantLocked(r)
+
+		// A grant can only block later waiters, so scanning on is safe
+	}
+}
+
+// detectLoop checks for deadlocks at the configured interval until the
+// manager is closed.
+func (m *Manager) detectLoop() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.config.DetectionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.DetectDeadlocks()
+		}
+	}
+}
+
+// DetectDeadlocks builds the wait-for graph, and while it contains a cycle,
+// aborts the waiting request of the youngest owner in the cycle with
+// utils.ErrTransactionDeadlock. It returns the victims, oldest cycle first.
+// The detector calls it periodically; it may also be called directly.
+func (m *Manager) DetectDeadlocks() []OwnerID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var victims []OwnerID
+	for {
+		cycle := findCycle(m.waitForGraphLocked())
+		if cycle == nil {
+			break
+		}
+
+		victim := cycle[0]
+		for _, owner := range cycle[1:] {
+			if owner > victim {
+				victim = owner
+			}
+		}
+
+		for _, r := range m.waiting {
+			if r.owner == victim {
+				m.abandonLocked(r, utils.ErrTransactionDeadlock)
+				break
+			}
+		}
+		m.stats.Deadlocks++
+		victims = append(victims, victim)
+	}
+
+	if len(victims) > 0 {
+		m.grantWaitersLocked()
+	}
+	return victims
+}
+
+// waitForGraphLocked returns, for each waiting owner, the owners it waits
+// for (assumes lock is held).
+func (m *Manager) waitForGraphLocked() map[OwnerID][]OwnerID {
+	graph := make(map[OwnerID][]OwnerID, len(m.waiting))
+	for _, r := range m.waiting {
+		seen := make(map[OwnerID]bool)
+		for _, b := range m.blockersLocked(r) {
+			if !seen[b.owner] {
+				seen[b.owner] = true
+				graph[r.owner] = append(graph[r.owner], b.owner)
+			}
+		}
+	}
+	return graph
+}
+
+// findCycle returns the owners on a cycle of the wait-for graph, or nil if
+// it has none. Owners are visited in ID order so the result is deterministic.
+func findCycle(graph map[OwnerID][]OwnerID) []OwnerID {
+	const (
+		unvisited = iota
+		onStack
+		finished
+	)
+
+	owners := make([]OwnerID, 0, len(graph))
+	for owner := range graph {
+		owners = append(owners, owner)
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i] < owners[j] })
+
+	state := make(map[OwnerID]int)
+	var stack []OwnerID
+
+	var visit func(owner OwnerID) []OwnerID
+	visit = func(owner OwnerID) []OwnerID {
+		state[owner] = onStack
+		stack = append(stack, owner)
+
+		for _, next := range graph[owner] {
+			switch state[next] {
+			case onStack:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == next {
+						return append([]OwnerID(nil), stack[i:]...)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[owner] = finished
+		return nil
+	}
+
+	for _, owner := range owners {
+		if state[owner] == unvisited {
+			if cycle := visit(owner); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// removeRequest removes a request from a slice, preserving order.
+func removeRequest(reqs []*request, r *request) []*request {
+	for i, c := range reqs {
+		if c == r {
+			return append(reqs[:i], reqs[i+1:]...)
+		}
+	}
+	return reqs
+}
+
+// Lock manager errors
+var (
+	ErrManagerClosed = errors.New("lock manager is closed")
+	ErrLockReleased  = errors.New("lock request abandoned by release")
+	ErrInvalidRange  = errors.New("invalid lock range")
+)
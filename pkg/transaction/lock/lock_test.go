@@ -0,0 +1,313 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// newTestManager creates a lock manager without the periodic detector, so
+// tests control when deadlocks are detected.
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	m, err := NewManager(&Config{DeadlockDetection: false})
+	if err != nil {
+		t.Fatalf("Failed to create lock manager: %v", err)
+	}
+	t.Cleanup(func() { _ = m.Close() })
+	return m
+}
+
+// lockAsync requests a lock in the background and returns the outcome channel.
+func lockAsync(m *Manager, owner OwnerID, key string, mode Mode) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- m.Lock(context.Background(), owner, []byte(key), mode)
+	}()
+	return result
+}
+
+// waitForWaiters waits until the manager has the given number of waiting requests.
+func waitForWaiters(t *testing.T, m *Manager, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for m.GetStatistics().Waiting != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d waiting requests, got %d", n, m.GetStatistics().Waiting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// expectBlocked checks that a lock request has not completed.
+func expectBlocked(t *testing.T, result <-chan error) {
+	t.Helper()
+
+	select {
+	case err := <-result:
+		t.Fatalf("Expected request to wait, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// expectGranted checks that a lock request completes successfully.
+func expectGranted(t *testing.T, result <-chan error) {
+	t.Helper()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("Expected request to be granted, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected request to be granted")
+	}
+}
+
+func TestSpan(t *testing.T) {
+	point := span{start: []byte("b"), point: true}
+	r := span{start: []byte("a"), end: []byte("c")}
+	unbounded := span{}
+
+	if !r.contains([]byte("b")) || r.contains([]byte("c")) {
+		t.Error("Expected range to include its start and exclude its end")
+	}
+	if !point.overlaps(r) || !r.overlaps(point) {
+		t.Error("Expected point inside range to overlap it")
+	}
+	if (span{start: []byte("c"), end: []byte("d")}).overlaps(r) {
+		t.Error("Expected adjacent ranges not to overlap")
+	}
+	if !unbounded.covers(r) || r.covers(unbounded) || !r.covers(point) || point.covers(r) {
+		t.Error("Unexpected covers result")
+	}
+}
+
+func TestManager_SharedAndExclusive(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+
+	if err := m.Lock(ctx, 1, []byte("k"), Shared); err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	if err := m.Lock(ctx, 2, []byte("k"), Shared); err != nil {
+		t.Fatalf("Expected shared locks to be compatible: %v", err)
+	}
+
+	writer := lockAsync(m, 3, "k", Exclusive)
+	waitForWaiters(t, m, 1)
+
+	// Later shared requests queue behind the waiting writer
+	reader := lockAsync(m, 4, "k", Shared)
+	expectBlocked(t, reader)
+
+	m.ReleaseAll(1)
+	expectBlocked(t, writer)
+	m.ReleaseAll(2)
+	expectGranted(t, writer)
+	expectBlocked(t, reader)
+
+	m.ReleaseAll(3)
+	expectGranted(t, reader)
+
+	if !m.Holds(4, []byte("k"), Shared) || m.Holds(4, []byte("k"), Exclusive) {
+		t.Error("Expected owner 4 to hold only a shared lock")
+	}
+}
+
+func TestManager_Reentrant(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+
+	if err := m.Lock(ctx, 1, []byte("k"), Exclusive); err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	if err := m.Lock(ctx, 1, []byte("k"), Shared); err != nil {
+		t.Fatalf("Expected exclusive lock to cover a shared request: %v", err)
+	}
+	if err := m.LockRange(ctx, 1, []byte("a"), []byte("z"), Shared); err != nil {
+		t.Fatalf("Failed to lock range: %v", err)
+	}
+	if err := m.Lock(ctx, 1, []byte("m"), Shared); err != nil {
+		t.Fatalf("Expected range lock to cover a key in it: %v", err)
+	}
+
+	if held := m.GetStatistics().Held; held != 2 {
+		t.Errorf("Expected 2 locks held, got %d", held)
+	}
+}
+
+func TestManager_Upgrade(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+
+	if err := m.Lock(ctx, 1, []byte("k"), Shared); err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	if err := m.Lock(ctx, 2, []byte("k"), Shared); err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+
+	// A writer queues first, but the upgrade only waits for the other reader
+	writer := lockAsync(m, 3, "k", Exclusive)
+	waitForWaiters(t, m, 1)
+	upgrade := lockAsync(m, 1, "k", Exclusive)
+	expectBlocked(t, upgrade)
+
+	m.ReleaseAll(2)
+	expectGranted(t, upgrade)
+	expectBlocked(t, writer)
+
+	m.ReleaseAll(1)
+	expectGranted(t, writer)
+}
+
+func TestManager_RangeLocks(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+
+	if err := m.LockRange(ctx, 1, []byte("b"), []byte("d"), Shared); err != nil {
+		t.Fatalf("Failed to lock range: %v", err)
+	}
+
+	// Writes inside the range wait, writes outside do not
+	if err := m.Lock(ctx, 2, []byte("d"), Exclusive); err != nil {
+		t.Fatalf("Expected key outside the range to be free: %v", err)
+	}
+	inside := lockAsync(m, 2, "c", Exclusive)
+	expectBlocked(t, inside)
+
+	m.ReleaseAll(1)
+	expectGranted(t, inside)
+
+	// A range request waits for point locks inside it
+	result := make(chan error, 1)
+	go func() { result <- m.LockRange(ctx, 3, nil, nil, Shared) }()
+	expectBlocked(t, result)
+	m.ReleaseAll(2)
+	expectGranted(t, result)
+
+	if err := m.LockRange(ctx, 3, []byte("b"), []byte("a"), Shared); !errors.Is(err, ErrInvalidRange) {
+		t.Errorf("Expected ErrInvalidRange, got %v", err)
+	}
+}
+
+func TestManager_ContextCancel(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.Lock(context.Background(), 1, []byte("k"), Exclusive); err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Lock(ctx, 2, []byte("k"), Exclusive); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if waiting := m.GetStatistics().Waiting; waiting != 0 {
+		t.Errorf("Expected abandoned request to leave the queue, %d waiting", waiting)
+	}
+}
+
+func TestManager_DeadlockVictimIsYoungest(t *testing.T) {
+	m := newTestManager(t)
+	ctx := context.Background()
+
+	if err := m.Lock(ctx, 1, []byte("a"), Exclusive); err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	if err := m.Lock(ctx, 2, []byte("b"), Exclusive); err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+
+	older := lockAsync(m, 1, "b", Exclusive)
+	younger := lockAsync(m, 2, "a", Exclusive)
+	waitForWaiters(t, m, 2)
+
+	victims := m.DetectDeadlocks()
+	if len(victims) != 1 || victims[0] != 2 {
+		t.Fatalf("Expected owner 2 to be the victim, got %v", victims)
+	}
+
+	select {
+	case err := <-younger:
+		if !errors.Is(err, utils.ErrTransactionDeadlock) {
+			t.Errorf("Expected ErrTransactionDeadlock, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the victim's request to fail")
+	}
+
+	// The victim rolls back, letting the older owner proceed
+	m.ReleaseAll(2)
+	expectGranted(t, older)
+
+	if deadlocks := m.GetStatistics().Deadlocks; deadlocks != 1 {
+		t.Errorf("Expected 1 deadlock, got %d", deadlocks)
+	}
+}
+
+func TestManager_PeriodicDetection(t *testing.T) {
+	m, err := NewManager(&Config{DeadlockDetection: true, DetectionInterval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create lock manager: %v", err)
+	}
+	defer m.Close()
+	ctx := context.Background()
+
+	// Three owners waiting on each other in a ring
+	for owner, key := range map[OwnerID]string{1: "a", 2: "b", 3: "c"} {
+		if err := m.Lock(ctx, owner, []byte(key), Exclusive); err != nil {
+			t.Fatalf("Failed to lock: %v", err)
+		}
+	}
+	first := lockAsync(m, 1, "b", Exclusive)
+	second := lockAsync(m, 2, "c", Exclusive)
+	third := lockAsync(m, 3, "a", Exclusive)
+
+	select {
+	case err := <-third:
+		if !errors.Is(err, utils.ErrTransactionDeadlock) {
+			t.Fatalf("Expected ErrTransactionDeadlock for the youngest owner, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the detector to break the deadlock")
+	}
+
+	m.ReleaseAll(3)
+	expectGranted(t, second)
+	m.ReleaseAll(2)
+	expectGranted(t, first)
+}
+
+func TestManager_Close(t *testing.T) {
+	m, err := NewManager(nil)
+	if err != nil {
+		t.Fatalf("Failed to create lock manager: %v", err)
+	}
+
+	if err := m.Lock(context.Background(), 1, []byte("k"), Exclusive); err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+	waiter := lockAsync(m, 2, "k", Shared)
+	waitForWaiters(t, m, 1)
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if err := <-waiter; !errors.Is(err, ErrManagerClosed) {
+		t.Errorf("Expected ErrManagerClosed for waiter, got %v", err)
+	}
+	if err := m.Lock(context.Background(), 3, []byte("k"), Shared); !errors.Is(err, ErrManagerClosed) {
+		t.Errorf("Expected ErrManagerClosed, got %v", err)
+	}
+
+	if _, err := NewManager(&Config{DeadlockDetection: true}); err == nil {
+		t.Error("Expected error for a zero detection interval")
+	}
+}
@@ -0,0 +1,522 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thromel/go-database/pkg/storage"
+	"github.com/thromel/go-database/pkg/transaction/lock"
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// Config configures a transaction manager.
+type Config struct {
+	// MaxActiveTransactions is the maximum number of concurrent transactions
+	MaxActiveTransactions int
+
+	// DefaultTimeout is the timeout of transactions that do not set their own
+	DefaultTimeout time.Duration
+
+	// DefaultIsolationLevel is the isolation level of transactions that do
+	// not set their own; DefaultIsolation means ReadCommitted
+	DefaultIsolationLevel IsolationLevel
+
+	// DeadlockDetection enables periodic deadlock detection among
+	// transactions waiting for locks
+	DeadlockDetection bool
+
+	// DeadlockDetectionInterval is how often to check for deadlocks
+	DeadlockDetectionInterval time.Duration
+
+	// RetryPolicy is how Run retries transactions that do not set their own
+	// policy; nil disables retries
+	RetryPolicy *RetryPolicy
+
+	// MaxVersionBytes caps the memory the values kept for snapshots may
+	// take. A commit that would exceed it expires the oldest snapshots,
+	// whose reads then fail with utils.ErrSnapshotTooOld (0 means no limit)
+	MaxVersionBytes int64
+}
+
+// DefaultConfig returns a transaction manager configuration with sensible defaults.
+func DefaultConfig() *Config {
+	return &Config{
+		MaxActiveTransactions:     1000,
+		DefaultTimeout:            30 * time.Second,
+		DefaultIsolationLevel:     ReadCommitted,
+		DeadlockDetection:         true,
+		DeadlockDetectionInterval: time.Second,
+		RetryPolicy:               DefaultRetryPolicy(),
+		MaxVersionBytes:           64 << 20,
+	}
+}
+
+// ManagerImpl implements the Manager interface on top of a storage engine.
+// Transactions buffer their writes and apply them to the engine as one
+// atomic write batch when they commit.
+//
+// RepeatableRead and Serializable transactions read a snapshot of the
+// committed state taken when they begin, served from a version store, so
+// they never block writers or see their changes. The values replaced under
+// a running snapshot are kept in memory, up to Config.MaxVersionBytes;
+// beyond that the oldest snapshots expire with utils.ErrSnapshotTooOld.
+// Concurrent snapshot transactions that write the same key conflict, and
+// the later one to commit fails with utils.ErrTransactionConflict. Serializable transactions
+// additionally fail if a key they read was changed after their snapshot;
+// reads are validated key by key, so the level is snapshot isolation with
+// point-read checks, not full serializability over ranges.
+// ReadUncommitted and ReadCommitted transactions read the newest committed
+// values; writes are never visible before commit at any level.
+//
+// Pessimistic transactions instead use strict two-phase locking: they lock
+// keys as they read and write them and hold the locks until they end, so
+// they wait rather than fail on contention. Every commit takes exclusive
+// locks on the keys it writes, so no write slips past a pessimistic lock.
+// Deadlocks are broken by rolling back the youngest waiting transaction.
+type ManagerImpl struct {
+	// engine is the storage engine transactions read from and commit to
+	engine storage.StorageEngine
+
+	// config holds the manager configuration
+	config *Config
+
+	// versions holds the values snapshot transactions may still read
+	versions *versionStore
+
+	// locks holds the key and range locks of transactions and commits
+	locks *lock.Manager
+
+	// commitMu serializes commits, so validation, the engine write and
+	// version bookkeeping of a commit happen as one step
+	commitMu sync.Mutex
+
+	// mu protects the fields below
+	mu sync.Mutex
+
+	// nextID is the ID handed to the next transaction
+	nextID ID
+
+	// active maps the IDs of running transactions to the transactions
+	active map[ID]*TransactionImpl
+
+	// closed indicates if the manager is closed
+	closed bool
+
+	// loading is set while Load runs; transactions and snapshots wait on
+	// loaded to begin until it is cleared
+	loading bool
+	loaded  *sync.Cond
+
+	// stats tracks transaction statistics
+	stats TransactionStats
+
+	// committedDuration is the total duration of committed transactions
+	committedDuration time.Duration
+}
+
+// NewManager creates a transaction manager for the given storage engine.
+func NewManager(engine storage.StorageEngine, config *Config) (*ManagerImpl, error) {
+	if engine == nil {
+		return nil, fmt.Errorf("storage engine cannot be nil")
+	}
+
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	if config.MaxActiveTransactions <= 0 {
+		return nil, fmt.Errorf("max active transactions must be positive, got %d", config.MaxActiveTransactions)
+	}
+
+	if config.DefaultTimeout <= 0 {
+		return nil, fmt.Errorf("default timeout must be positive, got %v", config.DefaultTimeout)
+	}
+
+	if config.MaxVersionBytes < 0 {
+		return nil, fmt.Errorf("max version bytes cannot be negative, got %d", config.MaxVersionBytes)
+	}
+
+	if config.DefaultIsolationLevel == DefaultIsolation {
+		resolved := *config
+		resolved.DefaultIsolationLevel = ReadCommitted
+		config = &resolved
+	}
+
+	locks, err := lock.NewManager(&lock.Config{
+		DeadlockDetection: config.DeadlockDetection,
+		DetectionInterval: config.DeadlockDetectionInterval,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock manager: %w", err)
+	}
+
+	m := &ManagerImpl{
+		engine:   engine,
+		config:   config,
+		versions: newVersionStore(config.MaxVersionBytes),
+		locks:    locks,
+		nextID:   1,
+		active:   make(map[ID]*TransactionImpl),
+	}
+	m.loaded = sync.NewCond(&m.mu)
+	return m, nil
+}
+
+// Begin starts a new transaction with default options.
+func (m *ManagerImpl) Begin() (Transaction, error) {
+	return m.begin(context.Background(), nil)
+}
+
+// BeginWithContext starts a new transaction with the given context. The
+// transaction is rolled back when the context is cancelled.
+func (m *ManagerImpl) BeginWithContext(ctx context.Context) (Transaction, error) {
+	return m.begin(ctx, nil)
+}
+
+// BeginWithOptions starts a new transaction with specific options.
+func (m *ManagerImpl) BeginWithOptions(opts *TransactionOptions) (Transaction, error) {
+	return m.begin(context.Background(), opts)
+}
+
+// begin creates, registers and starts a transaction.
+func (m *ManagerImpl) begin(ctx context.Context, opts *TransactionOptions) (*TransactionImpl, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Fill in the manager defaults for unset options
+	var resolved TransactionOptions
+	if opts != nil {
+		resolved = *opts
+	}
+	if resolved.IsolationLevel == DefaultIsolation {
+		resolved.IsolationLevel = m.config.DefaultIsolationLevel
+	}
+	if resolved.Timeout <= 0 {
+		resolved.Timeout = m.config.DefaultTimeout
+	}
+
+	m.mu.Lock()
+	m.waitLoadedLocked()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, utils.ErrDatabaseClosed
+	}
+	if len(m.active) >= m.config.MaxActiveTransactions {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: limit is %d", utils.ErrTooManyTransactions, m.config.MaxActiveTransactions)
+	}
+
+	txn := newTransaction(m, m.nextID, ctx, resolved)
+	if resolved.IsolationLevel >= RepeatableRead && !resolved.Pessimistic {
+		m.versions.beginSnapshot(txn.id)
+		txn.snapshotted = true
+	}
+
+	m.nextID++
+	m.active[txn.id] = txn
+	m.stats.TotalTransactions++
+	m.stats.ActiveTransactions = int64(len(m.active))
+	m.mu.Unlock()
+
+	txn.start()
+	return txn, nil
+}
+
+// GetTransaction retrieves an active transaction by its ID.
+func (m *ManagerImpl) GetTransaction(id ID) (Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txn, ok := m.active[id]
+	if !ok {
+		return nil, utils.ErrTransactionNotFound
+	}
+	return txn, nil
+}
+
+// ActiveTransactions returns the number of currently active transactions.
+func (m *ManagerImpl) ActiveTransactions() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int64(len(m.active))
+}
+
+// Put stores a key-value pair outside of any transaction, as a commit of
+// its own.
+func (m *ManagerImpl) Put(key, value []byte) error {
+	batch := storage.NewWriteBatch()
+	batch.Put(key, value)
+	return m.autocommit(batch, nil)
+}
+
+// Delete removes a key outside of any transaction, as a commit of its own.
+// Returns utils.ErrKeyNotFound if the key does not exist.
+func (m *ManagerImpl) Delete(key []byte) error {
+	batch := storage.NewWriteBatch()
+	batch.Delete(key)
+	return m.autocommit(batch, func() error {
+		exists, err := m.engine.Exists(key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return utils.ErrKeyNotFound
+		}
+		return nil
+	})
+}
+
+// Write applies a batch of writes outside of any transaction as one atomic
+// commit. Writes to the storage engine that bypass the manager would be
+// visible to running snapshots and ignore locks, so all writes must go
+// through it.
+func (m *ManagerImpl) Write(batch *storage.WriteBatch) error {
+	return m.autocommit(batch, nil)
+}
+
+// Stats returns a snapshot of the transaction statistics.
+func (m *ManagerImpl) Stats() TransactionStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.DeadlockCount = m.locks.GetStatistics().Deadlocks
+	if stats.CommittedTransactions > 0 {
+		stats.AverageTransactionDuration = m.committedDuration / time.Duration(stats.CommittedTransactions)
+	}
+	return stats
+}
+
+// Close shuts down the transaction manager and rolls back any active transactions.
+func (m *ManagerImpl) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return utils.ErrDatabaseClosed
+	}
+	m.closed = true
+
+	active := make([]*TransactionImpl, 0, len(m.active))
+	for _, txn := range m.active {
+		active = append(active, txn)
+	}
+	m.mu.Unlock()
+
+	// Transactions that finish on their own in the meantime are skipped
+	for _, txn := range active {
+		txn.abort(utils.ErrTransactionRolledBack)
+	}
+
+	return m.locks.Close()
+}
+
+// Load runs load, which writes the storage engine directly rather than
+// through a write batch, such as a bulk load, as a commit of its own.
+// Running transactions and snapshots could neither see such a write as a
+// conflict nor read around it, so Load fails with
+// utils.ErrTransactionsActive while any is open, and those that begin while
+// it runs wait for it to finish.
+func (m *ManagerImpl) Load(load func() error) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return utils.ErrDatabaseClosed
+	}
+	if m.loading || len(m.active) > 0 || m.versions.running() > 0 {
+		m.mu.Unlock()
+		return utils.ErrTransactionsActive
+	}
+	m.loading = true
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		m.loading = false
+		m.loaded.Broadcast()
+		m.mu.Unlock()
+	}()
+
+	// Autocommits are committed around it
+	m.commitMu.Lock()
+	defer m.commitMu.Unlock()
+	return load()
+}
+
+// waitLoadedLocked waits for a running Load to finish (assumes mu is held).
+func (m *ManagerImpl) waitLoadedLocked() {
+	for m.loading {
+		m.loaded.Wait()
+	}
+}
+
+// checkOpen returns an error if the manager is closed.
+func (m *ManagerImpl) checkOpen() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return utils.ErrDatabaseClosed
+	}
+	return nil
+}
+
+// autocommit applies a batch as a commit of its own under exclusive locks on
+// its keys. check, if set, runs once the locks are held and may reject the
+// commit.
+func (m *ManagerImpl) autocommit(batch *storage.WriteBatch, check func() error) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return utils.ErrDatabaseClosed
+	}
+	owner := lock.OwnerID(m.nextID)
+	m.nextID++
+	m.mu.Unlock()
+
+	defer m.locks.ReleaseAll(owner)
+	if err := m.lockKeys(context.Background(), owner, batchKeys(batch)); err != nil {
+		return err
+	}
+
+	m.commitMu.Lock()
+	defer m.commitMu.Unlock()
+
+	if check != nil {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	return m.apply(batch)
+}
+
+// lockKeys takes exclusive locks on keys in the given order.
+func (m *ManagerImpl) lockKeys(ctx context.Context, owner lock.OwnerID, keys []string) error {
+	for _, key := range keys {
+		if err := m.locks.Lock(ctx, owner, []byte(key), lock.Exclusive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit validates a transaction against the commits made since its
+// snapshot and applies its writes (assumes the transaction lock is held).
+func (m *ManagerImpl) commit(txn *TransactionImpl, batch *storage.WriteBatch) error {
+	m.commitMu.Lock()
+	defer m.commitMu.Unlock()
+
+	if txn.snapshotted {
+		key, ok, err := m.versions.modifiedSince(txn.validationKeysLocked(), txn.id)
+		if err != nil {
+			return err
+		}
+		if ok {
+			m.mu.Lock()
+			m.stats.ConflictCount++
+			m.mu.Unlock()
+			return fmt.Errorf("%w: key %q was changed by a concurrent transaction", utils.ErrTransactionConflict, key)
+		}
+	}
+
+	return m.apply(batch)
+}
+
+// apply writes a batch to the storage engine as one commit, keeping the
+// replaced values for running snapshots (assumes commitMu is held).
+func (m *ManagerImpl) apply(batch *storage.WriteBatch) error {
+	ts := m.versions.nextTimestamp()
+
+	// Capture the values being replaced before the engine changes, unless
+	// no snapshot is running to read them
+	if !m.versions.skipVersions() {
+		versions, err := m.replacedVersions(batch, ts)
+		if err != nil {
+			return err
+		}
+		m.versions.prepare(versions)
+	}
+
+	if err := m.engine.Write(batch); err != nil {
+		m.versions.discard(ts)
+		return err
+	}
+	m.versions.publish(ts)
+
+	return nil
+}
+
+// replacedVersions reads the values a batch replaces from the storage
+// engine, as versions superseded at the given timestamp.
+func (m *ManagerImpl) replacedVersions(batch *storage.WriteBatch, ts uint64) ([]*version, error) {
+	var versions []*version
+	seen := make(map[string]bool, batch.Len())
+	err := batch.ForEach(func(key, _ []byte, _ bool) error {
+		if seen[string(key)] {
+			return nil
+		}
+		seen[string(key)] = true
+
+		value, err := m.engine.Get(key)
+		switch {
+		case err == nil:
+			versions = append(versions, &version{key: string(key), supersededAt: ts, value: value, existed: true})
+		case errors.Is(err, utils.ErrKeyNotFound):
+			versions = append(versions, &version{key: string(key), supersededAt: ts})
+		default:
+			return err
+		}
+		return nil
+	})
+	return versions, err
+}
+
+// batchKeys returns the distinct keys a batch writes, in key order.
+func batchKeys(batch *storage.WriteBatch) []string {
+	seen := make(map[string]bool, batch.Len())
+	keys := make([]string, 0, batch.Len())
+	_ = batch.ForEach(func(key, _ []byte, _ bool) error {
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			keys = append(keys, string(key))
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+// finish removes a finished transaction from the active set and records its
+// outcome.
+func (m *ManagerImpl) finish(txn *TransactionImpl, committed bool) {
+	if txn.snapshotted {
+		m.versions.endSnapshot(txn.id)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.active[txn.id]; !ok {
+		return
+	}
+	delete(m.active, txn.id)
+	m.stats.ActiveTransactions = int64(len(m.active))
+
+	if committed {
+		m.stats.CommittedTransactions++
+		m.committedDuration += time.Since(txn.startTime)
+	} else {
+		m.stats.RolledBackTransactions++
+	}
+}
+
+// Ensure ManagerImpl implements the Manager interface
+var _ Manager = (*ManagerImpl)(nil)
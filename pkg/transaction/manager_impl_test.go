@@ -0,0 +1,426 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thromel/go-database/pkg/storage"
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// newTestManager creates a transaction manager over an in-memory engine.
+func newTestManager(t *testing.T, config *Config) (*ManagerImpl, *storage.MemoryEngine) {
+	t.Helper()
+
+	engine := storage.NewMemoryEngine()
+	manager, err := NewManager(engine, config)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = manager.Close()
+		_ = engine.Close()
+	})
+	return manager, engine
+}
+
+func TestManager_MonotonicIDs(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	var last ID
+	for i := 0; i < 10; i++ {
+		txn, err := manager.Begin()
+		if err != nil {
+			t.Fatalf("Failed to begin: %v", err)
+		}
+		if txn.ID() <= last {
+			t.Errorf("Expected IDs to increase, got %d after %d", txn.ID(), last)
+		}
+		last = txn.ID()
+		if err := txn.Rollback(); err != nil {
+			t.Fatalf("Failed to roll back: %v", err)
+		}
+	}
+}
+
+func TestTransaction_ReadOwnWrites(t *testing.T) {
+	manager, engine := newTestManager(t, nil)
+
+	if err := engine.Put([]byte("a"), []byte("committed")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	txn, err := manager.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+
+	if value, err := txn.Get([]byte("a")); err != nil || string(value) != "committed" {
+		t.Errorf("Expected committed value, got %q (%v)", value, err)
+	}
+
+	if err := txn.Put([]byte("a"), []byte("mine")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if value, err := txn.Get([]byte("a")); err != nil || string(value) != "mine" {
+		t.Errorf("Expected own write, got %q (%v)", value, err)
+	}
+
+	if err := txn.Delete([]byte("a")); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if exists, err := txn.Exists([]byte("a")); err != nil || exists {
+		t.Errorf("Expected own delete to hide the key, got %v (%v)", exists, err)
+	}
+	if err := txn.Delete([]byte("a")); !errors.Is(err, utils.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound for a second delete, got %v", err)
+	}
+
+	// Nothing reaches the engine before commit
+	if value, err := engine.Get([]byte("a")); err != nil || string(value) != "committed" {
+		t.Errorf("Expected engine to be unchanged, got %q (%v)", value, err)
+	}
+}
+
+func TestTransaction_CommitAndRollback(t *testing.T) {
+	manager, engine := newTestManager(t, nil)
+
+	txn, err := manager.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	for _, key := range []string{"x", "y", "z"} {
+		if err := txn.Put([]byte(key), []byte("value")); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if size, _ := engine.Size(); size != 3 {
+		t.Errorf("Expected 3 keys after commit, got %d", size)
+	}
+
+	txn, err = manager.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if err := txn.Delete([]byte("x")); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if exists, _ := engine.Exists([]byte("x")); !exists {
+		t.Error("Expected rolled back delete to be discarded")
+	}
+
+	if err := txn.Rollback(); !errors.Is(err, utils.ErrTransactionRolledBack) {
+		t.Errorf("Expected ErrTransactionRolledBack, got %v", err)
+	}
+
+	stats := manager.Stats()
+	if stats.TotalTransactions != 2 || stats.CommittedTransactions != 1 || stats.RolledBackTransactions != 1 {
+		t.Errorf("Unexpected statistics: %+v", stats)
+	}
+}
+
+func TestTransaction_CommitIsAtomic(t *testing.T) {
+	manager, engine := newTestManager(t, nil)
+
+	txn, err := manager.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if err := txn.Put([]byte("ok"), []byte("value")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := txn.Put(make([]byte, 70000), []byte("value")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	// The oversized key fails the batch, and with it the whole transaction
+	if err := txn.Commit(); !errors.Is(err, utils.ErrKeyTooLarge) {
+		t.Fatalf("Expected ErrKeyTooLarge, got %v", err)
+	}
+	if exists, _ := engine.Exists([]byte("ok")); exists {
+		t.Error("Expected no writes to be applied from a failed commit")
+	}
+	if manager.ActiveTransactions() != 0 {
+		t.Errorf("Expected failed commit to end the transaction")
+	}
+}
+
+func TestTransaction_ReadOnly(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	txn, err := manager.BeginWithOptions(&TransactionOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	defer txn.Rollback()
+
+	if !txn.IsReadOnly() {
+		t.Error("Expected read-only transaction")
+	}
+	if err := txn.Put([]byte("key"), []byte("value")); !errors.Is(err, utils.ErrTransactionReadOnly) {
+		t.Errorf("Expected ErrTransactionReadOnly, got %v", err)
+	}
+}
+
+func TestManager_DefaultIsolationLevel(t *testing.T) {
+	config := DefaultConfig()
+	config.DefaultIsolationLevel = RepeatableRead
+	manager, _ := newTestManager(t, config)
+
+	// Options that set other fields keep the default level
+	for _, opts := range []*TransactionOptions{nil, {ReadOnly: true}, {Timeout: time.Minute}} {
+		txn, err := manager.BeginWithOptions(opts)
+		if err != nil {
+			t.Fatalf("Failed to begin: %v", err)
+		}
+		if level := txn.(*TransactionImpl).IsolationLevel(); level != RepeatableRead {
+			t.Errorf("Expected %s for options %+v, got %s", RepeatableRead, opts, level)
+		}
+		if err := txn.Rollback(); err != nil {
+			t.Fatalf("Failed to roll back: %v", err)
+		}
+	}
+
+	txn, err := manager.BeginWithOptions(&TransactionOptions{IsolationLevel: ReadUncommitted})
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	defer txn.Rollback()
+	if level := txn.(*TransactionImpl).IsolationLevel(); level != ReadUncommitted {
+		t.Errorf("Expected %s when set, got %s", ReadUncommitted, level)
+	}
+
+	// A configuration without a default level reads committed values
+	manager, _ = newTestManager(t, &Config{MaxActiveTransactions: 1, DefaultTimeout: time.Minute})
+	txn, err = manager.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	defer txn.Rollback()
+	if level := txn.(*TransactionImpl).IsolationLevel(); level != ReadCommitted {
+		t.Errorf("Expected %s by default, got %s", ReadCommitted, level)
+	}
+}
+
+func TestManager_Load(t *testing.T) {
+	manager, engine := newTestManager(t, nil)
+
+	txn, err := manager.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if err := manager.Load(func() error { return nil }); !errors.Is(err, utils.ErrTransactionsActive) {
+		t.Errorf("Expected ErrTransactionsActive, got %v", err)
+	}
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+
+	// Transactions and snapshots begun during a load wait for it
+	release := make(chan struct{})
+	loading := make(chan struct{})
+	loaded := async(func() error {
+		return manager.Load(func() error {
+			close(loading)
+			<-release
+			return engine.Put([]byte("k"), []byte("loaded"))
+		})
+	})
+	<-loading
+	begun := async(func() error {
+		txn, err := manager.BeginWithOptions(&TransactionOptions{IsolationLevel: RepeatableRead})
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback()
+		if value, err := txn.Get([]byte("k")); err != nil || string(value) != "loaded" {
+			return fmt.Errorf("expected the loaded value, got %q (%v)", value, err)
+		}
+		return nil
+	})
+	taken := async(func() error {
+		snapshot, err := manager.Snapshot()
+		if err != nil {
+			return err
+		}
+		return snapshot.Release()
+	})
+	expectWaiting(t, begun)
+	expectWaiting(t, taken)
+
+	close(release)
+	for _, result := range []<-chan error{loaded, begun, taken} {
+		if err := expectDone(t, result); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+}
+
+func TestManager_MaxActiveTransactions(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxActiveTransactions = 2
+	manager, _ := newTestManager(t, config)
+
+	first, err := manager.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if _, err := manager.Begin(); err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+
+	if _, err := manager.Begin(); !errors.Is(err, utils.ErrTooManyTransactions) {
+		t.Errorf("Expected ErrTooManyTransactions, got %v", err)
+	}
+
+	if err := first.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if _, err := manager.Begin(); err != nil {
+		t.Errorf("Expected a slot to be free after commit, got %v", err)
+	}
+}
+
+func TestTransaction_Timeout(t *testing.T) {
+	config := DefaultConfig()
+	config.DefaultTimeout = 20 * time.Millisecond
+	manager, _ := newTestManager(t, config)
+
+	txn, err := manager.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+
+	// The timer rolls the transaction back without further calls
+	deadline := time.Now().Add(time.Second)
+	for manager.ActiveTransactions() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if manager.ActiveTransactions() != 0 {
+		t.Fatal("Expected timed out transaction to be rolled back")
+	}
+
+	if _, err := txn.Get([]byte("key")); !errors.Is(err, utils.ErrTransactionTimeout) {
+		t.Errorf("Expected ErrTransactionTimeout, got %v", err)
+	}
+
+	// SetDeadline replaces the default timeout
+	txn, err = manager.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if err := txn.SetDeadline(time.Now().Add(-time.Millisecond)); err != nil {
+		t.Fatalf("Failed to set deadline: %v", err)
+	}
+	if err := txn.Commit(); !errors.Is(err, utils.ErrTransactionTimeout) {
+		t.Errorf("Expected ErrTransactionTimeout after the deadline, got %v", err)
+	}
+}
+
+func TestTransaction_ContextCancel(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	txn, err := manager.BeginWithContext(ctx)
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if txn.Context() != ctx {
+		t.Error("Expected transaction to keep its context")
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for manager.ActiveTransactions() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := txn.Put([]byte("key"), []byte("value")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	if _, err := manager.BeginWithContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancelled context to be rejected, got %v", err)
+	}
+}
+
+func TestManager_GetTransactionAndClose(t *testing.T) {
+	manager, engine := newTestManager(t, nil)
+
+	txn, err := manager.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if err := txn.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	found, err := manager.GetTransaction(txn.ID())
+	if err != nil || found != txn {
+		t.Errorf("Expected to find active transaction, got %v (%v)", found, err)
+	}
+	if _, err := manager.GetTransaction(txn.ID() + 100); !errors.Is(err, utils.ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Failed to close manager: %v", err)
+	}
+
+	if err := txn.Commit(); !errors.Is(err, utils.ErrTransactionRolledBack) {
+		t.Errorf("Expected Close to roll back active transactions, got %v", err)
+	}
+	if exists, _ := engine.Exists([]byte("key")); exists {
+		t.Error("Expected rolled back write to be discarded")
+	}
+	if _, err := manager.Begin(); !errors.Is(err, utils.ErrDatabaseClosed) {
+		t.Errorf("Expected ErrDatabaseClosed, got %v", err)
+	}
+}
+
+func TestManager_ConcurrentTransactions(t *testing.T) {
+	manager, engine := newTestManager(t, nil)
+
+	const numWorkers = 8
+	const numTxns = 50
+
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < numTxns; i++ {
+				txn, err := manager.Begin()
+				if err != nil {
+					t.Errorf("Failed to begin: %v", err)
+					return
+				}
+				key := []byte{byte(worker), byte(i)}
+				if err := txn.Put(key, []byte("value")); err != nil {
+					t.Errorf("Failed to put: %v", err)
+				}
+				if err := txn.Commit(); err != nil {
+					t.Errorf("Failed to commit: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if size, _ := engine.Size(); size != numWorkers*numTxns {
+		t.Errorf("Expected %d keys, got %d", numWorkers*numTxns, size)
+	}
+	if stats := manager.Stats(); stats.CommittedTransactions != numWorkers*numTxns {
+		t.Errorf("Expected %d commits, got %d", numWorkers*numTxns, stats.CommittedTransactions)
+	}
+}
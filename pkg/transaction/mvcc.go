@@ -0,0 +1,343 @@
+package transaction
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// version is the value a key held before a commit replaced it. The storage
+// engine always holds the newest committed value of every key; versions keep
+// the older values that running snapshots may still need.
+type version struct {
+	// key is the key that was changed
+	key string
+
+	// supersededAt is the timestamp of the commit that replaced the value
+	supersededAt uint64
+
+	// value is the replaced value
+	value []byte
+
+	// existed reports whether the key existed before the commit
+	existed bool
+}
+
+// bytes returns the memory the version's key and value take.
+func (v *version) bytes() int64 {
+	return int64(len(v.key) + len(v.value))
+}
+
+// versionStore implements multi-version concurrency control on top of a
+// single-version storage engine. Every commit gets a timestamp from a
+// logical clock, and snapshot transactions read the committed state as of
+// the timestamp they started at by consulting per-key version chains.
+//
+// Versions are held in memory until no snapshot can read them. Their keys
+// and values may take up to limit bytes; a commit that would take more
+// expires the oldest snapshots, whose reads then fail with
+// utils.ErrSnapshotTooOld, until the versions still needed fit.
+type versionStore struct {
+	// mu protects the fields below
+	mu sync.RWMutex
+
+	// commitTS is the timestamp of the newest commit visible to new snapshots
+	commitTS uint64
+
+	// history holds all versions in timestamp order, for garbage collection
+	history []*version
+
+	// chains holds the versions of each key in timestamp order, and keys
+	// the keys that have them, in key order
+	chains map[string][]*version
+	keys   *keyIndex
+
+	// snapshots maps running snapshot transactions to their timestamps, and
+	// expired holds those dropped to keep the versions within limit
+	snapshots map[ID]uint64
+	expired   map[ID]bool
+
+	// held is the number of bytes of keys and values the versions take, and
+	// limit the most they may take (0 means no limit)
+	held  int64
+	limit int64
+
+	// unversioned is set while a commit that recorded no versions writes
+	// the storage engine, and settled signals when it is cleared
+	unversioned bool
+	settled     *sync.Cond
+}
+
+// newVersionStore creates an empty version store whose versions may take up
+// to limit bytes (0 means no limit).
+func newVersionStore(limit int64) *versionStore {
+	vs := &versionStore{
+		chains:    make(map[string][]*version),
+		keys:      newKeyIndex(),
+		snapshots: make(map[ID]uint64),
+		expired:   make(map[ID]bool),
+		limit:     limit,
+	}
+	vs.settled = sync.NewCond(&vs.mu)
+	return vs
+}
+
+// beginSnapshot registers a snapshot transaction, which reads the newest
+// committed state. It waits for a commit that recorded no
+// versions to finish, since the snapshot could not tell its writes from the
+// committed state.
+func (vs *versionStore) beginSnapshot(id ID) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	for vs.unversioned {
+		vs.settled.Wait()
+	}
+	vs.snapshots[id] = vs.commitTS
+}
+
+// running returns the number of registered snapshots.
+func (vs *versionStore) running() int {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	return len(vs.snapshots)
+}
+
+// endSnapshot unregisters a snapshot transaction and drops the versions no
+// remaining snapshot can read.
+func (vs *versionStore) endSnapshot(id ID) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	delete(vs.snapshots, id)
+	delete(vs.expired, id)
+	vs.collectLocked()
+}
+
+// read returns the value of a key as of a snapshot. get reads the newest
+// committed value from the storage engine. The engine is read before the
+// chains are consulted: a commit records its versions before writing the
+// engine, so a value newer than the snapshot is always covered by a version.
+func (vs *versionStore) read(key []byte, id ID, get func() ([]byte, error)) ([]byte, error) {
+	value, getErr := get()
+	if getErr != nil && !errors.Is(getErr, utils.ErrKeyNotFound) {
+		return nil, getErr
+	}
+
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	snapshot, err := vs.timestampLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	if v := vs.visibleLocked(string(key), snapshot); v != nil {
+		if !v.existed {
+			return nil, utils.ErrKeyNotFound
+		}
+		return append([]byte{}, v.value...), nil
+	}
+
+	return value, getErr
+}
+
+// modifiedSince returns the first of the given keys that a commit after the
+// snapshot changed.
+func (vs *versionStore) modifiedSince(keys []string, id ID) (string, bool, error) {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	snapshot, err := vs.timestampLocked(id)
+	if err != nil {
+		return "", false, err
+	}
+	for _, key := range keys {
+		if vs.visibleLocked(key, snapshot) != nil {
+			return key, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// lookup returns the version of a key as of a snapshot, or nil if the
+// storage engine holds the key's value as of the snapshot.
+func (vs *versionStore) lookup(key string, id ID) (*version, error) {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+
+	snapshot, err := vs.timestampLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	return vs.visibleLocked(key, snapshot), nil
+}
+
+// timestampLocked returns the timestamp of a registered snapshot, or
+// utils.ErrSnapshotTooOld if it expired (assumes lock is held).
+func (vs *versionStore) timestampLocked(id ID) (uint64, error) {
+	if vs.expired[id] {
+		return 0, utils.ErrSnapshotTooOld
+	}
+	return vs.snapshots[id], nil
+}
+
+// nextKey returns the first key with versions after from in the given
+// direction, or at it if inclusive; a nil from starts at the first or last
+// key. It reports false if there is none.
+func (vs *versionStore) nextKey(from []byte, inclusive, forward bool) (string, bool) {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	return vs.keys.seek(from, inclusive, forward)
+}
+
+// nextTimestamp returns the timestamp the next commit will get. Commits are
+// serialized by the caller.
+func (vs *versionStore) nextTimestamp() uint64 {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	return vs.commitTS + 1
+}
+
+// skipVersions reports whether the next commit can skip recording versions
+// because no snapshot is running to read them. If so, new snapshots wait
+// until the commit is published or discarded. Otherwise prepare records
+// them, within the store's limit. Commits are serialized by the caller.
+func (vs *versionStore) skipVersions() bool {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.unversioned = len(vs.snapshots) == 0
+	return vs.unversioned
+}
+
+// prepare records the versions a commit with the given timestamp replaces.
+// It must be called before the commit writes the storage engine. Versions
+// are kept in memory, so if they would take more than the store's limit,
+// the oldest snapshots are expired until the ones still needed fit; a
+// commit larger than the limit on its own expires every snapshot.
+func (vs *versionStore) prepare(versions []*version) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	for _, v := range versions {
+		vs.history = append(vs.history, v)
+		if len(vs.chains[v.key]) == 0 {
+			vs.keys.insert(v.key)
+		}
+		vs.chains[v.key] = append(vs.chains[v.key], v)
+		vs.held += v.bytes()
+	}
+
+	for vs.limit > 0 && vs.held > vs.limit && len(vs.snapshots) > 0 {
+		vs.expireOldestLocked()
+	}
+}
+
+// expireOldestLocked expires the snapshots with the oldest timestamp and
+// drops the versions only they could read (assumes lock is held).
+func (vs *versionStore) expireOldestLocked() {
+	oldest := vs.oldestLocked()
+	for id, ts := range vs.snapshots {
+		if ts == oldest {
+			delete(vs.snapshots, id)
+			vs.expired[id] = true
+		}
+	}
+	vs.collectLocked()
+}
+
+// publish makes a commit visible to new snapshots.
+func (vs *versionStore) publish(ts uint64) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	vs.commitTS = ts
+	vs.collectLocked()
+	vs.settleLocked()
+}
+
+// discard removes the versions recorded for a commit that failed to write
+// the storage engine. They are the newest versions in the store.
+func (vs *versionStore) discard(ts uint64) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+
+	for len(vs.history) > 0 && vs.history[len(vs.history)-1].supersededAt == ts {
+		v := vs.history[len(vs.history)-1]
+		vs.history = vs.history[:len(vs.history)-1]
+		vs.dropLocked(v.key, len(vs.chains[v.key])-1)
+	}
+	vs.settleLocked()
+}
+
+// settleLocked lets snapshots waiting for a commit without versions begin
+// (assumes lock is held).
+func (vs *versionStore) settleLocked() {
+	if vs.unversioned {
+		vs.unversioned = false
+		vs.settled.Broadcast()
+	}
+}
+
+// size returns the number of versions held.
+func (vs *versionStore) size() int {
+	vs.mu.RLock()
+	defer vs.mu.RUnlock()
+	return len(vs.history)
+}
+
+// visibleLocked returns the version of a key as of the snapshot timestamp:
+// the value replaced by the first commit after the snapshot. It returns nil
+// if no commit after the snapshot changed the key (assumes lock is held).
+func (vs *versionStore) visibleLocked(key string, snapshot uint64) *version {
+	chain := vs.chains[key]
+	i := sort.Search(len(chain), func(i int) bool {
+		return chain[i].supersededAt > snapshot
+	})
+	if i == len(chain) {
+		return nil
+	}
+	return chain[i]
+}
+
+// oldestLocked returns the timestamp of the oldest running snapshot, or the
+// newest commit's if none is running (assumes lock is held).
+func (vs *versionStore) oldestLocked() uint64 {
+	oldest := vs.commitTS
+	for _, ts := range vs.snapshots {
+		if ts < oldest {
+			oldest = ts
+		}
+	}
+	return oldest
+}
+
+// collectLocked drops the versions that no running snapshot can read: those
+// replaced at or before the oldest snapshot (assumes lock is held).
+func (vs *versionStore) collectLocked() {
+	oldest := vs.oldestLocked()
+
+	n := 0
+	for n < len(vs.history) && vs.history[n].supersededAt <= oldest {
+		vs.dropLocked(vs.history[n].key, 0)
+		vs.history[n] = nil
+		n++
+	}
+	vs.history = vs.history[n:]
+}
+
+// dropLocked removes the version at index i from a key's chain (assumes lock
+// is held).
+func (vs *versionStore) dropLocked(key string, i int) {
+	chain := vs.chains[key]
+	vs.held -= chain[i].bytes()
+	chain = append(chain[:i], chain[i+1:]...)
+	if len(chain) == 0 {
+		delete(vs.chains, key)
+		vs.keys.remove(key)
+		return
+	}
+	vs.chains[key] = chain
+}
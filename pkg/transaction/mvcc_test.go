@@ -0,0 +1,440 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage"
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// beginLevel starts a transaction with the given isolation level.
+func beginLevel(t *testing.T, manager *ManagerImpl, level IsolationLevel) Transaction {
+	t.Helper()
+
+	txn, err := manager.BeginWithOptions(&TransactionOptions{IsolationLevel: level})
+	if err != nil {
+		t.Fatalf("Failed to begin %s transaction: %v", level, err)
+	}
+	return txn
+}
+
+// mustGet reads a key and fails the test on error.
+func mustGet(t *testing.T, txn Transaction, key string) string {
+	t.Helper()
+
+	value, err := txn.Get([]byte(key))
+	if err != nil {
+		t.Fatalf("Failed to get %s: %v", key, err)
+	}
+	return string(value)
+}
+
+// observedEngine is a storage engine that counts reads and can hold writes
+// until released.
+type observedEngine struct {
+	storage.StorageEngine
+	gets    atomic.Int64
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (e *observedEngine) Get(key []byte) ([]byte, error) {
+	e.gets.Add(1)
+	return e.StorageEngine.Get(key)
+}
+
+func (e *observedEngine) Write(batch *storage.WriteBatch) error {
+	if e.release != nil {
+		e.writing <- struct{}{}
+		<-e.release
+	}
+	return e.StorageEngine.Write(batch)
+}
+
+func TestMVCC_VersionsOnlyForSnapshots(t *testing.T) {
+	engine := &observedEngine{StorageEngine: storage.NewMemoryEngine()}
+	manager, err := NewManager(engine, nil)
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	defer manager.Close()
+
+	// Without snapshots, writes do not read the values they replace
+	if err := manager.Put([]byte("k"), []byte("v1")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := manager.Delete([]byte("k")); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if gets := engine.gets.Load(); gets != 0 {
+		t.Errorf("Expected no reads, got %d", gets)
+	}
+
+	// A snapshot needs them
+	if err := manager.Put([]byte("k"), []byte("v2")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	snapshot, err := manager.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	if err := manager.Put([]byte("k"), []byte("v3")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if value, err := snapshot.Get([]byte("k")); err != nil || string(value) != "v2" {
+		t.Errorf("Expected the snapshot to read v2, got %q (%v)", value, err)
+	}
+	if err := snapshot.Release(); err != nil {
+		t.Fatalf("Failed to release snapshot: %v", err)
+	}
+
+	// A snapshot taken while a write without versions runs waits for it
+	engine.writing, engine.release = make(chan struct{}), make(chan struct{})
+	put := async(func() error { return manager.Put([]byte("k"), []byte("v4")) })
+	<-engine.writing
+	var later Snapshot
+	taken := async(func() (err error) {
+		later, err = manager.Snapshot()
+		return err
+	})
+	expectWaiting(t, taken)
+	close(engine.release)
+	if err := expectDone(t, put); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := expectDone(t, taken); err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	defer later.Release()
+	if value, err := later.Get([]byte("k")); err != nil || string(value) != "v4" {
+		t.Errorf("Expected the snapshot to read v4, got %q (%v)", value, err)
+	}
+}
+
+func TestMVCC_SnapshotReads(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	if err := manager.Put([]byte("k"), []byte("v1")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := manager.Put([]byte("gone"), []byte("v1")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	snapshot := beginLevel(t, manager, RepeatableRead)
+	committed := beginLevel(t, manager, ReadCommitted)
+
+	// Commits after the snapshot: an update, a delete and an insert
+	if err := manager.Put([]byte("k"), []byte("v2")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := manager.Delete([]byte("gone")); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := manager.Put([]byte("new"), []byte("v1")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	if value := mustGet(t, snapshot, "k"); value != "v1" {
+		t.Errorf("Expected snapshot to read v1, got %s", value)
+	}
+	if value := mustGet(t, snapshot, "gone"); value != "v1" {
+		t.Errorf("Expected snapshot to still see the deleted key, got %s", value)
+	}
+	if exists, _ := snapshot.Exists([]byte("new")); exists {
+		t.Error("Expected snapshot not to see a key inserted after it began")
+	}
+
+	if value := mustGet(t, committed, "k"); value != "v2" {
+		t.Errorf("Expected read committed to read v2, got %s", value)
+	}
+	if exists, _ := committed.Exists([]byte("gone")); exists {
+		t.Error("Expected read committed to see the delete")
+	}
+
+	if err := snapshot.Commit(); err != nil {
+		t.Fatalf("Failed to commit read-only snapshot: %v", err)
+	}
+	if err := committed.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	// Versions are dropped once no snapshot can read them
+	if n := manager.versions.size(); n != 0 {
+		t.Errorf("Expected all versions to be collected, %d remain", n)
+	}
+}
+
+func TestMVCC_WriteWriteConflict(t *testing.T) {
+	for _, level := range []IsolationLevel{RepeatableRead, Serializable} {
+		t.Run(level.String(), func(t *testing.T) {
+			manager, _ := newTestManager(t, nil)
+
+			first := beginLevel(t, manager, level)
+			second := beginLevel(t, manager, level)
+
+			if err := first.Put([]byte("k"), []byte("first")); err != nil {
+				t.Fatalf("Failed to put: %v", err)
+			}
+			if err := second.Put([]byte("k"), []byte("second")); err != nil {
+				t.Fatalf("Failed to put: %v", err)
+			}
+
+			if err := first.Commit(); err != nil {
+				t.Fatalf("Expected first committer to win, got %v", err)
+			}
+			if err := second.Commit(); !errors.Is(err, utils.ErrTransactionConflict) {
+				t.Fatalf("Expected ErrTransactionConflict, got %v", err)
+			}
+
+			// The loser is rolled back
+			if err := second.Rollback(); !errors.Is(err, utils.ErrTransactionRolledBack) {
+				t.Errorf("Expected conflicting transaction to be rolled back, got %v", err)
+			}
+			if stats := manager.Stats(); stats.ConflictCount != 1 {
+				t.Errorf("Expected 1 conflict, got %d", stats.ConflictCount)
+			}
+
+			check := beginLevel(t, manager, ReadCommitted)
+			defer check.Rollback()
+			if value := mustGet(t, check, "k"); value != "first" {
+				t.Errorf("Expected the first commit to survive, got %s", value)
+			}
+		})
+	}
+}
+
+func TestMVCC_WriteSkew(t *testing.T) {
+	// Each transaction reads one key and writes the other. Snapshot isolation
+	// lets both commit; serializable must reject the second.
+	tests := []struct {
+		level    IsolationLevel
+		conflict bool
+	}{
+		{RepeatableRead, false},
+		{Serializable, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			manager, _ := newTestManager(t, nil)
+
+			for _, key := range []string{"x", "y"} {
+				if err := manager.Put([]byte(key), []byte("0")); err != nil {
+					t.Fatalf("Failed to put: %v", err)
+				}
+			}
+
+			first := beginLevel(t, manager, tt.level)
+			second := beginLevel(t, manager, tt.level)
+
+			mustGet(t, first, "x")
+			mustGet(t, second, "y")
+			if err := first.Put([]byte("y"), []byte("1")); err != nil {
+				t.Fatalf("Failed to put: %v", err)
+			}
+			if err := second.Put([]byte("x"), []byte("1")); err != nil {
+				t.Fatalf("Failed to put: %v", err)
+			}
+
+			if err := first.Commit(); err != nil {
+				t.Fatalf("Failed to commit first transaction: %v", err)
+			}
+
+			err := second.Commit()
+			if tt.conflict && !errors.Is(err, utils.ErrTransactionConflict) {
+				t.Errorf("Expected ErrTransactionConflict, got %v", err)
+			}
+			if !tt.conflict && err != nil {
+				t.Errorf("Expected write skew to be allowed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCC_ReadOnlySerializableNeverConflicts(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	if err := manager.Put([]byte("k"), []byte("v1")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	reader := beginLevel(t, manager, Serializable)
+	mustGet(t, reader, "k")
+
+	if err := manager.Put([]byte("k"), []byte("v2")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	if err := reader.Commit(); err != nil {
+		t.Errorf("Expected read-only transaction to commit, got %v", err)
+	}
+}
+
+func TestMVCC_StableSnapshotUnderConcurrentWrites(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	// Accounts whose balances always sum to the same total
+	const numAccounts = 20
+	const initialBalance = 100
+	account := func(i int) []byte { return []byte(fmt.Sprintf("account-%02d", i)) }
+	encode := func(n uint64) []byte { return binary.BigEndian.AppendUint64(nil, n) }
+
+	for i := 0; i < numAccounts; i++ {
+		if err := manager.Put(account(i), encode(initialBalance)); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	// Writers move money between accounts, retrying on conflicts
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				from, to := account((worker+i)%numAccounts), account((worker+3*i+1)%numAccounts)
+				if string(from) == string(to) {
+					continue
+				}
+
+				txn, err := manager.BeginWithOptions(&TransactionOptions{IsolationLevel: RepeatableRead})
+				if err != nil {
+					t.Errorf("Failed to begin: %v", err)
+					return
+				}
+				fromValue, err1 := txn.Get(from)
+				toValue, err2 := txn.Get(to)
+				if err1 != nil || err2 != nil {
+					t.Errorf("Failed to read balances: %v %v", err1, err2)
+					_ = txn.Rollback()
+					return
+				}
+				fromBalance := binary.BigEndian.Uint64(fromValue)
+				if fromBalance == 0 {
+					_ = txn.Rollback()
+					continue
+				}
+				_ = txn.Put(from, encode(fromBalance-1))
+				_ = txn.Put(to, encode(binary.BigEndian.Uint64(toValue)+1))
+				if err := txn.Commit(); err != nil && !errors.Is(err, utils.ErrTransactionConflict) {
+					t.Errorf("Failed to commit transfer: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+
+	// Long read-only scans must always see the same total
+	for scan := 0; scan < 50; scan++ {
+		txn, err := manager.BeginWithOptions(&TransactionOptions{IsolationLevel: RepeatableRead, ReadOnly: true})
+		if err != nil {
+			t.Fatalf("Failed to begin scan: %v", err)
+		}
+
+		var total uint64
+		for i := 0; i < numAccounts; i++ {
+			value, err := txn.Get(account(i))
+			if err != nil {
+				t.Fatalf("Failed to read account: %v", err)
+			}
+			total += binary.BigEndian.Uint64(value)
+		}
+		if total != numAccounts*initialBalance {
+			t.Fatalf("Scan %d saw an inconsistent total %d", scan, total)
+		}
+
+		if err := txn.Commit(); err != nil {
+			t.Fatalf("Failed to finish scan: %v", err)
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+
+	if n := manager.versions.size(); n != 0 {
+		t.Errorf("Expected all versions to be collected, %d remain", n)
+	}
+}
+
+func TestMVCC_VersionMemoryLimit(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxVersionBytes = 1000
+	manager, _ := newTestManager(t, config)
+
+	big := func(b byte) []byte { return bytes.Repeat([]byte{b}, 950) }
+	if err := manager.Put([]byte("a"), bytes.Repeat([]byte{'a'}, 100)); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := manager.Put([]byte("big"), big('1')); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	old, err := manager.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+	defer old.Release()
+	if err := manager.Put([]byte("a"), []byte("changed")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	txn := beginLevel(t, manager, RepeatableRead)
+
+	// The versions no longer fit, so the oldest snapshot expires and the
+	// version only it could read is dropped
+	if err := manager.Put([]byte("big"), big('2')); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if _, err := old.Get([]byte("a")); !errors.Is(err, utils.ErrSnapshotTooOld) {
+		t.Errorf("Expected ErrSnapshotTooOld, got %v", err)
+	}
+	it := old.NewIterator(nil, nil)
+	if it.SeekToFirst(); it.Valid() || !errors.Is(it.Error(), utils.ErrSnapshotTooOld) {
+		t.Errorf("Expected the scan to fail with ErrSnapshotTooOld, got %v", it.Error())
+	}
+	it.Close()
+	if value := mustGet(t, txn, "big"); value != string(big('1')) {
+		t.Errorf("Expected the newer snapshot to read the first value, got %d bytes", len(value))
+	}
+	if n := manager.versions.size(); n != 1 {
+		t.Errorf("Expected 1 version to remain, got %d", n)
+	}
+
+	// A commit larger than the limit on its own expires every snapshot
+	if err := manager.Put([]byte("big"), big('3')); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if _, err := txn.Get([]byte("a")); !errors.Is(err, utils.ErrSnapshotTooOld) {
+		t.Errorf("Expected ErrSnapshotTooOld, got %v", err)
+	}
+	if err := txn.Put([]byte("c"), []byte("v")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := txn.Commit(); !errors.Is(err, utils.ErrSnapshotTooOld) {
+		t.Errorf("Expected the commit to fail with ErrSnapshotTooOld, got %v", err)
+	}
+	if err := old.Release(); err != nil {
+		t.Errorf("Failed to release expired snapshot: %v", err)
+	}
+
+	manager.versions.mu.RLock()
+	defer manager.versions.mu.RUnlock()
+	if len(manager.versions.history) != 0 || manager.versions.held != 0 || len(manager.versions.expired) != 0 {
+		t.Errorf("Expected an empty version store, got %d versions of %d bytes and %d expired snapshots",
+			len(manager.versions.history), manager.versions.held, len(manager.versions.expired))
+	}
+}
@@ -0,0 +1,228 @@
+package transaction
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/thromel/go-database/pkg/transaction/lock"
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// beginPessimistic starts a pessimistic transaction.
+func beginPessimistic(t *testing.T, manager *ManagerImpl) *TransactionImpl {
+	t.Helper()
+
+	txn, err := manager.BeginWithOptions(&TransactionOptions{Pessimistic: true})
+	if err != nil {
+		t.Fatalf("Failed to begin pessimistic transaction: %v", err)
+	}
+	return txn.(*TransactionImpl)
+}
+
+// async runs fn in the background and returns its outcome channel.
+func async(fn func() error) <-chan error {
+	result := make(chan error, 1)
+	go func() { result <- fn() }()
+	return result
+}
+
+// expectWaiting checks that a background operation has not completed.
+func expectWaiting(t *testing.T, result <-chan error) {
+	t.Helper()
+
+	select {
+	case err := <-result:
+		t.Fatalf("Expected operation to wait for a lock, got %v", err)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+// expectDone waits for a background operation and returns its error.
+func expectDone(t *testing.T, result <-chan error) error {
+	t.Helper()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected operation to complete")
+		return nil
+	}
+}
+
+func TestPessimistic_WriterBlocksReader(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	if err := manager.Put([]byte("k"), []byte("v1")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	writer := beginPessimistic(t, manager)
+	if err := writer.Put([]byte("k"), []byte("v2")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	reader := beginPessimistic(t, manager)
+	var value []byte
+	read := async(func() error {
+		var err error
+		value, err = reader.Get([]byte("k"))
+		return err
+	})
+	expectWaiting(t, read)
+
+	// Writes outside transactions also respect the lock
+	put := async(func() error { return manager.Put([]byte("k"), []byte("v3")) })
+	expectWaiting(t, put)
+
+	if err := writer.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if err := expectDone(t, read); err != nil {
+		t.Fatalf("Failed to read after commit: %v", err)
+	}
+	if string(value) != "v2" {
+		t.Errorf("Expected reader to see the committed value v2, got %s", value)
+	}
+
+	// The reader's shared lock keeps the autocommit waiting until it ends
+	expectWaiting(t, put)
+	if err := reader.Commit(); err != nil {
+		t.Fatalf("Failed to commit reader: %v", err)
+	}
+	if err := expectDone(t, put); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+}
+
+func TestPessimistic_Deadlock(t *testing.T) {
+	config := DefaultConfig()
+	config.DeadlockDetectionInterval = 5 * time.Millisecond
+	manager, _ := newTestManager(t, config)
+
+	older := beginPessimistic(t, manager)
+	younger := beginPessimistic(t, manager)
+
+	if err := older.Put([]byte("a"), []byte("older")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+	if err := younger.Put([]byte("b"), []byte("younger")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	olderWait := async(func() error { return older.Put([]byte("b"), []byte("older")) })
+	expectWaiting(t, olderWait)
+
+	// Closing the cycle makes the younger transaction the victim
+	err := younger.Put([]byte("a"), []byte("younger"))
+	if !errors.Is(err, utils.ErrTransactionDeadlock) {
+		t.Fatalf("Expected ErrTransactionDeadlock, got %v", err)
+	}
+	if err := younger.Commit(); !errors.Is(err, utils.ErrTransactionDeadlock) {
+		t.Errorf("Expected the victim to be rolled back, got %v", err)
+	}
+
+	if err := expectDone(t, olderWait); err != nil {
+		t.Fatalf("Expected the older transaction to proceed, got %v", err)
+	}
+	if err := older.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	if stats := manager.Stats(); stats.DeadlockCount != 1 {
+		t.Errorf("Expected 1 deadlock, got %d", stats.DeadlockCount)
+	}
+}
+
+func TestPessimistic_TimeoutWhileWaiting(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	holder := beginPessimistic(t, manager)
+	defer holder.Rollback()
+	if err := holder.Put([]byte("k"), []byte("value")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	waiter, err := manager.BeginWithOptions(&TransactionOptions{Pessimistic: true, Timeout: 30 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if _, err := waiter.Get([]byte("k")); !errors.Is(err, utils.ErrTransactionTimeout) {
+		t.Errorf("Expected ErrTransactionTimeout, got %v", err)
+	}
+	if err := waiter.Commit(); !errors.Is(err, utils.ErrTransactionTimeout) {
+		t.Errorf("Expected the timed out transaction to be rolled back, got %v", err)
+	}
+}
+
+func TestPessimistic_RollbackWhileWaiting(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	holder := beginPessimistic(t, manager)
+	defer holder.Rollback()
+	if err := holder.Put([]byte("k"), []byte("value")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	waiter := beginPessimistic(t, manager)
+	put := async(func() error { return waiter.Put([]byte("k"), []byte("other")) })
+	expectWaiting(t, put)
+
+	if err := waiter.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if err := expectDone(t, put); !errors.Is(err, utils.ErrTransactionRolledBack) {
+		t.Errorf("Expected ErrTransactionRolledBack, got %v", err)
+	}
+}
+
+func TestPessimistic_RangeLock(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	scanner := beginPessimistic(t, manager)
+	if err := scanner.LockRange([]byte("a"), []byte("m"), lock.Shared); err != nil {
+		t.Fatalf("Failed to lock range: %v", err)
+	}
+
+	// Inserts into the range wait; inserts outside it do not
+	if err := manager.Put([]byte("z"), []byte("value")); err != nil {
+		t.Fatalf("Failed to put outside the range: %v", err)
+	}
+	insert := async(func() error { return manager.Put([]byte("c"), []byte("value")) })
+	expectWaiting(t, insert)
+
+	if err := scanner.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if err := expectDone(t, insert); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+}
+
+func TestPessimistic_OptimisticCommitWaits(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	holder := beginPessimistic(t, manager)
+	if _, err := holder.Exists([]byte("k")); err != nil {
+		t.Fatalf("Failed to check key: %v", err)
+	}
+
+	optimistic, err := manager.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if err := optimistic.Put([]byte("k"), []byte("value")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	commit := async(optimistic.Commit)
+	expectWaiting(t, commit)
+
+	if err := holder.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if err := expectDone(t, commit); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package transaction
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// DefaultRetryPolicy returns a retry policy with sensible defaults.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:        3,
+		InitialDelay:      10 * time.Millisecond,
+		MaxDelay:          time.Second,
+		BackoffMultiplier: 2.0,
+	}
+}
+
+// Backoff returns how long to wait before the given retry, counting from 1.
+// The delay grows exponentially from InitialDelay, is capped at MaxDelay
+// and is jittered to between half and all of that, so transactions that
+// conflicted with each other do not retry in lockstep.
+func (p *RetryPolicy) Backoff(retry int) time.Duration {
+	multiplier := p.BackoffMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialDelay)
+	for i := 1; i < retry; i++ {
+		delay *= multiplier
+		if p.MaxDelay > 0 && delay >= float64(p.MaxDelay) {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := time.Duration(delay / 2)
+	return half + rand.N(time.Duration(delay)-half+1)
+}
+
+// Update runs fn in a read-write transaction with the default options and
+// commits it. See Run.
+func (m *ManagerImpl) Update(ctx context.Context, fn func(txn Transaction) error) error {
+	return m.Run(ctx, nil, fn)
+}
+
+// View runs fn in a read-only transaction at the default isolation level.
+// See Run.
+func (m *ManagerImpl) View(ctx context.Context, fn func(txn Transaction) error) error {
+	return m.Run(ctx, &TransactionOptions{
+		ReadOnly:       true,
+		IsolationLevel: m.config.DefaultIsolationLevel,
+	}, fn)
+}
+
+// Run executes fn in a new transaction and commits it if fn returns nil;
+// otherwise the transaction is rolled back and fn's error returned. The
+// transaction is bound to ctx.
+//
+// When fn or the commit fails with a retryable error, such as a conflict
+// or a deadlock, the whole transaction is run again after a backoff, up to
+// the retries allowed by the options' retry policy, or the manager's if the
+// options do not set one. fn must therefore be safe to run more than once.
+// Retrying stops when ctx is done.
+func (m *ManagerImpl) Run(ctx context.Context, opts *TransactionOptions, fn func(txn Transaction) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	policy := m.config.RetryPolicy
+	if opts != nil && opts.RetryPolicy != nil {
+		policy = opts.RetryPolicy
+	}
+
+	for retry := 1; ; retry++ {
+		err := m.runOnce(ctx, opts, fn)
+		if err == nil || !utils.IsRetryableError(err) {
+			return err
+		}
+		if policy == nil || retry > policy.MaxRetries {
+			if retry > 1 {
+				return fmt.Errorf("transaction failed after %d attempts: %w", retry, err)
+			}
+			return err
+		}
+
+		timer := time.NewTimer(policy.Backoff(retry))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w: %w", context.Cause(ctx), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// runOnce makes a single attempt at running fn in a transaction.
+func (m *ManagerImpl) runOnce(ctx context.Context, opts *TransactionOptions, fn func(txn Transaction) error) error {
+	txn, err := m.begin(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	// Harmless after a commit, and rolls back if fn panics
+	defer func() { _ = txn.Rollback() }()
+
+	if err := fn(txn); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
@@ -0,0 +1,161 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := &RetryPolicy{
+		InitialDelay:      10 * time.Millisecond,
+		MaxDelay:          50 * time.Millisecond,
+		BackoffMultiplier: 2,
+	}
+
+	tests := []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{1, 5 * time.Millisecond, 10 * time.Millisecond},
+		{2, 10 * time.Millisecond, 20 * time.Millisecond},
+		{3, 20 * time.Millisecond, 40 * time.Millisecond},
+		{4, 25 * time.Millisecond, 50 * time.Millisecond},
+		{100, 25 * time.Millisecond, 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if delay := policy.Backoff(tt.retry); delay < tt.min || delay > tt.max {
+				t.Fatalf("Backoff(%d) = %v, expected between %v and %v", tt.retry, delay, tt.min, tt.max)
+			}
+		}
+	}
+
+	if delay := (&RetryPolicy{}).Backoff(1); delay != 0 {
+		t.Errorf("Expected no delay for a zero policy, got %v", delay)
+	}
+}
+
+// conflictOnce returns a transaction body that conflicts with a concurrent
+// commit the first times it runs, and counts its attempts.
+func conflictOnce(t *testing.T, manager *ManagerImpl, conflicts int, attempts *int) func(Transaction) error {
+	return func(txn Transaction) error {
+		*attempts++
+		if _, err := txn.Get([]byte("k")); err != nil && !errors.Is(err, utils.ErrKeyNotFound) {
+			return err
+		}
+		if *attempts <= conflicts {
+			if err := manager.Put([]byte("k"), []byte("other")); err != nil {
+				t.Errorf("Failed to put: %v", err)
+			}
+		}
+		return txn.Put([]byte("k"), []byte("mine"))
+	}
+}
+
+func TestManager_RunRetriesConflicts(t *testing.T) {
+	config := DefaultConfig()
+	config.DefaultIsolationLevel = Serializable
+	config.RetryPolicy = &RetryPolicy{MaxRetries: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, BackoffMultiplier: 2}
+	manager, engine := newTestManager(t, config)
+
+	attempts := 0
+	if err := manager.Update(context.Background(), conflictOnce(t, manager, 2, &attempts)); err != nil {
+		t.Fatalf("Expected update to succeed after retrying, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+	if value, _ := engine.Get([]byte("k")); string(value) != "mine" {
+		t.Errorf("Expected the retried write to be committed, got %s", value)
+	}
+
+	// Retries run out
+	attempts = 0
+	err := manager.Update(context.Background(), conflictOnce(t, manager, 10, &attempts))
+	if !errors.Is(err, utils.ErrTransactionConflict) {
+		t.Errorf("Expected ErrTransactionConflict, got %v", err)
+	}
+	if attempts != 4 {
+		t.Errorf("Expected 4 attempts, got %d", attempts)
+	}
+
+	// The transaction's own policy overrides the manager's
+	attempts = 0
+	opts := &TransactionOptions{IsolationLevel: Serializable, RetryPolicy: &RetryPolicy{MaxRetries: 0}}
+	if err := manager.Run(context.Background(), opts, conflictOnce(t, manager, 1, &attempts)); !errors.Is(err, utils.ErrTransactionConflict) {
+		t.Errorf("Expected ErrTransactionConflict without retries, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+
+	if active := manager.ActiveTransactions(); active != 0 {
+		t.Errorf("Expected no active transactions, got %d", active)
+	}
+}
+
+func TestManager_RunStopsOnCancel(t *testing.T) {
+	config := DefaultConfig()
+	config.DefaultIsolationLevel = Serializable
+	config.RetryPolicy = &RetryPolicy{MaxRetries: 100, InitialDelay: time.Hour, MaxDelay: time.Hour, BackoffMultiplier: 1}
+	manager, _ := newTestManager(t, config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	attempts := 0
+	err := manager.Update(ctx, conflictOnce(t, manager, 100, &attempts))
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, utils.ErrTransactionConflict) {
+		t.Errorf("Expected the deadline and the last conflict, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestManager_RunRollsBackOnError(t *testing.T) {
+	manager, engine := newTestManager(t, nil)
+	errAbort := errors.New("abort")
+
+	attempts := 0
+	err := manager.Update(context.Background(), func(txn Transaction) error {
+		attempts++
+		if err := txn.Put([]byte("k"), []byte("value")); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("Expected the closure's error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected non-retryable errors not to be retried, got %d attempts", attempts)
+	}
+	if exists, _ := engine.Exists([]byte("k")); exists {
+		t.Error("Expected the write to be rolled back")
+	}
+
+	// Read-only transactions reject writes
+	err = manager.View(context.Background(), func(txn Transaction) error {
+		return txn.Put([]byte("k"), []byte("value"))
+	})
+	if !errors.Is(err, utils.ErrTransactionReadOnly) {
+		t.Errorf("Expected ErrTransactionReadOnly, got %v", err)
+	}
+
+	// A panic rolls the transaction back
+	func() {
+		defer func() { _ = recover() }()
+		_ = manager.Update(context.Background(), func(txn Transaction) error {
+			panic("boom")
+		})
+	}()
+	if active := manager.ActiveTransactions(); active != 0 {
+		t.Errorf("Expected no active transactions, got %d", active)
+	}
+}
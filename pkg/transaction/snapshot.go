@@ -0,0 +1,367 @@
+package transaction
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+
+	"github.com/thromel/go-database/pkg/storage"
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// Snapshot is a read-only view of the committed state of the database at
+// the moment it was taken. Writes committed afterwards are not visible
+// through it. A snapshot keeps the values it may still read, so it should
+// be released as soon as it is no longer needed.
+type Snapshot interface {
+	// Get retrieves the value a key had when the snapshot was taken.
+	// Returns ErrKeyNotFound if the key did not exist.
+	Get(key []byte) ([]byte, error)
+
+	// Exists reports whether a key existed when the snapshot was taken.
+	Exists(key []byte) (bool, error)
+
+	// NewIterator creates an iterator over the keys in [start, end) as of the
+	// snapshot. A nil start or end leaves that side unbounded. The iterator
+	// stops with ErrSnapshotReleased if the snapshot is released first.
+	NewIterator(start, end []byte) storage.Iterator
+
+	// Release discards the snapshot. Reads from it fail afterwards.
+	Release() error
+}
+
+// SnapshotImpl implements Snapshot on top of the manager's version store,
+// like the snapshot of a RepeatableRead transaction.
+type SnapshotImpl struct {
+	// manager is the transaction manager the snapshot was taken from
+	manager *ManagerImpl
+
+	// id registers the snapshot with the version store, which knows the
+	// timestamp of the committed state it reads
+	id ID
+
+	// released indicates if the snapshot has been released
+	released atomic.Bool
+}
+
+// Snapshot takes a snapshot of the committed state. Snapshots do not count
+// toward MaxActiveTransactions and never expire; they last until released.
+func (m *ManagerImpl) Snapshot() (Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.waitLoadedLocked()
+	if m.closed {
+		return nil, utils.ErrDatabaseClosed
+	}
+	id := m.nextID
+	m.nextID++
+
+	m.versions.beginSnapshot(id)
+	return &SnapshotImpl{manager: m, id: id}, nil
+}
+
+// Get retrieves the value a key had when the snapshot was taken.
+func (s *SnapshotImpl) Get(key []byte) ([]byte, error) {
+	if s.released.Load() {
+		return nil, utils.ErrSnapshotReleased
+	}
+	if len(key) == 0 {
+		return nil, utils.ErrInvalidKey
+	}
+
+	get := func() ([]byte, error) { return s.manager.engine.Get(key) }
+	return s.manager.versions.read(key, s.id, get)
+}
+
+// Exists reports whether a key existed when the snapshot was taken.
+func (s *SnapshotImpl) Exists(key []byte) (bool, error) {
+	_, err := s.Get(key)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, utils.ErrKeyNotFound):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// NewIterator creates an iterator over the keys in [start, end) as of the
+// snapshot.
+func (s *SnapshotImpl) NewIterator(start, end []byte) storage.Iterator {
+	it := &snapshotIterator{
+		snapshot: s,
+		start:    start,
+		end:      end,
+		engine:   s.manager.engine.NewIterator(start, end),
+	}
+	if it.engine == nil {
+		it.err = utils.ErrDatabaseClosed
+	}
+	return it
+}
+
+// Release discards the snapshot and lets the version store drop the values
+// only it could read.
+func (s *SnapshotImpl) Release() error {
+	if s.released.Swap(true) {
+		return utils.ErrSnapshotReleased
+	}
+	s.manager.versions.endSnapshot(s.id)
+	return nil
+}
+
+// snapshotIterator iterates over a snapshot by merging an iterator over the
+// storage engine with the keys that have versions. The engine holds the
+// newest committed values; where a commit after the snapshot changed a key,
+// its version supplies the snapshot's value instead, or hides the key if it
+// did not exist. As with point reads, the engine is always read before the
+// versions are consulted, so no commit can slip in between unnoticed.
+type snapshotIterator struct {
+	snapshot   *SnapshotImpl
+	engine     storage.Iterator
+	start, end []byte
+
+	// key and value are the current entry, if valid
+	key, value []byte
+	valid      bool
+
+	// positioned reports whether the iterator has been moved, and forward
+	// the direction of its last move
+	positioned bool
+	forward    bool
+
+	closed bool
+	err    error
+}
+
+// Valid returns true if the iterator is positioned at a valid key-value pair.
+func (it *snapshotIterator) Valid() bool {
+	return it.valid && it.err == nil
+}
+
+// Next advances the iterator to the next key-value pair.
+func (it *snapshotIterator) Next() bool {
+	switch {
+	case !it.positioned || (!it.valid && !it.forward):
+		it.move(nil, true)
+	case !it.valid:
+		return false
+	default:
+		it.move(it.key, true)
+	}
+	return it.Valid()
+}
+
+// Prev moves the iterator back to the previous key-value pair.
+func (it *snapshotIterator) Prev() bool {
+	switch {
+	case !it.positioned || (!it.valid && it.forward):
+		it.move(nil, false)
+	case !it.valid:
+		return false
+	default:
+		it.move(it.key, false)
+	}
+	return it.Valid()
+}
+
+// Key returns the current key.
+func (it *snapshotIterator) Key() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.key
+}
+
+// Value returns the current value.
+func (it *snapshotIterator) Value() []byte {
+	if !it.Valid() {
+		return nil
+	}
+	return it.value
+}
+
+// Seek positions the iterator at the first key that is >= target.
+func (it *snapshotIterator) Seek(target []byte) {
+	if it.start != nil && bytes.Compare(target, it.start) < 0 {
+		target = it.start
+	}
+	if !it.usable() {
+		return
+	}
+
+	it.engine.Seek(target)
+	it.positioned, it.forward = true, true
+	it.scan(target, true)
+}
+
+// SeekToFirst positions the iterator at the first key-value pair.
+func (it *snapshotIterator) SeekToFirst() {
+	it.move(nil, true)
+}
+
+// SeekToLast positions the iterator at the last key-value pair.
+func (it *snapshotIterator) SeekToLast() {
+	it.move(nil, false)
+}
+
+// Error returns any error encountered during iteration.
+func (it *snapshotIterator) Error() error {
+	return it.err
+}
+
+// Close releases resources associated with the iterator.
+func (it *snapshotIterator) Close() error {
+	if it.closed {
+		return utils.ErrIteratorClosed
+	}
+
+	it.closed = true
+	it.valid = false
+	if it.engine == nil {
+		return nil
+	}
+	return it.engine.Close()
+}
+
+// move positions the iterator at the first visible key after from in the
+// given direction, or at the first or last one if from is nil.
+func (it *snapshotIterator) move(from []byte, forward bool) {
+	if !it.usable() {
+		return
+	}
+
+	// Reposition the engine iterator when starting over or turning around;
+	// otherwise it is already at or just before the next candidate
+	switch {
+	case from == nil && forward:
+		it.engine.SeekToFirst()
+	case from == nil:
+		it.engine.SeekToLast()
+	case !it.positioned || it.forward != forward:
+		it.engine.Seek(from)
+		if !forward {
+			if it.engine.Valid() {
+				it.engine.Prev()
+			} else {
+				it.engine.SeekToLast()
+			}
+		}
+	}
+	it.positioned, it.forward = true, forward
+
+	it.scan(from, false)
+}
+
+// scan finds the first visible key in the iterator's direction after from,
+// or at it if inclusive; a nil from starts at the first key in range. The
+// engine iterator is at or before the first engine key in that range.
+func (it *snapshotIterator) scan(from []byte, inclusive bool) {
+	it.valid, it.key, it.value = false, nil, nil
+
+	beyond := func(key []byte) bool {
+		return from == nil || it.before(from, key) || (inclusive && bytes.Equal(key, from))
+	}
+
+	for {
+		// Read the engine first
+		var engineKey, engineValue []byte
+		for it.engine.Valid() && !beyond(it.engine.Key()) {
+			it.step()
+		}
+		if err := it.engine.Error(); err != nil {
+			it.err = err
+			return
+		}
+		if it.engine.Valid() {
+			engineKey = append([]byte(nil), it.engine.Key()...)
+			engineValue = append([]byte(nil), it.engine.Value()...)
+			if err := it.engine.Error(); err != nil {
+				it.err = err
+				return
+			}
+		}
+
+		// Then the keys with versions, which include every key a commit
+		// since the snapshot removed from the engine
+		key := it.versionedKey(from, inclusive)
+		if key == nil || (engineKey != nil && it.before(engineKey, key)) {
+			key = engineKey
+		}
+		if key == nil {
+			return
+		}
+
+		v, err := it.snapshot.manager.versions.lookup(string(key), it.snapshot.id)
+		if err != nil {
+			it.err = err
+			return
+		}
+		switch {
+		case v != nil && v.existed:
+			it.key, it.value, it.valid = key, append([]byte(nil), v.value...), true
+			return
+		case v == nil && bytes.Equal(key, engineKey):
+			it.key, it.value, it.valid = key, engineValue, true
+			return
+		}
+
+		// The key did not exist at the snapshot
+		from, inclusive = key, false
+	}
+}
+
+// versionedKey returns the first key with versions in the iterator's
+// direction starting from from, or nil if there is none in range.
+func (it *snapshotIterator) versionedKey(from []byte, inclusive bool) []byte {
+	if from == nil {
+		if it.forward {
+			from, inclusive = it.start, true
+		} else {
+			from, inclusive = it.end, false
+		}
+	}
+
+	key, ok := it.snapshot.manager.versions.nextKey(from, inclusive, it.forward)
+	if !ok || !it.inRange([]byte(key)) {
+		return nil
+	}
+	return []byte(key)
+}
+
+// before reports whether a comes before b in the iterator's direction.
+func (it *snapshotIterator) before(a, b []byte) bool {
+	if it.forward {
+		return bytes.Compare(a, b) < 0
+	}
+	return bytes.Compare(a, b) > 0
+}
+
+// step moves the engine iterator one key in the iterator's direction.
+func (it *snapshotIterator) step() {
+	if it.forward {
+		it.engine.Next()
+	} else {
+		it.engine.Prev()
+	}
+}
+
+// inRange reports whether key lies within the iterator's bounds.
+func (it *snapshotIterator) inRange(key []byte) bool {
+	return (it.start == nil || bytes.Compare(key, it.start) >= 0) &&
+		(it.end == nil || bytes.Compare(key, it.end) < 0)
+}
+
+// usable reports whether the iterator can move, recording why not otherwise.
+func (it *snapshotIterator) usable() bool {
+	it.valid = false
+	switch {
+	case it.closed:
+		it.err = utils.ErrIteratorClosed
+	case it.snapshot.released.Load():
+		it.err = utils.ErrSnapshotReleased
+	}
+	return it.err == nil
+}
@@ -0,0 +1,224 @@
+package transaction
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thromel/go-database/pkg/storage"
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// scanKeys returns the entries an iterator visits moving with step, as
+// key=value strings.
+func scanKeys(it storage.Iterator, step func() bool) []string {
+	var entries []string
+	for ; it.Valid(); step() {
+		entries = append(entries, fmt.Sprintf("%s=%s", it.Key(), it.Value()))
+	}
+	return entries
+}
+
+func TestSnapshot_Reads(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		if err := manager.Put([]byte(key), []byte("v1")); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	snapshot, err := manager.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %v", err)
+	}
+
+	// Commits after the snapshot: updates, deletes and inserts
+	batch := storage.NewWriteBatch()
+	batch.Put([]byte("b"), []byte("v2"))
+	batch.Delete([]byte("c"))
+	batch.Put([]byte("bb"), []byte("v2"))
+	batch.Delete([]byte("e"))
+	batch.Put([]byte("f"), []byte("v2"))
+	if err := manager.Write(batch); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := manager.Put([]byte("c"), []byte("v3")); err != nil {
+		t.Fatalf("Failed to put: %v", err)
+	}
+
+	if value, err := snapshot.Get([]byte("b")); err != nil || string(value) != "v1" {
+		t.Errorf("Expected the snapshot to read v1, got %q: %v", value, err)
+	}
+	if _, err := snapshot.Get([]byte("f")); !errors.Is(err, utils.ErrKeyNotFound) {
+		t.Errorf("Expected a later insert to be invisible, got %v", err)
+	}
+	if exists, err := snapshot.Exists([]byte("e")); err != nil || !exists {
+		t.Errorf("Expected a later delete to be invisible: %v", err)
+	}
+
+	want := []string{"a=v1", "b=v1", "c=v1", "d=v1", "e=v1"}
+	it := snapshot.NewIterator(nil, nil)
+	defer it.Close()
+
+	it.SeekToFirst()
+	if got := scanKeys(it, it.Next); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v forward, got %v", want, got)
+	}
+	it.SeekToLast()
+	got := scanKeys(it, it.Prev)
+	for i, j := 0, len(got)-1; i < j; i, j = i+1, j-1 {
+		got[i], got[j] = got[j], got[i]
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v backward, got %v", want, got)
+	}
+
+	// Seeking and turning around
+	it.Seek([]byte("bb"))
+	if string(it.Key()) != "c" {
+		t.Errorf("Expected to seek to c, got %q", it.Key())
+	}
+	if !it.Prev() || string(it.Key()) != "b" {
+		t.Errorf("Expected to step back to b, got %q", it.Key())
+	}
+	if !it.Next() || !it.Next() || string(it.Key()) != "d" {
+		t.Errorf("Expected to step forward to d, got %q", it.Key())
+	}
+
+	bounded := snapshot.NewIterator([]byte("b"), []byte("e"))
+	bounded.SeekToFirst()
+	if got := scanKeys(bounded, bounded.Next); strings.Join(got, " ") != "b=v1 c=v1 d=v1" {
+		t.Errorf("Expected b to d in range, got %v", got)
+	}
+	bounded.Close()
+
+	// Releasing the snapshot drops the versions only it needed
+	if err := snapshot.Release(); err != nil {
+		t.Fatalf("Failed to release snapshot: %v", err)
+	}
+	if n := manager.versions.size(); n != 0 {
+		t.Errorf("Expected no versions after release, got %d", n)
+	}
+	if _, err := snapshot.Get([]byte("a")); !errors.Is(err, utils.ErrSnapshotReleased) {
+		t.Errorf("Expected ErrSnapshotReleased, got %v", err)
+	}
+	if it.Next() || !errors.Is(it.Error(), utils.ErrSnapshotReleased) {
+		t.Errorf("Expected the iterator to stop with ErrSnapshotReleased, got %v", it.Error())
+	}
+	if err := snapshot.Release(); !errors.Is(err, utils.ErrSnapshotReleased) {
+		t.Errorf("Expected a second release to fail, got %v", err)
+	}
+}
+
+func TestSnapshot_ConsistentScanUnderWrites(t *testing.T) {
+	manager, _ := newTestManager(t, nil)
+
+	// Balances move between accounts, which are closed and opened as they
+	// do, so keys come and go while the total stays the same
+	const numKeys = 60
+	const total = 20 * 100
+	account := func(i int) []byte { return []byte(fmt.Sprintf("account-%02d", i%numKeys)) }
+	encode := func(n uint64) []byte { return binary.BigEndian.AppendUint64(nil, n) }
+	for i := 0; i < numKeys; i += 3 {
+		if err := manager.Put(account(i), encode(100)); err != nil {
+			t.Fatalf("Failed to put: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := worker; ; i += 7 {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				// Close one account into another, which may be new
+				from, to := account(i), account(i*5+1)
+				if string(from) == string(to) {
+					continue
+				}
+				txn, err := manager.BeginWithOptions(&TransactionOptions{IsolationLevel: RepeatableRead})
+				if err != nil {
+					t.Errorf("Failed to begin: %v", err)
+					return
+				}
+				fromValue, err := txn.Get(from)
+				if err != nil {
+					_ = txn.Rollback()
+					continue
+				}
+				balance := binary.BigEndian.Uint64(fromValue)
+				if toValue, err := txn.Get(to); err == nil {
+					balance += binary.BigEndian.Uint64(toValue)
+				}
+				_ = txn.Delete(from)
+				_ = txn.Put(to, encode(balance))
+				if err := txn.Commit(); err != nil && !errors.Is(err, utils.ErrTransactionConflict) {
+					t.Errorf("Failed to commit: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+
+	for scan := 0; scan < 20; scan++ {
+		snapshot, err := manager.Snapshot()
+		if err != nil {
+			t.Fatalf("Failed to take snapshot: %v", err)
+		}
+
+		// Let a commit land between the snapshot and the scan
+		for ts := manager.versions.nextTimestamp(); manager.versions.nextTimestamp() == ts; {
+			runtime.Gosched()
+		}
+
+		it := snapshot.NewIterator([]byte("account-"), []byte("account."))
+		step := it.Next
+		if scan%2 == 0 {
+			it.SeekToFirst()
+		} else {
+			it.SeekToLast()
+			step = it.Prev
+		}
+		balances := make(map[string]uint64)
+		var sum uint64
+		for ; it.Valid(); step() {
+			balances[string(it.Key())] = binary.BigEndian.Uint64(it.Value())
+			sum += balances[string(it.Key())]
+		}
+		if it.Error() != nil {
+			t.Fatalf("Scan failed: %v", it.Error())
+		}
+		if sum != total {
+			t.Fatalf("Scan %d saw an inconsistent total %d", scan, sum)
+		}
+
+		// The scan agrees with point reads from the snapshot
+		for i := 0; i < numKeys; i++ {
+			value, err := snapshot.Get(account(i))
+			balance, scanned := balances[string(account(i))]
+			if scanned != (err == nil) || (scanned && binary.BigEndian.Uint64(value) != balance) {
+				t.Fatalf("Scan %d disagrees with reading %s: %v", scan, account(i), err)
+			}
+		}
+
+		it.Close()
+		if err := snapshot.Release(); err != nil {
+			t.Fatalf("Failed to release snapshot: %v", err)
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+}
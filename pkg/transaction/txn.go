@@ -5,6 +5,8 @@ package transaction
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -79,7 +81,8 @@ type TransactionOptions struct {
 	// Read-only transactions can have better performance characteristics.
 	ReadOnly bool
 
-	// IsolationLevel specifies the isolation level for this transaction.
+	// IsolationLevel specifies the isolation level for this transaction. The
+	// zero value, DefaultIsolation, uses the manager's default level.
 	IsolationLevel IsolationLevel
 
 	// Timeout specifies the maximum duration this transaction can remain active.
@@ -87,14 +90,24 @@ type TransactionOptions struct {
 
 	// RetryPolicy specifies how transaction conflicts should be handled.
 	RetryPolicy *RetryPolicy
+
+	// Pessimistic makes the transaction lock keys as it reads and writes
+	// them and hold the locks until it ends, waiting on contention instead
+	// of failing at commit. Pessimistic transactions are serializable and
+	// read the newest committed values rather than a snapshot.
+	Pessimistic bool
 }
 
 // IsolationLevel defines the isolation level for transactions.
 type IsolationLevel int
 
 const (
+	// DefaultIsolation is the zero value, so that options which do not set
+	// an isolation level get the manager's DefaultIsolationLevel
+	DefaultIsolation IsolationLevel = iota
+
 	// ReadUncommitted allows dirty reads (lowest isolation, highest performance)
-	ReadUncommitted IsolationLevel = iota
+	ReadUncommitted
 
 	// ReadCommitted prevents dirty reads but allows non-repeatable reads
 	ReadCommitted
@@ -102,10 +115,43 @@ const (
 	// RepeatableRead prevents dirty reads and non-repeatable reads
 	RepeatableRead
 
-	// Serializable provides the highest isolation level (highest consistency, lowest performance)
+	// Serializable is snapshot isolation that also fails a commit if a key
+	// the transaction read, or found missing, changed since its snapshot.
+	// Only point reads are checked: ranges scanned outside the transaction
+	// are not, so write skew and phantoms through them remain possible.
+	// Pessimistic transactions can guard a range with LockRange.
 	Serializable
 )
 
+// String returns the configuration name of the isolation level.
+func (l IsolationLevel) String() string {
+	switch l {
+	case DefaultIsolation:
+		return "DEFAULT"
+	case ReadUncommitted:
+		return "READ_UNCOMMITTED"
+	case ReadCommitted:
+		return "READ_COMMITTED"
+	case RepeatableRead:
+		return "REPEATABLE_READ"
+	case Serializable:
+		return "SERIALIZABLE"
+	default:
+		return fmt.Sprintf("IsolationLevel(%d)", int(l))
+	}
+}
+
+// ParseIsolationLevel returns the isolation level with the given
+// configuration name, such as "READ_COMMITTED".
+func ParseIsolationLevel(name string) (IsolationLevel, error) {
+	for _, level := range []IsolationLevel{ReadUncommitted, ReadCommitted, RepeatableRead, Serializable} {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown isolation level %q", name)
+}
+
 // RetryPolicy defines how transaction conflicts should be handled.
 type RetryPolicy struct {
 	// MaxRetries is the maximum number of retry attempts
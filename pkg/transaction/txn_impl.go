@@ -0,0 +1,493 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thromel/go-database/pkg/storage"
+	"github.com/thromel/go-database/pkg/transaction/lock"
+	"github.com/thromel/go-database/pkg/utils"
+)
+
+// txnState is the lifecycle state of a transaction.
+type txnState int
+
+const (
+	txnActive txnState = iota
+	txnCommitted
+	txnRolledBack
+)
+
+// pendingWrite is a change buffered by a transaction until it commits.
+type pendingWrite struct {
+	value   []byte
+	deleted bool
+}
+
+// TransactionImpl implements the Transaction interface. Writes are buffered
+// in the transaction, so reads see its own changes, and are applied to the
+// storage engine atomically on Commit. Reads of snapshot transactions are
+// served as of the snapshot; see ManagerImpl for the isolation guarantees.
+type TransactionImpl struct {
+	// id is the unique transaction identifier
+	id ID
+
+	// manager is the manager that started the transaction
+	manager *ManagerImpl
+
+	// ctx is the context the transaction was started with
+	ctx context.Context
+
+	// lockCtx bounds lock waits; it is cancelled with the reason when the
+	// transaction is rolled back from another goroutine
+	lockCtx     context.Context
+	cancelLocks context.CancelCauseFunc
+
+	// opts holds the resolved transaction options
+	opts TransactionOptions
+
+	// startTime is when the transaction began
+	startTime time.Time
+
+	// snapshotted reports whether the transaction reads from a snapshot,
+	// registered with the version store under its ID
+	snapshotted bool
+
+	// mu protects the fields below
+	mu sync.Mutex
+
+	// state is the lifecycle state
+	state txnState
+
+	// err is the reason the transaction was rolled back without a call to
+	// Rollback, such as a timeout or a cancelled context
+	err error
+
+	// writes holds the buffered changes keyed by key
+	writes map[string]*pendingWrite
+
+	// reads holds the keys read from storage, validated on commit by
+	// serializable transactions. Only point reads are recorded, as
+	// transactions have no range reads to record
+	reads map[string]struct{}
+
+	// deadline is when the transaction times out
+	deadline time.Time
+
+	// timer rolls the transaction back at its deadline
+	timer *time.Timer
+
+	// stopContext stops watching the context for cancellation
+	stopContext func() bool
+}
+
+// newTransaction creates a transaction; start must be called before use.
+func newTransaction(manager *ManagerImpl, id ID, ctx context.Context, opts TransactionOptions) *TransactionImpl {
+	now := time.Now()
+	lockCtx, cancelLocks := context.WithCancelCause(ctx)
+	return &TransactionImpl{
+		id:          id,
+		manager:     manager,
+		ctx:         ctx,
+		lockCtx:     lockCtx,
+		cancelLocks: cancelLocks,
+		opts:        opts,
+		startTime:   now,
+		state:       txnActive,
+		writes:      make(map[string]*pendingWrite),
+		reads:       make(map[string]struct{}),
+		deadline:    now.Add(opts.Timeout),
+	}
+}
+
+// start arms the timeout and begins watching the context.
+func (t *TransactionImpl) start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.timer = time.AfterFunc(time.Until(t.deadline), func() {
+		t.abort(utils.ErrTransactionTimeout)
+	})
+	t.stopContext = context.AfterFunc(t.ctx, func() {
+		t.abort(t.ctx.Err())
+	})
+}
+
+// Put stores a key-value pair within the transaction context.
+func (t *TransactionImpl) Put(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return utils.ErrInvalidKey
+	}
+	if value == nil {
+		return utils.ErrInvalidValue
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkWritableLocked(); err != nil {
+		return err
+	}
+	if err := t.lockLocked(key, lock.Exclusive); err != nil {
+		return err
+	}
+
+	t.writes[string(key)] = &pendingWrite{value: append([]byte{}, value...)}
+	return nil
+}
+
+// Get retrieves the value associated with the given key within the transaction.
+func (t *TransactionImpl) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, utils.ErrInvalidKey
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkActiveLocked(); err != nil {
+		return nil, err
+	}
+	if err := t.lockLocked(key, lock.Shared); err != nil {
+		return nil, err
+	}
+
+	return t.getLocked(key)
+}
+
+// Delete removes the key-value pair within the transaction context.
+func (t *TransactionImpl) Delete(key []byte) error {
+	if len(key) == 0 {
+		return utils.ErrInvalidKey
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkWritableLocked(); err != nil {
+		return err
+	}
+	if err := t.lockLocked(key, lock.Exclusive); err != nil {
+		return err
+	}
+
+	exists, err := t.existsLocked(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return utils.ErrKeyNotFound
+	}
+
+	t.writes[string(key)] = &pendingWrite{deleted: true}
+	return nil
+}
+
+// Exists checks if a key exists within the transaction context.
+func (t *TransactionImpl) Exists(key []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, utils.ErrInvalidKey
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkActiveLocked(); err != nil {
+		return false, err
+	}
+	if err := t.lockLocked(key, lock.Shared); err != nil {
+		return false, err
+	}
+
+	return t.existsLocked(key)
+}
+
+// Commit applies all changes made within this transaction to the database
+// as one atomic write. If the write fails, the transaction is rolled back.
+func (t *TransactionImpl) Commit() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkActiveLocked(); err != nil {
+		return err
+	}
+
+	// Transactions without writes read a consistent state and need no validation
+	if len(t.writes) > 0 {
+		// Pessimistic transactions already hold their write locks
+		batch := t.batchLocked()
+		err := t.acquireLocked(func(ctx context.Context) error {
+			return t.manager.lockKeys(ctx, lock.OwnerID(t.id), batchKeys(batch))
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := t.manager.commit(t, batch); err != nil {
+			t.finishLocked(txnRolledBack, nil)
+			return err
+		}
+	}
+
+	t.finishLocked(txnCommitted, nil)
+	return nil
+}
+
+// Rollback discards all changes made within this transaction. It may be
+// called while another goroutine waits for a lock in the transaction.
+func (t *TransactionImpl) Rollback() error {
+	t.cancelLocks(utils.ErrTransactionRolledBack)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkActiveLocked(); err != nil {
+		return err
+	}
+
+	t.finishLocked(txnRolledBack, nil)
+	return nil
+}
+
+// ID returns the unique identifier for this transaction.
+func (t *TransactionImpl) ID() ID {
+	return t.id
+}
+
+// IsReadOnly returns true if this transaction was started read-only.
+func (t *TransactionImpl) IsReadOnly() bool {
+	return t.opts.ReadOnly
+}
+
+// IsolationLevel returns the isolation level of the transaction.
+func (t *TransactionImpl) IsolationLevel() IsolationLevel {
+	return t.opts.IsolationLevel
+}
+
+// Context returns the context associated with this transaction.
+func (t *TransactionImpl) Context() context.Context {
+	return t.ctx
+}
+
+// LockRange locks every key in [start, end), including keys that do not
+// exist yet, until the transaction ends. Pessimistic transactions use it to
+// keep a scanned range stable; a nil start or end leaves the range unbounded
+// on that side.
+func (t *TransactionImpl) LockRange(start, end []byte, mode lock.Mode) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkActiveLocked(); err != nil {
+		return err
+	}
+	if mode == lock.Exclusive && t.opts.ReadOnly {
+		return utils.ErrTransactionReadOnly
+	}
+
+	return t.acquireLocked(func(ctx context.Context) error {
+		return t.manager.locks.LockRange(ctx, lock.OwnerID(t.id), start, end, mode)
+	})
+}
+
+// SetDeadline sets a deadline for the transaction, replacing its timeout.
+// The transaction is rolled back if it is still active at the deadline.
+func (t *TransactionImpl) SetDeadline(deadline time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkActiveLocked(); err != nil {
+		return err
+	}
+
+	t.deadline = deadline
+	t.timer.Reset(time.Until(deadline))
+	return nil
+}
+
+// abort rolls the transaction back for the given reason if it is still active.
+func (t *TransactionImpl) abort(cause error) {
+	// Wake a lock wait holding the transaction lock
+	t.cancelLocks(cause)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == txnActive {
+		t.finishLocked(txnRolledBack, cause)
+	}
+}
+
+// checkActiveLocked returns an error if the transaction can no longer be
+// used, rolling it back first if its deadline has passed (assumes lock is held).
+func (t *TransactionImpl) checkActiveLocked() error {
+	switch t.state {
+	case txnCommitted:
+		return utils.ErrTransactionCommitted
+	case txnRolledBack:
+		if t.err != nil {
+			return t.err
+		}
+		return utils.ErrTransactionRolledBack
+	}
+
+	// The timer may not have fired yet
+	if !time.Now().Before(t.deadline) {
+		t.finishLocked(txnRolledBack, utils.ErrTransactionTimeout)
+		return t.err
+	}
+
+	return nil
+}
+
+// checkWritableLocked returns an error if the transaction cannot write
+// (assumes lock is held).
+func (t *TransactionImpl) checkWritableLocked() error {
+	if err := t.checkActiveLocked(); err != nil {
+		return err
+	}
+	if t.opts.ReadOnly {
+		return utils.ErrTransactionReadOnly
+	}
+	return nil
+}
+
+// lockLocked locks a key for a pessimistic transaction (assumes lock is held).
+func (t *TransactionImpl) lockLocked(key []byte, mode lock.Mode) error {
+	if !t.opts.Pessimistic {
+		return nil
+	}
+
+	return t.acquireLocked(func(ctx context.Context) error {
+		return t.manager.locks.Lock(ctx, lock.OwnerID(t.id), key, mode)
+	})
+}
+
+// acquireLocked waits for locks and handles a failed wait: a deadlock victim
+// is rolled back, and a wait cancelled by a concurrent rollback reports its
+// reason (assumes lock is held).
+func (t *TransactionImpl) acquireLocked(acquire func(ctx context.Context) error) error {
+	err := acquire(t.lockCtx)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, utils.ErrTransactionDeadlock):
+		t.finishLocked(txnRolledBack, utils.ErrTransactionDeadlock)
+		return err
+	case t.lockCtx.Err() != nil:
+		// The rollback completes once the transaction lock is released
+		return context.Cause(t.lockCtx)
+	default:
+		return err
+	}
+}
+
+// getLocked reads a key, preferring the transaction's own writes (assumes
+// lock is held).
+func (t *TransactionImpl) getLocked(key []byte) ([]byte, error) {
+	if w, ok := t.writes[string(key)]; ok {
+		if w.deleted {
+			return nil, utils.ErrKeyNotFound
+		}
+		return append([]byte{}, w.value...), nil
+	}
+
+	return t.readLocked(key)
+}
+
+// existsLocked checks a key, preferring the transaction's own writes
+// (assumes lock is held).
+func (t *TransactionImpl) existsLocked(key []byte) (bool, error) {
+	if w, ok := t.writes[string(key)]; ok {
+		return !w.deleted, nil
+	}
+
+	if !t.snapshotted {
+		return t.manager.engine.Exists(key)
+	}
+
+	_, err := t.readLocked(key)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, utils.ErrKeyNotFound):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// readLocked reads a committed value, from the snapshot if the transaction
+// has one, and records the read for validation (assumes lock is held).
+func (t *TransactionImpl) readLocked(key []byte) ([]byte, error) {
+	get := func() ([]byte, error) { return t.manager.engine.Get(key) }
+	if !t.snapshotted {
+		return get()
+	}
+
+	if t.opts.IsolationLevel == Serializable {
+		t.reads[string(key)] = struct{}{}
+	}
+	return t.manager.versions.read(key, t.id, get)
+}
+
+// validationKeysLocked returns the keys that must not have changed since the
+// snapshot for the transaction to commit: the keys it writes and, for
+// serializable transactions, the keys it read (assumes lock is held).
+func (t *TransactionImpl) validationKeysLocked() []string {
+	keys := make([]string, 0, len(t.writes)+len(t.reads))
+	for key := range t.writes {
+		keys = append(keys, key)
+	}
+	for key := range t.reads {
+		if _, ok := t.writes[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// batchLocked builds the write batch applied on commit, in key order
+// (assumes lock is held).
+func (t *TransactionImpl) batchLocked() *storage.WriteBatch {
+	keys := make([]string, 0, len(t.writes))
+	for key := range t.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	batch := storage.NewWriteBatch()
+	for _, key := range keys {
+		if w := t.writes[key]; w.deleted {
+			batch.Delete([]byte(key))
+		} else {
+			batch.Put([]byte(key), w.value)
+		}
+	}
+	return batch
+}
+
+// finishLocked ends the transaction, releases its resources and reports the
+// outcome to the manager (assumes lock is held).
+func (t *TransactionImpl) finishLocked(state txnState, cause error) {
+	t.state = state
+	t.err = cause
+	t.writes = nil
+	t.reads = nil
+
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	if t.stopContext != nil {
+		t.stopContext()
+	}
+	t.cancelLocks(nil)
+	t.manager.locks.ReleaseAll(lock.OwnerID(t.id))
+
+	t.manager.finish(t, state == txnCommitted)
+}
+
+// Ensure TransactionImpl implements the Transaction interface
+var _ Transaction = (*TransactionImpl)(nil)
@@ -59,6 +59,20 @@ var (
 
 	// ErrTransactionReadOnly is returned when attempting write operations on a read-only transaction
 	ErrTransactionReadOnly = errors.New("transaction is read-only")
+
+	// ErrTooManyTransactions is returned when the maximum number of active transactions is reached
+	ErrTooManyTransactions = errors.New("too many active transactions")
+
+	// ErrSnapshotReleased is returned when reading from a released snapshot
+	ErrSnapshotReleased = errors.New("snapshot is released")
+
+	// ErrSnapshotTooOld is returned when reading from a snapshot that expired
+	// because the values it needed took more memory than allowed
+	ErrSnapshotTooOld = errors.New("snapshot is too old")
+
+	// ErrTransactionsActive is returned by operations that need the database
+	// to themselves while transactions or snapshots are open
+	ErrTransactionsActive = errors.New("transactions or snapshots are active")
 )
 
 // Storage-related errors
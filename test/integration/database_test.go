@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -198,7 +199,7 @@ func TestDatabaseConfiguration(t *testing.T) {
 
 	for _, tc := range configs {
 		t.Run(tc.name, func(t *testing.T) {
-			tc.config.Path = "config-test-" + tc.name + ".db"
+			tc.config.Path = filepath.Join(t.TempDir(), "config-test-"+tc.name+".db")
 
 			db, err := api.Open(tc.config.Path, tc.config)
 			testutils.AssertNoError(t, err, "Opening database with "+tc.name+" config")
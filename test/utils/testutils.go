@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/thromel/go-database/pkg/api"
+	"github.com/thromel/go-database/pkg/storage/file"
+	"github.com/thromel/go-database/pkg/storage/wal"
 )
 
 // TestDatabase provides utilities for testing database operations.
@@ -31,7 +33,7 @@ func NewTestDatabase(t *testing.T) *TestDatabase {
 		t.Fatalf("Failed to generate random suffix: %v", err)
 	}
 
-	path := filepath.Join(os.TempDir(), fmt.Sprintf("test-db-%d-%x", time.Now().UnixNano(), suffix))
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("test-db-%d-%x.godb", time.Now().UnixNano(), suffix))
 
 	config := api.DefaultConfig()
 	config.Path = path
@@ -57,9 +59,11 @@ func (td *TestDatabase) Close() {
 		}
 	}
 
-	// Clean up test file if it exists
+	// Clean up test file, its write-ahead log and double-write file if they exist
 	if td.Path != "" {
-		_ = os.Remove(td.Path) // Ignore error on cleanup
+		_ = os.Remove(td.Path)                             // Ignore error on cleanup
+		_ = os.RemoveAll(td.Path + wal.DirExtension)       // Ignore error on cleanup
+		_ = os.Remove(td.Path + file.DoubleWriteExtension) // Ignore error on cleanup
 	}
 }
 
@@ -188,7 +192,8 @@ func (g *TestDataGenerator) GenerateSequentialKeys(count int, prefix string) []s
 
 // BenchmarkHelper provides utilities for benchmark tests.
 type BenchmarkHelper struct {
-	DB api.Database
+	DB   api.Database
+	Path string
 }
 
 // NewBenchmarkHelper creates a new benchmark helper.
@@ -200,7 +205,7 @@ func NewBenchmarkHelper(b *testing.B) *BenchmarkHelper {
 		b.Fatalf("Failed to generate random suffix: %v", err)
 	}
 
-	path := filepath.Join(os.TempDir(), fmt.Sprintf("bench-db-%d-%x", time.Now().UnixNano(), suffix))
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("bench-db-%d-%x.godb", time.Now().UnixNano(), suffix))
 
 	config := api.DefaultConfig()
 	config.Path = path
@@ -211,7 +216,8 @@ func NewBenchmarkHelper(b *testing.B) *BenchmarkHelper {
 	}
 
 	return &BenchmarkHelper{
-		DB: db,
+		DB:   db,
+		Path: path,
 	}
 }
 
@@ -220,6 +226,12 @@ func (bh *BenchmarkHelper) Close() {
 	if bh.DB != nil {
 		_ = bh.DB.Close() // Ignore error on cleanup
 	}
+
+	if bh.Path != "" {
+		_ = os.Remove(bh.Path)                             // Ignore error on cleanup
+		_ = os.RemoveAll(bh.Path + wal.DirExtension)       // Ignore error on cleanup
+		_ = os.Remove(bh.Path + file.DoubleWriteExtension) // Ignore error on cleanup
+	}
 }
 
 // PrepareData prepares test data for benchmarks.